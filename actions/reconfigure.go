@@ -6,18 +6,22 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"html/template"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"text/template"
+	"time"
 )
 
 const ServiceTemplateFeFilename = "service-formatted-fe.ctmpl"
 const ServiceTemplateBeFilename = "service-formatted-be.ctmpl"
 
+// Bodies larger than this are not worth buffering (option http-buffer-request)
+const maxBufferedBodySize = 1048576
+
 var mu = &sync.Mutex{}
 
 type Reconfigurable interface {
@@ -25,6 +29,7 @@ type Reconfigurable interface {
 	GetData() (BaseReconfigure, proxy.Service)
 	ReloadAllServices(addresses []string, instanceName, mode, listenerAddress string) error
 	GetTemplates(sr *proxy.Service) (front, back string, err error)
+	CreateConfigs() error
 }
 
 type Reconfigure struct {
@@ -34,10 +39,15 @@ type Reconfigure struct {
 }
 
 type BaseReconfigure struct {
-	ConsulAddresses       []string
-	ConfigsPath           string `short:"c" long:"configs-path" default:"/cfg" description:"The path to the configurations directory"`
-	InstanceName          string `long:"proxy-instance-name" env:"PROXY_INSTANCE_NAME" default:"docker-flow" required:"true" description:"The name of the proxy instance."`
-	TemplatesPath         string `short:"t" long:"templates-path" default:"/cfg/tmpl" description:"The path to the templates directory"`
+	ConsulAddresses []string
+	ConfigsPath     string `short:"c" long:"configs-path" default:"/cfg" description:"The path to the configurations directory"`
+	InstanceName    string `long:"proxy-instance-name" env:"PROXY_INSTANCE_NAME" default:"docker-flow" required:"true" description:"The name of the proxy instance."`
+	TemplatesPath   string `short:"t" long:"templates-path" default:"/cfg/tmpl" description:"The path to the templates directory"`
+	// The time the reload waits for. Set from the X-Reload-Delay header of distributed requests.
+	ReloadDelay time.Duration
+	// Whether the service can be added while the proxy is in the read-only mode.
+	// Set for the requests forwarded by the primary instance.
+	AllowMutations        bool
 	skipAddressValidation bool
 }
 
@@ -65,19 +75,43 @@ func (m *Reconfigure) Execute(args []string) error {
 			return err
 		}
 	}
+	if err := proxy.ValidateService(m.Service); err != nil {
+		return err
+	}
+	if err := proxy.ValidateServiceForRenderer(proxy.Instance.GetRenderer(), m.Service); err != nil {
+		return err
+	}
+	if err := proxy.ValidateIdentifier(m.Service, proxy.Instance.GetServices()); err != nil {
+		return err
+	}
+	registered, found := proxy.Instance.GetServices()[m.ServiceName]
+	if m.UpdatedAt.IsZero() {
+		m.UpdatedAt = proxy.GetUpdatedAt(m.Service, proxy.Instance.GetServices())
+	}
+	service := m.Service
+	service.ServiceDest = append([]proxy.ServiceDest{}, m.ServiceDest...)
 	if err := m.createConfigs(m.TemplatesPath, &m.Service); err != nil {
 		return err
 	}
 	if len(m.ConsulTemplateBePath) == 0 && len(m.ConsulTemplateFePath) == 0 {
-		proxy.Instance.AddService(m.Service)
+		if err := proxy.ForMutations(m.AllowMutations).AddService(m.Service); err != nil {
+			return err
+		}
 	}
 	if err := proxy.Instance.CreateConfigFromTemplates(); err != nil {
 		return err
 	}
-	reload := Reload{}
+	grace := getDeploymentGrace(service)
+	if grace > 0 && found && isSwarm(m.Mode) && !registered.UpdatedAt.Equal(m.UpdatedAt) {
+		proxy.DrainServers(registered)
+	}
+	reload := Reload{Delay: m.ReloadDelay}
 	if err := reload.Execute(); err != nil {
 		return err
 	}
+	if grace > 0 {
+		m.scheduleDeploymentGraceEnd(service, grace)
+	}
 	if len(m.ConsulAddresses) > 0 || !isSwarm(m.Mode) {
 		if err := m.putToConsul(m.ConsulAddresses, m.Service, m.InstanceName); err != nil {
 			return err
@@ -86,6 +120,40 @@ func (m *Reconfigure) Execute(args []string) error {
 	return nil
 }
 
+// CreateConfigs writes the templates of the service without reloading the proxy.
+// Used when the running proxy was already changed through the runtime socket so that the next reload keeps the change.
+func (m *Reconfigure) CreateConfigs() error {
+	mu.Lock()
+	defer mu.Unlock()
+	return m.createConfigs(m.TemplatesPath, &m.Service)
+}
+
+// Regenerates the configuration of the service once its deployment grace period expires.
+// Nothing is done if the service was changed or removed in the meantime.
+func (m *Reconfigure) scheduleDeploymentGraceEnd(service proxy.Service, grace time.Duration) {
+	base, mode := m.BaseReconfigure, m.Mode
+	afterFunc(grace, func() {
+		if registered, ok := proxy.Instance.GetServices()[service.ServiceName]; !ok || !registered.UpdatedAt.Equal(service.UpdatedAt) {
+			return
+		}
+		logPrintf("The deployment grace period of the service %s expired", service.ServiceName)
+		if err := NewReconfigure(base, service, mode).Execute([]string{}); err != nil {
+			logPrintf("Could not reconfigure the service %s after its deployment grace period\n%s", service.ServiceName, err.Error())
+		}
+	})
+}
+
+// Returns the longest remaining deployment grace period of the destinations of the service
+func getDeploymentGrace(service proxy.Service) time.Duration {
+	var grace time.Duration
+	for _, sd := range service.ServiceDest {
+		if remaining := proxy.GetDeploymentGraceRemaining(service, sd); remaining > grace {
+			grace = remaining
+		}
+	}
+	return grace
+}
+
 func (m *Reconfigure) GetData() (BaseReconfigure, proxy.Service) {
 	return m.BaseReconfigure, m.Service
 }
@@ -179,13 +247,13 @@ func (m *Reconfigure) getService(addresses []string, serviceName, instanceName s
 	domain, err := registryInstance.GetServiceAttribute(addresses, serviceName, registry.DOMAIN_KEY, instanceName)
 	port, _ := m.getServiceAttribute(addresses, serviceName, registry.PORT, instanceName)
 	sd := proxy.ServiceDest{
-		ServicePath: strings.Split(path, ","),
+		ServicePath: proxy.SplitEscaped(path),
 		Port:        port,
 	}
 	if err == nil {
 		sr.ServiceDest = []proxy.ServiceDest{sd}
 		sr.ServiceColor, _ = m.getServiceAttribute(addresses, serviceName, registry.COLOR_KEY, instanceName)
-		sr.ServiceDomain = strings.Split(domain, ",")
+		sr.ServiceDomain = proxy.SplitEscaped(domain)
 		sr.ServiceCert, _ = m.getServiceAttribute(addresses, serviceName, registry.CERT_KEY, instanceName)
 		sr.OutboundHostname, _ = m.getServiceAttribute(addresses, serviceName, registry.HOSTNAME_KEY, instanceName)
 		sr.PathType, _ = m.getServiceAttribute(addresses, serviceName, registry.PATH_TYPE_KEY, instanceName)
@@ -217,14 +285,25 @@ func (m *Reconfigure) createConfigs(templatesPath string, sr *proxy.Service) err
 	if err != nil {
 		return err
 	}
+	skipBe := false
+	if file, backend := m.getBackendConflict(templatesPath, sr); len(backend) > 0 {
+		if strings.EqualFold(os.Getenv("STRICT_BACKENDS"), "true") {
+			return fmt.Errorf("The backend %s of the service %s is already defined in %s", backend, sr.ServiceName, file)
+		}
+		logPrintf("The backend %s is already defined in %s. The backend of the service %s will not be generated.", backend, file, sr.ServiceName)
+		skipBe = true
+		beTemplate = ""
+	}
 	if strings.EqualFold(m.Mode, "service") || strings.EqualFold(m.Mode, "swarm") {
 		if len(sr.AclName) == 0 {
-			sr.AclName = sr.ServiceName
+			sr.AclName = proxy.GetIdentifier(sr.ServiceName)
 		}
 		destFe := fmt.Sprintf("%s/%s-fe.cfg", templatesPath, sr.AclName)
 		writeFeTemplate(destFe, []byte(feTemplate), 0664)
-		destBe := fmt.Sprintf("%s/%s-be.cfg", templatesPath, sr.AclName)
-		writeBeTemplate(destBe, []byte(beTemplate), 0664)
+		if !skipBe {
+			destBe := fmt.Sprintf("%s/%s-be.cfg", templatesPath, sr.AclName)
+			writeBeTemplate(destBe, []byte(beTemplate), 0664)
+		}
 	} else {
 		args := registry.CreateConfigsArgs{
 			Addresses:     m.ConsulAddresses,
@@ -242,6 +321,53 @@ func (m *Reconfigure) createConfigs(templatesPath string, sr *proxy.Service) err
 	return nil
 }
 
+// Returns the file and the name of a backend that is already defined in the templates directory
+// and has the same name as one of the backends that would be generated for the service.
+// The file generated for the service itself is ignored unless the service has no destinations,
+// in which case the file must have been provided by the user.
+func (m *Reconfigure) getBackendConflict(templatesPath string, sr *proxy.Service) (file, backend string) {
+	// The backends are named after the ACL name, which GetTemplates defaults to the identifier of the service
+	aclName := sr.AclName
+	if len(aclName) == 0 {
+		aclName = proxy.GetIdentifier(sr.ServiceName)
+	}
+	names := map[string]bool{}
+	prefixes := []string{""}
+	if sr.HttpsPort > 0 {
+		prefixes = append(prefixes, "https-")
+	}
+	for _, prefix := range prefixes {
+		if len(sr.ServiceDest) == 0 {
+			names[fmt.Sprintf("%s%s-be", prefix, aclName)] = true
+		}
+		for _, sd := range sr.ServiceDest {
+			names[prefix+proxy.GetBackendName(*sr, sd)] = true
+		}
+	}
+	ownFile := fmt.Sprintf("%s-be.cfg", aclName)
+	files, err := readTemplatesDir(templatesPath)
+	if err != nil {
+		return "", ""
+	}
+	for _, fi := range files {
+		if !strings.HasSuffix(fi.Name(), "-be.cfg") || (fi.Name() == ownFile && len(sr.ServiceDest) > 0) {
+			continue
+		}
+		path := fmt.Sprintf("%s/%s", templatesPath, fi.Name())
+		content, err := readTemplateFile(path)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) > 1 && fields[0] == "backend" && names[fields[1]] {
+				return path, fields[1]
+			}
+		}
+	}
+	return "", ""
+}
+
 func (m *Reconfigure) putToConsul(addresses []string, sr proxy.Service, instanceName string) error {
 	path := []string{}
 	port := ""
@@ -293,6 +419,13 @@ func (m *Reconfigure) GetTemplates(sr *proxy.Service) (front, back string, err e
 			sr.ReqMode = "http"
 		}
 		m.formatData(sr)
+		if sr.BufferRequest && sr.MaxBodySize > maxBufferedBodySize {
+			logPrintf(
+				"WARNING: The service %s buffers requests with bodies of up to %d bytes. Large bodies are only partially buffered and hold connections open while they are received.",
+				sr.ServiceName,
+				sr.MaxBodySize,
+			)
+		}
 		front, back = m.parseTemplate(
 			"",
 			m.getUsersList(sr),
@@ -305,8 +438,9 @@ func (m *Reconfigure) GetTemplates(sr *proxy.Service) (front, back string, err e
 // TODO: Move to ha_proxy.go
 func (m *Reconfigure) formatData(sr *proxy.Service) {
 	sr.AclCondition = ""
+	sr.Identifier = proxy.GetIdentifier(sr.ServiceName)
 	if len(sr.AclName) == 0 {
-		sr.AclName = sr.ServiceName
+		sr.AclName = sr.Identifier
 	}
 	sr.Host = m.ServiceName
 	if len(m.OutboundHostname) > 0 {
@@ -320,11 +454,13 @@ func (m *Reconfigure) formatData(sr *proxy.Service) {
 	if len(sr.PathType) == 0 {
 		sr.PathType = "path_beg"
 	}
+	sr.ReplicaSlots = proxy.Instance.GetRenderer().GetReplicaSlots(*sr)
 	for i, sd := range sr.ServiceDest {
+		sr.ServiceDest[i].DeploymentGraceBackend, sr.ServiceDest[i].DeploymentGraceServer = proxy.GetDeploymentGraceOptions(*sr, sd)
 		if sd.SrcPort > 0 {
-			sr.ServiceDest[i].SrcPortAclName = fmt.Sprintf(" srcPort_%s%d", sr.ServiceName, sd.SrcPort)
+			sr.ServiceDest[i].SrcPortAclName = fmt.Sprintf(" srcPort_%s%d", sr.Identifier, sd.SrcPort)
 			sr.ServiceDest[i].SrcPortAcl = fmt.Sprintf(`
-    acl srcPort_%s%d dst_port %d`, sr.ServiceName, sd.SrcPort, sd.SrcPort)
+    acl srcPort_%s%d dst_port %d`, sr.Identifier, sd.SrcPort, sd.SrcPort)
 		}
 	}
 }
@@ -347,50 +483,44 @@ func (m *Reconfigure) getBackTemplateProtocol(protocol string, sr *proxy.Service
 		prefix = "https-"
 	}
 	tmpl := fmt.Sprintf(`{{range .ServiceDest}}
-backend %s{{$.AclName}}-be{{.Port}}
+backend %s{{backendName $ .}}
     mode {{$.ReqMode}}`,
 		prefix,
 	)
-	// TODO: Deprecated (dec. 2016).
-	if len(sr.ReqRepSearch) > 0 && len(sr.ReqRepReplace) > 0 {
-		tmpl += `
-    reqrep {{$.ReqRepSearch}}     {{$.ReqRepReplace}}`
-	}
-	if len(sr.ReqPathSearch) > 0 && len(sr.ReqPathReplace) > 0 {
+	renderer := proxy.Instance.GetRenderer()
+	tmpl += renderer.RenderBackend(*sr)
+	tmpl += `{{.DeploymentGraceBackend}}`
+	tmpl += renderer.RenderServers(*sr, m.Mode, protocol)
+	if len(sr.Users) > 0 {
 		tmpl += `
-    http-request set-path %[path,regsub({{$.ReqPathSearch}},{{$.ReqPathReplace}})]`
-	}
-	if strings.EqualFold(m.Mode, "service") || strings.EqualFold(m.Mode, "swarm") {
-		if strings.EqualFold(protocol, "https") {
+    acl {{$.Identifier}}UsersAcl http_auth({{$.Identifier}}Users)`
+		// The users of the service and the global users are accepted
+		if sr.UseGlobalUsers {
 			tmpl += `
-    server {{$.ServiceName}} {{$.Host}}:{{$.HttpsPort}}`
+    acl defaultUsersAcl http_auth(defaultUsers)
+    http-request auth realm {{if $.AuthRealm}}{{quote $.AuthRealm}}{{else}}{{$.Identifier}}Realm{{end}} if !{{$.Identifier}}UsersAcl !defaultUsersAcl`
 		} else {
 			tmpl += `
-    server {{$.ServiceName}} {{$.Host}}:{{.Port}}`
+    http-request auth realm {{if $.AuthRealm}}{{quote $.AuthRealm}}{{else}}{{$.Identifier}}Realm{{end}} if !{{$.Identifier}}UsersAcl`
+		}
+		if len(sr.AuthErrorFile) > 0 {
+			tmpl += `
+    errorfile 401 {{$.AuthErrorFile}}`
 		}
-	} else { // It's Consul
-		tmpl += `
-    {{"{{"}}range $i, $e := service "{{$.FullServiceName}}" "any"{{"}}"}}
-    server {{"{{$e.Node}}_{{$i}}_{{$e.Port}} {{$e.Address}}:{{$e.Port}}"}}{{if eq $.SkipCheck false}} check{{end}}
-    {{"{{end}}"}}`
-	}
-	if len(sr.Users) > 0 {
-		tmpl += `
-    acl {{$.ServiceName}}UsersAcl http_auth({{$.ServiceName}}Users)
-    http-request auth realm {{$.ServiceName}}Realm if !{{$.ServiceName}}UsersAcl`
 	} else if len(os.Getenv("USERS")) > 0 {
 		tmpl += `
     acl defaultUsersAcl http_auth(defaultUsers)
     http-request auth realm defaultRealm if !defaultUsersAcl`
 	}
-	tmpl += "{{end}}"
+	tmpl += `{{range $.BackendExtra}}{{if directive .}}
+    {{directive .}}{{end}}{{end}}{{end}}`
 	return tmpl
 }
 
 func (m *Reconfigure) getUsersList(sr *proxy.Service) string {
 	if len(sr.Users) > 0 {
-		return `userlist {{.ServiceName}}Users{{range .Users}}
-    user {{.Username}} insecure-password {{.Password}}{{end}}
+		return `userlist {{.Identifier}}Users{{range .Users}}
+    user {{.Username}} {{if $.UsersPassEncrypted}}password{{else}}insecure-password{{end}} {{quote .Password}}{{end}}
 
 `
 	}
@@ -400,11 +530,11 @@ func (m *Reconfigure) getUsersList(sr *proxy.Service) string {
 func (m *Reconfigure) parseTemplate(front, usersList, back string, sr *proxy.Service) (pFront, pBack string) {
 	var ctFront bytes.Buffer
 	if len(front) > 0 {
-		tmplFront, _ := template.New("template").Parse(front)
+		tmplFront, _ := template.New("template").Funcs(proxy.TemplateFuncs).Parse(front)
 		tmplFront.Execute(&ctFront, sr)
 	}
-	tmplUsersList, _ := template.New("template").Parse(usersList)
-	tmplBack, _ := template.New("template").Parse(back)
+	tmplUsersList, _ := template.New("template").Funcs(proxy.TemplateFuncs).Parse(usersList)
+	tmplBack, _ := template.New("template").Funcs(proxy.TemplateFuncs).Parse(back)
 	var ctUsersList bytes.Buffer
 	var ctBack bytes.Buffer
 	tmplUsersList.Execute(&ctUsersList, sr)
@@ -6,6 +6,7 @@ import (
 	"../proxy"
 	"../registry"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
@@ -14,6 +15,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 type ReconfigureTestSuite struct {
@@ -175,8 +177,8 @@ func (s ReconfigureTestSuite) Test_GetTemplates_AddsHttpAuth_WhenUsersIsPresent(
 		{Username: "user-2", Password: "pass-2"},
 	}
 	expected := `userlist myServiceUsers
-    user user-1 insecure-password pass-1
-    user user-2 insecure-password pass-2
+    user user-1 insecure-password "pass-1"
+    user user-2 insecure-password "pass-2"
 
 
 backend myService-be
@@ -192,6 +194,606 @@ backend myService-be
 	s.Equal(expected, back)
 }
 
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsAuthRealmAndErrorFile_WhenUsersIsPresent() {
+	s.reconfigure.Users = []proxy.User{
+		{Username: "user-1", Password: "pass-1"},
+	}
+	s.reconfigure.AuthRealm = `My "Private" Service`
+	s.reconfigure.AuthErrorFile = "/errorfiles/my-service-401.http"
+	expected := `userlist myServiceUsers
+    user user-1 insecure-password "pass-1"
+
+
+backend myService-be
+    mode http
+    {{range $i, $e := service "myService" "any"}}
+    server {{$e.Node}}_{{$i}}_{{$e.Port}} {{$e.Address}}:{{$e.Port}} check
+    {{end}}
+    acl myServiceUsersAcl http_auth(myServiceUsers)
+    http-request auth realm "My \"Private\" Service" if !myServiceUsersAcl
+    errorfile 401 /errorfiles/my-service-401.http`
+
+	_, back, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, back)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsDefaultServer_WhenDefaultServerOptionsEnvIsPresent() {
+	optionsOrig := os.Getenv("DEFAULT_SERVER_OPTIONS")
+	defer func() { os.Setenv("DEFAULT_SERVER_OPTIONS", optionsOrig) }()
+	os.Setenv("DEFAULT_SERVER_OPTIONS", "inter 2s fall 3 rise 2 slowstart 10s")
+	expected := `
+backend myService-be
+    mode http
+    default-server inter 2s fall 3 rise 2 slowstart 10s
+    {{range $i, $e := service "myService" "any"}}
+    server {{$e.Node}}_{{$i}}_{{$e.Port}} {{$e.Address}}:{{$e.Port}} check
+    {{end}}`
+
+	_, back, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, back)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_UsesServiceDefaultServerOptions_WhenPresent() {
+	optionsOrig := os.Getenv("DEFAULT_SERVER_OPTIONS")
+	defer func() { os.Setenv("DEFAULT_SERVER_OPTIONS", optionsOrig) }()
+	os.Setenv("DEFAULT_SERVER_OPTIONS", "inter 2s fall 3")
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.DefaultServerOptions = "maxconn 100"
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    default-server maxconn 100
+    server myService myService:1234`
+
+	_, back, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, back)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsHttpBufferRequest_WhenBufferRequestIsTrue() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.BufferRequest = true
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    option http-buffer-request
+    server myService myService:1234`
+
+	_, back, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, back)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_DeniesLargeBodies_WhenMaxBodySizeIsSet() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.MaxBodySize = 1024
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    http-request deny deny_status 413 if { req.hdr_val(content-length) gt 1024 }
+    server myService myService:1234`
+
+	_, back, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, back)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsBackendExtraAtTheEndOfBackend() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.BackendExtra = []string{"http-send-name-header X-Server", "option\nexternal-check"}
+	s.reconfigure.Users = []proxy.User{{Username: "user", Password: "pass"}}
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    server myService myService:1234
+    acl myServiceUsersAcl http_auth(myServiceUsers)
+    http-request auth realm myServiceRealm if !myServiceUsersAcl
+    http-send-name-header X-Server
+    option external-check`
+
+	_, back, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Contains(back, expected)
+}
+
+func (s ReconfigureTestSuite) Test_Execute_ReturnsValidationError_WhenBackendExtraIsNotAllowed() {
+	writeBeTemplateOrig := writeBeTemplate
+	defer func() { writeBeTemplate = writeBeTemplateOrig }()
+	written := false
+	writeBeTemplate = func(filename string, data []byte, perm os.FileMode) error {
+		written = true
+		return nil
+	}
+	s.reconfigure.BackendExtra = []string{"server other-server 10.0.0.1:80"}
+
+	err := s.reconfigure.Execute([]string{})
+
+	var validation *proxy.ErrValidation
+	s.True(errors.As(err, &validation))
+	s.Contains(err.Error(), "server")
+	s.False(written)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsBalance_WhenBalanceModeIsSet() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.BalanceMode = "leastconn"
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    balance leastconn
+    server myService myService:1234`
+
+	_, back, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, back)
+}
+
+func (s ReconfigureTestSuite) Test_Execute_ReturnsValidationError_WhenBalanceModeIsNotSupported() {
+	s.reconfigure.BalanceMode = "fastest"
+
+	err := s.reconfigure.Execute([]string{})
+
+	var validation *proxy.ErrValidation
+	s.True(errors.As(err, &validation))
+	s.Equal([]string{"balanceMode"}, validation.Fields)
+}
+
+func (s ReconfigureTestSuite) Test_Execute_ReturnsValidationError_WhenIdentifierIsUsedByAnotherService() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	mockObj := getProxyMock("GetServices")
+	mockObj.On("GetServices").Return(map[string]proxy.Service{"my_service": {ServiceName: "my_service"}})
+	proxy.Instance = mockObj
+	s.reconfigure.ServiceName = "my/service"
+
+	err := s.reconfigure.Execute([]string{})
+
+	var validation *proxy.ErrValidation
+	s.True(errors.As(err, &validation))
+	s.Equal([]string{"serviceName"}, validation.Fields)
+	mockObj.AssertNotCalled(s.T(), "AddService", mock.Anything)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_UsesIdentifier_WhenServiceNameContainsDisallowedCharacters() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.ServiceName = "my/service"
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	expected := `
+backend my_service-be1234
+    mode http
+    server my_service my/service:1234`
+
+	_, backend, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, backend)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsHealthCheck_WhenCheckPathIsSet() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.CheckPath = "/health"
+	s.reconfigure.CheckInterval = "5s"
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    option httpchk GET /health
+    server myService myService:1234 check inter 5s rise 2 fall 3`
+
+	_, backend, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, backend)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsHealthCheckWithMethod_WhenCheckMethodIsSet() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.CheckPath = "/ping"
+	s.reconfigure.CheckMethod = "head"
+	s.reconfigure.CheckInterval = "1500ms"
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    option httpchk HEAD /ping
+    server myService myService:1234 check inter 1500ms rise 2 fall 3`
+
+	_, backend, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, backend)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsUnixSocketServerWithoutCheck_WhenPortIsUnixSocket() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.CheckPath = "/health"
+	s.reconfigure.ServiceDest[0].Port = "unix@/var/run/app.sock"
+	expected := `
+backend myService-besockfd49e30f
+    mode http
+    option httpchk GET /health
+    server myService_fd49e30f unix@/var/run/app.sock`
+
+	_, backend, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, backend)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsUnixSocketServerWithCheck_WhenCheckSocketIsTrue() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.CheckSocket = true
+	s.reconfigure.ServiceDest[0].Port = "unix@/var/run/app.sock"
+	expected := `
+backend myService-besockfd49e30f
+    mode http
+    server myService_fd49e30f unix@/var/run/app.sock check`
+
+	_, backend, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, backend)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_UsesOutboundHostnameOfServiceDest() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.ServiceName = "my-service"
+	s.reconfigure.PathType = "path_beg"
+	s.reconfigure.ServiceDest = []proxy.ServiceDest{
+		{Port: "8080", ServicePath: []string{"/api"}, OutboundHostname: "external.example.com"},
+		{Port: "9090", ServicePath: []string{"/admin"}},
+	}
+	expectedBack := `
+backend my-service-be8080
+    mode http
+    server my-service external.example.com:8080
+backend my-service-be9090
+    mode http
+    server my-service my-service:9090`
+
+	_, back, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+	front := proxy.GetConfigRenderer().RenderFrontend(s.reconfigure.Service)
+
+	s.Equal(expectedBack, back)
+	s.Contains(front, "acl url_my-service8080 path_beg /api")
+	s.Contains(front, "use_backend my-service-be8080 if url_my-service8080")
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsResolversToServer_WhenResolversIsTrue() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.Resolvers = true
+	s.reconfigure.CheckPath = "/health"
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    option httpchk GET /health
+    server myService myService:1234 check rise 2 fall 3 resolvers docker resolve-prefer ipv4`
+
+	_, backend, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, backend)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsServerTemplate_WhenReplicasIsSet() {
+	defer os.Unsetenv("CONFIG_FLAVOR")
+	os.Setenv("CONFIG_FLAVOR", "haproxy-2.x")
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.Replicas = 3
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    retry-on all-retryable-errors
+    server-template myService 3 tasks.myService:1234 check resolvers docker init-addr none`
+
+	_, backend, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, backend)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsDisabledServerTemplate_WhenReplicaHeadroomIsSet() {
+	defer func() {
+		os.Unsetenv("CONFIG_FLAVOR")
+		os.Unsetenv("REPLICA_HEADROOM")
+	}()
+	os.Setenv("CONFIG_FLAVOR", "haproxy-2.x")
+	os.Setenv("REPLICA_HEADROOM", "2")
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.Replicas = 3
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    retry-on all-retryable-errors
+    server-template myService 3 tasks.myService:1234 check resolvers docker init-addr none
+    server-template myService 4-5 tasks.myService:1234 check resolvers docker init-addr none disabled`
+
+	_, backend, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, backend)
+	s.Equal(5, s.reconfigure.ReplicaSlots)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsVipServer_WhenReplicasIsSetAndConfigFlavorIsHaProxy17() {
+	defer os.Unsetenv("REPLICA_HEADROOM")
+	os.Setenv("REPLICA_HEADROOM", "2")
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.Replicas = 3
+	s.reconfigure.SessionCookie = "SERVERID"
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    cookie SERVERID insert indirect nocache
+    server myService myService:1234 cookie myService`
+
+	_, backend, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, backend)
+	s.Equal(0, s.reconfigure.ReplicaSlots)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsServerTemplateWithHealthCheckAndDynamicCookie_WhenReplicasIsSet() {
+	defer os.Unsetenv("CONFIG_FLAVOR")
+	os.Setenv("CONFIG_FLAVOR", "haproxy-2.x")
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.Replicas = 2
+	s.reconfigure.CheckPath = "/health"
+	s.reconfigure.SessionCookie = "SERVERID"
+	s.reconfigure.HttpsPort = 4321
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    cookie SERVERID insert indirect nocache dynamic
+    dynamic-cookie-key myService
+    option httpchk GET /health
+    retry-on all-retryable-errors
+    server-template myService 2 tasks.myService:1234 check rise 2 fall 3 resolvers docker init-addr none
+
+
+backend https-myService-be1234
+    mode http
+    cookie SERVERID insert indirect nocache dynamic
+    dynamic-cookie-key myService
+    option httpchk GET /health
+    retry-on all-retryable-errors
+    server-template myService 2 tasks.myService:4321 check rise 2 fall 3 resolvers docker init-addr none`
+
+	_, backend, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, backend)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_DoesNotAddHealthCheck_WhenCheckPathIsNotSet() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.CheckInterval = "5s"
+	s.reconfigure.CheckMethod = "HEAD"
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    server myService myService:1234`
+
+	_, backend, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, backend)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsRequestDeadline_WhenRequestDeadlineIsSet() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.RequestDeadline = "2s"
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    timeout server 2000ms
+    http-request set-header X-Request-Deadline %[date(2)]
+    errorfile 504 /errorfiles/504.http
+    server myService myService:1234`
+
+	_, back, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, back)
+}
+
+func (s ReconfigureTestSuite) Test_Execute_ReturnsValidationError_WhenRequestDeadlineIsBelowOneSecond() {
+	for _, deadline := range []string{"500ms", "0", "two seconds"} {
+		s.reconfigure.RequestDeadline = deadline
+
+		err := s.reconfigure.Execute([]string{})
+
+		var validation *proxy.ErrValidation
+		s.True(errors.As(err, &validation), deadline)
+		s.Equal([]string{"requestDeadline"}, validation.Fields)
+	}
+}
+
+func (s ReconfigureTestSuite) Test_Execute_ReturnsValidationError_WhenDeploymentGraceIsInvalid() {
+	for _, grace := range []string{"-5s", "0", "a while"} {
+		s.reconfigure.ServiceDest[0].DeploymentGrace = grace
+
+		err := s.reconfigure.Execute([]string{})
+
+		var validation *proxy.ErrValidation
+		s.True(errors.As(err, &validation), grace)
+		s.Equal([]string{"deploymentGrace"}, validation.Fields)
+	}
+}
+
+func (s ReconfigureTestSuite) Test_Execute_SchedulesRegeneration_WhenDeploymentGraceIsSet() {
+	var durations []time.Duration
+	var callbacks []func()
+	afterFuncOrig := afterFunc
+	defer func() { afterFunc = afterFuncOrig }()
+	afterFunc = func(d time.Duration, f func()) *time.Timer {
+		durations = append(durations, d)
+		callbacks = append(callbacks, f)
+		return nil
+	}
+	mockObj := getProxyMock("")
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxy.Instance = mockObj
+	s.reconfigure.ServiceDest[0].DeploymentGrace = "30s"
+
+	s.NoError(s.reconfigure.Execute([]string{}))
+
+	s.Require().Len(durations, 1)
+	s.True(durations[0] > 29*time.Second && durations[0] <= 30*time.Second)
+
+	// The service is not registered anymore so it is not regenerated
+	callbacks[0]()
+
+	mockObj.AssertNumberOfCalls(s.T(), "AddService", 1)
+}
+
+func (s ReconfigureTestSuite) Test_Execute_DoesNotScheduleRegeneration_WhenDeploymentGraceIsNotSet() {
+	called := false
+	afterFuncOrig := afterFunc
+	defer func() { afterFunc = afterFuncOrig }()
+	afterFunc = func(d time.Duration, f func()) *time.Timer {
+		called = true
+		return nil
+	}
+
+	s.reconfigure.Execute([]string{})
+
+	s.False(called)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsRetries_WhenInDeploymentGrace() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.UpdatedAt = time.Now()
+	s.reconfigure.ServiceDest = []proxy.ServiceDest{
+		{Port: "1111", ServicePath: []string{"/path-1"}, DeploymentGrace: "1m"},
+		{Port: "2222", ServicePath: []string{"/path-2"}},
+	}
+	expected := `
+backend myService-be1111
+    mode http
+    retries 3
+    option redispatch 1
+    server myService myService:1111 on-error mark-down observe layer7 error-limit 10
+backend myService-be2222
+    mode http
+    server myService myService:2222`
+
+	_, actual, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, actual)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_DoesNotAddRetries_WhenDeploymentGraceExpired() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.UpdatedAt = time.Now().Add(-2 * time.Minute)
+	s.reconfigure.ServiceDest = []proxy.ServiceDest{
+		{Port: "1111", ServicePath: []string{"/path-1"}, DeploymentGrace: "1m"},
+	}
+	expected := `
+backend myService-be1111
+    mode http
+    server myService myService:1111`
+
+	_, actual, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, actual)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsSessionCookie_WhenSessionCookieIsSet() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.SessionCookie = "SERVERID"
+	s.reconfigure.ServiceDest = []proxy.ServiceDest{
+		{Port: "1111", ServicePath: []string{"/path-1"}},
+		{Port: "2222", ServicePath: []string{"/path-2"}},
+	}
+	expected := `
+backend myService-be1111
+    mode http
+    cookie SERVERID insert indirect nocache
+    server myService myService:1111 cookie myService
+backend myService-be2222
+    mode http
+    cookie SERVERID insert indirect nocache
+    server myService myService:2222 cookie myService`
+
+	_, back, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, back)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsSessionCookieToConsulServers_WhenSessionCookieIsSet() {
+	s.reconfigure.SessionCookie = "SERVERID"
+	expected := `
+backend myService-be
+    mode http
+    cookie SERVERID insert indirect nocache
+    {{range $i, $e := service "myService" "any"}}
+    server {{$e.Node}}_{{$i}}_{{$e.Port}} {{$e.Address}}:{{$e.Port}} check cookie {{$e.Node}}_{{$i}}_{{$e.Port}}
+    {{end}}`
+
+	_, back, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, back)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_DoesNotAddSessionCookie_WhenSessionCookieIsNotSet() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.ServiceDest = []proxy.ServiceDest{
+		{Port: "1111", ServicePath: []string{"/path-1"}},
+		{Port: "2222", ServicePath: []string{"/path-2"}},
+	}
+
+	_, back, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.NotContains(back, "cookie")
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_DoesNotAddSessionCookie_WhenReqModeIsTcp() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.ReqMode = "tcp"
+	s.reconfigure.SessionCookie = "SERVERID"
+	s.reconfigure.ServiceDest[0].Port = "1234"
+
+	_, back, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.NotContains(back, "cookie")
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_LogsWarning_WhenBufferRequestIsCombinedWithLargeMaxBodySize() {
+	logPrintfOrig := logPrintf
+	defer func() { logPrintf = logPrintfOrig }()
+	actual := []string{}
+	logPrintf = func(format string, v ...interface{}) {
+		actual = append(actual, fmt.Sprintf(format, v...))
+	}
+	s.reconfigure.BufferRequest = true
+	s.reconfigure.MaxBodySize = 104857600
+
+	s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Len(actual, 1)
+	s.Contains(actual[0], "WARNING: The service myService buffers requests with bodies of up to 104857600 bytes")
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_DoesNotLogWarning_WhenBufferRequestIsCombinedWithSmallMaxBodySize() {
+	logPrintfOrig := logPrintf
+	defer func() { logPrintf = logPrintfOrig }()
+	called := false
+	logPrintf = func(format string, v ...interface{}) {
+		called = true
+	}
+	s.reconfigure.BufferRequest = true
+	s.reconfigure.MaxBodySize = 1024
+
+	s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.False(called)
+}
+
 func (s ReconfigureTestSuite) Test_GetTemplates_ReturnsFormattedContent_WhenModeIsSwarm() {
 	modes := []string{"service", "sWARm"}
 	for _, mode := range modes {
@@ -222,6 +824,73 @@ backend myService-be1234
 	s.Equal(expected, actual)
 }
 
+func (s ReconfigureTestSuite) Test_GetTemplates_OmitsServerPort_WhenSrcPortRangeIsPresent() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.ReqMode = "tcp"
+	s.reconfigure.Service.ServiceDest = []proxy.ServiceDest{{SrcPortRange: "10000-10100"}}
+	expected := `
+backend myService-be10000-10100
+    mode tcp
+    server myService myService`
+
+	_, actual, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, actual)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsSource_WhenSourceAddressIsPresent() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.SourceAddress = "10.0.0.5"
+	s.reconfigure.Service.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    server myService myService:1234 source 10.0.0.5`
+
+	_, actual, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, actual)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsSourceWithUseSrc_WhenReqModeIsTcpAndTransparentProxyIsTrue() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.ReqMode = "tcp"
+	s.reconfigure.SourceAddress = "10.0.0.5"
+	s.reconfigure.TransparentProxy = true
+	s.reconfigure.Service.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode tcp
+    server myService myService:1234 source 10.0.0.5 usesrc clientip`
+
+	_, actual, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, actual)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsSourceWithAnyAddress_WhenOnlyTransparentProxyIsTrue() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.TransparentProxy = true
+	s.reconfigure.Service.ServiceDest[0].Port = "1234"
+	expected := `
+backend myService-be1234
+    mode http
+    server myService myService:1234 source 0.0.0.0 usesrc clientip`
+
+	_, actual, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, actual)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsSource_WhenModeIsDefault() {
+	s.ConsulTemplateBe = strings.Replace(s.ConsulTemplateBe, " check", " check source 10.0.0.5", -1)
+	s.reconfigure.SourceAddress = "10.0.0.5"
+
+	_, actual, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(s.ConsulTemplateBe, actual)
+}
+
 func (s ReconfigureTestSuite) Test_GetTemplates_AddsHttpAuth_WhenModeIsSwarmAndUsersEnvIsPresent() {
 	usersOrig := os.Getenv("USERS")
 	defer func() { os.Setenv("USERS", usersOrig) }()
@@ -240,6 +909,44 @@ backend myService-be1234
 	s.Equal(expected, actual)
 }
 
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsEncryptedPasswords_WhenUsersPassEncryptedIsTrue() {
+	s.reconfigure.Users = []proxy.User{{Username: "user-1", Password: "$6$salt$hash"}}
+	s.reconfigure.UsersPassEncrypted = true
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.Service.ServiceDest[0].Port = "1234"
+
+	_, actual, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Contains(actual, `userlist myServiceUsers
+    user user-1 password ""'$'"6"'$'"salt"'$'"hash"
+`)
+	s.NotContains(actual, "insecure-password")
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_AcceptsGlobalUsers_WhenUseGlobalUsersIsTrue() {
+	usersOrig := os.Getenv("USERS")
+	defer func() { os.Setenv("USERS", usersOrig) }()
+	os.Setenv("USERS", "anything")
+	s.reconfigure.Users = []proxy.User{{Username: "user-1", Password: "pass-1"}}
+	s.reconfigure.UseGlobalUsers = true
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.Service.ServiceDest[0].Port = "1234"
+	expected := `userlist myServiceUsers
+    user user-1 insecure-password "pass-1"
+
+
+backend myService-be1234
+    mode http
+    server myService myService:1234
+    acl myServiceUsersAcl http_auth(myServiceUsers)
+    acl defaultUsersAcl http_auth(defaultUsers)
+    http-request auth realm myServiceRealm if !myServiceUsersAcl !defaultUsersAcl`
+
+	_, actual, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Equal(expected, actual)
+}
+
 func (s ReconfigureTestSuite) Test_GetTemplates_AddsHttpAuth_WhenModeIsSwarmAndUsersIsPresent() {
 	s.reconfigure.Users = []proxy.User{
 		{Username: "user-1", Password: "pass-1"},
@@ -248,8 +955,8 @@ func (s ReconfigureTestSuite) Test_GetTemplates_AddsHttpAuth_WhenModeIsSwarmAndU
 	s.reconfigure.Mode = "swarm"
 	s.reconfigure.Service.ServiceDest[0].Port = "1234"
 	expected := `userlist myServiceUsers
-    user user-1 insecure-password pass-1
-    user user-2 insecure-password pass-2
+    user user-1 insecure-password "pass-1"
+    user user-2 insecure-password "pass-2"
 
 
 backend myService-be1234
@@ -306,6 +1013,21 @@ backend myService-be5555
 	s.Equal(expectedBack, actualBack)
 }
 
+func (s ReconfigureTestSuite) Test_GetTemplates_QuotesUserValues() {
+	s.reconfigure.ReqRepSearch = `^([^\ :]*)\ /api/(.*)$`
+	s.reconfigure.ReqRepReplace = `\1\ /\2 # "quoted"`
+	s.reconfigure.Users = []proxy.User{
+		{Username: "user-1", Password: ` pass#1 "$HOME"`},
+	}
+	expectedUsers := `    user user-1 insecure-password " pass#1 \""'$'"HOME\""`
+	expectedReqRep := `    reqrep "^([^\\ :]*)\\ /api/(.*)"'$'""     "\\1\\ /\\2 # \"quoted\""`
+
+	_, backend, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Contains(backend, expectedUsers)
+	s.Contains(backend, expectedReqRep)
+}
+
 // TODO: Deprecated (dec. 2016).
 func (s ReconfigureTestSuite) Test_GetTemplates_AddsReqRep_WhenReqRepSearchAndReqRepReplaceArePresent() {
 	s.reconfigure.ReqRepSearch = "this"
@@ -313,7 +1035,7 @@ func (s ReconfigureTestSuite) Test_GetTemplates_AddsReqRep_WhenReqRepSearchAndRe
 	expected := fmt.Sprintf(`
 backend myService-be
     mode http
-    reqrep %s     %s
+    reqrep "%s"     "%s"
     {{range $i, $e := service "%s" "any"}}
     server {{$e.Node}}_{{$i}}_{{$e.Port}} {{$e.Address}}:{{$e.Port}} check
     {{end}}`,
@@ -328,17 +1050,15 @@ backend myService-be
 }
 
 func (s ReconfigureTestSuite) Test_GetTemplates_AddsHttpRequestSetPath_WhenReqPathSearchAndReqPathReplaceArePresent() {
-	s.reconfigure.ReqPathSearch = "this"
-	s.reconfigure.ReqPathReplace = "that"
+	s.reconfigure.ReqPathSearch = []string{"this"}
+	s.reconfigure.ReqPathReplace = []string{"that"}
 	expected := fmt.Sprintf(`
 backend myService-be
     mode http
-    http-request set-path %%[path,regsub(%s,%s)]
+    http-request set-path %%[path,regsub(this,that)]
     {{range $i, $e := service "%s" "any"}}
     server {{$e.Node}}_{{$i}}_{{$e.Port}} {{$e.Address}}:{{$e.Port}} check
     {{end}}`,
-		s.reconfigure.ReqPathSearch,
-		s.reconfigure.ReqPathReplace,
 		s.reconfigure.ServiceName,
 	)
 
@@ -347,6 +1067,27 @@ backend myService-be
 	s.Equal(expected, backend)
 }
 
+func (s ReconfigureTestSuite) Test_GetTemplates_AddsHttpRequestSetPathForEachPair_WhenMultipleReqPathSearchValuesArePresent() {
+	s.reconfigure.ReqPathSearch = []string{"^/api/v1/", "^/api/"}
+	s.reconfigure.ReqPathReplace = []string{"/v1/", "/"}
+	expected := `
+    http-request set-path %[path,regsub(^/api/v1/,/v1/)]
+    http-request set-path %[path,regsub(^/api/,/)]
+    http-response replace-header Location "^/(.*)" "/api/\\1"
+    http-response replace-header Location "^/v1/(.*)" "/api/v1/\\1"
+    {{range`
+
+	_, backend, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.Contains(backend, expected)
+}
+
+func (s ReconfigureTestSuite) Test_GetTemplates_DoesNotAddHttpRequestSetPath_WhenReqPathSearchIsEmpty() {
+	_, backend, _ := s.reconfigure.GetTemplates(&s.reconfigure.Service)
+
+	s.NotContains(backend, "set-path")
+}
+
 func (s ReconfigureTestSuite) Test_GetTemplates_AddsColor() {
 	s.reconfigure.ServiceColor = "black"
 	expected := fmt.Sprintf(`service "%s-%s"`, s.ServiceName, s.reconfigure.ServiceColor)
@@ -536,6 +1277,102 @@ backend %s-be%s
 	s.Equal(expectedData, actualData)
 }
 
+func (s ReconfigureTestSuite) Test_Execute_DoesNotWriteBeTemplate_WhenBackendIsDefinedInTemplatesDir() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	defer s.mockTemplatesDir(map[string]string{
+		"myService-be.cfg": "backend myService-be1234",
+		"prebaked-be.cfg":  "\nbackend myService-be1234\n    mode http",
+		"prebaked-fe.cfg":  "backend something-else",
+	})()
+	writeBeTemplateOrig := writeBeTemplate
+	defer func() { writeBeTemplate = writeBeTemplateOrig }()
+	invoked := false
+	writeBeTemplate = func(filename string, data []byte, perm os.FileMode) error {
+		invoked = true
+		return nil
+	}
+
+	err := s.reconfigure.Execute([]string{})
+
+	s.NoError(err)
+	s.False(invoked)
+}
+
+func (s ReconfigureTestSuite) Test_Execute_WritesBeTemplate_WhenOnlyOwnFileDefinesTheBackend() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	defer s.mockTemplatesDir(map[string]string{
+		"myService-be.cfg": "backend myService-be1234",
+		"prebaked-be.cfg":  "backend myService-be4321",
+	})()
+	writeBeTemplateOrig := writeBeTemplate
+	defer func() { writeBeTemplate = writeBeTemplateOrig }()
+	invoked := false
+	writeBeTemplate = func(filename string, data []byte, perm os.FileMode) error {
+		invoked = true
+		return nil
+	}
+
+	s.reconfigure.Execute([]string{})
+
+	s.True(invoked)
+}
+
+func (s ReconfigureTestSuite) Test_Execute_DoesNotWriteBeTemplate_WhenServiceDestIsEmptyAndOwnFileDefinesTheBackend() {
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.ServiceDest = []proxy.ServiceDest{}
+	defer s.mockTemplatesDir(map[string]string{
+		"myService-be.cfg": "backend myService-be",
+	})()
+	writeBeTemplateOrig := writeBeTemplate
+	defer func() { writeBeTemplate = writeBeTemplateOrig }()
+	invoked := false
+	writeBeTemplate = func(filename string, data []byte, perm os.FileMode) error {
+		invoked = true
+		return nil
+	}
+
+	s.reconfigure.Execute([]string{})
+
+	s.False(invoked)
+}
+
+func (s ReconfigureTestSuite) Test_Execute_ReturnsError_WhenBackendIsDefinedInTemplatesDirAndStrictBackendsIsTrue() {
+	strictOrig := os.Getenv("STRICT_BACKENDS")
+	defer func() { os.Setenv("STRICT_BACKENDS", strictOrig) }()
+	os.Setenv("STRICT_BACKENDS", "true")
+	s.reconfigure.Mode = "swarm"
+	s.reconfigure.ServiceDest[0].Port = "1234"
+	defer s.mockTemplatesDir(map[string]string{
+		"prebaked-be.cfg": "backend myService-be1234",
+	})()
+
+	err := s.reconfigure.Execute([]string{})
+
+	s.Error(err)
+}
+
+func (s ReconfigureTestSuite) Test_CreateConfigs_DoesNotSetAclName_WhenModeIsNotSwarm() {
+	registryInstanceOrig := registryInstance
+	defer func() { registryInstance = registryInstanceOrig }()
+	registryInstance = getRegistrarableMock("")
+	readTemplateFileOrig := readTemplateFile
+	defer func() { readTemplateFile = readTemplateFileOrig }()
+	readTemplateFile = func(filename string) ([]byte, error) {
+		return []byte("backend my-consul-be"), nil
+	}
+	s.reconfigure.Mode = "default"
+	s.reconfigure.AclName = ""
+	s.reconfigure.ConsulTemplateFePath = "/path/to/my/consul/fe/template"
+	s.reconfigure.ConsulTemplateBePath = "/path/to/my/consul/be/template"
+
+	err := s.reconfigure.createConfigs(s.TemplatesPath, &s.reconfigure.Service)
+
+	s.NoError(err)
+	s.Empty(s.reconfigure.AclName)
+}
+
 func (s ReconfigureTestSuite) Test_Execute_WritesBeTemplateAsAclName_WhenModeIsSwarmAndAclNameIsPresent() {
 	s.reconfigure.Mode = "sWArm"
 	s.reconfigure.ServiceDest[0].Port = "1234"
@@ -635,6 +1472,19 @@ func (s ReconfigureTestSuite) Test_Execute_ReturnsError_WhenProxyFails() {
 	s.Error(err)
 }
 
+func (s ReconfigureTestSuite) Test_Execute_ReturnsError_WhenAddServiceFails() {
+	mockObj := getProxyMock("AddService")
+	mockObj.On("AddService", mock.Anything).Return(fmt.Errorf("This is an error"))
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxy.Instance = mockObj
+
+	err := s.reconfigure.Execute([]string{})
+
+	s.Error(err)
+	mockObj.AssertNotCalled(s.T(), "CreateConfigFromTemplates")
+}
+
 func (s ReconfigureTestSuite) Test_Execute_AddsService() {
 	mockObj := getProxyMock("")
 	proxyOrig := proxy.Instance
@@ -922,6 +1772,11 @@ func (m *ReconfigureMock) GetTemplates(sr proxy.Service) (front, back string, er
 	return params.String(0), params.String(1), params.Error(2)
 }
 
+func (m *ReconfigureMock) CreateConfigs() error {
+	params := m.Called()
+	return params.Error(0)
+}
+
 func getReconfigureMock(skipMethod string) *ReconfigureMock {
 	mockObj := new(ReconfigureMock)
 	if skipMethod != "Execute" {
@@ -936,6 +1791,9 @@ func getReconfigureMock(skipMethod string) *ReconfigureMock {
 	if skipMethod != "GetTemplates" {
 		mockObj.On("GetTemplates", mock.Anything).Return("", "", nil)
 	}
+	if skipMethod != "CreateConfigs" {
+		mockObj.On("CreateConfigs").Return(nil)
+	}
 	return mockObj
 }
 
@@ -1021,7 +1879,12 @@ func (m *ProxyMock) Reload() error {
 	return params.Error(0)
 }
 
-func (m *ProxyMock) AddCert(certName string) {
+func (m *ProxyMock) AddCert(certName string) error {
+	params := m.Called(certName)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) RemoveCert(certName string) {
 	m.Called(certName)
 }
 
@@ -1030,16 +1893,75 @@ func (m *ProxyMock) GetCerts() map[string]string {
 	return params.Get(0).(map[string]string)
 }
 
-func (m *ProxyMock) AddService(service proxy.Service) {
-	m.Called(service)
+func (m *ProxyMock) AddService(service proxy.Service) error {
+	params := m.Called(service)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) RemoveService(service string) error {
+	params := m.Called(service)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) GetServices() map[string]proxy.Service {
+	params := m.Called()
+	return params.Get(0).(map[string]proxy.Service)
+}
+
+func (m *ProxyMock) GetServicesByNamespace(namespace string) map[string]proxy.Service {
+	params := m.Called(namespace)
+	return params.Get(0).(map[string]proxy.Service)
+}
+
+func (m *ProxyMock) RemoveNamespace(namespace string) error {
+	params := m.Called(namespace)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) CreateSupportBundle() ([]byte, error) {
+	params := m.Called()
+	return params.Get(0).([]byte), params.Error(1)
+}
+
+func (m *ProxyMock) DebugState() proxy.DebugState {
+	params := m.Called()
+	return params.Get(0).(proxy.DebugState)
+}
+
+func (m *ProxyMock) SetServiceReplicas(serviceName string, replicas int) error {
+	params := m.Called(serviceName, replicas)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) ReloadAfter(delay time.Duration) error {
+	params := m.Called(delay)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) LoadState() error {
+	params := m.Called()
+	return params.Error(0)
+}
+
+func (m *ProxyMock) WithMutations() proxy.Proxy {
+	m.Called()
+	return m
 }
 
-func (m *ProxyMock) RemoveService(service string) {
-	m.Called(service)
+// Without a renderer of the test, the mock uses the renderer of the flavor defined through CONFIG_FLAVOR
+func (m *ProxyMock) GetRenderer() proxy.ConfigRenderer {
+	params := m.Called()
+	if renderer, ok := params.Get(0).(proxy.ConfigRenderer); ok {
+		return renderer
+	}
+	return proxy.HaProxy{}.GetRenderer()
 }
 
 func getProxyMock(skipMethod string) *ProxyMock {
 	mockObj := new(ProxyMock)
+	if skipMethod != "GetRenderer" {
+		mockObj.On("GetRenderer").Return(nil)
+	}
 	if skipMethod != "RunCmd" {
 		mockObj.On("RunCmd", mock.Anything).Return(nil)
 	}
@@ -1055,18 +1977,57 @@ func getProxyMock(skipMethod string) *ProxyMock {
 	if skipMethod != "AddCert" {
 		mockObj.On("AddCert", mock.Anything).Return(nil)
 	}
+	if skipMethod != "RemoveCert" {
+		mockObj.On("RemoveCert", mock.Anything)
+	}
 	if skipMethod != "GetCerts" {
 		mockObj.On("GetCerts").Return(map[string]string{})
 	}
 	if skipMethod != "AddService" {
-		mockObj.On("AddService", mock.Anything)
+		mockObj.On("AddService", mock.Anything).Return(nil)
 	}
 	if skipMethod != "RemoveService" {
-		mockObj.On("RemoveService", mock.Anything)
+		mockObj.On("RemoveService", mock.Anything).Return(nil)
+	}
+	if skipMethod != "GetServices" {
+		mockObj.On("GetServices").Return(map[string]proxy.Service{})
+	}
+	if skipMethod != "GetServicesByNamespace" {
+		mockObj.On("GetServicesByNamespace", mock.Anything).Return(map[string]proxy.Service{})
+	}
+	if skipMethod != "RemoveNamespace" {
+		mockObj.On("RemoveNamespace", mock.Anything).Return(nil)
+	}
+	if skipMethod != "CreateSupportBundle" {
+		mockObj.On("CreateSupportBundle").Return([]byte{}, nil)
+	}
+	if skipMethod != "DebugState" {
+		mockObj.On("DebugState").Return(proxy.DebugState{})
+	}
+	if skipMethod != "SetServiceReplicas" {
+		mockObj.On("SetServiceReplicas", mock.Anything, mock.Anything).Return(nil)
+	}
+	if skipMethod != "ReloadAfter" {
+		mockObj.On("ReloadAfter", mock.Anything).Return(nil)
+	}
+	if skipMethod != "LoadState" {
+		mockObj.On("LoadState").Return(nil)
+	}
+	if skipMethod != "WithMutations" {
+		mockObj.On("WithMutations")
 	}
 	return mockObj
 }
 
+type FileInfoMock struct {
+	os.FileInfo
+	name string
+}
+
+func (m FileInfoMock) Name() string {
+	return m.name
+}
+
 // Util
 
 func (s ReconfigureTestSuite) verifyDoesNotPutDataToConsul(mode string) {
@@ -1083,3 +2044,22 @@ func (s ReconfigureTestSuite) verifyDoesNotPutDataToConsul(mode string) {
 
 	mockObj.AssertNotCalled(s.T(), "PutService", mock.Anything, mock.Anything, mock.Anything)
 }
+
+func (s ReconfigureTestSuite) mockTemplatesDir(files map[string]string) func() {
+	readTemplatesDirOrig := readTemplatesDir
+	readTemplateFileOrig := readTemplateFile
+	readTemplatesDir = func(dirname string) ([]os.FileInfo, error) {
+		fis := []os.FileInfo{}
+		for name, _ := range files {
+			fis = append(fis, FileInfoMock{name: name})
+		}
+		return fis, nil
+	}
+	readTemplateFile = func(filename string) ([]byte, error) {
+		return []byte(files[strings.TrimPrefix(filename, s.TemplatesPath+"/")]), nil
+	}
+	return func() {
+		readTemplatesDir = readTemplatesDirOrig
+		readTemplateFile = readTemplateFileOrig
+	}
+}
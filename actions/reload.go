@@ -1,15 +1,25 @@
 package actions
 
-import "../proxy"
+import (
+	"../proxy"
+	"time"
+)
 
 type Reloader interface {
 	Execute() error
 }
 
-type Reload struct{}
+type Reload struct {
+	// The time the reload waits for so that the instances receiving the same distributed request do not reload at once
+	Delay time.Duration
+}
 
 func (m *Reload) Execute() error {
-	if err := proxy.Instance.Reload(); err != nil {
+	reload := proxy.Instance.Reload
+	if m.Delay > 0 {
+		reload = func() error { return proxy.Instance.ReloadAfter(m.Delay) }
+	}
+	if err := reload(); err != nil {
 		logPrintf(err.Error())
 		return err
 	}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/stretchr/testify/suite"
 	"testing"
+	"time"
 )
 
 type ReloadTestSuite struct {
@@ -32,6 +33,19 @@ func (s *ReloadTestSuite) Test_Execute_Invokes_HaProxyReload() {
 	mockObj.AssertCalled(s.T(), "Reload")
 }
 
+func (s *ReloadTestSuite) Test_Execute_InvokesHaProxyReloadAfter_WhenDelayIsSet() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	mockObj := getProxyMock("")
+	proxy.Instance = mockObj
+	reload := Reload{Delay: 4 * time.Second}
+
+	reload.Execute()
+
+	mockObj.AssertCalled(s.T(), "ReloadAfter", 4*time.Second)
+	mockObj.AssertNotCalled(s.T(), "Reload")
+}
+
 func (s *ReloadTestSuite) Test_Execute_ReturnsError_WhenHaProxyReloadFails() {
 	proxyOrig := proxy.Instance
 	defer func() { proxy.Instance = proxyOrig }()
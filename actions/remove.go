@@ -2,6 +2,7 @@ package actions
 
 import (
 	"../proxy"
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -18,13 +19,16 @@ type Remove struct {
 	TemplatesPath   string `short:"t" long:"templates-path" default:"/cfg/tmpl" description:"The path to the templates directory"`
 	Mode            string
 	AclName         string
+	// Whether the service can be removed while the proxy is in the read-only mode
+	AllowMutations bool
 }
 
 var RemoveInstance Remove
 
 // TODO: Change to addresses
-var NewRemove = func(serviceName, aclName, configsPath, templatesPath string, consulAddresses []string, instanceName, mode string) Removable {
+var NewRemove = func(serviceName, aclName, configsPath, templatesPath string, consulAddresses []string, instanceName, mode string, allowMutations bool) Removable {
 	return &Remove{
+		AllowMutations:  allowMutations,
 		ServiceName:     serviceName,
 		AclName:         aclName,
 		TemplatesPath:   templatesPath,
@@ -39,17 +43,23 @@ var NewRemove = func(serviceName, aclName, configsPath, templatesPath string, co
 func (m *Remove) Execute(args []string) error {
 	logPrintf("Removing %s configuration", m.ServiceName)
 	if err := m.removeFiles(m.TemplatesPath, m.ServiceName, m.AclName, m.ConsulAddresses, m.InstanceName, m.Mode); err != nil {
-		logPrintf(err.Error())
+		logPrintf("%s", err.Error())
 		return err
 	}
-	proxy.Instance.RemoveService(m.ServiceName)
+	if err := proxy.ForMutations(m.AllowMutations).RemoveService(m.ServiceName); err != nil {
+		if !errors.Is(err, proxy.ErrServiceNotFound) {
+			return err
+		}
+		// Services defined through Consul templates are not stored
+		logPrintf("%s", err.Error())
+	}
 	if err := proxy.Instance.CreateConfigFromTemplates(); err != nil {
-		logPrintf(err.Error())
+		logPrintf("%s", err.Error())
 		return err
 	}
 	reload := Reload{}
 	if err := reload.Execute(); err != nil {
-		logPrintf(err.Error())
+		logPrintf("%s", err.Error())
 		return err
 	}
 	return nil
@@ -58,7 +68,7 @@ func (m *Remove) Execute(args []string) error {
 func (m *Remove) removeFiles(templatesPath, serviceName, aclName string, registryAddresses []string, instanceName, mode string) error {
 	logPrintf("Removing the %s configuration files", serviceName)
 	if len(aclName) == 0 {
-		aclName = serviceName
+		aclName = proxy.GetIdentifier(serviceName)
 	}
 	paths := []string{
 		fmt.Sprintf("%s/%s-fe.cfg", templatesPath, aclName),
@@ -86,3 +96,54 @@ func (m *Remove) removeFiles(templatesPath, serviceName, aclName string, registr
 	}
 	return nil
 }
+
+// RemoveNamespace removes all the services that belong to a namespace (e.g. a Swarm stack)
+// with a single generation of the configuration and a single reload
+type RemoveNamespace struct {
+	ConfigsPath     string
+	ConsulAddresses []string
+	InstanceName    string
+	Namespace       string
+	TemplatesPath   string
+	Mode            string
+	// Whether the services can be removed while the proxy is in the read-only mode
+	AllowMutations bool
+}
+
+var NewRemoveNamespace = func(namespace, configsPath, templatesPath string, consulAddresses []string, instanceName, mode string, allowMutations bool) Removable {
+	return &RemoveNamespace{
+		AllowMutations:  allowMutations,
+		Namespace:       namespace,
+		TemplatesPath:   templatesPath,
+		ConfigsPath:     configsPath,
+		ConsulAddresses: consulAddresses,
+		InstanceName:    instanceName,
+		Mode:            mode,
+	}
+}
+
+func (m *RemoveNamespace) Execute(args []string) error {
+	logPrintf("Removing the services of the namespace %s", m.Namespace)
+	services := proxy.Instance.GetServicesByNamespace(m.Namespace)
+	remove := Remove{}
+	for name, s := range services {
+		if err := remove.removeFiles(m.TemplatesPath, name, s.AclName, m.ConsulAddresses, m.InstanceName, m.Mode); err != nil {
+			logPrintf("%s", err.Error())
+			return err
+		}
+	}
+	if err := proxy.ForMutations(m.AllowMutations).RemoveNamespace(m.Namespace); err != nil {
+		logPrintf("%s", err.Error())
+		return err
+	}
+	if err := proxy.Instance.CreateConfigFromTemplates(); err != nil {
+		logPrintf("%s", err.Error())
+		return err
+	}
+	reload := Reload{}
+	if err := reload.Execute(); err != nil {
+		logPrintf("%s", err.Error())
+		return err
+	}
+	return nil
+}
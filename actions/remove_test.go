@@ -199,3 +199,63 @@ func (s RemoveTestSuite) Test_Execute_RemovesService() {
 
 	mockObj.AssertCalled(s.T(), "RemoveService", s.remove.ServiceName)
 }
+
+func (s RemoveTestSuite) Test_Execute_ReloadsProxy_WhenServiceIsNotFound() {
+	mockObj := getProxyMock("RemoveService")
+	mockObj.On("RemoveService", mock.Anything).Return(fmt.Errorf("%w: my-service", proxy.ErrServiceNotFound))
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxy.Instance = mockObj
+
+	err := s.remove.Execute([]string{})
+
+	s.NoError(err)
+	mockObj.AssertCalled(s.T(), "Reload")
+}
+
+// RemoveNamespace > Execute
+
+func (s RemoveTestSuite) Test_RemoveNamespaceExecute_RemovesServicesWithSingleReload() {
+	mockObj := getProxyMock("GetServicesByNamespace")
+	mockObj.On("GetServicesByNamespace", "mystack").Return(map[string]proxy.Service{
+		"mystack_api": {ServiceName: "mystack_api"},
+		"mystack_web": {ServiceName: "mystack_web", AclName: "01-web"},
+	})
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxy.Instance = mockObj
+	actual := map[string]bool{}
+	OsRemove = func(name string) error {
+		actual[name] = true
+		return nil
+	}
+	remove := NewRemoveNamespace("mystack", s.ConfigsPath, s.TemplatesPath, []string{}, s.InstanceName, "swarm", false)
+
+	err := remove.Execute([]string{})
+
+	s.NoError(err)
+	s.Equal(map[string]bool{
+		s.TemplatesPath + "/mystack_api-fe.cfg": true,
+		s.TemplatesPath + "/mystack_api-be.cfg": true,
+		s.TemplatesPath + "/01-web-fe.cfg":      true,
+		s.TemplatesPath + "/01-web-be.cfg":      true,
+	}, actual)
+	mockObj.AssertCalled(s.T(), "RemoveNamespace", "mystack")
+	mockObj.AssertNotCalled(s.T(), "RemoveService", mock.Anything)
+	mockObj.AssertNumberOfCalls(s.T(), "CreateConfigFromTemplates", 1)
+	mockObj.AssertNumberOfCalls(s.T(), "Reload", 1)
+}
+
+func (s RemoveTestSuite) Test_RemoveNamespaceExecute_ReturnsError_WhenNamespaceIsNotFound() {
+	mockObj := getProxyMock("RemoveNamespace")
+	mockObj.On("RemoveNamespace", mock.Anything).Return(fmt.Errorf("%w: no services in the namespace mystack", proxy.ErrServiceNotFound))
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxy.Instance = mockObj
+	remove := NewRemoveNamespace("mystack", s.ConfigsPath, s.TemplatesPath, []string{}, s.InstanceName, "swarm", false)
+
+	err := remove.Execute([]string{})
+
+	s.Error(err)
+	mockObj.AssertNotCalled(s.T(), "Reload")
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 )
 
 type Executable interface {
@@ -25,4 +26,6 @@ var registryInstance registry.Registrarable = registry.Consul{}
 var writeFeTemplate = ioutil.WriteFile
 var writeBeTemplate = ioutil.WriteFile
 var readTemplateFile = ioutil.ReadFile
+var readTemplatesDir = ioutil.ReadDir
 var OsRemove = os.Remove
+var afterFunc = time.AfterFunc
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	"./actions"
 	"./proxy"
@@ -21,7 +22,7 @@ type ArgsTestSuite struct {
 }
 
 func (s *ArgsTestSuite) SetupTest() {
-	httpListenAndServe = func(addr string, handler http.Handler) error {
+	httpListenAndServe = func(srv *http.Server) error {
 		return nil
 	}
 	actions.OsRemove = func(name string) error {
@@ -309,7 +310,12 @@ func (m *ProxyMock) Reload() error {
 	return params.Error(0)
 }
 
-func (m *ProxyMock) AddCert(certName string) {
+func (m *ProxyMock) AddCert(certName string) error {
+	params := m.Called(certName)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) RemoveCert(certName string) {
 	m.Called(certName)
 }
 
@@ -318,16 +324,75 @@ func (m *ProxyMock) GetCerts() map[string]string {
 	return params.Get(0).(map[string]string)
 }
 
-func (m *ProxyMock) AddService(service proxy.Service) {
-	m.Called(service)
+func (m *ProxyMock) AddService(service proxy.Service) error {
+	params := m.Called(service)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) RemoveService(service string) error {
+	params := m.Called(service)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) GetServices() map[string]proxy.Service {
+	params := m.Called()
+	return params.Get(0).(map[string]proxy.Service)
+}
+
+func (m *ProxyMock) GetServicesByNamespace(namespace string) map[string]proxy.Service {
+	params := m.Called(namespace)
+	return params.Get(0).(map[string]proxy.Service)
+}
+
+func (m *ProxyMock) RemoveNamespace(namespace string) error {
+	params := m.Called(namespace)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) CreateSupportBundle() ([]byte, error) {
+	params := m.Called()
+	return params.Get(0).([]byte), params.Error(1)
+}
+
+func (m *ProxyMock) DebugState() proxy.DebugState {
+	params := m.Called()
+	return params.Get(0).(proxy.DebugState)
+}
+
+func (m *ProxyMock) SetServiceReplicas(serviceName string, replicas int) error {
+	params := m.Called(serviceName, replicas)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) ReloadAfter(delay time.Duration) error {
+	params := m.Called(delay)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) LoadState() error {
+	params := m.Called()
+	return params.Error(0)
+}
+
+func (m *ProxyMock) WithMutations() proxy.Proxy {
+	m.Called()
+	return m
 }
 
-func (m *ProxyMock) RemoveService(service string) {
-	m.Called(service)
+// Without a renderer of the test, the mock uses the renderer of the flavor defined through CONFIG_FLAVOR
+func (m *ProxyMock) GetRenderer() proxy.ConfigRenderer {
+	params := m.Called()
+	if renderer, ok := params.Get(0).(proxy.ConfigRenderer); ok {
+		return renderer
+	}
+	return proxy.HaProxy{}.GetRenderer()
 }
 
 func getProxyMock(skipMethod string) *ProxyMock {
 	mockObj := new(ProxyMock)
+	if skipMethod != "GetRenderer" {
+		mockObj.On("GetRenderer").Return(nil)
+	}
 	if skipMethod != "RunCmd" {
 		mockObj.On("RunCmd", mock.Anything).Return(nil)
 	}
@@ -343,14 +408,44 @@ func getProxyMock(skipMethod string) *ProxyMock {
 	if skipMethod != "AddCert" {
 		mockObj.On("AddCert", mock.Anything).Return(nil)
 	}
+	if skipMethod != "RemoveCert" {
+		mockObj.On("RemoveCert", mock.Anything)
+	}
 	if skipMethod != "GetCerts" {
 		mockObj.On("GetCerts").Return(map[string]string{})
 	}
 	if skipMethod != "AddService" {
-		mockObj.On("AddService", mock.Anything)
+		mockObj.On("AddService", mock.Anything).Return(nil)
 	}
 	if skipMethod != "RemoveService" {
-		mockObj.On("RemoveService", mock.Anything)
+		mockObj.On("RemoveService", mock.Anything).Return(nil)
+	}
+	if skipMethod != "GetServices" {
+		mockObj.On("GetServices").Return(map[string]proxy.Service{})
+	}
+	if skipMethod != "GetServicesByNamespace" {
+		mockObj.On("GetServicesByNamespace", mock.Anything).Return(map[string]proxy.Service{})
+	}
+	if skipMethod != "RemoveNamespace" {
+		mockObj.On("RemoveNamespace", mock.Anything).Return(nil)
+	}
+	if skipMethod != "CreateSupportBundle" {
+		mockObj.On("CreateSupportBundle").Return([]byte{}, nil)
+	}
+	if skipMethod != "DebugState" {
+		mockObj.On("DebugState").Return(proxy.DebugState{})
+	}
+	if skipMethod != "SetServiceReplicas" {
+		mockObj.On("SetServiceReplicas", mock.Anything, mock.Anything).Return(nil)
+	}
+	if skipMethod != "ReloadAfter" {
+		mockObj.On("ReloadAfter", mock.Anything).Return(nil)
+	}
+	if skipMethod != "LoadState" {
+		mockObj.On("LoadState").Return(nil)
+	}
+	if skipMethod != "WithMutations" {
+		mockObj.On("WithMutations")
 	}
 	return mockObj
 }
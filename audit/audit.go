@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// The maximum number of entries kept in memory
+const MaxEntries = 1000
+
+var logPrintf = log.Printf
+var timeNow = time.Now
+
+// Instance is the audit log used by all the packages
+var Instance = NewLog(MaxEntries)
+
+// Entry is a single event recorded in the audit log
+type Entry struct {
+	Time    time.Time
+	Event   string
+	Message string
+}
+
+// Log keeps the most recent audit entries in memory
+type Log struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    []Entry
+}
+
+// NewLog returns a new instance of the audit log that keeps up to maxEntries entries
+func NewLog(maxEntries int) *Log {
+	return &Log{maxEntries: maxEntries, entries: []Entry{}}
+}
+
+// Append records an event. The oldest entries are discarded when the log is full.
+func (m *Log) Append(event, format string, v ...interface{}) {
+	entry := Entry{Time: timeNow(), Event: event, Message: fmt.Sprintf(format, v...)}
+	logPrintf("AUDIT %s: %s", entry.Event, entry.Message)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, entry)
+	if len(m.entries) > m.maxEntries {
+		m.entries = m.entries[len(m.entries)-m.maxEntries:]
+	}
+}
+
+// GetEntries returns up to the last limit entries, the oldest first.
+// If limit is zero or negative, all the entries are returned.
+func (m *Log) GetEntries(limit int) []Entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	from := 0
+	if limit > 0 && len(m.entries) > limit {
+		from = len(m.entries) - limit
+	}
+	return append([]Entry{}, m.entries[from:]...)
+}
@@ -0,0 +1,61 @@
+// +build !integration
+
+package audit
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+type AuditTestSuite struct {
+	suite.Suite
+}
+
+func TestAuditUnitTestSuite(t *testing.T) {
+	s := new(AuditTestSuite)
+	logPrintf = func(format string, v ...interface{}) {}
+	suite.Run(t, s)
+}
+
+// Append
+
+func (s *AuditTestSuite) Test_Append_RecordsEntry() {
+	now := time.Now()
+	timeNowOrig := timeNow
+	defer func() { timeNow = timeNowOrig }()
+	timeNow = func() time.Time { return now }
+	l := NewLog(10)
+
+	l.Append("reload", "Reloaded the service %s", "my-service")
+
+	s.Equal([]Entry{{Time: now, Event: "reload", Message: "Reloaded the service my-service"}}, l.GetEntries(0))
+}
+
+func (s *AuditTestSuite) Test_Append_DiscardsOldestEntries_WhenLogIsFull() {
+	l := NewLog(2)
+
+	l.Append("event", "1")
+	l.Append("event", "2")
+	l.Append("event", "3")
+
+	actual := l.GetEntries(0)
+	s.Len(actual, 2)
+	s.Equal("2", actual[0].Message)
+	s.Equal("3", actual[1].Message)
+}
+
+// GetEntries
+
+func (s *AuditTestSuite) Test_GetEntries_ReturnsLastEntries() {
+	l := NewLog(10)
+	l.Append("event", "1")
+	l.Append("event", "2")
+	l.Append("event", "3")
+
+	actual := l.GetEntries(2)
+
+	s.Len(actual, 2)
+	s.Equal("2", actual[0].Message)
+	s.Equal("3", actual[1].Message)
+}
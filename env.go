@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The environment variables read by the proxy.
+// New variables must be added to the list so that they are not reported as unknown.
+var knownEnvVars = []string{
+	"API_BIND_ADDRESS",
+	"API_CERT_NAME",
+	"API_CORS_CREDENTIALS",
+	"API_CORS_ORIGINS",
+	"API_PORT",
+	"API_RATE_LIMIT",
+	"API_RATE_LIMIT_PER_IP",
+	"APPLY_PENDING_ON_START",
+	"AUTO_DOMAIN_FROM_CERT",
+	"BIND_ADDRESS",
+	"BIND_ADDRESSES",
+	"BIND_PORTS",
+	"BLOCKLIST_PATH",
+	"BLOCKLIST_REFRESH_INTERVAL",
+	"BLOCKLIST_URL",
+	"CERTS_PRUNE_GRACE_PERIOD",
+	"CHECK_RESOLVERS",
+	"CONFIG_FLAVOR",
+	"CONSUL_ADDRESS",
+	"DEBUG",
+	"DEEP_VALIDATION",
+	"DEFAULT_CERT",
+	"DEFAULT_SERVER_OPTIONS",
+	"DISTRIBUTE_SECRET",
+	"DOMAIN_OWNERSHIP_FILE",
+	"DOMAIN_ROUTING_MODE",
+	"ENABLE_DEBUG_ENDPOINTS",
+	"ENABLE_IPV6",
+	"ERROR_MESSAGE_400",
+	"ERROR_MESSAGE_403",
+	"ERROR_MESSAGE_405",
+	"ERROR_MESSAGE_408",
+	"ERROR_MESSAGE_429",
+	"ERROR_MESSAGE_500",
+	"ERROR_MESSAGE_502",
+	"ERROR_MESSAGE_503",
+	"ERROR_MESSAGE_504",
+	"EXTRA_DIRECTIVE_ALLOWLIST",
+	"EXTRA_FRONTEND",
+	"EXTRA_FRONTEND_AFTER_ACLS",
+	"EXTRA_FRONTEND_BEFORE_ACLS",
+	"EXTRA_FRONTEND_SPLIT_ON_COMMA",
+	"HEALTHCHECK_PORT",
+	"HEALTHCHECK_REQUIRE_BACKENDS",
+	"HEALTH_CHECK_INTERVAL",
+	"HEALTH_NOTIFY_MIN_INTERVAL",
+	"HEALTH_NOTIFY_URLS",
+	"HEALTH_STATS_URL",
+	"HTTPS_ONLY",
+	"HTTPS_REDIRECT_CODE",
+	"IP",
+	"LISTENER_ADDRESS",
+	"LUA_SCRIPTS_PATH",
+	"MODE",
+	"PORT",
+	"PRIMARY_ADDRESS",
+	"PROXY_INSTANCE_NAME",
+	"QUARANTINE_BROKEN_SERVICES",
+	"READ_ONLY_MODE",
+	"RELOAD_DEBOUNCE_INTERVAL",
+	"RELOAD_SOCKET",
+	"RELOAD_SPREAD_INTERVAL",
+	"REPLICA_HEADROOM",
+	"SECURITY_RULES",
+	"SERVICE_BYTES_METRICS",
+	"SERVICE_DEFAULTS_FILE",
+	"SERVICE_NAME",
+	"SET_REAL_IP",
+	"STATS_DISABLED",
+	"STATS_PASS",
+	"STATS_PORT",
+	"STATS_REALM",
+	"STATS_URI",
+	"STATS_USER",
+	"STATS_USERS",
+	"STRICT_BACKENDS",
+	"STRICT_ENV_VARS",
+	"STRICT_TEMPLATE",
+	"SYNC_FROM_PEERS",
+	"SYSLOG_LISTENER_ADDRESS",
+	"TIMEOUT_CLIENT",
+	"TIMEOUT_CONNECT",
+	"TIMEOUT_HTTP_KEEP_ALIVE",
+	"TIMEOUT_HTTP_REQUEST",
+	"TIMEOUT_QUEUE",
+	"TIMEOUT_SERVER",
+	"TIMEOUT_TUNNEL",
+	"TRUSTED_PROXY_NETWORKS",
+	"USERS",
+	"USERS_PASS_ENCRYPTED",
+	"WARMUP_DURATION",
+	"WARMUP_MAXCONN",
+}
+
+// Variables with these prefixes are expected to be meant for the proxy
+var knownEnvVarPrefixes = []string{
+	"API_",
+	"BIND_",
+	"BLOCKLIST_",
+	"CONFIG_",
+	"CERTS_",
+	"CONSUL_",
+	"DFP_",
+	"ERROR_",
+	"EXTRA_",
+	"HEALTH",
+	"SSL_",
+	"STATS_",
+	"STRICT_",
+	"SYSLOG_",
+	"TIMEOUT_",
+	"TRUSTED_",
+	"WARMUP_",
+}
+
+var osEnviron = os.Environ
+
+// Looks for environment variables that look as if they were meant for the proxy but are not used by it (e.g. typos).
+// Unknown variables are logged. If STRICT_ENV_VARS is true, an error is returned instead.
+func checkEnvVars() error {
+	known := map[string]bool{}
+	for _, name := range knownEnvVars {
+		known[name] = true
+	}
+	unknown := []string{}
+	for _, env := range osEnviron() {
+		name := strings.SplitN(env, "=", 2)[0]
+		if known[name] || !hasKnownEnvVarPrefix(name) {
+			continue
+		}
+		msg := name
+		if suggestion := getEnvVarSuggestion(name); len(suggestion) > 0 {
+			msg = fmt.Sprintf("%s (did you mean %s?)", name, suggestion)
+		}
+		unknown = append(unknown, msg)
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	err := fmt.Errorf("The following environment variables are not used by the proxy: %s", strings.Join(unknown, ", "))
+	if strings.EqualFold(os.Getenv("STRICT_ENV_VARS"), "true") {
+		return err
+	}
+	logPrintf("WARNING: %s", err.Error())
+	return nil
+}
+
+func hasKnownEnvVarPrefix(name string) bool {
+	for _, prefix := range knownEnvVarPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the known variable closest to the name or an empty string if none of them is close enough
+func getEnvVarSuggestion(name string) string {
+	suggestion := ""
+	minDistance := len(name)/3 + 1
+	for _, known := range knownEnvVars {
+		if distance := getEditDistance(name, known); distance < minDistance {
+			suggestion = known
+			minDistance = distance
+		}
+	}
+	return suggestion
+}
+
+// Returns the Levenshtein distance between two strings
+func getEditDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,100 @@
+// +build !integration
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type EnvTestSuite struct {
+	suite.Suite
+	Logs []string
+}
+
+func TestEnvUnitTestSuite(t *testing.T) {
+	logPrintfOrig := logPrintf
+	defer func() { logPrintf = logPrintfOrig }()
+	s := new(EnvTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *EnvTestSuite) SetupTest() {
+	s.Logs = []string{}
+	logPrintf = func(format string, v ...interface{}) {
+		s.Logs = append(s.Logs, fmt.Sprintf(format, v...))
+	}
+}
+
+func (s *EnvTestSuite) TearDownTest() {
+	osEnviron = os.Environ
+	os.Unsetenv("STRICT_ENV_VARS")
+}
+
+// checkEnvVars
+
+func (s *EnvTestSuite) Test_CheckEnvVars_LogsUnknownEnvVarsWithSuggestions() {
+	osEnviron = func() []string {
+		return []string{
+			"TIMEOUT_CLEINT=10",
+			"STATS_USR=admin",
+			"DFP_SOMETHING_ELSE=true",
+			"TIMEOUT_CLIENT=20",
+			"PATH=/usr/bin",
+			"HOSTNAME=proxy",
+		}
+	}
+
+	err := checkEnvVars()
+
+	s.NoError(err)
+	s.Equal(
+		[]string{"WARNING: The following environment variables are not used by the proxy: DFP_SOMETHING_ELSE, STATS_USR (did you mean STATS_USER?), TIMEOUT_CLEINT (did you mean TIMEOUT_CLIENT?)"},
+		s.Logs,
+	)
+}
+
+func (s *EnvTestSuite) Test_CheckEnvVars_DoesNotLog_WhenAllEnvVarsAreKnown() {
+	osEnviron = func() []string {
+		return []string{"TIMEOUT_CLIENT=20", "EXTRA_FRONTEND=something", "HOME=/root"}
+	}
+
+	err := checkEnvVars()
+
+	s.NoError(err)
+	s.Empty(s.Logs)
+}
+
+func (s *EnvTestSuite) Test_CheckEnvVars_ReturnsError_WhenStrictEnvVarsIsTrue() {
+	os.Setenv("STRICT_ENV_VARS", "true")
+	osEnviron = func() []string {
+		return []string{"STRICT_ENV_VARS=true", "BIND_PORT=8085"}
+	}
+
+	err := checkEnvVars()
+
+	s.Error(err)
+	s.Contains(err.Error(), "BIND_PORT (did you mean BIND_PORTS?)")
+	s.Empty(s.Logs)
+}
+
+// getEditDistance
+
+func (s *EnvTestSuite) Test_GetEditDistance_ReturnsLevenshteinDistance() {
+	testData := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"", "ABC", 3},
+		{"TIMEOUT_CLEINT", "TIMEOUT_CLIENT", 2},
+		{"STATS_USR", "STATS_USER", 1},
+		{"KITTEN", "SITTING", 3},
+	}
+	for _, data := range testData {
+		s.Equal(data.expected, getEditDistance(data.a, data.b), "%s -> %s", data.a, data.b)
+	}
+}
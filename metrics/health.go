@@ -0,0 +1,273 @@
+package metrics
+
+import (
+	"../proxy"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerState is the state of a backend or one of its servers as reported by HAProxy statistics
+type ServerState struct {
+	Backend     string
+	Server      string
+	Status      string
+	CheckStatus string
+	CheckOutput string
+	// The number of bytes received from the clients (bin)
+	BytesIn uint64
+	// The number of bytes sent to the clients (bout)
+	BytesOut uint64
+}
+
+// HealthEvent is sent when a backend or a server changes its state between UP and DOWN
+type HealthEvent struct {
+	Service     string
+	Backend     string
+	Server      string
+	OldState    string
+	NewState    string
+	Timestamp   time.Time
+	CheckOutput string `json:",omitempty"`
+}
+
+// HealthDetector detects state transitions by comparing consecutive snapshots of HAProxy statistics
+type HealthDetector struct {
+	// The minimum time between two notifications about the same backend
+	MinInterval time.Duration
+	// Snapshots taken further apart (e.g. after a proxy restart) are used only as a new baseline
+	MaxGap       time.Duration
+	states       map[string]string
+	lastSnapshot time.Time
+	lastNotified map[string]time.Time
+}
+
+// NewHealthDetector returns a new instance of the HealthDetector
+func NewHealthDetector(minInterval, maxGap time.Duration) *HealthDetector {
+	return &HealthDetector{
+		MinInterval:  minInterval,
+		MaxGap:       maxGap,
+		states:       map[string]string{},
+		lastNotified: map[string]time.Time{},
+	}
+}
+
+// ParseStatsCsv parses HAProxy statistics in the CSV format (e.g. /admin?stats;csv).
+// Frontends are skipped.
+func ParseStatsCsv(content []byte) ([]ServerState, error) {
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("The statistics are empty")
+	}
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.TrimPrefix(strings.TrimSpace(name), "# ")] = i
+	}
+	for _, name := range []string{"pxname", "svname", "status"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("The statistics do not contain the %s column", name)
+		}
+	}
+	get := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	states := []ServerState{}
+	for _, record := range records[1:] {
+		if get(record, "svname") == "FRONTEND" {
+			continue
+		}
+		bytesIn, _ := strconv.ParseUint(get(record, "bin"), 10, 64)
+		bytesOut, _ := strconv.ParseUint(get(record, "bout"), 10, 64)
+		states = append(states, ServerState{
+			Backend:     get(record, "pxname"),
+			Server:      get(record, "svname"),
+			Status:      get(record, "status"),
+			CheckStatus: get(record, "check_status"),
+			CheckOutput: get(record, "last_chk"),
+			BytesIn:     bytesIn,
+			BytesOut:    bytesOut,
+		})
+	}
+	return states, nil
+}
+
+// Process compares the snapshot with the previous states and returns the transitions between UP and DOWN.
+// Transitional states (e.g. UP 1/3), servers without checks, and servers missing from the snapshot keep the previous state.
+// The first snapshot and snapshots taken after a gap longer than MaxGap do not produce events.
+// Transitions of a backend notified less than MinInterval ago are not returned, but their states are recorded.
+func (m *HealthDetector) Process(snapshot []ServerState, now time.Time) []HealthEvent {
+	baseline := m.lastSnapshot.IsZero() || (m.MaxGap > 0 && now.Sub(m.lastSnapshot) > m.MaxGap)
+	m.lastSnapshot = now
+	events := []HealthEvent{}
+	for _, s := range snapshot {
+		state := strings.ToUpper(strings.TrimSpace(s.Status))
+		if (state != "UP" && state != "DOWN") || s.CheckStatus == "INI" {
+			continue
+		}
+		key := s.Backend + "/" + s.Server
+		oldState, known := m.states[key]
+		m.states[key] = state
+		if baseline || !known || oldState == state {
+			continue
+		}
+		if notified, ok := m.lastNotified[s.Backend]; ok && now.Sub(notified) < m.MinInterval {
+			continue
+		}
+		m.lastNotified[s.Backend] = now
+		events = append(events, HealthEvent{
+			Service:     getServiceName(s.Backend),
+			Backend:     s.Backend,
+			Server:      s.Server,
+			OldState:    oldState,
+			NewState:    state,
+			Timestamp:   now,
+			CheckOutput: s.CheckOutput,
+		})
+	}
+	return events
+}
+
+// StartHealthNotifier periodically reads HAProxy statistics and publishes the health transitions through proxy.Subscribe.
+// The events of the channel are sent to HEALTH_NOTIFY_URLS and recorded in metrics. The audit log consumes the same channel.
+// The bytes transferred by the services are recorded as well.
+func StartHealthNotifier() error {
+	interval, err := getSecondsFromEnv("HEALTH_CHECK_INTERVAL", 10)
+	if err != nil {
+		return err
+	}
+	minInterval, err := getSecondsFromEnv("HEALTH_NOTIFY_MIN_INTERVAL", 60)
+	if err != nil {
+		return err
+	}
+	urls := strings.Split(os.Getenv("HEALTH_NOTIFY_URLS"), ",")
+	detector := NewHealthDetector(minInterval, 3*interval)
+	watchServices()
+	go notifyHealthEvents(urls, proxySubscribe())
+	go func() {
+		for range time.Tick(interval) {
+			content, err := getStats()
+			if err != nil {
+				logPrintf("Could not read the statistics\n%s", err.Error())
+				continue
+			}
+			snapshot, err := ParseStatsCsv(content)
+			if err != nil {
+				logPrintf("Could not parse the statistics\n%s", err.Error())
+				continue
+			}
+			Instance.RecordBytes(snapshot)
+			for _, event := range detector.Process(snapshot, time.Now()) {
+				proxyPublishHealthChange(event.Service, proxy.HealthChange{
+					Backend:     event.Backend,
+					Server:      event.Server,
+					OldState:    event.OldState,
+					NewState:    event.NewState,
+					Timestamp:   event.Timestamp,
+					CheckOutput: event.CheckOutput,
+				})
+			}
+		}
+	}()
+	return nil
+}
+
+// Sends the health transitions of the channel to the URLs. Service changes are skipped.
+func notifyHealthEvents(urls []string, events <-chan proxy.ServiceChangeEvent) {
+	for event := range events {
+		if event.Health == nil {
+			continue
+		}
+		notifyHealthEvent(urls, HealthEvent{
+			Service:     event.ServiceName,
+			Backend:     event.Health.Backend,
+			Server:      event.Health.Server,
+			OldState:    event.Health.OldState,
+			NewState:    event.Health.NewState,
+			Timestamp:   event.Health.Timestamp,
+			CheckOutput: event.Health.CheckOutput,
+		})
+	}
+}
+
+func notifyHealthEvent(urls []string, event HealthEvent) {
+	Instance.RecordHealthEvent(event)
+	js, _ := json.Marshal(event)
+	for _, url := range urls {
+		if len(url) == 0 {
+			continue
+		}
+		resp, err := httpPost(url, "application/json", bytes.NewReader(js))
+		if err != nil {
+			logPrintf("Could not send the health event to %s\n%s", url, err.Error())
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			logPrintf("Sending the health event to %s failed with status %d", url, resp.StatusCode)
+		}
+	}
+}
+
+// Reads HAProxy statistics using the credentials of the statistics page
+var getStats = func() ([]byte, error) {
+	url := os.Getenv("HEALTH_STATS_URL")
+	uri := "/admin?stats"
+	if len(os.Getenv("STATS_URI")) > 0 {
+		uri = os.Getenv("STATS_URI")
+	}
+	if len(url) == 0 && len(os.Getenv("STATS_PORT")) > 0 {
+		url = fmt.Sprintf("http://127.0.0.1:%s%s;csv", os.Getenv("STATS_PORT"), uri)
+	} else if len(url) == 0 {
+		url = fmt.Sprintf("http://127.0.0.1%s;csv", uri)
+	}
+	user, pass := "admin", "admin"
+	if len(os.Getenv("STATS_USERS")) > 0 {
+		parts := strings.Split(strings.Split(os.Getenv("STATS_USERS"), ",")[0], ":")
+		if len(parts) > 1 {
+			user, pass = parts[0], parts[1]
+		}
+	} else {
+		if len(os.Getenv("STATS_USER")) > 0 {
+			user = os.Getenv("STATS_USER")
+		}
+		if len(os.Getenv("STATS_PASS")) > 0 {
+			pass = os.Getenv("STATS_PASS")
+		}
+	}
+	req, _ := http.NewRequest("GET", url, nil)
+	req.SetBasicAuth(user, pass)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("The statistics request failed with status %d", resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func getSecondsFromEnv(key string, defaultValue int) (time.Duration, error) {
+	seconds := defaultValue
+	if len(os.Getenv(key)) > 0 {
+		value, err := strconv.Atoi(os.Getenv(key))
+		if err != nil || value <= 0 {
+			return 0, fmt.Errorf("%s must be a positive number of seconds", key)
+		}
+		seconds = value
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
@@ -0,0 +1,168 @@
+// +build !integration
+
+package metrics
+
+import (
+	"../proxy"
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type HealthTestSuite struct {
+	suite.Suite
+	Now time.Time
+}
+
+func TestHealthUnitTestSuite(t *testing.T) {
+	s := new(HealthTestSuite)
+	logPrintf = func(format string, v ...interface{}) {}
+	suite.Run(t, s)
+}
+
+func (s *HealthTestSuite) SetupTest() {
+	s.Now = time.Now()
+}
+
+// ParseStatsCsv
+
+func (s *HealthTestSuite) Test_ParseStatsCsv_ReturnsBackendsAndServers() {
+	content, _ := ioutil.ReadFile("testdata/stats.csv")
+
+	actual, err := ParseStatsCsv(content)
+
+	s.NoError(err)
+	s.Equal(
+		[]ServerState{
+			{Backend: "go-demo-be8080", Server: "go-demo_1", Status: "UP", CheckStatus: "L4OK", CheckOutput: "Layer4 check passed"},
+			{Backend: "go-demo-be8080", Server: "go-demo_2", Status: "DOWN", CheckStatus: "L4CON", CheckOutput: "Connection refused"},
+			{Backend: "go-demo-be8080", Server: "BACKEND", Status: "UP", BytesIn: 1024, BytesOut: 4096},
+		},
+		actual,
+	)
+}
+
+func (s *HealthTestSuite) Test_ParseStatsCsv_ReturnsError_WhenColumnsAreMissing() {
+	_, err := ParseStatsCsv([]byte("# pxname,svname\ngo-demo-be8080,go-demo_1\n"))
+
+	s.Error(err)
+}
+
+// Process
+
+func (s *HealthTestSuite) Test_Process_ReturnsTransitions() {
+	d := NewHealthDetector(0, time.Minute)
+	d.Process(s.getSnapshot("UP", "UP"), s.Now)
+
+	actual := d.Process(s.getSnapshot("UP", "DOWN"), s.Now.Add(10*time.Second))
+
+	s.Equal(
+		[]HealthEvent{{
+			Service:     "go-demo",
+			Backend:     "go-demo-be8080",
+			Server:      "go-demo_2",
+			OldState:    "UP",
+			NewState:    "DOWN",
+			Timestamp:   s.Now.Add(10 * time.Second),
+			CheckOutput: "Connection refused",
+		}},
+		actual,
+	)
+}
+
+func (s *HealthTestSuite) Test_Process_DoesNotReturnTransitions_ForTheFirstSnapshot() {
+	d := NewHealthDetector(0, time.Minute)
+
+	s.Empty(d.Process(s.getSnapshot("UP", "DOWN"), s.Now))
+}
+
+func (s *HealthTestSuite) Test_Process_IgnoresTransitionalStatesAndMissingServers() {
+	d := NewHealthDetector(0, time.Minute)
+	d.Process(s.getSnapshot("UP", "DOWN"), s.Now)
+
+	s.Empty(d.Process(s.getSnapshot("UP 1/3", "DOWN 1/2"), s.Now.Add(10*time.Second)))
+	s.Empty(d.Process([]ServerState{}, s.Now.Add(20*time.Second)))
+	s.Empty(d.Process(s.getSnapshot("UP", "DOWN"), s.Now.Add(30*time.Second)))
+}
+
+func (s *HealthTestSuite) Test_Process_DoesNotReturnTransitions_AfterGap() {
+	d := NewHealthDetector(0, time.Minute)
+	d.Process(s.getSnapshot("DOWN", "DOWN"), s.Now)
+
+	restarted := s.getSnapshot("UP", "UP")
+	restarted[0].CheckStatus = "INI"
+	s.Empty(d.Process(restarted, s.Now.Add(5*time.Minute)))
+	s.Empty(d.Process(s.getSnapshot("DOWN", "UP"), s.Now.Add(5*time.Minute+10*time.Second)))
+}
+
+func (s *HealthTestSuite) Test_Process_SuppressesTransitionsWithinMinInterval() {
+	d := NewHealthDetector(time.Minute, time.Minute)
+	d.Process(s.getSnapshot("UP", "UP"), s.Now)
+
+	s.Len(d.Process(s.getSnapshot("UP", "DOWN"), s.Now.Add(10*time.Second)), 1)
+	s.Empty(d.Process(s.getSnapshot("UP", "UP"), s.Now.Add(20*time.Second)))
+	s.Empty(d.Process(s.getSnapshot("UP", "DOWN"), s.Now.Add(30*time.Second)))
+	s.Len(d.Process(s.getSnapshot("UP", "UP"), s.Now.Add(80*time.Second)), 1)
+}
+
+// notifyHealthEvents
+
+func (s *HealthTestSuite) Test_NotifyHealthEvents_SendsHealthEventsOfChannelAndRecordsThem() {
+	received := []HealthEvent{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actualEvent := HealthEvent{}
+		json.NewDecoder(r.Body).Decode(&actualEvent)
+		received = append(received, actualEvent)
+	}))
+	defer server.Close()
+	instanceOrig := Instance
+	defer func() { Instance = instanceOrig }()
+	Instance = NewCollector()
+	change := proxy.HealthChange{
+		Backend:   "go-demo-be8080",
+		Server:    "go-demo_2",
+		OldState:  "UP",
+		NewState:  "DOWN",
+		Timestamp: s.Now.UTC(),
+	}
+	events := make(chan proxy.ServiceChangeEvent, 2)
+	events <- proxy.ServiceChangeEvent{ServiceName: "go-demo", NewHash: "1"}
+	events <- proxy.ServiceChangeEvent{ServiceName: "go-demo", Health: &change}
+	close(events)
+
+	notifyHealthEvents([]string{server.URL, ""}, events)
+
+	expected := HealthEvent{
+		Service:   "go-demo",
+		Backend:   "go-demo-be8080",
+		Server:    "go-demo_2",
+		OldState:  "UP",
+		NewState:  "DOWN",
+		Timestamp: s.Now.UTC(),
+	}
+	s.Equal([]HealthEvent{expected}, received)
+	s.Contains(
+		s.getPrometheusOutput(Instance),
+		`docker_flow_proxy_health_transitions_total{service="go-demo",state="DOWN"} 1`,
+	)
+}
+
+// Util
+
+func (s *HealthTestSuite) getSnapshot(state1, state2 string) []ServerState {
+	return []ServerState{
+		{Backend: "go-demo-be8080", Server: "go-demo_1", Status: state1, CheckStatus: "L4OK"},
+		{Backend: "go-demo-be8080", Server: "go-demo_2", Status: state2, CheckStatus: "L4CON", CheckOutput: "Connection refused"},
+	}
+}
+
+func (s *HealthTestSuite) getPrometheusOutput(c *Collector) string {
+	var buf bytes.Buffer
+	c.WritePrometheus(&buf)
+	return buf.String()
+}
@@ -0,0 +1,290 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Buckets (in seconds) used by the response time histograms
+var Buckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Instance is the collector fed by the syslog listener and exposed through the metrics endpoint
+var Instance = NewCollector()
+
+var backendSuffixRegex = regexp.MustCompile(`^(?:https-)?(.+)-be[0-9-]*$`)
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(seconds float64) {
+	for i, bucket := range Buckets {
+		if seconds <= bucket {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// ServiceBytes contains the numbers of bytes transferred by a service
+type ServiceBytes struct {
+	// The number of bytes received from the clients
+	BytesIn uint64
+	// The number of bytes sent to the clients
+	BytesOut uint64
+}
+
+// Collector aggregates HAProxy log lines into per-service metrics
+type Collector struct {
+	mu            sync.Mutex
+	responseTimes map[string]*histogram
+	totalTimes    map[string]*histogram
+	statuses      map[string]map[int]uint64
+	health        map[string]map[string]uint64
+	bytes         map[string]*ServiceBytes
+	backendBytes  map[string]ServiceBytes
+	dropped       uint64
+}
+
+// NewCollector returns a new instance of the Collector
+func NewCollector() *Collector {
+	return &Collector{
+		responseTimes: map[string]*histogram{},
+		totalTimes:    map[string]*histogram{},
+		statuses:      map[string]map[int]uint64{},
+		health:        map[string]map[string]uint64{},
+		bytes:         map[string]*ServiceBytes{},
+		backendBytes:  map[string]ServiceBytes{},
+	}
+}
+
+// ProcessLine parses an HAProxy log line and records its timings and status code.
+// Lines that cannot be parsed are dropped and counted.
+func (m *Collector) ProcessLine(line string) {
+	entry, err := ParseLogLine(line)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.dropped++
+		return
+	}
+	serviceName := getServiceName(entry.Backend)
+	if entry.ResponseTime >= 0 {
+		m.getHistogram(m.responseTimes, serviceName).observe(float64(entry.ResponseTime) / 1000)
+	}
+	if entry.TotalTime >= 0 {
+		m.getHistogram(m.totalTimes, serviceName).observe(float64(entry.TotalTime) / 1000)
+	}
+	if entry.Status > 0 {
+		if _, ok := m.statuses[serviceName]; !ok {
+			m.statuses[serviceName] = map[int]uint64{}
+		}
+		m.statuses[serviceName][entry.Status]++
+	}
+}
+
+// RecordHealthEvent counts the transition of a backend or a server to a new state
+func (m *Collector) RecordHealthEvent(event HealthEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.health[event.Service]; !ok {
+		m.health[event.Service] = map[string]uint64{}
+	}
+	m.health[event.Service][event.NewState]++
+}
+
+// RecordBytes adds the bytes transferred by the backends since the previous snapshot to the counters of their services.
+// The counters are kept per service so that they survive reloads and changes of the names of the backends.
+// Backends are mapped to services through the backend names of the registered services. Other backends are ignored.
+// HAProxy resets its counters when it reloads so a counter lower than in the previous snapshot is added as it is.
+func (m *Collector) RecordBytes(snapshot []ServerState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current := map[string]ServiceBytes{}
+	for _, s := range snapshot {
+		if s.Server != "BACKEND" {
+			continue
+		}
+		serviceName, ok := lookupBackendService(s.Backend)
+		if !ok {
+			continue
+		}
+		current[s.Backend] = ServiceBytes{BytesIn: s.BytesIn, BytesOut: s.BytesOut}
+		previous := m.backendBytes[s.Backend]
+		if _, ok := m.bytes[serviceName]; !ok {
+			m.bytes[serviceName] = &ServiceBytes{}
+		}
+		m.bytes[serviceName].BytesIn += getCounterDelta(previous.BytesIn, s.BytesIn)
+		m.bytes[serviceName].BytesOut += getCounterDelta(previous.BytesOut, s.BytesOut)
+	}
+	// Backends missing from the snapshot start from zero if they appear again
+	m.backendBytes = current
+}
+
+// GetServiceBytes returns the numbers of bytes transferred by the service and whether any were recorded
+func (m *Collector) GetServiceBytes(serviceName string) (ServiceBytes, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if bytes, ok := m.bytes[serviceName]; ok {
+		return *bytes, true
+	}
+	return ServiceBytes{}, false
+}
+
+func getCounterDelta(previous, current uint64) uint64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+// ListenSyslog starts receiving HAProxy logs sent over UDP to the specified address
+func (m *Collector) ListenSyslog(address string) (net.PacketConn, error) {
+	conn, err := listenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	watchServices()
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				logPrintf("Stopped listening for syslog messages: %s", err.Error())
+				return
+			}
+			for _, line := range strings.Split(strings.TrimSpace(string(buf[:n])), "\n") {
+				m.ProcessLine(line)
+			}
+		}
+	}()
+	return conn, nil
+}
+
+// WritePrometheus writes all the metrics in the Prometheus text format
+func (m *Collector) WritePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writeHistograms(
+		w,
+		"docker_flow_proxy_backend_response_time_seconds",
+		"Time the backend servers took to send the response headers.",
+		m.responseTimes,
+	)
+	m.writeHistograms(
+		w,
+		"docker_flow_proxy_total_time_seconds",
+		"Total time of requests and TCP sessions.",
+		m.totalTimes,
+	)
+	fmt.Fprintln(w, "# HELP docker_flow_proxy_responses_total Number of responses by status code.")
+	fmt.Fprintln(w, "# TYPE docker_flow_proxy_responses_total counter")
+	serviceNames := []string{}
+	for serviceName := range m.statuses {
+		serviceNames = append(serviceNames, serviceName)
+	}
+	sort.Strings(serviceNames)
+	for _, serviceName := range serviceNames {
+		codes := []int{}
+		for code := range m.statuses[serviceName] {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(
+				w,
+				"docker_flow_proxy_responses_total{service=\"%s\",code=\"%d\"} %d\n",
+				serviceName,
+				code,
+				m.statuses[serviceName][code],
+			)
+		}
+	}
+	fmt.Fprintln(w, "# HELP docker_flow_proxy_health_transitions_total Number of transitions of backends and servers between UP and DOWN states.")
+	fmt.Fprintln(w, "# TYPE docker_flow_proxy_health_transitions_total counter")
+	serviceNames = []string{}
+	for serviceName := range m.health {
+		serviceNames = append(serviceNames, serviceName)
+	}
+	sort.Strings(serviceNames)
+	for _, serviceName := range serviceNames {
+		states := []string{}
+		for state := range m.health[serviceName] {
+			states = append(states, state)
+		}
+		sort.Strings(states)
+		for _, state := range states {
+			fmt.Fprintf(
+				w,
+				"docker_flow_proxy_health_transitions_total{service=\"%s\",state=\"%s\"} %d\n",
+				serviceName,
+				state,
+				m.health[serviceName][state],
+			)
+		}
+	}
+	serviceNames = []string{}
+	for serviceName := range m.bytes {
+		serviceNames = append(serviceNames, serviceName)
+	}
+	sort.Strings(serviceNames)
+	fmt.Fprintln(w, "# HELP proxy_service_bytes_in_total Number of bytes received from the clients of the service.")
+	fmt.Fprintln(w, "# TYPE proxy_service_bytes_in_total counter")
+	for _, serviceName := range serviceNames {
+		fmt.Fprintf(w, "proxy_service_bytes_in_total{service=\"%s\"} %d\n", serviceName, m.bytes[serviceName].BytesIn)
+	}
+	fmt.Fprintln(w, "# HELP proxy_service_bytes_out_total Number of bytes sent to the clients of the service.")
+	fmt.Fprintln(w, "# TYPE proxy_service_bytes_out_total counter")
+	for _, serviceName := range serviceNames {
+		fmt.Fprintf(w, "proxy_service_bytes_out_total{service=\"%s\"} %d\n", serviceName, m.bytes[serviceName].BytesOut)
+	}
+	fmt.Fprintln(w, "# HELP docker_flow_proxy_log_lines_dropped_total Number of log lines that could not be parsed.")
+	fmt.Fprintln(w, "# TYPE docker_flow_proxy_log_lines_dropped_total counter")
+	fmt.Fprintf(w, "docker_flow_proxy_log_lines_dropped_total %d\n", m.dropped)
+}
+
+func (m *Collector) getHistogram(histograms map[string]*histogram, serviceName string) *histogram {
+	if _, ok := histograms[serviceName]; !ok {
+		histograms[serviceName] = &histogram{counts: make([]uint64, len(Buckets))}
+	}
+	return histograms[serviceName]
+}
+
+func (m *Collector) writeHistograms(w io.Writer, name, help string, histograms map[string]*histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	serviceNames := []string{}
+	for serviceName := range histograms {
+		serviceNames = append(serviceNames, serviceName)
+	}
+	sort.Strings(serviceNames)
+	for _, serviceName := range serviceNames {
+		h := histograms[serviceName]
+		for i, bucket := range Buckets {
+			fmt.Fprintf(w, "%s_bucket{service=\"%s\",le=\"%g\"} %d\n", name, serviceName, bucket, h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{service=\"%s\",le=\"+Inf\"} %d\n", name, serviceName, h.count)
+		fmt.Fprintf(w, "%s_sum{service=\"%s\"} %g\n", name, serviceName, h.sum)
+		fmt.Fprintf(w, "%s_count{service=\"%s\"} %d\n", name, serviceName, h.count)
+	}
+}
+
+// Backends are named after the ACL name of the service (e.g. go-demo-be8080 or https-go-demo-be8080).
+// If the backend belongs to a registered service, its service name is used.
+var getServiceName = func(backend string) string {
+	if name, ok := lookupBackendService(backend); ok {
+		return name
+	}
+	if m := backendSuffixRegex.FindStringSubmatch(backend); m != nil {
+		return m[1]
+	}
+	return backend
+}
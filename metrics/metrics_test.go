@@ -0,0 +1,211 @@
+// +build !integration
+
+package metrics
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type MetricsTestSuite struct {
+	suite.Suite
+	Lines []string
+}
+
+func TestMetricsUnitTestSuite(t *testing.T) {
+	s := new(MetricsTestSuite)
+	logPrintf = func(format string, v ...interface{}) {}
+	suite.Run(t, s)
+}
+
+func (s *MetricsTestSuite) SetupTest() {
+	content, _ := ioutil.ReadFile("testdata/haproxy.log")
+	s.Lines = strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+// ProcessLine
+
+func (s *MetricsTestSuite) Test_ProcessLine_RecordsResponseTimes() {
+	c := NewCollector()
+
+	c.ProcessLine(s.Lines[0])
+	c.ProcessLine(s.Lines[2])
+
+	actual := s.getPrometheusOutput(c)
+	s.Contains(actual, `docker_flow_proxy_backend_response_time_seconds_bucket{service="go-demo",le="0.025"} 1`)
+	s.Contains(actual, `docker_flow_proxy_backend_response_time_seconds_bucket{service="go-demo",le="0.25"} 2`)
+	s.Contains(actual, `docker_flow_proxy_backend_response_time_seconds_bucket{service="go-demo",le="+Inf"} 2`)
+	s.Contains(actual, `docker_flow_proxy_backend_response_time_seconds_sum{service="go-demo"} 0.145`)
+	s.Contains(actual, `docker_flow_proxy_backend_response_time_seconds_count{service="go-demo"} 2`)
+	s.Contains(actual, `docker_flow_proxy_total_time_seconds_count{service="go-demo"} 2`)
+}
+
+func (s *MetricsTestSuite) Test_ProcessLine_RecordsStatusCodes() {
+	c := NewCollector()
+
+	c.ProcessLine(s.Lines[0])
+	c.ProcessLine(s.Lines[1])
+	c.ProcessLine(s.Lines[3])
+
+	actual := s.getPrometheusOutput(c)
+	s.Contains(actual, `docker_flow_proxy_responses_total{service="go-demo",code="200"} 2`)
+	s.Contains(actual, `docker_flow_proxy_responses_total{service="go-demo",code="503"} 1`)
+}
+
+func (s *MetricsTestSuite) Test_ProcessLine_DoesNotRecordResponseTime_WhenNotAvailable() {
+	c := NewCollector()
+
+	c.ProcessLine(s.Lines[4])
+
+	actual := s.getPrometheusOutput(c)
+	s.NotContains(actual, `docker_flow_proxy_backend_response_time_seconds_count{service="redis"}`)
+	s.Contains(actual, `docker_flow_proxy_total_time_seconds_bucket{service="redis",le="10"} 1`)
+	s.Contains(actual, `docker_flow_proxy_total_time_seconds_bucket{service="redis",le="5"} 0`)
+	s.NotContains(actual, `docker_flow_proxy_responses_total{service="redis"`)
+}
+
+func (s *MetricsTestSuite) Test_ProcessLine_CountsDroppedLines() {
+	c := NewCollector()
+
+	c.ProcessLine(s.Lines[6])
+	c.ProcessLine(s.Lines[7])
+
+	s.Contains(s.getPrometheusOutput(c), "docker_flow_proxy_log_lines_dropped_total 2")
+}
+
+func (s *MetricsTestSuite) Test_ProcessLine_UsesServiceName() {
+	getServiceNameOrig := getServiceName
+	defer func() { getServiceName = getServiceNameOrig }()
+	getServiceName = func(backend string) string {
+		return "my-service"
+	}
+	c := NewCollector()
+
+	c.ProcessLine(s.Lines[0])
+
+	s.Contains(s.getPrometheusOutput(c), `docker_flow_proxy_responses_total{service="my-service",code="200"} 1`)
+}
+
+// RecordBytes
+
+func (s *MetricsTestSuite) Test_RecordBytes_AccumulatesBytesAcrossReloads() {
+	defer func() { backendServices.names = map[string]string{} }()
+	backendServices.names = map[string]string{"go-demo-be8080": "go-demo"}
+	c := NewCollector()
+	snapshots := [][]ServerState{
+		{{Backend: "go-demo-be8080", Server: "BACKEND", BytesIn: 100, BytesOut: 1000}},
+		{{Backend: "go-demo-be8080", Server: "BACKEND", BytesIn: 150, BytesOut: 1500}},
+		// HAProxy reloaded and its counters started from zero
+		{{Backend: "go-demo-be8080", Server: "BACKEND", BytesIn: 20, BytesOut: 200}},
+		{{Backend: "go-demo-be8080", Server: "BACKEND", BytesIn: 70, BytesOut: 700}},
+	}
+
+	for _, snapshot := range snapshots {
+		c.RecordBytes(snapshot)
+	}
+
+	actual, ok := c.GetServiceBytes("go-demo")
+	s.True(ok)
+	s.Equal(ServiceBytes{BytesIn: 220, BytesOut: 2200}, actual)
+	output := s.getPrometheusOutput(c)
+	s.Contains(output, `proxy_service_bytes_in_total{service="go-demo"} 220`)
+	s.Contains(output, `proxy_service_bytes_out_total{service="go-demo"} 2200`)
+}
+
+func (s *MetricsTestSuite) Test_RecordBytes_AccumulatesBytesOfRenamedBackendsPerService() {
+	defer func() { backendServices.names = map[string]string{} }()
+	backendServices.names = map[string]string{"go-demo-be8080": "go-demo"}
+	c := NewCollector()
+
+	c.RecordBytes([]ServerState{{Backend: "go-demo-be8080", Server: "BACKEND", BytesIn: 100, BytesOut: 1000}})
+	// The service was reconfigured with the ACL name 01-go-demo
+	backendServices.names = map[string]string{"01-go-demo-be8080": "go-demo"}
+	c.RecordBytes([]ServerState{{Backend: "01-go-demo-be8080", Server: "BACKEND", BytesIn: 30, BytesOut: 300}})
+	c.RecordBytes([]ServerState{{Backend: "01-go-demo-be8080", Server: "BACKEND", BytesIn: 50, BytesOut: 500}})
+
+	actual, _ := c.GetServiceBytes("go-demo")
+	s.Equal(ServiceBytes{BytesIn: 150, BytesOut: 1500}, actual)
+}
+
+func (s *MetricsTestSuite) Test_RecordBytes_IgnoresServers() {
+	defer func() { backendServices.names = map[string]string{} }()
+	backendServices.names = map[string]string{"go-demo-be8080": "go-demo"}
+	c := NewCollector()
+
+	c.RecordBytes([]ServerState{
+		{Backend: "go-demo-be8080", Server: "go-demo_1", BytesIn: 100, BytesOut: 1000},
+		{Backend: "go-demo-be8080", Server: "BACKEND", BytesIn: 100, BytesOut: 1000},
+	})
+
+	actual, _ := c.GetServiceBytes("go-demo")
+	s.Equal(ServiceBytes{BytesIn: 100, BytesOut: 1000}, actual)
+}
+
+func (s *MetricsTestSuite) Test_RecordBytes_IgnoresBackendsOfUnregisteredServices() {
+	c := NewCollector()
+
+	c.RecordBytes([]ServerState{{Backend: "go-demo-be8080", Server: "BACKEND", BytesIn: 100, BytesOut: 1000}})
+
+	_, ok := c.GetServiceBytes("go-demo")
+	s.False(ok)
+}
+
+func (s *MetricsTestSuite) Test_GetServiceBytes_ReturnsFalse_WhenNothingWasRecorded() {
+	_, ok := NewCollector().GetServiceBytes("go-demo")
+
+	s.False(ok)
+}
+
+// ListenSyslog
+
+func (s *MetricsTestSuite) Test_ListenSyslog_RecordsLogLinesSentOverUdp() {
+	c := NewCollector()
+	conn, err := c.ListenSyslog("127.0.0.1:0")
+	s.NoError(err)
+	defer conn.Close()
+	client, _ := net.Dial("udp", conn.LocalAddr().String())
+	defer client.Close()
+
+	for _, line := range s.Lines {
+		client.Write([]byte(line))
+	}
+
+	expected := []string{
+		`docker_flow_proxy_responses_total{service="go-demo",code="200"} 2`,
+		`docker_flow_proxy_responses_total{service="go-demo",code="500"} 1`,
+		`docker_flow_proxy_responses_total{service="go-demo",code="503"} 1`,
+		`docker_flow_proxy_responses_total{service="services",code="503"} 1`,
+		`docker_flow_proxy_total_time_seconds_count{service="redis"} 1`,
+		"docker_flow_proxy_log_lines_dropped_total 2",
+	}
+	actual := ""
+	for i := 0; i < 100; i++ {
+		actual = s.getPrometheusOutput(c)
+		if strings.Contains(actual, expected[len(expected)-1]) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, e := range expected {
+		s.Contains(actual, e)
+	}
+}
+
+func (s *MetricsTestSuite) Test_ListenSyslog_ReturnsError_WhenAddressIsInvalid() {
+	_, err := NewCollector().ListenSyslog("this-is-not-an-address")
+
+	s.Error(err)
+}
+
+// Util
+
+func (s *MetricsTestSuite) getPrometheusOutput(c *Collector) string {
+	var buf bytes.Buffer
+	c.WritePrometheus(&buf)
+	return buf.String()
+}
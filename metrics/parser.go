@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// LogEntry contains the information extracted from a single HAProxy log line
+type LogEntry struct {
+	// The name of the backend that processed the request
+	Backend string
+	// The time in milliseconds the server took to send the response headers. It is -1 if not available (e.g. tcp mode).
+	ResponseTime int
+	// The total time in milliseconds of the request or the session
+	TotalTime int
+	// The HTTP status code. It is 0 in tcp mode.
+	Status int
+}
+
+// Matches the default HTTP log format (option httplog):
+// ... [accept_date] frontend backend/server TR/Tw/Tc/Tr/Tt status bytes ...
+var httpLogRegex = regexp.MustCompile(`\] \S+ (\S+)/\S+ -?\d+/-?\d+/-?\d+/(-?\d+)/\+?(-?\d+) (-?\d+) `)
+
+// Matches the default TCP log format (option tcplog):
+// ... [accept_date] frontend backend/server Tw/Tc/Tt bytes ...
+var tcpLogRegex = regexp.MustCompile(`\] \S+ (\S+)/\S+ -?\d+/-?\d+/\+?(-?\d+) \+?\d+ `)
+
+// ParseLogLine extracts timings, status code, and backend from an HAProxy log line.
+// Both HTTP and TCP log formats are supported.
+func ParseLogLine(line string) (LogEntry, error) {
+	if m := httpLogRegex.FindStringSubmatch(line); m != nil {
+		responseTime, _ := strconv.Atoi(m[2])
+		totalTime, _ := strconv.Atoi(m[3])
+		status, _ := strconv.Atoi(m[4])
+		return LogEntry{Backend: m[1], ResponseTime: responseTime, TotalTime: totalTime, Status: status}, nil
+	}
+	if m := tcpLogRegex.FindStringSubmatch(line); m != nil {
+		totalTime, _ := strconv.Atoi(m[2])
+		return LogEntry{Backend: m[1], ResponseTime: -1, TotalTime: totalTime}, nil
+	}
+	return LogEntry{}, fmt.Errorf("Could not parse the log line %s", line)
+}
@@ -0,0 +1,81 @@
+// +build !integration
+
+package metrics
+
+import (
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+type ParserTestSuite struct {
+	suite.Suite
+	Lines []string
+}
+
+func TestParserUnitTestSuite(t *testing.T) {
+	s := new(ParserTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *ParserTestSuite) SetupTest() {
+	content, err := ioutil.ReadFile("testdata/haproxy.log")
+	s.NoError(err)
+	s.Lines = strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+// ParseLogLine
+
+func (s *ParserTestSuite) Test_ParseLogLine_ReturnsEntry_WhenHttpLogFormat() {
+	expected := LogEntry{Backend: "go-demo-be8080", ResponseTime: 25, TotalTime: 26, Status: 200}
+
+	actual, err := ParseLogLine(s.Lines[0])
+
+	s.NoError(err)
+	s.Equal(expected, actual)
+}
+
+func (s *ParserTestSuite) Test_ParseLogLine_ReturnsNegativeResponseTime_WhenConnectionFailed() {
+	expected := LogEntry{Backend: "go-demo-be8080", ResponseTime: -1, TotalTime: 3002, Status: 503}
+
+	actual, err := ParseLogLine(s.Lines[1])
+
+	s.NoError(err)
+	s.Equal(expected, actual)
+}
+
+func (s *ParserTestSuite) Test_ParseLogLine_ReturnsEntry_WhenHttpsBackend() {
+	expected := LogEntry{Backend: "https-go-demo-be8080", ResponseTime: 120, TotalTime: 121, Status: 500}
+
+	actual, err := ParseLogLine(s.Lines[2])
+
+	s.NoError(err)
+	s.Equal(expected, actual)
+}
+
+func (s *ParserTestSuite) Test_ParseLogLine_ReturnsEntry_WhenLogAsap() {
+	expected := LogEntry{Backend: "go-demo-be8080", ResponseTime: 5, TotalTime: 5, Status: 200}
+
+	actual, err := ParseLogLine(s.Lines[3])
+
+	s.NoError(err)
+	s.Equal(expected, actual)
+}
+
+func (s *ParserTestSuite) Test_ParseLogLine_ReturnsEntry_WhenTcpLogFormat() {
+	expected := LogEntry{Backend: "redis-be6379", ResponseTime: -1, TotalTime: 5003}
+
+	actual, err := ParseLogLine(s.Lines[4])
+
+	s.NoError(err)
+	s.Equal(expected, actual)
+}
+
+func (s *ParserTestSuite) Test_ParseLogLine_ReturnsError_WhenLineCannotBeParsed() {
+	for _, line := range s.Lines[6:] {
+		_, err := ParseLogLine(line)
+
+		s.Error(err)
+	}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"sync"
+)
+
+// The names of the services keyed by the names of their backends.
+// The map is rebuilt each time a reload changes the services so that log lines are mapped without locking the proxy.
+var backendServices = struct {
+	sync.RWMutex
+	names map[string]string
+}{names: map[string]string{}}
+
+var watchServicesOnce sync.Once
+
+// Starts keeping the names of the services of the backends up to date with the service change events of the proxy
+func watchServices() {
+	watchServicesOnce.Do(func() {
+		events := proxySubscribe()
+		updateBackendServices()
+		go func() {
+			for event := range events {
+				if event.Health != nil {
+					continue
+				}
+				// A reload publishes an event for each changed service. One rebuild is enough for all of them.
+				for drained := false; !drained; {
+					select {
+					case <-events:
+					default:
+						drained = true
+					}
+				}
+				updateBackendServices()
+			}
+		}()
+	})
+}
+
+func updateBackendServices() {
+	names := proxyGetBackendServiceNames()
+	backendServices.Lock()
+	defer backendServices.Unlock()
+	backendServices.names = names
+}
+
+// Returns the name of the service of the backend and whether the backend belongs to a registered service
+func lookupBackendService(backend string) (string, bool) {
+	backendServices.RLock()
+	defer backendServices.RUnlock()
+	name, ok := backendServices.names[backend]
+	return name, ok
+}
@@ -0,0 +1,71 @@
+// +build !integration
+
+package metrics
+
+import (
+	"../proxy"
+	"github.com/stretchr/testify/suite"
+	"sync"
+	"testing"
+	"time"
+)
+
+type ServicesTestSuite struct {
+	suite.Suite
+}
+
+func TestServicesUnitTestSuite(t *testing.T) {
+	s := new(ServicesTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *ServicesTestSuite) SetupTest() {
+	watchServicesOnce = sync.Once{}
+}
+
+func (s *ServicesTestSuite) TearDownTest() {
+	proxySubscribe = proxy.Subscribe
+	proxyGetBackendServiceNames = proxy.GetBackendServiceNames
+	backendServices.names = map[string]string{}
+}
+
+// getServiceName
+
+func (s *ServicesTestSuite) Test_GetServiceName_ReturnsNameOfTheServiceOfTheBackend() {
+	backendServices.names = map[string]string{"my_service-be8080": "my/service"}
+
+	s.Equal("my/service", getServiceName("my_service-be8080"))
+}
+
+func (s *ServicesTestSuite) Test_GetServiceName_ReturnsAclName_WhenBackendIsUnknown() {
+	s.Equal("go-demo", getServiceName("https-go-demo-be8080"))
+	s.Equal("stats", getServiceName("stats"))
+}
+
+// watchServices
+
+func (s *ServicesTestSuite) Test_WatchServices_RebuildsBackendServices_WhenServicesChange() {
+	events := make(chan proxy.ServiceChangeEvent, 10)
+	proxySubscribe = func() <-chan proxy.ServiceChangeEvent {
+		return events
+	}
+	names := make(chan map[string]string, 10)
+	names <- map[string]string{"go-demo-be8080": "go-demo"}
+	proxyGetBackendServiceNames = func() map[string]string {
+		return <-names
+	}
+
+	watchServices()
+
+	s.Equal("go-demo", getServiceName("go-demo-be8080"))
+	names <- map[string]string{"api-be8080": "go-demo"}
+	events <- proxy.ServiceChangeEvent{ServiceName: "go-demo"}
+	actual := ""
+	for i := 0; i < 100; i++ {
+		if actual = getServiceName("api-be8080"); actual == "go-demo" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Equal("go-demo", actual)
+}
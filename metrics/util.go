@@ -0,0 +1,15 @@
+package metrics
+
+import (
+	"../proxy"
+	"log"
+	"net"
+	"net/http"
+)
+
+var logPrintf = log.Printf
+var listenPacket = net.ListenPacket
+var httpPost = http.Post
+var proxySubscribe = proxy.Subscribe
+var proxyPublishHealthChange = proxy.PublishHealthChange
+var proxyGetBackendServiceNames = proxy.GetBackendServiceNames
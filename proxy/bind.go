@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// ValidateBindAddresses returns an error if an entry of BIND_ADDRESSES (or BIND_ADDRESS) is not an IP address or `*`.
+// IPv6 addresses can be enclosed in brackets (e.g. [::1]).
+func ValidateBindAddresses() error {
+	_, err := parseBindAddresses(getBindAddressesEnv())
+	return err
+}
+
+// Returns the bind lines of the port, one for each of the BIND_ADDRESSES, with the options appended to each of them.
+// If neither BIND_ADDRESSES nor BIND_ADDRESS is set, the port is bound on all IPv4 addresses (*).
+// If ENABLE_IPV6 is true and none of the addresses is IPv6, the port is also bound on all IPv6 addresses with the same options.
+func getBindLines(port, options string) string {
+	lines := ""
+	addresses := getBindAddresses()
+	for _, address := range addresses {
+		lines += fmt.Sprintf("\n    bind %s:%s%s", address, port, options)
+	}
+	if strings.EqualFold(os.Getenv("ENABLE_IPV6"), "true") && !hasIpv6Address(addresses) {
+		// v6only prevents the IPv6 socket from conflicting with the IPv4 one on the same port
+		lines += fmt.Sprintf("\n    bind :::%s%s v6only", port, options)
+	}
+	return lines
+}
+
+func hasIpv6Address(addresses []string) bool {
+	for _, address := range addresses {
+		if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Invalid entries are rejected when the proxy starts so the default is used only if the variable was changed afterwards
+func getBindAddresses() []string {
+	addresses, err := parseBindAddresses(getBindAddressesEnv())
+	if err != nil || len(addresses) == 0 {
+		return []string{"*"}
+	}
+	return addresses
+}
+
+// BIND_ADDRESS is the single address variant of BIND_ADDRESSES. The latter takes precedence when both are set.
+func getBindAddressesEnv() string {
+	if value := os.Getenv("BIND_ADDRESSES"); len(strings.TrimSpace(value)) > 0 {
+		return value
+	}
+	return os.Getenv("BIND_ADDRESS")
+}
+
+// HAProxy uses the last colon as the port separator so IPv6 addresses are rendered without brackets (e.g. ::1:80)
+func parseBindAddresses(value string) ([]string, error) {
+	addresses := []string{}
+	if len(strings.TrimSpace(value)) == 0 {
+		return addresses, nil
+	}
+	for _, entry := range strings.Split(value, ",") {
+		address := strings.TrimSpace(entry)
+		if strings.HasPrefix(address, "[") && strings.HasSuffix(address, "]") {
+			address = address[1 : len(address)-1]
+		}
+		if address != "*" && net.ParseIP(address) == nil {
+			return nil, fmt.Errorf("The bind address %s is invalid", strings.TrimSpace(entry))
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
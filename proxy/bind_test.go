@@ -0,0 +1,159 @@
+// +build !integration
+
+package proxy
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type BindTestSuite struct {
+	suite.Suite
+}
+
+func TestBindUnitTestSuite(t *testing.T) {
+	s := new(BindTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *BindTestSuite) TearDownTest() {
+	os.Unsetenv("BIND_ADDRESSES")
+	os.Unsetenv("BIND_ADDRESS")
+	os.Unsetenv("ENABLE_IPV6")
+}
+
+// ValidateBindAddresses
+
+func (s *BindTestSuite) Test_ValidateBindAddresses_ReturnsNil_WhenAddressesAreValid() {
+	for _, value := range []string{"", "*", "10.0.0.1,10.0.0.2", "::", "[::1], 127.0.0.1", "fe80::1"} {
+		os.Setenv("BIND_ADDRESSES", value)
+
+		s.NoError(ValidateBindAddresses(), value)
+	}
+}
+
+func (s *BindTestSuite) Test_ValidateBindAddresses_ReturnsError_WhenAddressIsMalformed() {
+	for _, value := range []string{"10.0.0.1,", "10.0.0.256", "my-host", "[::1", "::1:80:xyz", "10.0.0.1:80"} {
+		os.Setenv("BIND_ADDRESSES", value)
+
+		s.Error(ValidateBindAddresses(), value)
+	}
+}
+
+// getBindLines
+
+func (s *BindTestSuite) Test_GetBindLines_BindsOnAllAddresses_WhenBindAddressesIsNotSet() {
+	s.Equal("\n    bind *:80", getBindLines("80", ""))
+}
+
+func (s *BindTestSuite) Test_GetBindLines_AddsOptionsToEachLine() {
+	os.Setenv("BIND_ADDRESSES", "*,[::]")
+
+	actual := getBindLines("443", " ssl crt /certs/my-cert.pem")
+
+	s.Equal("\n    bind *:443 ssl crt /certs/my-cert.pem\n    bind :::443 ssl crt /certs/my-cert.pem", actual)
+}
+
+func (s *BindTestSuite) Test_GetBindLines_UsesBindAddress_WhenBindAddressesIsNotSet() {
+	os.Setenv("BIND_ADDRESS", "10.0.0.10")
+
+	s.Equal("\n    bind 10.0.0.10:80", getBindLines("80", ""))
+
+	os.Setenv("BIND_ADDRESSES", "10.0.0.1,10.0.0.2")
+
+	s.Equal("\n    bind 10.0.0.1:80\n    bind 10.0.0.2:80", getBindLines("80", ""))
+}
+
+func (s *BindTestSuite) Test_GetBindLines_AddsIpv6Line_WhenEnableIpv6IsTrue() {
+	os.Setenv("ENABLE_IPV6", "true")
+
+	s.Equal("\n    bind *:80\n    bind :::80 v6only", getBindLines("80", ""))
+
+	os.Setenv("BIND_ADDRESS", "10.0.0.10")
+
+	s.Equal("\n    bind 10.0.0.10:80\n    bind :::80 v6only", getBindLines("80", ""))
+}
+
+func (s *BindTestSuite) Test_GetBindLines_DoesNotAddIpv6Line_WhenBindAddressesContainIpv6Address() {
+	os.Setenv("ENABLE_IPV6", "true")
+	os.Setenv("BIND_ADDRESSES", "10.0.0.10,[fe80::1]")
+
+	s.Equal("\n    bind 10.0.0.10:80\n    bind fe80::1:80", getBindLines("80", ""))
+}
+
+func (s *BindTestSuite) Test_ValidateBindAddresses_ReturnsError_WhenBindAddressIsMalformed() {
+	os.Setenv("BIND_ADDRESS", "my-host")
+
+	s.Error(ValidateBindAddresses())
+}
+
+// Frontends
+
+func (s *BindTestSuite) Test_GetConfigData_BindsServicesFrontendOnBindAddress() {
+	defer os.Unsetenv("BIND_PORTS")
+	os.Setenv("BIND_ADDRESS", "10.0.0.10")
+	os.Setenv("BIND_PORTS", "8080")
+
+	actual := HaProxy{}.getConfigData(map[string]bool{})
+
+	s.Equal("\n    bind 10.0.0.10:80\n    bind 10.0.0.10:443", actual.BindServices)
+	s.Contains(actual.ExtraFrontend, "\n    bind 10.0.0.10:8080")
+	s.NotContains(actual.BindServices+actual.ExtraFrontend, "*:")
+}
+
+func (s *BindTestSuite) Test_RenderFrontend_BindsTcpFrontendOnBindAddress() {
+	os.Setenv("BIND_ADDRESS", "10.0.0.10")
+	sr := Service{
+		ServiceName: "my-db",
+		ReqMode:     "tcp",
+		ServiceDest: []ServiceDest{{Port: "5432", SrcPort: 5432}},
+	}
+
+	actual := haProxy17Renderer{}.RenderFrontend(sr)
+
+	s.Contains(actual, "frontend my-db_5432\n    bind 10.0.0.10:5432\n")
+	s.NotContains(actual, "*:")
+}
+
+func (s *BindTestSuite) Test_GetConfigData_AppliesCertsToBothAddressFamilies_WhenEnableIpv6IsTrue() {
+	defer os.Unsetenv("BIND_PORTS")
+	dataOrig := data
+	defer func() { data = dataOrig }()
+	data = Data{Certs: map[string]bool{"my-cert.pem": true}, Services: map[string]Service{}}
+	os.Setenv("ENABLE_IPV6", "true")
+	os.Setenv("BIND_PORTS", "8080")
+
+	actual := HaProxy{}.getConfigData(map[string]bool{})
+
+	s.Equal(`
+    bind *:80
+    bind :::80 v6only
+    bind *:443 ssl crt /certs/my-cert.pem
+    bind :::443 ssl crt /certs/my-cert.pem v6only`, actual.BindServices)
+	s.Contains(actual.ExtraFrontend, "\n    bind *:8080\n    bind :::8080 v6only")
+}
+
+func (s *BindTestSuite) Test_RenderFrontend_BindsTcpFrontendOnIpv6_WhenEnableIpv6IsTrue() {
+	os.Setenv("ENABLE_IPV6", "true")
+	sr := Service{
+		ServiceName: "my-db",
+		ReqMode:     "tcp",
+		ServiceDest: []ServiceDest{{Port: "5432", SrcPort: 5432}},
+	}
+
+	actual := haProxy17Renderer{}.RenderFrontend(sr)
+
+	s.Contains(actual, "frontend my-db_5432\n    bind *:5432\n    bind :::5432 v6only\n")
+}
+
+// getHealthcheck
+
+func (s *BindTestSuite) Test_GetHealthcheck_BindsOnEachAddress() {
+	os.Setenv("BIND_ADDRESSES", "10.0.0.1,::1")
+
+	actual := HaProxy{}.getHealthcheck("8081")
+
+	s.Contains(actual, "frontend healthcheck\n    bind 10.0.0.1:8081\n    bind ::1:8081\n    mode http")
+}
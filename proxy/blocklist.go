@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StartBlocklistRefresher downloads the list of blocked networks from BLOCKLIST_URL into BLOCKLIST_PATH
+// and keeps refreshing it every BLOCKLIST_REFRESH_INTERVAL seconds.
+// The first download is performed before the function returns so that the file exists when the proxy starts.
+func StartBlocklistRefresher() error {
+	interval := 3600
+	if len(os.Getenv("BLOCKLIST_REFRESH_INTERVAL")) > 0 {
+		value, err := strconv.Atoi(os.Getenv("BLOCKLIST_REFRESH_INTERVAL"))
+		if err != nil || value <= 0 {
+			return fmt.Errorf("BLOCKLIST_REFRESH_INTERVAL must be a positive number of seconds")
+		}
+		interval = value
+	}
+	url := os.Getenv("BLOCKLIST_URL")
+	path := os.Getenv("BLOCKLIST_PATH")
+	if len(path) == 0 {
+		return fmt.Errorf("BLOCKLIST_PATH must be set when BLOCKLIST_URL is used")
+	}
+	if _, err := downloadBlocklist(url, path); err != nil {
+		logPrintf("Could not download the blocklist from %s\n%s", url, err.Error())
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if err := writeFile(path, []byte{}, 0664); err != nil {
+				return err
+			}
+		}
+	}
+	go func() {
+		for range time.Tick(time.Duration(interval) * time.Second) {
+			if err := (HaProxy{}).RefreshBlocklist(url, path); err != nil {
+				logPrintf("Could not refresh the blocklist\n%s", err.Error())
+			}
+		}
+	}()
+	return nil
+}
+
+// RefreshBlocklist downloads the list of blocked networks and applies it to the running proxy.
+// The list is applied through the runtime socket when it is available and through a reload otherwise.
+func (m HaProxy) RefreshBlocklist(url, path string) error {
+	networks, err := downloadBlocklist(url, path)
+	if err != nil {
+		return err
+	}
+	if _, err := statFile(haproxySocketPath); err == nil {
+		err := m.applyBlocklist(path, networks)
+		if err == nil {
+			logPrintf("Applied %d blocked networks through the runtime socket", len(networks))
+			return nil
+		}
+		logPrintf("Could not apply the blocklist through the runtime socket\n%s", err.Error())
+	}
+	return m.Reload()
+}
+
+func (m HaProxy) applyBlocklist(path string, networks []string) error {
+	if err := sendRuntimeCommand(haproxySocketPath, fmt.Sprintf("clear acl %s", path)); err != nil {
+		return err
+	}
+	for _, network := range networks {
+		if err := sendRuntimeCommand(haproxySocketPath, fmt.Sprintf("add acl %s %s", path, network)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Downloads the list, skipping invalid entries, and replaces the file atomically
+func downloadBlocklist(url, path string) ([]string, error) {
+	resp, err := httpGet(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("The blocklist request failed with status %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	networks := parseBlocklist(string(body))
+	tmpPath := path + ".tmp"
+	content := ""
+	if len(networks) > 0 {
+		content = strings.Join(networks, "\n") + "\n"
+	}
+	if err := writeFile(tmpPath, []byte(content), 0664); err != nil {
+		return nil, err
+	}
+	if err := renameFile(tmpPath, path); err != nil {
+		return nil, err
+	}
+	return networks, nil
+}
+
+// Returns valid CIDRs and IPs from the content. Empty lines and comments (#) are ignored.
+func parseBlocklist(content string) []string {
+	networks := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(line); err != nil && net.ParseIP(line) == nil {
+			logPrintf("Skipping the blocklist entry %s since it is not a valid CIDR or IP", line)
+			continue
+		}
+		networks = append(networks, line)
+	}
+	return networks
+}
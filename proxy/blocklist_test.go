@@ -0,0 +1,183 @@
+// +build !integration
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type BlocklistTestSuite struct {
+	suite.Suite
+	SocketPath string
+	Files      map[string]string
+	Commands   []string
+	ReloadArgs []string
+}
+
+func TestBlocklistUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	validateConfig = func(content string) error { return nil }
+	s := new(BlocklistTestSuite)
+	suite.Run(t, s)
+}
+
+var sendRuntimeCommandOrig = sendRuntimeCommand
+
+func (s *BlocklistTestSuite) SetupTest() {
+	os.Setenv("BLOCKLIST_PATH", "/cfg/blocklist.lst")
+	readPidFile = func(fileName string) ([]byte, error) {
+		return []byte("123"), nil
+	}
+	s.Files = map[string]string{}
+	s.Commands = []string{}
+	s.ReloadArgs = []string{}
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		s.Files[filename] = string(data)
+		return nil
+	}
+	renameFile = func(oldpath, newpath string) error {
+		s.Files[newpath] = s.Files[oldpath]
+		delete(s.Files, oldpath)
+		return nil
+	}
+	httpGet = func(url string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString("# blocked\n10.0.0.0/8\n\n1.2.3.4 # single\nnot-an-ip\n")),
+		}, nil
+	}
+	sendRuntimeCommand = func(socket, command string) error {
+		s.Commands = append(s.Commands, command)
+		return nil
+	}
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		s.ReloadArgs = cmd.Args
+		return nil
+	}
+	socket, _ := ioutil.TempFile("", "haproxy-sock")
+	s.SocketPath = socket.Name()
+	haproxySocketPath = s.SocketPath
+}
+
+func (s *BlocklistTestSuite) TearDownTest() {
+	os.Unsetenv("BLOCKLIST_PATH")
+	os.Remove(s.SocketPath)
+	haproxySocketPath = "/var/run/haproxy.sock"
+	writeFile = ioutil.WriteFile
+	renameFile = os.Rename
+	httpGet = http.Get
+	sendRuntimeCommand = sendRuntimeCommandOrig
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return cmd.Run()
+	}
+}
+
+// CreateConfigFromTemplates
+
+func (s *BlocklistTestSuite) Test_CreateConfigFromTemplates_DeniesBlockedNetworks() {
+	dataOrig := data
+	defer func() { data = dataOrig }()
+	data.Services = map[string]Service{}
+
+	NewHaProxy("test_configs/tmpl", "test_configs", map[string]bool{}).CreateConfigFromTemplates()
+
+	s.Contains(s.Files["test_configs/haproxy.cfg"], "\n    http-request deny deny_status 403 if { src -f /cfg/blocklist.lst }\n")
+}
+
+func (s *BlocklistTestSuite) Test_CreateConfigFromTemplates_DeniesBlockedNetworksAfterSettingTheSource() {
+	dataOrig := data
+	defer func() {
+		data = dataOrig
+		os.Unsetenv("TRUSTED_PROXY_NETWORKS")
+	}()
+	data.Services = map[string]Service{}
+	os.Setenv("TRUSTED_PROXY_NETWORKS", "10.0.0.0/8")
+
+	NewHaProxy("test_configs/tmpl", "test_configs", map[string]bool{}).CreateConfigFromTemplates()
+
+	s.Contains(s.Files["test_configs/haproxy.cfg"], `    http-request set-src hdr_ip(X-Forwarded-For,-1) if { src 10.0.0.0/8 }
+    http-request deny deny_status 403 if { src -f /cfg/blocklist.lst }`)
+}
+
+// RefreshBlocklist
+
+func (s *BlocklistTestSuite) Test_RefreshBlocklist_WritesValidNetworks() {
+	HaProxy{}.RefreshBlocklist("http://lists.acme.com", "/cfg/blocklist.lst")
+
+	s.Equal(map[string]string{"/cfg/blocklist.lst": "10.0.0.0/8\n1.2.3.4\n"}, s.Files)
+}
+
+func (s *BlocklistTestSuite) Test_RefreshBlocklist_AppliesNetworksThroughTheSocketWithoutReload() {
+	err := HaProxy{}.RefreshBlocklist("http://lists.acme.com", "/cfg/blocklist.lst")
+
+	s.NoError(err)
+	s.Equal([]string{
+		"clear acl /cfg/blocklist.lst",
+		"add acl /cfg/blocklist.lst 10.0.0.0/8",
+		"add acl /cfg/blocklist.lst 1.2.3.4",
+	}, s.Commands)
+	s.Empty(s.ReloadArgs)
+}
+
+func (s *BlocklistTestSuite) Test_RefreshBlocklist_Reloads_WhenSocketDoesNotExist() {
+	haproxySocketPath = "/this/socket/does/not/exist"
+
+	err := HaProxy{}.RefreshBlocklist("http://lists.acme.com", "/cfg/blocklist.lst")
+
+	s.NoError(err)
+	s.Empty(s.Commands)
+	s.Contains(strings.Join(s.ReloadArgs, " "), "-sf 123")
+}
+
+func (s *BlocklistTestSuite) Test_RefreshBlocklist_Reloads_WhenSocketCommandFails() {
+	sendRuntimeCommand = func(socket, command string) error {
+		return fmt.Errorf("This is an error")
+	}
+
+	err := HaProxy{}.RefreshBlocklist("http://lists.acme.com", "/cfg/blocklist.lst")
+
+	s.NoError(err)
+	s.Contains(strings.Join(s.ReloadArgs, " "), "-sf 123")
+}
+
+func (s *BlocklistTestSuite) Test_RefreshBlocklist_ReturnsError_WhenDownloadFails() {
+	httpGet = func(url string) (*http.Response, error) {
+		return &http.Response{StatusCode: 500, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil
+	}
+
+	err := HaProxy{}.RefreshBlocklist("http://lists.acme.com", "/cfg/blocklist.lst")
+
+	s.Error(err)
+	s.Empty(s.Files)
+	s.Empty(s.ReloadArgs)
+}
+
+// StartBlocklistRefresher
+
+func (s *BlocklistTestSuite) Test_StartBlocklistRefresher_CreatesEmptyFile_WhenDownloadFailsAndFileDoesNotExist() {
+	os.Setenv("BLOCKLIST_PATH", "/this/file/does/not/exist.lst")
+	httpGet = func(url string) (*http.Response, error) {
+		return nil, fmt.Errorf("This is an error")
+	}
+
+	err := StartBlocklistRefresher()
+
+	s.NoError(err)
+	s.Equal(map[string]string{"/this/file/does/not/exist.lst": ""}, s.Files)
+}
+
+func (s *BlocklistTestSuite) Test_StartBlocklistRefresher_ReturnsError_WhenIntervalIsInvalid() {
+	defer os.Unsetenv("BLOCKLIST_REFRESH_INTERVAL")
+	os.Setenv("BLOCKLIST_REFRESH_INTERVAL", "abc")
+
+	s.Error(StartBlocklistRefresher())
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Whether the domains of certificates should be added to the services they belong to
+func isAutoDomainFromCert() bool {
+	return strings.EqualFold(os.Getenv("AUTO_DOMAIN_FROM_CERT"), "true")
+}
+
+// Returns the DNS names (SANs) of the first certificate stored in the file.
+// If the certificate has no SANs, its common name is used instead.
+func (m HaProxy) getCertDomains(certName string) []string {
+	content, err := ReadFile(fmt.Sprintf("/certs/%s", certName))
+	if err != nil {
+		logPrintf("Could not read the certificate %s\n%s", certName, err.Error())
+		return []string{}
+	}
+	for {
+		block, rest := pem.Decode(content)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				logPrintf("Could not parse the certificate %s\n%s", certName, err.Error())
+				return []string{}
+			}
+			if len(cert.DNSNames) > 0 {
+				return cert.DNSNames
+			} else if len(cert.Subject.CommonName) > 0 {
+				return []string{cert.Subject.CommonName}
+			}
+			return []string{}
+		}
+		content = rest
+	}
+	return []string{}
+}
+
+// Returns the domains that belong to the service.
+// A domain belongs to the service if its first label matches the name or the cert domain alias of the service.
+// Wildcard domains (e.g. *.example.com) belong only to services with the cert domain alias (e.g. api.example.com).
+func (m HaProxy) getServiceCertDomains(service Service, certDomains []string) []string {
+	domains := []string{}
+	for _, certDomain := range certDomains {
+		labels := strings.SplitN(certDomain, ".", 2)
+		if len(labels) < 2 {
+			continue
+		}
+		if labels[0] == "*" {
+			if len(service.CertDomainAlias) > 0 {
+				domains = append(domains, fmt.Sprintf("%s.%s", service.CertDomainAlias, labels[1]))
+			}
+		} else if strings.EqualFold(labels[0], service.ServiceName) || strings.EqualFold(labels[0], service.CertDomainAlias) {
+			domains = append(domains, certDomain)
+		}
+	}
+	return domains
+}
+
+// Adds the domains of the certificate that belong to the service to its ServiceDomain.
+// Only the domains that were not already present are added and recorded in CertDomains,
+// so that they can be removed together with the certificate.
+func (m HaProxy) addCertDomains(service Service, certName string, certDomains []string) Service {
+	added := []string{}
+	serviceDomain := append([]string{}, service.ServiceDomain...)
+	for _, domain := range m.getServiceCertDomains(service, certDomains) {
+		exists := false
+		for _, existing := range serviceDomain {
+			if strings.EqualFold(existing, domain) {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			serviceDomain = append(serviceDomain, domain)
+			added = append(added, domain)
+		}
+	}
+	if len(added) > 0 {
+		logPrintf("Adding the domains %s from the certificate %s to the service %s", added, certName, service.ServiceName)
+		certDomainsMap := map[string][]string{}
+		for key, value := range service.CertDomains {
+			certDomainsMap[key] = value
+		}
+		certDomainsMap[certName] = added
+		service.CertDomains = certDomainsMap
+		service.ServiceDomain = serviceDomain
+	}
+	return service
+}
+
+// Removes the domains added from the certificate from the service
+func (m HaProxy) removeCertDomains(service Service, certName string) Service {
+	removed, ok := service.CertDomains[certName]
+	if !ok {
+		return service
+	}
+	serviceDomain := []string{}
+	for _, domain := range service.ServiceDomain {
+		keep := true
+		for _, r := range removed {
+			if strings.EqualFold(domain, r) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			serviceDomain = append(serviceDomain, domain)
+		}
+	}
+	certDomainsMap := map[string][]string{}
+	for key, value := range service.CertDomains {
+		if key != certName {
+			certDomainsMap[key] = value
+		}
+	}
+	service.CertDomains = certDomainsMap
+	service.ServiceDomain = serviceDomain
+	return service
+}
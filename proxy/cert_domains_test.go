@@ -0,0 +1,127 @@
+// +build !integration
+
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CertDomainsTestSuite struct {
+	suite.Suite
+	CertFiles map[string][]byte
+}
+
+func TestCertDomainsUnitTestSuite(t *testing.T) {
+	s := new(CertDomainsTestSuite)
+	logPrintf = func(format string, v ...interface{}) {}
+	suite.Run(t, s)
+}
+
+func (s *CertDomainsTestSuite) SetupTest() {
+	os.Setenv("AUTO_DOMAIN_FROM_CERT", "true")
+	s.CertFiles = map[string][]byte{
+		"api.example.com.pem": s.createCert("api.example.com", "api.example.org"),
+		"wildcard.pem":        s.createCert("*.example.net"),
+	}
+	ReadFile = func(filename string) ([]byte, error) {
+		return s.CertFiles[filename[len("/certs/"):]], nil
+	}
+}
+
+func (s *CertDomainsTestSuite) TearDownTest() {
+	os.Unsetenv("AUTO_DOMAIN_FROM_CERT")
+	ReadFile = ioutil.ReadFile
+}
+
+// AddCert
+
+func (s *CertDomainsTestSuite) Test_AddCert_AddsCertDomainsToServiceWithMatchingName() {
+	p := NewHaProxy("anything", "doesn't", map[string]bool{}).(HaProxy)
+	p.AddService(Service{ServiceName: "api", ServiceDomain: []string{"my-domain.com"}})
+	p.AddService(Service{ServiceName: "web"})
+
+	p.AddCert("api.example.com.pem")
+
+	s.Equal([]string{"my-domain.com", "api.example.com", "api.example.org"}, data.Services["api"].ServiceDomain)
+	s.Equal(
+		map[string][]string{"api.example.com.pem": {"api.example.com", "api.example.org"}},
+		data.Services["api"].CertDomains,
+	)
+	s.Empty(data.Services["web"].ServiceDomain)
+}
+
+func (s *CertDomainsTestSuite) Test_AddCert_AddsCertDomainsToServiceWithMatchingAlias() {
+	p := NewHaProxy("anything", "doesn't", map[string]bool{}).(HaProxy)
+	p.AddService(Service{ServiceName: "api-v2", CertDomainAlias: "api"})
+	p.AddService(Service{ServiceName: "web", CertDomainAlias: "www"})
+
+	p.AddCert("api.example.com.pem")
+	p.AddCert("wildcard.pem")
+
+	s.Equal([]string{"api.example.com", "api.example.org", "api.example.net"}, data.Services["api-v2"].ServiceDomain)
+	s.Equal([]string{"www.example.net"}, data.Services["web"].ServiceDomain)
+}
+
+func (s *CertDomainsTestSuite) Test_AddCert_DoesNotAddDomains_WhenAutoDomainFromCertIsNotSet() {
+	os.Unsetenv("AUTO_DOMAIN_FROM_CERT")
+	p := NewHaProxy("anything", "doesn't", map[string]bool{}).(HaProxy)
+	p.AddService(Service{ServiceName: "api"})
+
+	p.AddCert("api.example.com.pem")
+
+	s.Empty(data.Services["api"].ServiceDomain)
+}
+
+// AddService
+
+func (s *CertDomainsTestSuite) Test_AddService_AddsDomainsOfExistingCerts() {
+	p := NewHaProxy("anything", "doesn't", map[string]bool{}).(HaProxy)
+	p.AddCert("api.example.com.pem")
+
+	p.AddService(Service{ServiceName: "api", ServiceDomain: []string{"api.example.com"}})
+
+	s.Equal([]string{"api.example.com", "api.example.org"}, data.Services["api"].ServiceDomain)
+	s.Equal(map[string][]string{"api.example.com.pem": {"api.example.org"}}, data.Services["api"].CertDomains)
+}
+
+// RemoveCert
+
+func (s *CertDomainsTestSuite) Test_RemoveCert_RemovesCertDomains() {
+	p := NewHaProxy("anything", "doesn't", map[string]bool{}).(HaProxy)
+	p.AddService(Service{ServiceName: "api", ServiceDomain: []string{"my-domain.com"}})
+	p.AddCert("api.example.com.pem")
+
+	p.RemoveCert("api.example.com.pem")
+
+	s.Equal([]string{"my-domain.com"}, data.Services["api"].ServiceDomain)
+	s.Empty(data.Services["api"].CertDomains)
+	s.NotContains(data.Certs, "api.example.com.pem")
+}
+
+// Util
+
+func (s *CertDomainsTestSuite) createCert(dnsNames ...string) []byte {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	s.NoError(err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
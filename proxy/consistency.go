@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ConfigHash identifies the configuration rendered by an instance of the proxy.
+// Instances with the same hashes serve the same configuration for the same services.
+type ConfigHash struct {
+	// The SHA-256 of haproxy.cfg without comments
+	Config string
+	// The SHA-256 of the snippet hashes of the registered services
+	Services string
+}
+
+// GetConfigHash returns the hashes of the configuration and of the services rendered by the renderer.
+// Comments are removed from the configuration before it is hashed since they do not change the behavior of the proxy
+// and may contain information specific to an instance.
+func GetConfigHash(renderer ConfigRenderer, config string, services map[string]Service) ConfigHash {
+	names := []string{}
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	catalog := []string{}
+	for _, name := range names {
+		catalog = append(catalog, name+"="+ServiceSnippetHash(renderer, services[name]))
+	}
+	return ConfigHash{
+		Config:   fmt.Sprintf("%x", sha256.Sum256([]byte(stripConfigComments(config)))),
+		Services: fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(catalog, "\n")))),
+	}
+}
+
+// Removes comment lines and trailing whitespace
+func stripConfigComments(config string) string {
+	lines := []string{}
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
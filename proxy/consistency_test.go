@@ -0,0 +1,48 @@
+// +build !integration
+
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ConsistencyTestSuite struct {
+	suite.Suite
+}
+
+func TestConsistencyUnitTestSuite(t *testing.T) {
+	s := new(ConsistencyTestSuite)
+	suite.Run(t, s)
+}
+
+// GetConfigHash
+
+func (s *ConsistencyTestSuite) Test_GetConfigHash_IgnoresComments() {
+	services := map[string]Service{"my-service": {ServiceName: "my-service"}}
+
+	expected := GetConfigHash(haProxy17Renderer{}, "global\n    maxconn 5000\n", services)
+	actual := GetConfigHash(haProxy17Renderer{}, "# Generated on instance 1\nglobal\n    # comment\n    maxconn 5000   \n", services)
+
+	s.Equal(expected, actual)
+}
+
+func (s *ConsistencyTestSuite) Test_GetConfigHash_ChangesWhenConfigChanges() {
+	expected := GetConfigHash(haProxy17Renderer{}, "global\n    maxconn 5000\n", nil)
+	actual := GetConfigHash(haProxy17Renderer{}, "global\n    maxconn 6000\n", nil)
+
+	s.NotEqual(expected.Config, actual.Config)
+	s.Equal(expected.Services, actual.Services)
+}
+
+func (s *ConsistencyTestSuite) Test_GetConfigHash_ChangesWhenServiceChanges() {
+	services := map[string]Service{"my-service": {ServiceName: "my-service", PathType: "path_beg"}}
+	changed := map[string]Service{"my-service": {ServiceName: "my-service", PathType: "path_reg"}}
+
+	expected := GetConfigHash(haProxy17Renderer{}, "", services)
+	actual := GetConfigHash(haProxy17Renderer{}, "", changed)
+
+	s.Equal(expected.Config, actual.Config)
+	s.NotEqual(expected.Services, actual.Services)
+}
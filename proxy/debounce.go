@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// The reload scheduled by the first request of a batch. Reloads requested until it runs join it.
+var reloadDebounce = struct {
+	sync.Mutex
+	scheduled bool
+	requests  int
+	// Whether every request of the batch changed only the domains applied through the runtime socket
+	skippable bool
+}{}
+
+// Serializes the reloads of consecutive batches
+var reloadFlushMu sync.Mutex
+
+// Returns the duration reloads are delayed by so that bursts of requests produce a single reload.
+// It is defined through RELOAD_DEBOUNCE_INTERVAL (e.g. 2s or 500ms, or a number of seconds).
+// Reloads are not delayed if it is not set or is invalid.
+func getReloadDebounceInterval() time.Duration {
+	value := os.Getenv("RELOAD_DEBOUNCE_INTERVAL")
+	if len(value) == 0 {
+		return 0
+	}
+	interval, err := parseDuration(value)
+	if err != nil || interval < 0 {
+		logPrintf("The reload debounce interval %s is not valid. Reloads are not delayed.", value)
+		return 0
+	}
+	return interval
+}
+
+// Adds the request to the batch, scheduling the reload if it is the first one.
+// The reload runs once the interval since the first request expires, even if requests keep coming.
+func (m HaProxy) scheduleReload(interval time.Duration, skippable bool) {
+	reloadDebounce.Lock()
+	defer reloadDebounce.Unlock()
+	reloadDebounce.requests++
+	if reloadDebounce.scheduled {
+		reloadDebounce.skippable = reloadDebounce.skippable && skippable
+		return
+	}
+	reloadDebounce.scheduled = true
+	reloadDebounce.skippable = skippable
+	afterFunc(interval, m.flushReload)
+}
+
+// Runs the reload of the batch
+func (m HaProxy) flushReload() {
+	reloadDebounce.Lock()
+	requests, skippable := reloadDebounce.requests, reloadDebounce.skippable
+	reloadDebounce.scheduled = false
+	reloadDebounce.requests = 0
+	reloadDebounce.Unlock()
+	if requests > 1 {
+		logPrintf("Reloading the proxy once for %d requests", requests)
+	}
+	reloadFlushMu.Lock()
+	defer reloadFlushMu.Unlock()
+	if err := m.reload(skippable); err != nil {
+		logPrintf("ERROR: The delayed reload of the proxy failed\n%s", err.Error())
+	}
+}
@@ -0,0 +1,159 @@
+// +build !integration
+
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type DebounceTestSuite struct {
+	suite.Suite
+	Path      string
+	Reloads   int
+	Timers    []func()
+	Durations []time.Duration
+	dataOrig  Data
+}
+
+func TestDebounceUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(DebounceTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *DebounceTestSuite) SetupTest() {
+	os.Setenv("RELOAD_DEBOUNCE_INTERVAL", "2s")
+	s.Path, _ = ioutil.TempDir("", "debounce")
+	ioutil.WriteFile(s.Path+"/haproxy.tmpl", []byte("frontend services{{.ContentFrontend}}"), 0644)
+	s.dataOrig = data
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{}}
+	s.Reloads = 0
+	s.Timers = []func(){}
+	s.Durations = []time.Duration{}
+	validateConfig = func(content string) error { return nil }
+	readPidFile = func(fileName string) ([]byte, error) { return []byte("1"), nil }
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		s.Reloads++
+		return nil
+	}
+	afterFunc = func(d time.Duration, f func()) func() bool {
+		s.Timers = append(s.Timers, f)
+		s.Durations = append(s.Durations, d)
+		return func() bool { return true }
+	}
+	writeFile = ioutil.WriteFile
+	ReadFile = ioutil.ReadFile
+	readConfigsDir = ioutil.ReadDir
+	readConfigsFile = ioutil.ReadFile
+}
+
+func (s *DebounceTestSuite) TearDownTest() {
+	os.Unsetenv("RELOAD_DEBOUNCE_INTERVAL")
+	os.RemoveAll(s.Path)
+	data = s.dataOrig
+	validateConfig = validateConfigOrig
+	readPidFile = ioutil.ReadFile
+	afterFunc = afterFuncOrig
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return cmd.Run()
+	}
+}
+
+func (s *DebounceTestSuite) addService(haproxy HaProxy, name string) {
+	s.Require().NoError(haproxy.AddService(Service{
+		ServiceName: name,
+		ServiceDest: []ServiceDest{{Port: "8080", ServicePath: []string{"/" + name}}},
+	}))
+	s.Require().NoError(haproxy.CreateConfigFromTemplates())
+	s.Require().NoError(haproxy.Reload())
+}
+
+// Reload
+
+func (s *DebounceTestSuite) Test_Reload_CoalescesRequestsWithinInterval() {
+	haproxy := HaProxy{TemplatesPath: s.Path, ConfigsPath: s.Path}
+
+	for i := 1; i <= 30; i++ {
+		s.addService(haproxy, fmt.Sprintf("service-%d", i))
+	}
+
+	s.Equal(0, s.Reloads)
+	s.Require().Len(s.Timers, 1)
+	s.Equal(2*time.Second, s.Durations[0])
+
+	s.Timers[0]()
+
+	s.Equal(1, s.Reloads)
+	config, _ := ioutil.ReadFile(s.Path + "/haproxy.cfg")
+	s.Contains(string(config), "acl url_service-308080")
+}
+
+func (s *DebounceTestSuite) Test_Reload_SchedulesNewReload_AfterPreviousOneRan() {
+	haproxy := HaProxy{TemplatesPath: s.Path, ConfigsPath: s.Path}
+	s.addService(haproxy, "service-1")
+	s.Timers[0]()
+
+	s.addService(haproxy, "service-2")
+	s.addService(haproxy, "service-3")
+
+	s.Require().Len(s.Timers, 2)
+	s.Timers[1]()
+	s.Equal(2, s.Reloads)
+}
+
+func (s *DebounceTestSuite) Test_Reload_ReloadsImmediately_WhenIntervalIsNotSet() {
+	os.Unsetenv("RELOAD_DEBOUNCE_INTERVAL")
+	haproxy := HaProxy{TemplatesPath: s.Path, ConfigsPath: s.Path}
+
+	s.addService(haproxy, "service-1")
+	s.addService(haproxy, "service-2")
+
+	s.Empty(s.Timers)
+	s.Equal(2, s.Reloads)
+}
+
+func (s *DebounceTestSuite) Test_Reload_ReloadsImmediately_WhenIntervalIsInvalid() {
+	os.Setenv("RELOAD_DEBOUNCE_INTERVAL", "soon")
+	haproxy := HaProxy{TemplatesPath: s.Path, ConfigsPath: s.Path}
+
+	s.addService(haproxy, "service-1")
+
+	s.Empty(s.Timers)
+	s.Equal(1, s.Reloads)
+}
+
+// ReloadAfter
+
+func (s *DebounceTestSuite) Test_ReloadAfter_StaggersReloadsOfInstances() {
+	os.Unsetenv("RELOAD_DEBOUNCE_INTERVAL")
+	haproxy := HaProxy{TemplatesPath: s.Path, ConfigsPath: s.Path}
+
+	for i := 0; i < 3; i++ {
+		s.Require().NoError(haproxy.ReloadAfter(time.Duration(i) * 2 * time.Second))
+		for _, timer := range s.Timers {
+			timer()
+		}
+		s.Timers = []func(){}
+	}
+
+	s.Equal(3, s.Reloads)
+	s.Equal([]time.Duration{2 * time.Second, 4 * time.Second}, s.Durations)
+}
+
+func (s *DebounceTestSuite) Test_ReloadAfter_AddsDelayToDebounceInterval() {
+	haproxy := HaProxy{TemplatesPath: s.Path, ConfigsPath: s.Path}
+
+	s.Require().NoError(haproxy.ReloadAfter(4 * time.Second))
+
+	s.Equal(0, s.Reloads)
+	s.Equal([]time.Duration{6 * time.Second}, s.Durations)
+	s.Timers[0]()
+	s.Equal(1, s.Reloads)
+}
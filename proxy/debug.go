@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DebugState is a snapshot of the internal state of the proxy used when diagnosing performance issues
+type DebugState struct {
+	Goroutines               int
+	Services                 int
+	QuarantinedServices      int
+	Certs                    int
+	IdempotencyEntries       int
+	ServiceChangeSubscribers int
+	// The changes recovered from the previous run that were not applied
+	PendingChanges int
+	// The durations of the last configuration generation and reload in milliseconds
+	LastGenerationMs int64
+	LastReloadMs     int64
+	LastGenerationAt time.Time
+	LastReloadAt     time.Time
+	// The warnings HAProxy printed during the last reload
+	ReloadWarnings []string
+	// The issues of the base template found when the proxy started
+	TemplateLintWarnings []TemplateLintWarning
+}
+
+// The durations and the warnings are guarded separately from data so that recording them does not wait for the generation to finish
+var durations = struct {
+	sync.Mutex
+	lastGeneration   time.Duration
+	lastReload       time.Duration
+	lastGenerationAt time.Time
+	lastReloadAt     time.Time
+	reloadWarnings   []string
+}{}
+
+// DebugState returns the snapshot of the internal state.
+// The data lock is held only while the services and certificates are counted.
+func (m HaProxy) DebugState() DebugState {
+	state := DebugState{
+		Goroutines:         runtime.NumGoroutine(),
+		IdempotencyEntries: Idempotency.Len(),
+	}
+	dataMu.RLock()
+	state.Services = len(data.Services)
+	state.Certs = len(data.Certs)
+	for _, s := range data.Services {
+		if s.Quarantined {
+			state.QuarantinedServices++
+		}
+	}
+	dataMu.RUnlock()
+	serviceChanges.Lock()
+	state.ServiceChangeSubscribers = len(serviceChanges.subscribers)
+	serviceChanges.Unlock()
+	pending.Lock()
+	state.PendingChanges = len(pending.recovered)
+	pending.Unlock()
+	durations.Lock()
+	state.LastGenerationMs = int64(durations.lastGeneration / time.Millisecond)
+	state.LastReloadMs = int64(durations.lastReload / time.Millisecond)
+	state.LastGenerationAt = durations.lastGenerationAt
+	state.LastReloadAt = durations.lastReloadAt
+	state.ReloadWarnings = append([]string{}, durations.reloadWarnings...)
+	durations.Unlock()
+	state.TemplateLintWarnings = GetTemplateLintWarnings()
+	return state
+}
+
+// Records the duration of a configuration generation that started at the specified time
+func recordGenerationDuration(start time.Time) {
+	durations.Lock()
+	defer durations.Unlock()
+	durations.lastGenerationAt = timeNow()
+	durations.lastGeneration = durations.lastGenerationAt.Sub(start)
+}
+
+// Records the duration of a reload that started at the specified time
+func recordReloadDuration(start time.Time) {
+	durations.Lock()
+	defer durations.Unlock()
+	durations.lastReloadAt = timeNow()
+	durations.lastReload = durations.lastReloadAt.Sub(start)
+}
@@ -0,0 +1,65 @@
+// +build !integration
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type DebugTestSuite struct {
+	suite.Suite
+	dataOrig Data
+}
+
+func TestDebugUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(DebugTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *DebugTestSuite) SetupTest() {
+	s.dataOrig = data
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{}}
+}
+
+func (s *DebugTestSuite) TearDownTest() {
+	data = s.dataOrig
+	timeNow = time.Now
+}
+
+// DebugState
+
+func (s *DebugTestSuite) Test_DebugState_ReturnsCounts() {
+	data.Services["service-1"] = Service{ServiceName: "service-1"}
+	data.Services["service-2"] = Service{ServiceName: "service-2", Quarantined: true}
+	data.Certs["my-cert.pem"] = true
+
+	actual := HaProxy{}.DebugState()
+
+	s.True(actual.Goroutines > 0)
+	s.Equal(2, actual.Services)
+	s.Equal(1, actual.QuarantinedServices)
+	s.Equal(1, actual.Certs)
+}
+
+func (s *DebugTestSuite) Test_DebugState_ReturnsLastDurations() {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time {
+		return start.Add(150 * time.Millisecond)
+	}
+	recordGenerationDuration(start)
+	timeNow = func() time.Time {
+		return start.Add(2 * time.Second)
+	}
+	recordReloadDuration(start)
+
+	actual := HaProxy{}.DebugState()
+
+	s.Equal(int64(150), actual.LastGenerationMs)
+	s.Equal(start.Add(150*time.Millisecond), actual.LastGenerationAt)
+	s.Equal(int64(2000), actual.LastReloadMs)
+	s.Equal(start.Add(2*time.Second), actual.LastReloadAt)
+}
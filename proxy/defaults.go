@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ServiceDefaults holds the values of the service parameters applied to the services that do not set them.
+// The values are in the format of the reconfigure request parameters (e.g. `timeoutServer: "60"`).
+// The values of a namespace take precedence over the global ones.
+type ServiceDefaults struct {
+	Defaults   map[string]string            `yaml:"defaults"`
+	Namespaces map[string]map[string]string `yaml:"namespaces"`
+}
+
+var serviceDefaults = struct {
+	sync.RWMutex
+	defaults *ServiceDefaults
+}{}
+
+// StartServiceDefaults loads the defaults from SERVICE_DEFAULTS_FILE and reloads them whenever the process receives SIGHUP.
+// If a reload fails, the previous defaults are kept.
+func StartServiceDefaults() error {
+	path := os.Getenv("SERVICE_DEFAULTS_FILE")
+	if err := LoadServiceDefaults(path); err != nil {
+		return err
+	}
+	hup := make(chan os.Signal, 1)
+	signalNotify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := LoadServiceDefaults(path); err != nil {
+				logPrintf("Could not reload the service defaults from %s. The previous defaults are kept.\n%s", path, err.Error())
+			}
+		}
+	}()
+	return nil
+}
+
+// LoadServiceDefaults parses the defaults stored in the file and applies them to the services registered from now on
+func LoadServiceDefaults(path string) error {
+	content, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+	defaults, err := ParseServiceDefaults(content)
+	if err != nil {
+		return fmt.Errorf("The service defaults %s are invalid\n%s", path, err.Error())
+	}
+	serviceDefaults.Lock()
+	defer serviceDefaults.Unlock()
+	serviceDefaults.defaults = defaults
+	logPrintf("Loaded %d service defaults and the overrides of %d namespaces from %s", len(defaults.Defaults), len(defaults.Namespaces), path)
+	return nil
+}
+
+// ParseServiceDefaults parses YAML defaults and validates their parameters and values
+func ParseServiceDefaults(content []byte) (*ServiceDefaults, error) {
+	defaults := ServiceDefaults{}
+	if err := yaml.Unmarshal(content, &defaults); err != nil {
+		return nil, err
+	}
+	if err := validateServiceDefaults(defaults.Defaults); err != nil {
+		return nil, err
+	}
+	for namespace, values := range defaults.Namespaces {
+		if err := validateServiceDefaults(values); err != nil {
+			return nil, fmt.Errorf("%s (namespace %s)", err.Error(), namespace)
+		}
+	}
+	return &defaults, nil
+}
+
+// ApplyServiceDefaults sets the parameters of the service and its destinations that are not set (have zero values)
+// to the defaults of its namespace and, after them, to the global defaults.
+// The names of the defaulted parameters are recorded in Defaulted. The parameters listed there already
+// are considered not set so that re-registered services follow the current defaults.
+func ApplyServiceDefaults(s Service) Service {
+	serviceDefaults.RLock()
+	defer serviceDefaults.RUnlock()
+	if serviceDefaults.defaults == nil {
+		return s
+	}
+	values := map[string]string{}
+	for name, value := range serviceDefaults.defaults.Defaults {
+		values[name] = value
+	}
+	for name, value := range serviceDefaults.defaults.Namespaces[GetNamespace(s)] {
+		values[name] = value
+	}
+	s.Defaulted = applyDefaults(reflect.ValueOf(&s).Elem(), values, s.Defaulted, nil)
+	if len(s.ServiceDest) > 0 {
+		dests := []ServiceDest{}
+		for _, sd := range s.ServiceDest {
+			sd.Defaulted = applyDefaults(reflect.ValueOf(&sd).Elem(), values, sd.Defaulted, serviceLevelParams)
+			dests = append(dests, sd)
+		}
+		s.ServiceDest = dests
+	}
+	return s
+}
+
+// Sets the fields of the struct that are not set to the values and returns the names of the defaulted parameters.
+// The fields listed in defaulted are reset first. The skipped parameters are not applied.
+func applyDefaults(v reflect.Value, values map[string]string, defaulted []string, skipped map[string]bool) []string {
+	previous := map[string]bool{}
+	for _, name := range defaulted {
+		previous[name] = true
+	}
+	applied := []string{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, opts := parseParamTag(t.Field(i).Tag.Get("param"))
+		if len(name) == 0 || skipped[name] {
+			continue
+		}
+		field := v.Field(i)
+		if previous[name] {
+			field.Set(reflect.Zero(field.Type()))
+		}
+		value, ok := values[name]
+		if !ok || !isZeroField(field) {
+			continue
+		}
+		if err := setField(field, name, value, opts); err != nil {
+			logPrintf("Could not apply the default %s\n%s", name, err.Error())
+			continue
+		}
+		applied = append(applied, name)
+	}
+	return applied
+}
+
+// Returns an error if one of the parameters does not exist or its value is not valid
+func validateServiceDefaults(values map[string]string) error {
+	for name, value := range values {
+		found := false
+		for _, v := range []reflect.Value{reflect.ValueOf(&Service{}).Elem(), reflect.ValueOf(&ServiceDest{}).Elem()} {
+			for i := 0; i < v.NumField(); i++ {
+				fieldName, opts := parseParamTag(v.Type().Field(i).Tag.Get("param"))
+				if fieldName != name {
+					continue
+				}
+				if err := setField(v.Field(i), name, value, opts); err != nil {
+					return err
+				}
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("The default %s is not a service parameter", name)
+		}
+	}
+	return nil
+}
+
+func isZeroField(field reflect.Value) bool {
+	switch field.Kind() {
+	case reflect.Slice, reflect.Map:
+		return field.Len() == 0
+	}
+	return reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface())
+}
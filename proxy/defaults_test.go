@@ -0,0 +1,178 @@
+// +build !integration
+
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type DefaultsTestSuite struct {
+	suite.Suite
+	defaultsOrig *ServiceDefaults
+}
+
+func TestDefaultsUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(DefaultsTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *DefaultsTestSuite) SetupTest() {
+	s.defaultsOrig = serviceDefaults.defaults
+	defaults, err := ParseServiceDefaults([]byte(`
+defaults:
+  timeoutServer: "30"
+  checkInterval: "10s"
+  deploymentGrace: "20s"
+namespaces:
+  payments:
+    timeoutServer: "120"
+    reqRateLimit: "100"
+`))
+	s.Require().NoError(err)
+	serviceDefaults.defaults = defaults
+}
+
+func (s *DefaultsTestSuite) TearDownTest() {
+	serviceDefaults.defaults = s.defaultsOrig
+	ReadFile = ioutil.ReadFile
+	signalNotify = signal.Notify
+}
+
+// ApplyServiceDefaults
+
+func (s *DefaultsTestSuite) Test_ApplyServiceDefaults_SetsParametersThatAreNotSet() {
+	sr := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "8080"}, {Port: "8081", DeploymentGrace: "1m"}},
+	}
+
+	actual := ApplyServiceDefaults(sr)
+
+	s.Equal("30", actual.TimeoutServer)
+	s.Equal("10s", actual.CheckInterval)
+	s.Equal(0, actual.ReqRateLimit)
+	s.Equal([]string{"checkInterval", "timeoutServer"}, actual.Defaulted)
+	s.Equal("20s", actual.ServiceDest[0].DeploymentGrace)
+	s.Equal([]string{"deploymentGrace"}, actual.ServiceDest[0].Defaulted)
+	s.Equal("1m", actual.ServiceDest[1].DeploymentGrace)
+	s.Empty(actual.ServiceDest[1].Defaulted)
+	s.Empty(sr.ServiceDest[0].DeploymentGrace)
+}
+
+func (s *DefaultsTestSuite) Test_ApplyServiceDefaults_LayersNamespaceOverGlobalAndExplicitOverBoth() {
+	testData := []struct {
+		service       Service
+		timeoutServer string
+		reqRateLimit  int
+	}{
+		{Service{ServiceName: "api"}, "30", 0},
+		{Service{ServiceName: "payments_api"}, "120", 100},
+		{Service{ServiceName: "api", Namespace: "payments"}, "120", 100},
+		{Service{ServiceName: "payments_api", TimeoutServer: "5", ReqRateLimit: 10}, "5", 10},
+	}
+	for _, data := range testData {
+		actual := ApplyServiceDefaults(data.service)
+
+		s.Equal(data.timeoutServer, actual.TimeoutServer, data.service.ServiceName)
+		s.Equal(data.reqRateLimit, actual.ReqRateLimit, data.service.ServiceName)
+	}
+}
+
+func (s *DefaultsTestSuite) Test_ApplyServiceDefaults_ReplacesPreviouslyDefaultedParameters() {
+	sr := Service{ServiceName: "api", TimeoutServer: "60", CheckInterval: "5s", Defaulted: []string{"timeoutServer"}}
+
+	actual := ApplyServiceDefaults(sr)
+
+	s.Equal("30", actual.TimeoutServer)
+	s.Equal("5s", actual.CheckInterval)
+	s.Equal([]string{"timeoutServer"}, actual.Defaulted)
+}
+
+func (s *DefaultsTestSuite) Test_ApplyServiceDefaults_ReturnsServiceUnchanged_WhenDefaultsAreNotLoaded() {
+	serviceDefaults.defaults = nil
+	sr := Service{ServiceName: "api"}
+
+	s.Equal(sr, ApplyServiceDefaults(sr))
+}
+
+// AddService
+
+func (s *DefaultsTestSuite) Test_AddService_RecordsDefaultedParameters() {
+	dataOrig := data
+	defer func() { data = dataOrig }()
+	data = Data{Services: map[string]Service{}}
+
+	err := HaProxy{}.AddService(Service{ServiceName: "payments_api", TimeoutServer: "5", ServiceDest: []ServiceDest{{Port: "8080"}}})
+
+	s.Require().NoError(err)
+	actual := HaProxy{}.GetServices()["payments_api"]
+	s.Equal("5", actual.TimeoutServer)
+	s.Equal(100, actual.ReqRateLimit)
+	s.Equal([]string{"checkInterval", "reqRateLimit"}, actual.Defaulted)
+	s.Equal([]string{"deploymentGrace"}, actual.ServiceDest[0].Defaulted)
+}
+
+// ParseServiceDefaults
+
+func (s *DefaultsTestSuite) Test_ParseServiceDefaults_ReturnsError_WhenParameterDoesNotExist() {
+	_, err := ParseServiceDefaults([]byte("defaults:\n  timeoutSrv: \"30\"\n"))
+
+	s.Error(err)
+}
+
+func (s *DefaultsTestSuite) Test_ParseServiceDefaults_ReturnsError_WhenValueIsInvalid() {
+	_, err := ParseServiceDefaults([]byte("namespaces:\n  payments:\n    reqRateLimit: many\n"))
+
+	s.Require().Error(err)
+	s.Contains(err.Error(), "payments")
+}
+
+func (s *DefaultsTestSuite) Test_ParseServiceDefaults_ReturnsError_WhenYamlIsInvalid() {
+	_, err := ParseServiceDefaults([]byte("defaults: [timeoutServer"))
+
+	s.Error(err)
+}
+
+// StartServiceDefaults
+
+func (s *DefaultsTestSuite) Test_StartServiceDefaults_ReloadsDefaults_WhenSighupIsReceived() {
+	defer os.Unsetenv("SERVICE_DEFAULTS_FILE")
+	os.Setenv("SERVICE_DEFAULTS_FILE", "/run/secrets/defaults.yml")
+	content := "defaults:\n  timeoutServer: \"30\"\n"
+	ReadFile = func(filename string) ([]byte, error) {
+		s.Equal("/run/secrets/defaults.yml", filename)
+		return []byte(content), nil
+	}
+	var hup chan<- os.Signal
+	signalNotify = func(c chan<- os.Signal, sig ...os.Signal) {
+		s.Equal([]os.Signal{syscall.SIGHUP}, sig)
+		hup = c
+	}
+
+	s.Require().NoError(StartServiceDefaults())
+	s.Equal("30", ApplyServiceDefaults(Service{ServiceName: "api"}).TimeoutServer)
+
+	content = "defaults:\n  timeoutServer: \"45\"\n"
+	hup <- syscall.SIGHUP
+
+	s.Eventually(func() bool {
+		return ApplyServiceDefaults(Service{ServiceName: "api"}).TimeoutServer == "45"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (s *DefaultsTestSuite) Test_LoadServiceDefaults_KeepsPreviousDefaults_WhenFileIsInvalid() {
+	ReadFile = func(filename string) ([]byte, error) {
+		return []byte("defaults:\n  reqRateLimit: many\n"), nil
+	}
+
+	s.Error(LoadServiceDefaults("/run/secrets/defaults.yml"))
+	s.Equal("30", ApplyServiceDefaults(Service{ServiceName: "api"}).TimeoutServer)
+}
@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"reflect"
+	"strings"
+)
+
+// FieldChange describes a parameter whose value differs between two versions of a service.
+// CurrentDefaulted and ProposedDefaulted tell whether the values come from SERVICE_DEFAULTS_FILE.
+type FieldChange struct {
+	Field             string
+	Current           interface{}
+	Proposed          interface{}
+	CurrentDefaulted  bool `json:",omitempty"`
+	ProposedDefaulted bool `json:",omitempty"`
+}
+
+// ServiceDestDiff describes the changes of a destination present in both versions of a service
+type ServiceDestDiff struct {
+	Index   int
+	Changes []FieldChange
+}
+
+// ServiceDiff describes the differences between the registered and the proposed version of a service.
+// SnippetDiff is filled by the caller since rendering of configuration snippets requires the templates.
+type ServiceDiff struct {
+	Changes             []FieldChange
+	AddedDomains        []string
+	RemovedDomains      []string
+	AddedDestinations   []ServiceDest
+	RemovedDestinations []ServiceDest
+	ChangedDestinations []ServiceDestDiff
+	SnippetDiff         []string
+}
+
+// Parameters whose values are not exposed in diffs
+var diffRedactedParams = map[string]bool{"serviceCert": true, "users": true}
+
+// DiffService compares parameters of two versions of a service.
+// Domains are compared regardless of their order while destinations are compared by their position.
+func DiffService(current, proposed Service) ServiceDiff {
+	diff := ServiceDiff{
+		Changes:             diffFields(reflect.ValueOf(current), reflect.ValueOf(proposed), current.Defaulted, proposed.Defaulted),
+		AddedDomains:        diffDomains(proposed.ServiceDomain, current.ServiceDomain),
+		RemovedDomains:      diffDomains(current.ServiceDomain, proposed.ServiceDomain),
+		AddedDestinations:   []ServiceDest{},
+		RemovedDestinations: []ServiceDest{},
+		ChangedDestinations: []ServiceDestDiff{},
+		SnippetDiff:         []string{},
+	}
+	for i := 0; i < len(current.ServiceDest) || i < len(proposed.ServiceDest); i++ {
+		if i >= len(current.ServiceDest) {
+			diff.AddedDestinations = append(diff.AddedDestinations, proposed.ServiceDest[i])
+		} else if i >= len(proposed.ServiceDest) {
+			diff.RemovedDestinations = append(diff.RemovedDestinations, current.ServiceDest[i])
+		} else {
+			cd, pd := current.ServiceDest[i], proposed.ServiceDest[i]
+			changes := diffFields(reflect.ValueOf(cd), reflect.ValueOf(pd), cd.Defaulted, pd.Defaulted)
+			if len(changes) > 0 {
+				diff.ChangedDestinations = append(diff.ChangedDestinations, ServiceDestDiff{Index: i, Changes: changes})
+			}
+		}
+	}
+	return diff
+}
+
+// DiffLines returns the lines of both contents prefixed with `-` if they were removed, `+` if they were added,
+// and a space if they did not change
+func DiffLines(current, proposed string) []string {
+	a := splitLines(current)
+	b := splitLines(proposed)
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	lines := []string{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if i < len(a) && j < len(b) && a[i] == b[j] {
+			lines = append(lines, " "+a[i])
+			i++
+			j++
+		} else if i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]) {
+			lines = append(lines, "-"+a[i])
+			i++
+		} else {
+			lines = append(lines, "+"+b[j])
+			j++
+		}
+	}
+	return lines
+}
+
+// Compares fields with the param tag except ServiceDomain, which is compared separately
+func diffFields(current, proposed reflect.Value, currentDefaulted, proposedDefaulted []string) []FieldChange {
+	changes := []FieldChange{}
+	for i := 0; i < current.NumField(); i++ {
+		name, _ := parseParamTag(current.Type().Field(i).Tag.Get("param"))
+		if len(name) == 0 || name == "serviceDomain" {
+			continue
+		}
+		c := current.Field(i).Interface()
+		p := proposed.Field(i).Interface()
+		if reflect.DeepEqual(c, p) || (isEmptySlice(current.Field(i)) && isEmptySlice(proposed.Field(i))) {
+			continue
+		}
+		if diffRedactedParams[name] {
+			c, p = redacted, redacted
+		}
+		changes = append(changes, FieldChange{
+			Field:             name,
+			Current:           c,
+			Proposed:          p,
+			CurrentDefaulted:  containsString(currentDefaulted, name),
+			ProposedDefaulted: containsString(proposedDefaulted, name),
+		})
+	}
+	return changes
+}
+
+func isEmptySlice(v reflect.Value) bool {
+	return v.Kind() == reflect.Slice && v.Len() == 0
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func splitLines(content string) []string {
+	content = strings.Trim(content, "\n")
+	if len(content) == 0 {
+		return []string{}
+	}
+	return strings.Split(content, "\n")
+}
+
+// Returns the domains from the first list that are not in the second one
+func diffDomains(domains, other []string) []string {
+	diff := []string{}
+	for _, domain := range domains {
+		found := false
+		for _, o := range other {
+			if strings.EqualFold(domain, o) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			diff = append(diff, domain)
+		}
+	}
+	return diff
+}
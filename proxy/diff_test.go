@@ -0,0 +1,147 @@
+// +build !integration
+
+package proxy
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type DiffTestSuite struct {
+	suite.Suite
+}
+
+func TestDiffUnitTestSuite(t *testing.T) {
+	s := new(DiffTestSuite)
+	suite.Run(t, s)
+}
+
+// DiffService
+
+func (s *DiffTestSuite) Test_DiffService_ReturnsChangedScalarParams() {
+	current := Service{ServiceName: "my-service", ReqMode: "http", HttpsPort: 443, Distribute: true}
+	proposed := Service{ServiceName: "my-service", ReqMode: "http", HttpsPort: 8443}
+
+	actual := DiffService(current, proposed)
+
+	s.Equal(
+		[]FieldChange{
+			{Field: "distribute", Current: true, Proposed: false},
+			{Field: "httpsPort", Current: 443, Proposed: 8443},
+		},
+		actual.Changes,
+	)
+}
+
+func (s *DiffTestSuite) Test_DiffService_MarksDefaultedParams() {
+	current := Service{ServiceName: "my-service", TimeoutServer: "30", CheckInterval: "5s", Defaulted: []string{"timeoutServer"}}
+	proposed := Service{ServiceName: "my-service", TimeoutServer: "60", CheckInterval: "10s", Defaulted: []string{"checkInterval"}}
+
+	actual := DiffService(current, proposed)
+
+	s.Equal(
+		[]FieldChange{
+			{Field: "checkInterval", Current: "5s", Proposed: "10s", ProposedDefaulted: true},
+			{Field: "timeoutServer", Current: "30", Proposed: "60", CurrentDefaulted: true},
+		},
+		actual.Changes,
+	)
+}
+
+func (s *DiffTestSuite) Test_DiffService_RedactsSensitiveParams() {
+	current := Service{ServiceCert: "cert-1", Users: []User{{Username: "user", Password: "pass-1"}}}
+	proposed := Service{ServiceCert: "cert-2", Users: []User{{Username: "user", Password: "pass-2"}}}
+
+	actual := DiffService(current, proposed)
+
+	s.Equal(
+		[]FieldChange{
+			{Field: "serviceCert", Current: redacted, Proposed: redacted},
+			{Field: "users", Current: redacted, Proposed: redacted},
+		},
+		actual.Changes,
+	)
+}
+
+func (s *DiffTestSuite) Test_DiffService_ComparesDomainsRegardlessOfOrder() {
+	current := Service{ServiceDomain: []string{"a.com", "b.com", "c.com"}}
+	proposed := Service{ServiceDomain: []string{"D.com", "c.com", "a.com"}}
+
+	actual := DiffService(current, proposed)
+
+	s.Empty(actual.Changes)
+	s.Equal([]string{"D.com"}, actual.AddedDomains)
+	s.Equal([]string{"b.com"}, actual.RemovedDomains)
+}
+
+func (s *DiffTestSuite) Test_DiffService_ReturnsEmptyDiff_WhenOnlyDomainOrderChanged() {
+	current := Service{ServiceDomain: []string{"a.com", "b.com"}, ServiceDest: []ServiceDest{{Port: "1111"}}}
+	proposed := Service{ServiceDomain: []string{"b.com", "a.com"}, ServiceDest: []ServiceDest{{Port: "1111", ServicePath: []string{}}}}
+
+	actual := DiffService(current, proposed)
+
+	s.Empty(actual.Changes)
+	s.Empty(actual.AddedDomains)
+	s.Empty(actual.RemovedDomains)
+	s.Empty(actual.ChangedDestinations)
+}
+
+func (s *DiffTestSuite) Test_DiffService_ComparesDestinationsByPosition() {
+	current := Service{ServiceDest: []ServiceDest{
+		{Port: "1111", ServicePath: []string{"/api"}},
+		{Port: "2222", ServicePath: []string{"/admin"}, SrcPort: 81},
+		{Port: "3333", ServicePath: []string{"/old"}},
+	}}
+	proposed := Service{ServiceDest: []ServiceDest{
+		{Port: "1111", ServicePath: []string{"/api"}},
+		{Port: "2222", ServicePath: []string{"/admin", "/ops"}, SrcPort: 82},
+	}}
+
+	actual := DiffService(current, proposed)
+
+	s.Equal(
+		[]ServiceDestDiff{{
+			Index: 1,
+			Changes: []FieldChange{
+				{Field: "servicePath", Current: []string{"/admin"}, Proposed: []string{"/admin", "/ops"}},
+				{Field: "srcPort", Current: 81, Proposed: 82},
+			},
+		}},
+		actual.ChangedDestinations,
+	)
+	s.Equal([]ServiceDest{{Port: "3333", ServicePath: []string{"/old"}}}, actual.RemovedDestinations)
+	s.Empty(actual.AddedDestinations)
+
+	actual = DiffService(proposed, current)
+
+	s.Equal([]ServiceDest{{Port: "3333", ServicePath: []string{"/old"}}}, actual.AddedDestinations)
+}
+
+// DiffLines
+
+func (s *DiffTestSuite) Test_DiffLines_MarksAddedAndRemovedLines() {
+	current := `
+    acl url_my-service1111 path_beg /api
+    use_backend my-service-be1111 if url_my-service1111`
+	proposed := `
+    acl url_my-service1111 path_beg /api
+    acl domain_my-service hdr_dom(host) -i my-domain.com
+    use_backend my-service-be1111 if url_my-service1111 domain_my-service`
+
+	actual := DiffLines(current, proposed)
+
+	s.Equal(
+		[]string{
+			"     acl url_my-service1111 path_beg /api",
+			"-    use_backend my-service-be1111 if url_my-service1111",
+			"+    acl domain_my-service hdr_dom(host) -i my-domain.com",
+			"+    use_backend my-service-be1111 if url_my-service1111 domain_my-service",
+		},
+		actual,
+	)
+}
+
+func (s *DiffTestSuite) Test_DiffLines_ReturnsEmptySlice_WhenContentIsEmpty() {
+	s.Empty(DiffLines("", ""))
+	s.Equal([]string{"+line"}, DiffLines("", "line"))
+}
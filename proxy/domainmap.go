@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The file name of the map of domains to backends, relative to the configs path
+const domainMapFile = "domains.map"
+
+var domainMapState = struct {
+	sync.Mutex
+	// Whether the last configuration differs from the running one only by the domains applied through the runtime socket
+	reloadSkippable bool
+}{}
+
+// Routes requests for the domain to the backend
+type domainMapEntry struct {
+	Domain  string
+	Backend string
+}
+
+// Returns whether the service is routed through the map of domains.
+// It is the case when DOMAIN_ROUTING_MODE is map and the service sends all the paths of its exact domains
+// to a single destination. Services that need path-based, method-based, source-based, or port-based routing,
+// wildcard domains, redirects, rate limits, frontend rules, or exclusions from the security rules keep their ACLs.
+func isDomainMapRouted(s Service) bool {
+	if !strings.EqualFold(os.Getenv("DOMAIN_ROUTING_MODE"), "map") {
+		return false
+	}
+	if len(s.ReqMode) > 0 && !strings.EqualFold(s.ReqMode, "http") {
+		return false
+	}
+	if len(s.ServiceDomain) == 0 || len(s.ServiceDest) != 1 || s.HttpsPort > 0 {
+		return false
+	}
+	if s.RedirectToWww || s.RedirectWhenHttpProto || len(s.NormalizeTrailingSlash) > 0 || len(s.FrontendExtra) > 0 || s.ReqRateLimit > 0 || s.SkipSecurityRules {
+		return false
+	}
+	m := &HaProxy{}
+	if len(m.getRealIpRule(s)) > 0 {
+		return false
+	}
+	for _, domain := range s.ServiceDomain {
+		if strings.HasPrefix(domain, "*") || strings.HasPrefix(domain, ".") || strings.Contains(domain, ":") {
+			return false
+		}
+	}
+	sd := s.ServiceDest[0]
+	if len(sd.HttpMethods) > 0 || len(sd.AllowedSourceNetworks) > 0 || len(sd.SrcPortAcl) > 0 || len(sd.ServicePath) == 0 {
+		return false
+	}
+	if pathType := (HaProxy{}).getDestPathType(s, sd); len(pathType) > 0 && pathType != "path_beg" {
+		return false
+	}
+	for _, path := range sd.ServicePath {
+		if path != "/" {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the domains of the services routed through the map, sorted by domain.
+// When services share a domain, the one whose frontend rules come first keeps it.
+func (m HaProxy) getDomainMapEntries(excluded map[string]bool) []domainMapEntry {
+	entries := []domainMapEntry{}
+	domains := map[string]bool{}
+	for _, name := range m.getSortedServiceNames() {
+		s := data.Services[name]
+		if excluded[name] || !isDomainMapRouted(s) {
+			continue
+		}
+		for _, domain := range s.ServiceDomain {
+			domain = strings.ToLower(domain)
+			if domains[domain] {
+				continue
+			}
+			domains[domain] = true
+			entries = append(entries, domainMapEntry{Domain: domain, Backend: s.AclName + "-be" + s.ServiceDest[0].PortName()})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Domain < entries[j].Domain
+	})
+	return entries
+}
+
+// Returns the rule that routes requests through the map of domains.
+// It is rendered after the ACL rules so that more specific rules of other services (e.g. paths of the same domain) win.
+func (m HaProxy) getDomainMapRule() string {
+	lookup := fmt.Sprintf("req.hdr(host),field(1,:),lower,map(%s)", m.getDomainMapPath())
+	return fmt.Sprintf(`
+    use_backend %%[%s] if { %s -m found }`, lookup, lookup)
+}
+
+func (m HaProxy) getDomainMapPath() string {
+	return fmt.Sprintf("%s/%s", m.ConfigsPath, domainMapFile)
+}
+
+// Writes the map of domains. If the rest of the configuration did not change and the runtime socket is available,
+// the domains are also updated in the running proxy so that the next reload can be skipped.
+func (m HaProxy) writeDomainMap(configsContent string) error {
+	domainMapState.Lock()
+	defer domainMapState.Unlock()
+	domainMapState.reloadSkippable = false
+	path := m.getDomainMapPath()
+	entries := m.getDomainMapEntries(m.getQuarantinedServices())
+	content := ""
+	for _, entry := range entries {
+		content += fmt.Sprintf("%s %s\n", entry.Domain, entry.Backend)
+	}
+	previous, mapErr := ReadFile(path)
+	config, configErr := m.ReadConfig()
+	if err := writeFile(path, []byte(content), 0664); err != nil {
+		return err
+	}
+	if mapErr != nil || configErr != nil || config != configsContent || string(previous) == content {
+		return nil
+	}
+	if _, err := statFile(haproxySocketPath); err != nil {
+		return nil
+	}
+	if err := m.applyDomainMap(path, parseDomainMap(string(previous)), entries); err != nil {
+		logPrintf("Could not update the domains through the runtime socket\n%s", err.Error())
+		return nil
+	}
+	domainMapState.reloadSkippable = true
+	return nil
+}
+
+// Sends the differences between the previous and the current domains to the running proxy
+func (m HaProxy) applyDomainMap(path string, previous map[string]string, entries []domainMapEntry) error {
+	current := map[string]bool{}
+	for _, entry := range entries {
+		current[entry.Domain] = true
+		command := ""
+		if backend, ok := previous[entry.Domain]; !ok {
+			command = fmt.Sprintf("add map %s %s %s", path, entry.Domain, entry.Backend)
+		} else if backend != entry.Backend {
+			command = fmt.Sprintf("set map %s %s %s", path, entry.Domain, entry.Backend)
+		} else {
+			continue
+		}
+		if err := sendRuntimeCommand(haproxySocketPath, command); err != nil {
+			return err
+		}
+	}
+	domains := []string{}
+	for domain := range previous {
+		if !current[domain] {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Strings(domains)
+	for _, domain := range domains {
+		if err := sendRuntimeCommand(haproxySocketPath, fmt.Sprintf("del map %s %s", path, domain)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseDomainMap(content string) map[string]string {
+	domains := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			domains[fields[0]] = fields[1]
+		}
+	}
+	return domains
+}
+
+// Returns whether the domains of the last configuration were applied through the runtime socket
+// and nothing else requires a reload. The state is reset so that it applies only to the next reload.
+func takeReloadSkippable() bool {
+	domainMapState.Lock()
+	defer domainMapState.Unlock()
+	skippable := domainMapState.reloadSkippable
+	domainMapState.reloadSkippable = false
+	return skippable
+}
@@ -0,0 +1,217 @@
+// +build !integration
+
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type DomainMapTestSuite struct {
+	suite.Suite
+	Path       string
+	SocketPath string
+	Commands   []string
+	Reloads    int
+	dataOrig   Data
+}
+
+func TestDomainMapUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(DomainMapTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *DomainMapTestSuite) SetupTest() {
+	os.Setenv("DOMAIN_ROUTING_MODE", "map")
+	s.Path, _ = ioutil.TempDir("", "domainmap")
+	ioutil.WriteFile(s.Path+"/haproxy.tmpl", []byte("frontend services{{.ContentFrontend}}"), 0644)
+	s.dataOrig = data
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{}}
+	s.Commands = []string{}
+	s.Reloads = 0
+	validateConfig = func(content string) error { return nil }
+	readPidFile = func(fileName string) ([]byte, error) { return []byte("1"), nil }
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		s.Reloads++
+		return nil
+	}
+	sendRuntimeCommand = func(socket, command string) error {
+		s.Commands = append(s.Commands, command)
+		return nil
+	}
+	writeFile = ioutil.WriteFile
+	ReadFile = ioutil.ReadFile
+	removeFile = os.Remove
+	readConfigsDir = ioutil.ReadDir
+	readConfigsFile = ioutil.ReadFile
+	socket, _ := ioutil.TempFile("", "haproxy-sock")
+	s.SocketPath = socket.Name()
+	haproxySocketPath = s.SocketPath
+	takeReloadSkippable()
+}
+
+func (s *DomainMapTestSuite) TearDownTest() {
+	os.Unsetenv("DOMAIN_ROUTING_MODE")
+	os.RemoveAll(s.Path)
+	os.Remove(s.SocketPath)
+	data = s.dataOrig
+	haproxySocketPath = "/var/run/haproxy.sock"
+	sendRuntimeCommand = sendRuntimeCommandOrig
+	validateConfig = validateConfigOrig
+	readPidFile = ioutil.ReadFile
+	takeReloadSkippable()
+}
+
+func (s *DomainMapTestSuite) haproxy() HaProxy {
+	return HaProxy{TemplatesPath: s.Path, ConfigsPath: s.Path}
+}
+
+func (s *DomainMapTestSuite) domainService(name string, domains ...string) Service {
+	return Service{
+		ServiceName:   name,
+		AclName:       name,
+		PathType:      "path_beg",
+		ServiceDomain: domains,
+		ServiceDest:   []ServiceDest{{Port: "8080", ServicePath: []string{"/"}}},
+	}
+}
+
+func (s *DomainMapTestSuite) readFile(name string) string {
+	content, _ := ioutil.ReadFile(s.Path + "/" + name)
+	return string(content)
+}
+
+// CreateConfigFromTemplates
+
+func (s *DomainMapTestSuite) Test_CreateConfigFromTemplates_WritesDomainMap() {
+	data.Services["shop"] = s.domainService("shop", "shop.example.com", "Store.example.com")
+	data.Services["blog"] = s.domainService("blog", "blog.example.com")
+
+	s.Require().NoError(s.haproxy().CreateConfigFromTemplates())
+
+	s.Equal(`blog.example.com blog-be8080
+shop.example.com shop-be8080
+store.example.com shop-be8080
+`, s.readFile("domains.map"))
+	config := s.readFile("haproxy.cfg")
+	s.NotContains(config, "acl domain_shop")
+	s.Contains(config, `
+    use_backend %[req.hdr(host),field(1,:),lower,map(`+s.Path+`/domains.map)] if { req.hdr(host),field(1,:),lower,map(`+s.Path+`/domains.map) -m found }`)
+}
+
+func (s *DomainMapTestSuite) Test_CreateConfigFromTemplates_UsesAclsForServicesThatCannotBeMapped() {
+	data.Services["shop"] = s.domainService("shop", "shop.example.com")
+	api := s.domainService("api", "shop.example.com")
+	api.ServiceDest[0].ServicePath = []string{"/api"}
+	data.Services["api"] = api
+	methods := s.domainService("methods", "methods.example.com")
+	methods.ServiceDest[0].HttpMethods = []string{"GET"}
+	data.Services["methods"] = methods
+	data.Services["wildcard"] = s.domainService("wildcard", "*.example.io")
+	office := s.domainService("office", "office.example.com")
+	office.ServiceDest[0].AllowedSourceNetworks = []string{"10.0.0.0/8"}
+	data.Services["office"] = office
+	quarantined := s.domainService("quarantined", "quarantined.example.com")
+	quarantined.Quarantined = true
+	data.Services["quarantined"] = quarantined
+
+	s.Require().NoError(s.haproxy().CreateConfigFromTemplates())
+
+	s.Equal("shop.example.com shop-be8080\n", s.readFile("domains.map"))
+	config := s.readFile("haproxy.cfg")
+	s.Contains(config, "acl url_api8080 path_beg /api")
+	s.Contains(config, "acl method_methods8080 method GET")
+	s.Contains(config, "acl domain_wildcard hdr_end(host) -i .example.io")
+	s.Contains(config, "acl allowed_src_office8080 src 10.0.0.0/8")
+	s.NotContains(config, "quarantined")
+	s.True(
+		strings.Index(config, "use_backend api-be8080") < strings.Index(config, "map("),
+		"The map rule must be rendered after the ACL rules",
+	)
+}
+
+func (s *DomainMapTestSuite) Test_CreateConfigFromTemplates_DoesNotWriteDomainMap_WhenModeIsNotMap() {
+	os.Unsetenv("DOMAIN_ROUTING_MODE")
+	data.Services["shop"] = s.domainService("shop", "shop.example.com")
+
+	s.Require().NoError(s.haproxy().CreateConfigFromTemplates())
+
+	_, err := os.Stat(s.Path + "/domains.map")
+	s.True(os.IsNotExist(err))
+	s.Contains(s.readFile("haproxy.cfg"), "acl domain_shop hdr_dom(host) -i shop.example.com")
+}
+
+// Runtime socket
+
+func (s *DomainMapTestSuite) Test_Reload_UpdatesDomainsThroughSocket_WhenOnlyDomainsChanged() {
+	data.Services["shop"] = s.domainService("shop", "shop.example.com", "old.example.com")
+	data.Services["blog"] = s.domainService("blog", "blog.example.com")
+	haproxy := s.haproxy()
+	s.Require().NoError(haproxy.CreateConfigFromTemplates())
+	s.Require().NoError(haproxy.Reload())
+	s.Require().Equal(1, s.Reloads)
+
+	data.Services["shop"] = s.domainService("shop", "shop.example.com", "new.example.com")
+	data.Services["blog"] = s.domainService("blog", "blog.example.com", "shop.example.org")
+	s.Require().NoError(haproxy.CreateConfigFromTemplates())
+	s.Require().NoError(haproxy.Reload())
+
+	path := s.Path + "/domains.map"
+	s.Equal([]string{
+		"add map " + path + " new.example.com shop-be8080",
+		"add map " + path + " shop.example.org blog-be8080",
+		"del map " + path + " old.example.com",
+	}, s.Commands)
+	s.Equal(1, s.Reloads)
+}
+
+func (s *DomainMapTestSuite) Test_Reload_ReloadsProxy_WhenConfigChanged() {
+	data.Services["shop"] = s.domainService("shop", "shop.example.com")
+	haproxy := s.haproxy()
+	s.Require().NoError(haproxy.CreateConfigFromTemplates())
+
+	data.Services["blog"] = s.domainService("blog", "blog.example.com")
+	ioutil.WriteFile(s.Path+"/blog-be.cfg", []byte("backend blog-be8080"), 0644)
+	s.Require().NoError(haproxy.CreateConfigFromTemplates())
+	s.Require().NoError(haproxy.Reload())
+
+	s.Empty(s.Commands)
+	s.Equal(1, s.Reloads)
+	s.Contains(s.readFile("domains.map"), "blog.example.com blog-be8080")
+}
+
+func (s *DomainMapTestSuite) Test_Reload_ReloadsProxy_WhenSocketDoesNotExist() {
+	data.Services["shop"] = s.domainService("shop", "shop.example.com")
+	haproxy := s.haproxy()
+	s.Require().NoError(haproxy.CreateConfigFromTemplates())
+	haproxySocketPath = "/this/socket/does/not/exist"
+
+	data.Services["shop"] = s.domainService("shop", "shop.example.com", "new.example.com")
+	s.Require().NoError(haproxy.CreateConfigFromTemplates())
+	s.Require().NoError(haproxy.Reload())
+
+	s.Empty(s.Commands)
+	s.Equal(1, s.Reloads)
+}
+
+func (s *DomainMapTestSuite) Test_Reload_ReloadsProxy_WhenSocketCommandFails() {
+	data.Services["shop"] = s.domainService("shop", "shop.example.com")
+	haproxy := s.haproxy()
+	s.Require().NoError(haproxy.CreateConfigFromTemplates())
+	sendRuntimeCommand = func(socket, command string) error {
+		return os.ErrClosed
+	}
+
+	data.Services["shop"] = s.domainService("shop", "shop.example.com", "new.example.com")
+	s.Require().NoError(haproxy.CreateConfigFromTemplates())
+	s.Require().NoError(haproxy.Reload())
+
+	s.Equal(1, s.Reloads)
+	s.Contains(s.readFile("domains.map"), "new.example.com shop-be8080")
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// The directory with the error files. The files of the html format are stored in it directly
+// and the files of other formats in sub-directories named after them (e.g. /errorfiles/json/503.http).
+var errorFilesPath = "/errorfiles"
+
+// The status codes of the error files defined in the defaults section of the configuration
+var errorFileCodes = []int{400, 403, 405, 408, 429, 500, 502, 503, 504}
+
+var mkdirAll = os.MkdirAll
+var statFile = os.Stat
+
+// GenerateErrorFiles creates the error files of the json format that do not exist.
+// The body contains the status code and the message defined through ERROR_MESSAGE_<code>
+// or the status text if the variable is not set.
+func GenerateErrorFiles() error {
+	dir := fmt.Sprintf("%s/json", errorFilesPath)
+	if err := mkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, code := range errorFileCodes {
+		path := fmt.Sprintf("%s/%d.http", dir, code)
+		if _, err := statFile(path); err == nil {
+			continue
+		}
+		if err := writeFile(path, []byte(getJsonErrorFile(code)), 0664); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns an error if the format is not supported or its error files do not exist
+func validateErrorResponseFormat(format string) error {
+	switch strings.ToLower(format) {
+	case "", "html":
+		return nil
+	case "json":
+		for _, code := range errorFileCodes {
+			if _, err := statFile(fmt.Sprintf("%s/json/%d.http", errorFilesPath, code)); err != nil {
+				return &ErrValidation{
+					Fields:  []string{"errorResponseFormat"},
+					Message: fmt.Sprintf("The error files of the json format do not exist\n%s", err.Error()),
+				}
+			}
+		}
+		return nil
+	}
+	return &ErrValidation{
+		Fields:  []string{"errorResponseFormat"},
+		Message: fmt.Sprintf("The error response format %s is not supported. Please use json or html", format),
+	}
+}
+
+// Returns the errorfile directives that replace the ones of the defaults section in the backends of the service
+func getErrorFiles(s Service) string {
+	if !strings.EqualFold(s.ErrorResponseFormat, "json") || (len(s.ReqMode) > 0 && !strings.EqualFold(s.ReqMode, "http")) {
+		return ""
+	}
+	errorFiles := ""
+	for _, code := range errorFileCodes {
+		errorFiles += fmt.Sprintf(`
+    errorfile %d %s/json/%d.http`, code, errorFilesPath, code)
+	}
+	return errorFiles
+}
+
+func getJsonErrorFile(code int) string {
+	message := os.Getenv(fmt.Sprintf("ERROR_MESSAGE_%d", code))
+	if len(message) == 0 {
+		message = http.StatusText(code)
+	}
+	body, _ := json.Marshal(struct {
+		Status  int
+		Message string
+	}{code, message})
+	return fmt.Sprintf(`HTTP/1.0 %d %s
+Cache-Control: no-cache
+Connection: close
+Content-Type: application/json
+
+%s
+`, code, http.StatusText(code), string(body))
+}
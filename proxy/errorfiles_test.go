@@ -0,0 +1,115 @@
+// +build !integration
+
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ErrorFilesTestSuite struct {
+	suite.Suite
+	ErrorFilesPath string
+}
+
+func TestErrorFilesUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(ErrorFilesTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *ErrorFilesTestSuite) SetupTest() {
+	s.ErrorFilesPath, _ = ioutil.TempDir("", "errorfiles")
+	errorFilesPath = s.ErrorFilesPath
+}
+
+func (s *ErrorFilesTestSuite) TearDownTest() {
+	os.RemoveAll(s.ErrorFilesPath)
+	errorFilesPath = "/errorfiles"
+	writeFile = ioutil.WriteFile
+}
+
+// GenerateErrorFiles
+
+func (s *ErrorFilesTestSuite) Test_GenerateErrorFiles_WritesJsonErrorFiles() {
+	defer os.Unsetenv("ERROR_MESSAGE_503")
+	os.Setenv("ERROR_MESSAGE_503", "The service is down")
+
+	err := GenerateErrorFiles()
+
+	s.NoError(err)
+	for _, code := range []string{"400", "403", "405", "408", "429", "500", "502", "503", "504"} {
+		_, err := os.Stat(s.ErrorFilesPath + "/json/" + code + ".http")
+		s.NoError(err, code)
+	}
+	actual, _ := ioutil.ReadFile(s.ErrorFilesPath + "/json/503.http")
+	s.Equal(`HTTP/1.0 503 Service Unavailable
+Cache-Control: no-cache
+Connection: close
+Content-Type: application/json
+
+{"Status":503,"Message":"The service is down"}
+`, string(actual))
+	actual, _ = ioutil.ReadFile(s.ErrorFilesPath + "/json/504.http")
+	s.Contains(string(actual), `{"Status":504,"Message":"Gateway Timeout"}`)
+}
+
+func (s *ErrorFilesTestSuite) Test_GenerateErrorFiles_DoesNotOverwriteExistingFiles() {
+	os.MkdirAll(s.ErrorFilesPath+"/json", 0755)
+	ioutil.WriteFile(s.ErrorFilesPath+"/json/503.http", []byte("custom"), 0644)
+	written := []string{}
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		written = append(written, filename)
+		return nil
+	}
+
+	GenerateErrorFiles()
+
+	s.Len(written, 8)
+	s.NotContains(written, s.ErrorFilesPath+"/json/503.http")
+}
+
+// ValidateService
+
+func (s *ErrorFilesTestSuite) Test_ValidateService_ReturnsNil_WhenJsonErrorFilesWereGenerated() {
+	GenerateErrorFiles()
+
+	s.NoError(ValidateService(Service{ErrorResponseFormat: "json"}))
+}
+
+func (s *ErrorFilesTestSuite) Test_ValidateService_ReturnsError_WhenJsonErrorFilesDoNotExist() {
+	err := ValidateService(Service{ErrorResponseFormat: "json"})
+
+	s.IsType(&ErrValidation{}, err)
+	s.Equal([]string{"errorResponseFormat"}, err.(*ErrValidation).Fields)
+}
+
+func (s *ErrorFilesTestSuite) Test_ValidateService_ReturnsError_WhenErrorResponseFormatIsNotSupported() {
+	err := ValidateService(Service{ErrorResponseFormat: "xml"})
+
+	s.IsType(&ErrValidation{}, err)
+	s.Equal([]string{"errorResponseFormat"}, err.(*ErrValidation).Fields)
+}
+
+// RenderBackend
+
+func (s *ErrorFilesTestSuite) Test_RenderBackend_ReferencesJsonErrorFiles_WhenErrorResponseFormatIsJson() {
+	for _, renderer := range configRenderers {
+		actual := renderer.RenderBackend(Service{ServiceName: "my-service", ErrorResponseFormat: "json"})
+
+		s.Contains(actual, "\n    errorfile 503 "+s.ErrorFilesPath+"/json/503.http")
+		s.Equal(9, strings.Count(actual, "errorfile "))
+	}
+}
+
+func (s *ErrorFilesTestSuite) Test_RenderBackend_DoesNotReferenceErrorFiles_WhenErrorResponseFormatIsHtml() {
+	for _, format := range []string{"", "html"} {
+		actual := configRenderers["haproxy-1.7"].RenderBackend(Service{ServiceName: "my-service", ErrorResponseFormat: format})
+
+		s.NotContains(actual, "errorfile")
+	}
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrServiceNotFound is returned when an operation refers to a service that is not registered
+var ErrServiceNotFound = errors.New("The service was not found")
+
+// ErrTemplateMissing is returned when the proxy configuration cannot be created because a template does not exist
+var ErrTemplateMissing = errors.New("The template is missing")
+
+// ErrReadOnly is returned when the configuration is changed while mutations are not allowed (see SetAllowMutations)
+var ErrReadOnly = errors.New("The proxy is in read-only mode")
+
+// ErrReconfigureRequired is returned when a change cannot be applied to the running proxy
+// and the service needs to be reconfigured instead
+var ErrReconfigureRequired = errors.New("The change requires the service to be reconfigured")
+
+// ErrIdempotencyKeyInFlight is returned when a request with the same idempotency key is still being processed
+var ErrIdempotencyKeyInFlight = errors.New("A request with the same idempotency key is being processed")
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is sent with a request that differs from the one it was used for
+var ErrIdempotencyKeyReused = errors.New("The idempotency key was already used for a different request")
+
+// ErrValidation is returned when the input of an operation is invalid
+type ErrValidation struct {
+	// The names of the invalid parameters
+	Fields  []string
+	Message string
+}
+
+func (e *ErrValidation) Error() string {
+	if len(e.Message) > 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("The following parameters are invalid: %s", strings.Join(e.Fields, ", "))
+}
+
+// ErrConflict is returned when a service uses a destination that already belongs to another service
+type ErrConflict struct {
+	// The name of the service that uses the destination
+	Owner string
+	Path  string
+	// The source port of a tcp destination that is not routed by domains
+	Port int
+	// The source port range that overlaps with the ports of the owner or, without an owner, with the port defined through BIND_PORTS
+	PortRange string
+}
+
+func (e *ErrConflict) Error() string {
+	if len(e.PortRange) > 0 && len(e.Owner) == 0 {
+		return fmt.Sprintf("The srcPortRange %s overlaps with the port %d defined through BIND_PORTS", e.PortRange, e.Port)
+	} else if len(e.PortRange) > 0 {
+		return fmt.Sprintf("The srcPortRange %s overlaps with ports used by the service %s", e.PortRange, e.Owner)
+	}
+	if e.Port > 0 {
+		return fmt.Sprintf("The port %d is already used by the tcp service %s. Services sharing a port must set serviceDomain or sniDomain.", e.Port, e.Owner)
+	}
+	return fmt.Sprintf("The path %s is already used by the service %s", e.Path, e.Owner)
+}
+
+// ErrForbidden is returned when the caller is not allowed to register a domain of the service (see DOMAIN_OWNERSHIP_FILE)
+type ErrForbidden struct {
+	Domain string
+	// The pattern of the domain ownership policy that matched the domain
+	Pattern string
+}
+
+func (e *ErrForbidden) Error() string {
+	return fmt.Sprintf("The caller is not allowed to register the domain %s (it matches the pattern %s of the domain ownership policy)", e.Domain, e.Pattern)
+}
+
+// ErrReloadFailed is returned when HAProxy could not be started or reloaded
+type ErrReloadFailed struct {
+	// The command and the configuration that failed
+	Output string
+	Err    error
+	// The services whose configuration is invalid, if they could be identified
+	BrokenServices []string
+}
+
+func (e *ErrReloadFailed) Error() string {
+	if len(e.BrokenServices) > 0 {
+		return fmt.Sprintf("%s\nThe configuration of the services %s is invalid\n%s", e.Err.Error(), strings.Join(e.BrokenServices, ", "), e.Output)
+	}
+	return fmt.Sprintf("%s\n%s", e.Err.Error(), e.Output)
+}
+
+func (e *ErrReloadFailed) Unwrap() error {
+	return e.Err
+}
+
+// ErrInvalidConfig is returned when the generated configuration does not pass the validation (haproxy -c).
+// The previous configuration is left in place.
+type ErrInvalidConfig struct {
+	// The output of the validation
+	Err error
+	// The services whose configuration is invalid, if they could be identified
+	BrokenServices []string
+}
+
+func (e *ErrInvalidConfig) Error() string {
+	if len(e.BrokenServices) > 0 {
+		return fmt.Sprintf("The configuration is invalid and was not applied\nThe configuration of the services %s is invalid\n%s", strings.Join(e.BrokenServices, ", "), e.Err.Error())
+	}
+	return fmt.Sprintf("The configuration is invalid and was not applied\n%s", e.Err.Error())
+}
+
+func (e *ErrInvalidConfig) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"../audit"
+)
+
+// The number of events a subscriber can fall behind before new events are dropped for it
+const serviceChangeBuffer = 100
+
+// ServiceChangeEvent is published when the configuration of a service changed after a successful reload.
+// OldHash is empty when the service was added and NewHash is empty when it was removed.
+// Changes contains the names of the parameters that differ between both versions.
+// Events with Health report a health transition of the service instead and leave the hashes empty.
+type ServiceChangeEvent struct {
+	ServiceName string
+	OldHash     string
+	NewHash     string
+	Changes     []string
+	Health      *HealthChange
+}
+
+// HealthChange is a transition of a backend or one of its servers between UP and DOWN
+type HealthChange struct {
+	Backend     string
+	Server      string
+	OldState    string
+	NewState    string
+	Timestamp   time.Time
+	CheckOutput string
+}
+
+// The services and their hashes as of the last successful reload
+var serviceChanges = struct {
+	sync.Mutex
+	subscribers []chan ServiceChangeEvent
+	services    map[string]Service
+	hashes      map[string]string
+}{services: map[string]Service{}, hashes: map[string]string{}}
+
+var recordServiceChangesOnce sync.Once
+
+// Subscribe returns a channel that receives an event each time a reload changes the configuration of a service
+// and each time a health transition of a service is published.
+// Events are dropped if the subscriber does not keep up with them.
+func Subscribe() <-chan ServiceChangeEvent {
+	ch := make(chan ServiceChangeEvent, serviceChangeBuffer)
+	serviceChanges.Lock()
+	defer serviceChanges.Unlock()
+	serviceChanges.subscribers = append(serviceChanges.subscribers, ch)
+	return ch
+}
+
+// RecordServiceChanges records the service change and health events in the audit log
+func RecordServiceChanges() {
+	recordServiceChangesOnce.Do(func() {
+		go auditServiceChanges(Subscribe())
+	})
+}
+
+// PublishHealthChange sends the health transition of the service to the subscribers
+func PublishHealthChange(serviceName string, change HealthChange) {
+	serviceChanges.Lock()
+	defer serviceChanges.Unlock()
+	sendServiceChangeEvent(ServiceChangeEvent{ServiceName: serviceName, Health: &change})
+}
+
+// ServiceSnippetHash returns the hash of the configuration snippets rendered for the service by the renderer and of its parameters.
+// Services with the same hash produce the same configuration.
+func ServiceSnippetHash(renderer ConfigRenderer, s Service) string {
+	// Rendering modifies the destinations and domains
+	s = deepCopy(reflect.ValueOf(s)).Interface().(Service)
+	content := renderer.RenderFrontend(s) + "\n" + renderer.RenderBackend(s) + "\n" + GetParamsFromService(s).Encode()
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+}
+
+// Compares the registered services with those of the previous successful reload and publishes an event for each
+// service that was added, removed, or whose hash changed
+func publishServiceChanges(renderer ConfigRenderer) {
+	serviceChanges.Lock()
+	defer serviceChanges.Unlock()
+	services := map[string]Service{}
+	hashes := map[string]string{}
+	dataMu.RLock()
+	for name, s := range data.Services {
+		services[name] = deepCopy(reflect.ValueOf(s)).Interface().(Service)
+		hashes[name] = ServiceSnippetHash(renderer, s)
+	}
+	dataMu.RUnlock()
+	names := []string{}
+	for name := range services {
+		names = append(names, name)
+	}
+	for name := range serviceChanges.services {
+		if _, ok := services[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		oldHash, newHash := serviceChanges.hashes[name], hashes[name]
+		if oldHash == newHash {
+			continue
+		}
+		sendServiceChangeEvent(ServiceChangeEvent{
+			ServiceName: name,
+			OldHash:     oldHash,
+			NewHash:     newHash,
+			Changes:     getChangedParams(DiffService(serviceChanges.services[name], services[name])),
+		})
+	}
+	serviceChanges.services = services
+	serviceChanges.hashes = hashes
+}
+
+// The caller must hold the lock of the service changes
+func sendServiceChangeEvent(event ServiceChangeEvent) {
+	for _, ch := range serviceChanges.subscribers {
+		select {
+		case ch <- event:
+		default:
+			logPrintf("The change event of the service %s was dropped since a subscriber is not receiving events", event.ServiceName)
+		}
+	}
+}
+
+func auditServiceChanges(events <-chan ServiceChangeEvent) {
+	for event := range events {
+		if event.Health != nil {
+			audit.Instance.Append(
+				"health",
+				"The server %s of the backend %s changed its state from %s to %s",
+				event.Health.Server,
+				event.Health.Backend,
+				event.Health.OldState,
+				event.Health.NewState,
+			)
+		} else if len(event.OldHash) == 0 {
+			audit.Instance.Append("service-added", "The service %s was added", event.ServiceName)
+		} else if len(event.NewHash) == 0 {
+			audit.Instance.Append("service-removed", "The service %s was removed", event.ServiceName)
+		} else {
+			audit.Instance.Append("service-changed", "The parameters %v of the service %s changed", event.Changes, event.ServiceName)
+		}
+	}
+}
+
+// Returns the names of the parameters that differ. Domains and destinations are reported as a whole.
+func getChangedParams(diff ServiceDiff) []string {
+	changes := []string{}
+	for _, change := range diff.Changes {
+		changes = append(changes, change.Field)
+	}
+	if len(diff.AddedDomains) > 0 || len(diff.RemovedDomains) > 0 {
+		changes = append(changes, "serviceDomain")
+	}
+	if len(diff.AddedDestinations) > 0 || len(diff.RemovedDestinations) > 0 || len(diff.ChangedDestinations) > 0 {
+		changes = append(changes, "serviceDest")
+	}
+	return changes
+}
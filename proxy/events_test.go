@@ -0,0 +1,185 @@
+// +build !integration
+
+package proxy
+
+import (
+	"../audit"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type EventsTestSuite struct {
+	suite.Suite
+	dataOrig Data
+	events   <-chan ServiceChangeEvent
+}
+
+func TestEventsUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(EventsTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *EventsTestSuite) SetupTest() {
+	s.dataOrig = data
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{}}
+	serviceChanges.services = map[string]Service{}
+	serviceChanges.hashes = map[string]string{}
+	serviceChanges.subscribers = nil
+	s.events = Subscribe()
+	readPidFile = func(fileName string) ([]byte, error) {
+		return []byte("123"), nil
+	}
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return nil
+	}
+}
+
+func (s *EventsTestSuite) TearDownTest() {
+	data = s.dataOrig
+	serviceChanges.subscribers = nil
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return cmd.Run()
+	}
+}
+
+// Subscribe
+
+func (s *EventsTestSuite) Test_Subscribe_ReceivesEvent_WhenServiceIsAdded() {
+	data.Services["my-service"] = s.getService("/api")
+
+	s.NoError(HaProxy{}.Reload())
+
+	event := s.receive()
+	s.Equal("my-service", event.ServiceName)
+	s.Empty(event.OldHash)
+	s.Equal(ServiceSnippetHash(haProxy17Renderer{}, s.getService("/api")), event.NewHash)
+	s.Contains(event.Changes, "serviceName")
+	s.Contains(event.Changes, "serviceDest")
+	s.assertNoEvents()
+}
+
+func (s *EventsTestSuite) Test_Subscribe_ReceivesEvent_WhenServiceIsModified() {
+	data.Services["my-service"] = s.getService("/api")
+	publishServiceChanges(haProxy17Renderer{})
+	s.receive()
+	modified := s.getService("/api")
+	modified.ServiceDomain = []string{"example.com"}
+	modified.BalanceMode = "leastconn"
+	data.Services["my-service"] = modified
+
+	publishServiceChanges(haProxy17Renderer{})
+
+	event := s.receive()
+	s.Equal("my-service", event.ServiceName)
+	s.Equal(ServiceSnippetHash(haProxy17Renderer{}, s.getService("/api")), event.OldHash)
+	s.Equal(ServiceSnippetHash(haProxy17Renderer{}, modified), event.NewHash)
+	s.Equal([]string{"balanceMode", "serviceDomain"}, event.Changes)
+	s.assertNoEvents()
+}
+
+func (s *EventsTestSuite) Test_Subscribe_ReceivesEvent_WhenServiceIsRemoved() {
+	data.Services["my-service"] = s.getService("/api")
+	publishServiceChanges(haProxy17Renderer{})
+	oldEvent := s.receive()
+	delete(data.Services, "my-service")
+
+	publishServiceChanges(haProxy17Renderer{})
+
+	event := s.receive()
+	s.Equal("my-service", event.ServiceName)
+	s.Equal(oldEvent.NewHash, event.OldHash)
+	s.Empty(event.NewHash)
+	s.assertNoEvents()
+}
+
+func (s *EventsTestSuite) Test_Subscribe_DoesNotReceiveEvent_WhenServiceIsReAddedWithoutChanges() {
+	data.Services["my-service"] = s.getService("/api")
+	publishServiceChanges(haProxy17Renderer{})
+	s.receive()
+	data.Services["my-service"] = s.getService("/api")
+
+	publishServiceChanges(haProxy17Renderer{})
+
+	s.assertNoEvents()
+}
+
+func (s *EventsTestSuite) Test_Subscribe_DoesNotReceiveEvent_WhenReloadFails() {
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return exec.ErrNotFound
+	}
+	data.Services["my-service"] = s.getService("/api")
+
+	HaProxy{}.Reload()
+
+	s.assertNoEvents()
+}
+
+// PublishHealthChange
+
+func (s *EventsTestSuite) Test_PublishHealthChange_SendsEventToSubscribers() {
+	change := HealthChange{Backend: "my-service-be8080", Server: "my-service_1", OldState: "UP", NewState: "DOWN"}
+
+	PublishHealthChange("my-service", change)
+
+	event := s.receive()
+	s.Equal("my-service", event.ServiceName)
+	s.Equal(&change, event.Health)
+	s.Empty(event.NewHash)
+}
+
+// auditServiceChanges
+
+func (s *EventsTestSuite) Test_AuditServiceChanges_AppendsEntries() {
+	log := audit.NewLog(10)
+	auditOrig := audit.Instance
+	defer func() { audit.Instance = auditOrig }()
+	audit.Instance = log
+	events := make(chan ServiceChangeEvent, 4)
+	events <- ServiceChangeEvent{ServiceName: "a", NewHash: "1"}
+	events <- ServiceChangeEvent{ServiceName: "a", OldHash: "1", NewHash: "2", Changes: []string{"balanceMode"}}
+	events <- ServiceChangeEvent{ServiceName: "a", OldHash: "2"}
+	events <- ServiceChangeEvent{ServiceName: "a", Health: &HealthChange{Backend: "a-be8080", Server: "a_1", OldState: "UP", NewState: "DOWN"}}
+	close(events)
+
+	auditServiceChanges(events)
+
+	entries := log.GetEntries(0)
+	s.Require().Len(entries, 4)
+	s.Equal("service-added", entries[0].Event)
+	s.Equal("service-changed", entries[1].Event)
+	s.Contains(entries[1].Message, "balanceMode")
+	s.Equal("service-removed", entries[2].Event)
+	s.Equal("health", entries[3].Event)
+	s.Contains(entries[3].Message, "a_1")
+}
+
+// Util
+
+func (s *EventsTestSuite) getService(path string) Service {
+	return Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "8080", ServicePath: []string{path}}},
+	}
+}
+
+func (s *EventsTestSuite) receive() ServiceChangeEvent {
+	select {
+	case event := <-s.events:
+		return event
+	case <-time.After(time.Second):
+		s.Fail("No event was received")
+		return ServiceChangeEvent{}
+	}
+}
+
+func (s *EventsTestSuite) assertNoEvents() {
+	select {
+	case event := <-s.events:
+		s.Fail("Unexpected event", "%v", event)
+	default:
+	}
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The directives allowed in backendExtra and frontendExtra when EXTRA_DIRECTIVE_ALLOWLIST is not set
+var defaultExtraDirectiveAllowlist = []string{
+	"balance",
+	"compression",
+	"cookie",
+	"external-check",
+	"hash-type",
+	"http-check",
+	"http-request",
+	"http-response",
+	"http-send-name-header",
+	"option",
+	"retries",
+	"timeout",
+}
+
+// The directives that accept an if/unless condition
+var conditionalDirectives = map[string]bool{
+	"http-request":  true,
+	"http-response": true,
+	"redirect":      true,
+	"tcp-request":   true,
+	"tcp-response":  true,
+}
+
+// ValidateExtraDirectives returns a validation error if a backendExtra or frontendExtra entry of the service
+// starts with a directive that is not in the allowlist (EXTRA_DIRECTIVE_ALLOWLIST).
+func ValidateExtraDirectives(s Service) error {
+	allowlist := getExtraDirectiveAllowlist()
+	fields := map[string][]string{"backendExtra": s.BackendExtra, "frontendExtra": s.FrontendExtra}
+	for _, field := range []string{"backendExtra", "frontendExtra"} {
+		for _, entry := range fields[field] {
+			directive := getDirectiveKeyword(entry)
+			if len(directive) == 0 {
+				continue
+			}
+			if !allowlist[strings.ToLower(directive)] {
+				return &ErrValidation{
+					Fields:  []string{field},
+					Message: fmt.Sprintf("The directive %s used in %s is not allowed", directive, field),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SanitizeDirective converts an extra entry into a single configuration line
+func SanitizeDirective(entry string) string {
+	entry = strings.Replace(entry, "\r", " ", -1)
+	return strings.TrimSpace(strings.Replace(entry, "\n", " ", -1))
+}
+
+// Returns the frontendExtra entries of the service.
+// Conditional directives without their own condition are limited to the requests that match the service destinations.
+func (m *HaProxy) getFrontendExtra(s Service) string {
+	extra := ""
+	for _, entry := range s.FrontendExtra {
+		entry = SanitizeDirective(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		if conditionalDirectives[strings.ToLower(getDirectiveKeyword(entry))] && !hasCondition(entry) && len(s.ServiceDest) > 0 {
+			entry += " if " + m.getRedirectCondition(s, "")
+		}
+		extra += "\n    " + entry
+	}
+	return extra
+}
+
+func getExtraDirectiveAllowlist() map[string]bool {
+	directives := defaultExtraDirectiveAllowlist
+	if value := os.Getenv("EXTRA_DIRECTIVE_ALLOWLIST"); len(value) > 0 {
+		directives = strings.Split(value, ",")
+	}
+	allowlist := map[string]bool{}
+	for _, directive := range directives {
+		allowlist[strings.ToLower(strings.TrimSpace(directive))] = true
+	}
+	return allowlist
+}
+
+func getDirectiveKeyword(entry string) string {
+	fields := strings.Fields(SanitizeDirective(entry))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+func hasCondition(entry string) bool {
+	for _, field := range strings.Fields(entry) {
+		if field == "if" || field == "unless" {
+			return true
+		}
+	}
+	return false
+}
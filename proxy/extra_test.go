@@ -0,0 +1,91 @@
+// +build !integration
+
+package proxy
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ExtraTestSuite struct {
+	suite.Suite
+}
+
+func TestExtraUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(ExtraTestSuite)
+	suite.Run(t, s)
+}
+
+// ValidateExtraDirectives
+
+func (s *ExtraTestSuite) Test_ValidateExtraDirectives_ReturnsNil_WhenDirectivesAreAllowed() {
+	service := Service{
+		BackendExtra:  []string{"http-send-name-header X-Server", "external-check command /bin/true"},
+		FrontendExtra: []string{"http-request set-header X-Service my-service"},
+	}
+
+	s.NoError(ValidateExtraDirectives(service))
+}
+
+func (s *ExtraTestSuite) Test_ValidateExtraDirectives_ReturnsError_WhenBackendDirectiveIsNotAllowed() {
+	service := Service{BackendExtra: []string{"http-send-name-header X-Server", "server other 10.0.0.1:80"}}
+
+	err := ValidateExtraDirectives(service)
+
+	s.Equal(&ErrValidation{Fields: []string{"backendExtra"}, Message: "The directive server used in backendExtra is not allowed"}, err)
+}
+
+func (s *ExtraTestSuite) Test_ValidateExtraDirectives_ReturnsError_WhenFrontendDirectiveIsNotAllowed() {
+	service := Service{FrontendExtra: []string{"use_backend other-be"}}
+
+	err := ValidateExtraDirectives(service)
+
+	s.Equal(&ErrValidation{Fields: []string{"frontendExtra"}, Message: "The directive use_backend used in frontendExtra is not allowed"}, err)
+}
+
+func (s *ExtraTestSuite) Test_ValidateExtraDirectives_ValidatesTheDirectiveOfEachLine() {
+	service := Service{BackendExtra: []string{"option forwardfor\nserver other 10.0.0.1:80"}}
+
+	s.NoError(ValidateExtraDirectives(service))
+	s.Equal("option forwardfor server other 10.0.0.1:80", SanitizeDirective(service.BackendExtra[0]))
+}
+
+func (s *ExtraTestSuite) Test_ValidateExtraDirectives_UsesExtraDirectiveAllowlistEnvVar() {
+	defer os.Unsetenv("EXTRA_DIRECTIVE_ALLOWLIST")
+	os.Setenv("EXTRA_DIRECTIVE_ALLOWLIST", "server, option")
+
+	s.NoError(ValidateExtraDirectives(Service{BackendExtra: []string{"server other 10.0.0.1:80"}}))
+	s.Error(ValidateExtraDirectives(Service{BackendExtra: []string{"http-send-name-header X-Server"}}))
+}
+
+// getFrontendExtra
+
+func (s *ExtraTestSuite) Test_GetFrontendExtra_WrapsConditionalDirectivesInServiceAcls() {
+	m := HaProxy{}
+	service := Service{
+		ServiceName:   "my-service",
+		AclCondition:  " domain_my-service",
+		FrontendExtra: []string{"http-request set-header X-Service my-service", "option forwardfor"},
+		ServiceDest:   []ServiceDest{{Port: "1111"}, {Port: "2222"}},
+	}
+	expected := `
+    http-request set-header X-Service my-service if url_my-service1111 domain_my-service || url_my-service2222 domain_my-service
+    option forwardfor`
+
+	s.Equal(expected, m.getFrontendExtra(service))
+}
+
+func (s *ExtraTestSuite) Test_GetFrontendExtra_DoesNotWrapDirectivesWithConditions() {
+	m := HaProxy{}
+	service := Service{
+		ServiceName:   "my-service",
+		FrontendExtra: []string{"http-request deny unless { src 10.0.0.0/8 }"},
+		ServiceDest:   []ServiceDest{{Port: "1111"}},
+	}
+
+	s.Equal(`
+    http-request deny unless { src 10.0.0.0/8 }`, m.getFrontendExtra(service))
+}
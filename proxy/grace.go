@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The backend options rendered while a destination is in its deployment grace period.
+// Failed connections are retried and redispatched to another server after the first retry.
+const deploymentGraceBackendOptions = `
+    retries 3
+    option redispatch 1`
+
+// GetUpdatedAt returns the time the service was last changed.
+// If the service is registered with the same parameters, the time of the registered version is kept.
+func GetUpdatedAt(s Service, services map[string]Service) time.Time {
+	current, ok := services[s.ServiceName]
+	if ok && getComparableParams(current) == getComparableParams(s) {
+		return current.UpdatedAt
+	}
+	return timeNow()
+}
+
+// GetDeploymentGraceRemaining returns how long the destination stays in its deployment grace period
+// or zero if it is not in it
+func GetDeploymentGraceRemaining(s Service, sd ServiceDest) time.Duration {
+	if len(sd.DeploymentGrace) == 0 || s.UpdatedAt.IsZero() {
+		return 0
+	}
+	grace, err := parseDuration(sd.DeploymentGrace)
+	if err != nil {
+		return 0
+	}
+	remaining := s.UpdatedAt.Add(grace).Sub(timeNow())
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// GetDeploymentGraceOptions returns the backend options and the server options of the destination.
+// Both are empty outside of the deployment grace period.
+// Servers are marked down on errors so that the retries are redispatched instead of hitting a dead address.
+func GetDeploymentGraceOptions(s Service, sd ServiceDest) (backend, server string) {
+	if GetDeploymentGraceRemaining(s, sd) == 0 {
+		return "", ""
+	}
+	observe := "layer7"
+	if len(s.ReqMode) > 0 && !strings.EqualFold(s.ReqMode, "http") {
+		observe = "layer4"
+	}
+	return deploymentGraceBackendOptions, fmt.Sprintf(" on-error mark-down observe %s error-limit 10", observe)
+}
+
+// DrainServers puts the servers of the service in the drain state through the runtime socket
+// so that they stop receiving new connections while the existing ones are completed.
+// Nothing is done if the socket does not exist.
+func DrainServers(s Service) {
+	if _, err := statFile(haproxySocketPath); err != nil {
+		return
+	}
+	id := getIdentifier(s)
+	for _, sd := range s.ServiceDest {
+		backends := []string{GetBackendName(s, sd)}
+		if s.HttpsPort > 0 {
+			backends = append(backends, "https-"+backends[0])
+		}
+		server := id
+		if sd.IsUnixSocket() {
+			server = id + "_" + sd.SocketHash()
+		}
+		for _, backend := range backends {
+			command := fmt.Sprintf("set server %s/%s state drain", backend, server)
+			if err := sendRuntimeCommand(haproxySocketPath, command); err != nil {
+				logPrintf("Could not drain the server %s/%s\n%s", backend, server, err.Error())
+			}
+		}
+	}
+}
+
+// Registered services contain the defaults applied while they were rendered
+func getComparableParams(s Service) string {
+	if len(s.AclName) == 0 {
+		s.AclName = GetIdentifier(s.ServiceName)
+	}
+	if len(s.ReqMode) == 0 {
+		s.ReqMode = "http"
+	}
+	if len(s.PathType) == 0 {
+		s.PathType = "path_beg"
+	}
+	return GetParamsFromService(s).Encode()
+}
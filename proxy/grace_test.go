@@ -0,0 +1,151 @@
+// +build !integration
+
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type GraceTestSuite struct {
+	suite.Suite
+	Now        time.Time
+	SocketPath string
+	Commands   []string
+}
+
+func TestGraceUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(GraceTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *GraceTestSuite) SetupTest() {
+	s.Now = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time {
+		return s.Now
+	}
+	s.Commands = []string{}
+	sendRuntimeCommand = func(socket, command string) error {
+		s.Commands = append(s.Commands, command)
+		return nil
+	}
+	socket, _ := ioutil.TempFile("", "haproxy-sock")
+	s.SocketPath = socket.Name()
+	haproxySocketPath = s.SocketPath
+}
+
+func (s *GraceTestSuite) TearDownTest() {
+	timeNow = time.Now
+	os.Remove(s.SocketPath)
+	haproxySocketPath = "/var/run/haproxy.sock"
+	sendRuntimeCommand = sendRuntimeCommandOrig
+}
+
+// GetDeploymentGraceOptions
+
+func (s *GraceTestSuite) Test_GetDeploymentGraceOptions_ReturnsOptions_WhenInGrace() {
+	sr := Service{UpdatedAt: s.Now.Add(-10 * time.Second)}
+	sd := ServiceDest{DeploymentGrace: "30s"}
+
+	backend, server := GetDeploymentGraceOptions(sr, sd)
+
+	s.Equal("\n    retries 3\n    option redispatch 1", backend)
+	s.Equal(" on-error mark-down observe layer7 error-limit 10", server)
+	s.Equal(20*time.Second, GetDeploymentGraceRemaining(sr, sd))
+}
+
+func (s *GraceTestSuite) Test_GetDeploymentGraceOptions_ObservesLayer4_WhenReqModeIsTcp() {
+	sr := Service{ReqMode: "tcp", UpdatedAt: s.Now}
+
+	_, server := GetDeploymentGraceOptions(sr, ServiceDest{DeploymentGrace: "30"})
+
+	s.Equal(" on-error mark-down observe layer4 error-limit 10", server)
+}
+
+func (s *GraceTestSuite) Test_GetDeploymentGraceOptions_ReturnsEmptyOptions_WhenGraceExpired() {
+	sr := Service{UpdatedAt: s.Now.Add(-31 * time.Second)}
+	sd := ServiceDest{DeploymentGrace: "30s"}
+
+	backend, server := GetDeploymentGraceOptions(sr, sd)
+
+	s.Empty(backend)
+	s.Empty(server)
+	s.Equal(time.Duration(0), GetDeploymentGraceRemaining(sr, sd))
+}
+
+func (s *GraceTestSuite) Test_GetDeploymentGraceOptions_ReturnsEmptyOptions_WhenUpdatedAtIsNotSet() {
+	backend, server := GetDeploymentGraceOptions(Service{}, ServiceDest{DeploymentGrace: "30s"})
+
+	s.Empty(backend)
+	s.Empty(server)
+}
+
+// GetUpdatedAt
+
+func (s *GraceTestSuite) Test_GetUpdatedAt_ReturnsTimeOfRegisteredService_WhenParamsAreTheSame() {
+	updatedAt := s.Now.Add(-time.Hour)
+	registered := Service{
+		ServiceName: "my-service",
+		AclName:     "my-service",
+		ReqMode:     "http",
+		PathType:    "path_beg",
+		ServiceDest: []ServiceDest{{Port: "8080", ServicePath: []string{"/api"}}},
+		UpdatedAt:   updatedAt,
+	}
+	proposed := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "8080", ServicePath: []string{"/api"}}},
+	}
+
+	actual := GetUpdatedAt(proposed, map[string]Service{"my-service": registered})
+
+	s.Equal(updatedAt, actual)
+}
+
+func (s *GraceTestSuite) Test_GetUpdatedAt_ReturnsNow_WhenParamsChanged() {
+	registered := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "8080"}},
+		UpdatedAt:   s.Now.Add(-time.Hour),
+	}
+	proposed := Service{
+		ServiceName: "my-service",
+		ServiceDest: []ServiceDest{{Port: "8081"}},
+	}
+
+	s.Equal(s.Now, GetUpdatedAt(proposed, map[string]Service{"my-service": registered}))
+	s.Equal(s.Now, GetUpdatedAt(proposed, map[string]Service{}))
+}
+
+// DrainServers
+
+func (s *GraceTestSuite) Test_DrainServers_SendsDrainCommands() {
+	sr := Service{
+		ServiceName: "my-service",
+		AclName:     "my-acl",
+		HttpsPort:   8443,
+		ServiceDest: []ServiceDest{{Port: "8080"}, {Port: "9090"}},
+	}
+
+	DrainServers(sr)
+
+	s.Equal([]string{
+		"set server my-acl-be8080/my-service state drain",
+		"set server https-my-acl-be8080/my-service state drain",
+		"set server my-acl-be9090/my-service state drain",
+		"set server https-my-acl-be9090/my-service state drain",
+	}, s.Commands)
+}
+
+func (s *GraceTestSuite) Test_DrainServers_DoesNothing_WhenSocketDoesNotExist() {
+	os.Remove(s.SocketPath)
+
+	DrainServers(Service{ServiceName: "my-service", ServiceDest: []ServiceDest{{Port: "8080"}}})
+
+	s.Empty(s.Commands)
+}
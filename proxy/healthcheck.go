@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The file with the patterns of the reload_failed ACL of the healthcheck frontend.
+// It is emptied whenever the configuration is created and contains `failed` after a reload fails.
+var healthcheckStatePath = "/cfg/healthcheck-state.lst"
+
+// The HAProxy runtime (stats) socket used for toggling the reload_failed ACL of the running proxy.
+// It exists only if it is defined through EXTRA_GLOBAL (e.g. `stats socket /var/run/haproxy.sock level admin`).
+var haproxySocketPath = "/var/run/haproxy.sock"
+
+// Returns the frontend answering the monitor URI with 200 while the proxy is ready and with 503 otherwise.
+// The proxy is not ready after a failed reload and, if HEALTHCHECK_REQUIRE_BACKENDS is true,
+// while none of the service backends has a usable server.
+func (m HaProxy) getHealthcheck(port string) string {
+	conditions := []string{"reload_failed"}
+	if strings.EqualFold(os.Getenv("HEALTHCHECK_REQUIRE_BACKENDS"), "true") {
+		backends := m.getBackendNames()
+		if len(backends) == 0 {
+			conditions = append(conditions, "TRUE")
+		} else {
+			nbsrv := []string{}
+			for _, backend := range backends {
+				nbsrv = append(nbsrv, fmt.Sprintf("{ nbsrv(%s) eq 0 }", backend))
+			}
+			conditions = append(conditions, strings.Join(nbsrv, " "))
+		}
+	}
+	return fmt.Sprintf(`
+frontend healthcheck%s
+    mode http
+    monitor-uri /
+    acl reload_failed str(failed) -m str -f %s
+    monitor fail if %s
+`,
+		getBindLines(port, ""),
+		healthcheckStatePath,
+		strings.Join(conditions, " || "),
+	)
+}
+
+// Returns the names of the backends of all the services sorted alphabetically
+func (m HaProxy) getBackendNames() []string {
+	names := []string{}
+	for _, s := range data.Services {
+		for _, sd := range s.ServiceDest {
+			names = append(names, GetBackendName(s, sd))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Marks the proxy as not ready. Since the running proxy keeps the previous configuration after a failed reload,
+// the reload_failed ACL is also toggled through the runtime socket when it is available.
+func (m HaProxy) setReloadFailed() {
+	if len(os.Getenv("HEALTHCHECK_PORT")) == 0 {
+		return
+	}
+	if err := writeFile(healthcheckStatePath, []byte("failed\n"), 0664); err != nil {
+		logPrintf("Could not write the healthcheck state\n%s", err.Error())
+	}
+	if _, err := statFile(haproxySocketPath); err != nil {
+		return
+	}
+	command := fmt.Sprintf("add acl %s failed", healthcheckStatePath)
+	if err := sendRuntimeCommand(haproxySocketPath, command); err != nil {
+		logPrintf("Could not mark the proxy as not ready through the runtime socket\n%s", err.Error())
+	}
+}
@@ -0,0 +1,185 @@
+// +build !integration
+
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type HealthcheckTestSuite struct {
+	suite.Suite
+}
+
+func TestHealthcheckUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	validateConfig = func(content string) error { return nil }
+	s := new(HealthcheckTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *HealthcheckTestSuite) SetupTest() {
+	os.Setenv("HEALTHCHECK_PORT", "8888")
+	readPidFile = func(fileName string) ([]byte, error) {
+		return []byte("123"), nil
+	}
+}
+
+func (s *HealthcheckTestSuite) TearDownTest() {
+	os.Unsetenv("HEALTHCHECK_PORT")
+	os.Unsetenv("HEALTHCHECK_REQUIRE_BACKENDS")
+}
+
+// CreateConfigFromTemplates
+
+func (s *HealthcheckTestSuite) Test_CreateConfigFromTemplates_AddsHealthcheckFrontend() {
+	expected := `
+frontend healthcheck
+    bind *:8888
+    mode http
+    monitor-uri /
+    acl reload_failed str(failed) -m str -f /cfg/healthcheck-state.lst
+    monitor fail if reload_failed
+
+frontend services`
+
+	actual := s.createConfig(map[string]Service{})
+
+	s.Contains(actual, expected)
+}
+
+func (s *HealthcheckTestSuite) Test_CreateConfigFromTemplates_FailsMonitor_WhenBackendsAreRequiredAndThereAreNoServices() {
+	os.Setenv("HEALTHCHECK_REQUIRE_BACKENDS", "true")
+
+	actual := s.createConfig(map[string]Service{})
+
+	s.Contains(actual, "\n    monitor fail if reload_failed || TRUE\n")
+}
+
+func (s *HealthcheckTestSuite) Test_CreateConfigFromTemplates_FailsMonitor_WhenBackendsAreRequiredAndNoneHasServers() {
+	os.Setenv("HEALTHCHECK_REQUIRE_BACKENDS", "true")
+	services := map[string]Service{
+		"my-service": {
+			ServiceName: "my-service",
+			ServiceDest: []ServiceDest{{Port: "1111"}, {Port: "2222"}},
+		},
+		"another-service": {
+			ServiceName: "another-service",
+			AclName:     "01-another",
+			ServiceDest: []ServiceDest{{Port: "3333"}},
+		},
+	}
+
+	actual := s.createConfig(services)
+
+	s.Contains(actual, "\n    monitor fail if reload_failed || { nbsrv(01-another-be3333) eq 0 } { nbsrv(my-service-be1111) eq 0 } { nbsrv(my-service-be2222) eq 0 }\n")
+}
+
+func (s *HealthcheckTestSuite) Test_CreateConfigFromTemplates_ResetsHealthcheckState() {
+	actual := map[string]string{}
+	writeFileOrig := writeFile
+	defer func() { writeFile = writeFileOrig }()
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actual[filename] = string(data)
+		return nil
+	}
+
+	NewHaProxy("test_configs/tmpl", "test_configs", map[string]bool{}).CreateConfigFromTemplates()
+
+	s.Equal("", actual["/cfg/healthcheck-state.lst"])
+}
+
+func (s *HealthcheckTestSuite) Test_CreateConfigFromTemplates_DoesNotAddHealthcheckFrontend_WhenPortIsNotSet() {
+	os.Unsetenv("HEALTHCHECK_PORT")
+
+	actual := s.createConfig(map[string]Service{})
+
+	s.NotContains(actual, "frontend healthcheck")
+}
+
+// Reload
+
+func (s *HealthcheckTestSuite) Test_Reload_MarksProxyAsNotReady_WhenReloadFails() {
+	socket, _ := ioutil.TempFile("", "haproxy-sock")
+	defer os.Remove(socket.Name())
+	socketPathOrig := haproxySocketPath
+	writeFileOrig := writeFile
+	cmdRunHaOrig := cmdRunHa
+	sendRuntimeCommandOrig := sendRuntimeCommand
+	defer func() {
+		haproxySocketPath = socketPathOrig
+		writeFile = writeFileOrig
+		cmdRunHa = cmdRunHaOrig
+		sendRuntimeCommand = sendRuntimeCommandOrig
+	}()
+	haproxySocketPath = socket.Name()
+	actualState := ""
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actualState = string(data)
+		return nil
+	}
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return fmt.Errorf("This is an error")
+	}
+	actualCommand := ""
+	sendRuntimeCommand = func(socket, command string) error {
+		actualCommand = command
+		return nil
+	}
+
+	HaProxy{}.Reload()
+
+	s.Equal("failed\n", actualState)
+	s.Equal("add acl /cfg/healthcheck-state.lst failed", actualCommand)
+}
+
+func (s *HealthcheckTestSuite) Test_Reload_DoesNotMarkProxyAsNotReady_WhenReloadSucceeds() {
+	writeFileOrig := writeFile
+	cmdRunHaOrig := cmdRunHa
+	defer func() {
+		writeFile = writeFileOrig
+		cmdRunHa = cmdRunHaOrig
+	}()
+	called := false
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		called = true
+		return nil
+	}
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return nil
+	}
+
+	HaProxy{}.Reload()
+
+	s.False(called)
+}
+
+// Util
+
+func (s *HealthcheckTestSuite) createConfig(services map[string]Service) string {
+	dataOrig := data
+	writeFileOrig := writeFile
+	defer func() {
+		data = dataOrig
+		writeFile = writeFileOrig
+	}()
+	actual := ""
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		if strings.HasSuffix(filename, "haproxy.cfg") {
+			actual = string(data)
+		}
+		return nil
+	}
+	p := NewHaProxy("test_configs/tmpl", "test_configs", map[string]bool{})
+	data.Services = services
+
+	p.CreateConfigFromTemplates()
+
+	return actual
+}
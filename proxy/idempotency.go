@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyCache remembers the responses of recently processed requests so that retried requests
+// with the same key are not applied twice.
+type IdempotencyCache struct {
+	ttl     time.Duration
+	size    int
+	mu      sync.Mutex
+	keys    []string
+	entries map[string]idempotencyEntry
+	// The keys of the requests being processed. The channels are closed when the processing finishes.
+	inFlight map[string]chan struct{}
+}
+
+type IdempotentResponse struct {
+	Status int
+	// The headers of the response (e.g. Content-Type)
+	Header http.Header
+	Body   []byte
+	// The fingerprint of the request the response was sent to. Requests reusing the key must have the same one.
+	Request string
+}
+
+type idempotencyEntry struct {
+	response IdempotentResponse
+	expires  time.Time
+}
+
+var Idempotency = NewIdempotencyCache(10*time.Minute, 1000)
+
+func NewIdempotencyCache(ttl time.Duration, size int) *IdempotencyCache {
+	return &IdempotencyCache{
+		ttl:      ttl,
+		size:     size,
+		entries:  map[string]idempotencyEntry{},
+		inFlight: map[string]chan struct{}{},
+	}
+}
+
+func (m *IdempotencyCache) Get(key string) (IdempotentResponse, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removeExpired()
+	entry, ok := m.entries[key]
+	return entry.response, ok
+}
+
+// Reserve returns the stored response and true if a request with the key was already processed.
+// Otherwise, the key is reserved for the caller, which must either Put the response or Release the key.
+// If another request with the key is being processed, Reserve waits until it finishes or the context is done.
+func (m *IdempotencyCache) Reserve(ctx context.Context, key string) (IdempotentResponse, bool, error) {
+	for {
+		m.mu.Lock()
+		m.removeExpired()
+		if entry, ok := m.entries[key]; ok {
+			m.mu.Unlock()
+			return entry.response, true, nil
+		}
+		done, ok := m.inFlight[key]
+		if !ok {
+			m.inFlight[key] = make(chan struct{})
+			m.mu.Unlock()
+			return IdempotentResponse{}, false, nil
+		}
+		m.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return IdempotentResponse{}, false, ErrIdempotencyKeyInFlight
+		}
+	}
+}
+
+// Release removes the reservation of the key without storing a response so that the request can be retried
+func (m *IdempotencyCache) Release(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.release(key)
+}
+
+func (m *IdempotencyCache) Put(key string, response IdempotentResponse) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.release(key)
+	m.removeExpired()
+	if _, ok := m.entries[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.entries[key] = idempotencyEntry{response: response, expires: timeNow().Add(m.ttl)}
+	for len(m.keys) > m.size {
+		delete(m.entries, m.keys[0])
+		m.keys = m.keys[1:]
+	}
+}
+
+// Len returns the number of responses that did not expire
+func (m *IdempotencyCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removeExpired()
+	return len(m.keys)
+}
+
+func (m *IdempotencyCache) release(key string) {
+	if done, ok := m.inFlight[key]; ok {
+		close(done)
+		delete(m.inFlight, key)
+	}
+}
+
+func (m *IdempotencyCache) removeExpired() {
+	now := timeNow()
+	keys := []string{}
+	for _, key := range m.keys {
+		if now.Before(m.entries[key].expires) {
+			keys = append(keys, key)
+		} else {
+			delete(m.entries, key)
+		}
+	}
+	m.keys = keys
+}
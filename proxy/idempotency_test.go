@@ -0,0 +1,138 @@
+// +build !integration
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+type IdempotencyTestSuite struct {
+	suite.Suite
+	Now time.Time
+}
+
+func TestIdempotencyUnitTestSuite(t *testing.T) {
+	s := new(IdempotencyTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *IdempotencyTestSuite) SetupTest() {
+	s.Now = time.Now()
+	timeNow = func() time.Time {
+		return s.Now
+	}
+}
+
+func (s *IdempotencyTestSuite) TearDownTest() {
+	timeNow = time.Now
+}
+
+// Get
+
+func (s *IdempotencyTestSuite) Test_Get_ReturnsStoredResponse() {
+	expected := IdempotentResponse{Status: 200, Body: []byte("body")}
+	c := NewIdempotencyCache(time.Minute, 10)
+	c.Put("key-1", expected)
+
+	actual, ok := c.Get("key-1")
+
+	s.True(ok)
+	s.Equal(expected, actual)
+}
+
+func (s *IdempotencyTestSuite) Test_Get_ReturnsFalse_WhenKeyIsUnknown() {
+	c := NewIdempotencyCache(time.Minute, 10)
+	c.Put("key-1", IdempotentResponse{Status: 200})
+
+	_, ok := c.Get("key-2")
+
+	s.False(ok)
+}
+
+func (s *IdempotencyTestSuite) Test_Get_ReturnsFalse_WhenEntryExpired() {
+	c := NewIdempotencyCache(time.Minute, 10)
+	c.Put("key-1", IdempotentResponse{Status: 200})
+	s.Now = s.Now.Add(time.Minute)
+
+	_, ok := c.Get("key-1")
+
+	s.False(ok)
+}
+
+// Put
+
+func (s *IdempotencyTestSuite) Test_Put_RemovesOldestEntries_WhenSizeIsExceeded() {
+	c := NewIdempotencyCache(time.Minute, 2)
+	for i := 1; i <= 3; i++ {
+		c.Put(fmt.Sprintf("key-%d", i), IdempotentResponse{Status: 200})
+	}
+
+	_, ok1 := c.Get("key-1")
+	_, ok2 := c.Get("key-2")
+	_, ok3 := c.Get("key-3")
+
+	s.False(ok1)
+	s.True(ok2)
+	s.True(ok3)
+}
+
+// Reserve
+
+func (s *IdempotencyTestSuite) Test_Reserve_ReturnsStoredResponse() {
+	expected := IdempotentResponse{Status: 200, Body: []byte("body")}
+	c := NewIdempotencyCache(time.Minute, 10)
+	c.Put("key-1", expected)
+
+	actual, ok, err := c.Reserve(context.Background(), "key-1")
+
+	s.NoError(err)
+	s.True(ok)
+	s.Equal(expected, actual)
+}
+
+func (s *IdempotencyTestSuite) Test_Reserve_WaitsForReservedKey() {
+	expected := IdempotentResponse{Status: 200, Body: []byte("body")}
+	c := NewIdempotencyCache(time.Minute, 10)
+	_, ok, _ := c.Reserve(context.Background(), "key-1")
+	s.Require().False(ok)
+	reserved := make(chan IdempotentResponse)
+	go func() {
+		actual, _, _ := c.Reserve(context.Background(), "key-1")
+		reserved <- actual
+	}()
+
+	select {
+	case <-reserved:
+		s.Fail("Reserve returned before the reserved key was stored")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.Put("key-1", expected)
+
+	s.Equal(expected, <-reserved)
+}
+
+func (s *IdempotencyTestSuite) Test_Reserve_ReservesKey_WhenItIsReleased() {
+	c := NewIdempotencyCache(time.Minute, 10)
+	c.Reserve(context.Background(), "key-1")
+	c.Release("key-1")
+
+	_, ok, err := c.Reserve(context.Background(), "key-1")
+
+	s.NoError(err)
+	s.False(ok)
+}
+
+func (s *IdempotencyTestSuite) Test_Reserve_ReturnsErrIdempotencyKeyInFlight_WhenContextIsDone() {
+	c := NewIdempotencyCache(time.Minute, 10)
+	c.Reserve(context.Background(), "key-1")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := c.Reserve(ctx, "key-1")
+
+	s.Equal(ErrIdempotencyKeyInFlight, err)
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GetIdentifier returns the form of the service name used in the names of ACLs, frontends, backends, and servers.
+// Characters HAProxy does not accept in identifiers are replaced with underscores.
+func GetIdentifier(serviceName string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '-', r == '_', r == '.', r == ':':
+			return r
+		}
+		return '_'
+	}, serviceName)
+}
+
+// ValidateIdentifier returns a validation error if the name of the service does not produce a usable identifier
+// or if its identifier is already used by another of the services
+func ValidateIdentifier(s Service, services map[string]Service) error {
+	if len(s.ServiceName) == 0 {
+		return nil
+	}
+	id := GetIdentifier(s.ServiceName)
+	if len(strings.Trim(id, "_")) == 0 {
+		return &ErrValidation{
+			Fields:  []string{"serviceName"},
+			Message: fmt.Sprintf("The service name %s does not contain any character allowed in HAProxy identifiers", s.ServiceName),
+		}
+	}
+	for name := range services {
+		if name != s.ServiceName && GetIdentifier(name) == id {
+			return &ErrValidation{
+				Fields:  []string{"serviceName"},
+				Message: fmt.Sprintf("The services %s and %s would use the same identifier %s", s.ServiceName, name, id),
+			}
+		}
+	}
+	return nil
+}
+
+// GetBackendName returns the name of the backend of the destination of the service.
+// The frontends and the backends use it so that they always refer to the same backend.
+// Backends are named after the ACL name, which defaults to the identifier of the service.
+func GetBackendName(s Service, sd ServiceDest) string {
+	aclName := s.AclName
+	if len(aclName) == 0 {
+		aclName = getIdentifier(s)
+	}
+	return fmt.Sprintf("%s-be%s%s", aclName, sd.PortName(), sd.SrcPortRange)
+}
+
+// Services rendered without being added keep their identifiers empty
+func getIdentifier(s Service) string {
+	if len(s.Identifier) > 0 {
+		return s.Identifier
+	}
+	return GetIdentifier(s.ServiceName)
+}
@@ -0,0 +1,87 @@
+// +build !integration
+
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type IdentifierTestSuite struct {
+	suite.Suite
+}
+
+func TestIdentifierUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(IdentifierTestSuite)
+	suite.Run(t, s)
+}
+
+// GetIdentifier
+
+func (s *IdentifierTestSuite) Test_GetIdentifier_KeepsAllowedCharacters() {
+	s.Equal("my-service_1.stack:v2", GetIdentifier("my-service_1.stack:v2"))
+}
+
+func (s *IdentifierTestSuite) Test_GetIdentifier_ReplacesDisallowedCharacters() {
+	s.Equal("my_service", GetIdentifier("my/service"))
+	s.Equal("my_service", GetIdentifier("my service"))
+	s.Equal("caf_-service", GetIdentifier("café-service"))
+	s.Equal("__", GetIdentifier("日本"))
+}
+
+// ValidateIdentifier
+
+func (s *IdentifierTestSuite) Test_ValidateIdentifier_ReturnsNil_WhenNameIsValid() {
+	services := map[string]Service{"other": {ServiceName: "other"}}
+
+	s.NoError(ValidateIdentifier(Service{ServiceName: "my.service"}, services))
+	s.NoError(ValidateIdentifier(Service{ServiceName: "my/service"}, services))
+}
+
+func (s *IdentifierTestSuite) Test_ValidateIdentifier_ReturnsError_WhenIdentifierIsEmpty() {
+	for _, name := range []string{"///", "日本", " "} {
+		err := ValidateIdentifier(Service{ServiceName: name}, nil)
+
+		s.Require().Error(err, name)
+		validationErr, ok := err.(*ErrValidation)
+		s.Require().True(ok)
+		s.Equal([]string{"serviceName"}, validationErr.Fields)
+	}
+}
+
+func (s *IdentifierTestSuite) Test_ValidateIdentifier_ReturnsError_WhenIdentifierIsUsedByAnotherService() {
+	services := map[string]Service{"a_b": {ServiceName: "a_b"}}
+
+	err := ValidateIdentifier(Service{ServiceName: "a/b"}, services)
+
+	s.Require().Error(err)
+	s.Contains(err.Error(), "a_b")
+	s.NoError(ValidateIdentifier(Service{ServiceName: "a_b"}, services))
+}
+
+func (s *IdentifierTestSuite) Test_ValidateIdentifier_ReturnsNil_WhenNamesDifferOnlyInDashesAndUnderscores() {
+	services := map[string]Service{"a_b": {ServiceName: "a_b"}}
+
+	s.NoError(ValidateIdentifier(Service{ServiceName: "a-b"}, services))
+}
+
+// Rendering
+
+func (s *IdentifierTestSuite) Test_RenderFrontend_UsesIdentifier() {
+	sr := Service{
+		ServiceName:   "my/service",
+		AclName:       "my_service",
+		PathType:      "path_beg",
+		ServiceDomain: []string{"example.com"},
+		ServiceDest:   []ServiceDest{{Port: "8080", ServicePath: []string{"/api"}}},
+	}
+
+	actual := haProxy17Renderer{}.RenderFrontend(sr)
+
+	s.Equal(`
+    acl url_my_service8080 path_beg /api
+    acl domain_my_service hdr_dom(host) -i example.com
+    use_backend my_service-be8080 if url_my_service8080 domain_my_service`, actual)
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Returns the output of `haproxy -vv` that lists the options HAProxy was built with
+var haproxyBuildInfo = func() (string, error) {
+	out, err := exec.Command("haproxy", "-vv").CombinedOutput()
+	return string(out), err
+}
+
+// HAProxy 1.x reports the version of Lua it was built with while 2.x lists +LUA in the features
+var luaSupportRegexp = regexp.MustCompile(`(?m)(^Built with Lua version|(^|\s)\+LUA(\s|$))`)
+var luaActionRegexp = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+
+// The build options of the binary do not change while the proxy runs so haproxy -vv is run only once
+var luaSupport = struct {
+	sync.Mutex
+	detected  bool
+	supported bool
+}{}
+
+// IsLuaSupported returns whether HAProxy was built with Lua (USE_LUA=1).
+// The result is detected on the first call and reused afterwards.
+func IsLuaSupported() bool {
+	luaSupport.Lock()
+	defer luaSupport.Unlock()
+	if !luaSupport.detected {
+		luaSupport.supported = detectLuaSupport()
+		luaSupport.detected = true
+	}
+	return luaSupport.supported
+}
+
+func detectLuaSupport() bool {
+	out, err := haproxyBuildInfo()
+	if err != nil {
+		logPrintf("Could not retrieve the build options of HAProxy\n%s", err.Error())
+		return false
+	}
+	return luaSupportRegexp.MatchString(out)
+}
+
+// Discards the detected Lua support so that the next call of IsLuaSupported runs haproxyBuildInfo again
+func resetLuaSupport() {
+	luaSupport.Lock()
+	defer luaSupport.Unlock()
+	luaSupport.detected = false
+}
+
+// ValidateLuaScripts returns an error if LUA_SCRIPTS_PATH is set and the directory does not exist
+// or HAProxy was built without Lua.
+func ValidateLuaScripts() error {
+	path := os.Getenv("LUA_SCRIPTS_PATH")
+	if len(path) == 0 {
+		return nil
+	}
+	if _, err := readConfigsDir(path); err != nil {
+		return fmt.Errorf("The Lua scripts directory %s (LUA_SCRIPTS_PATH) could not be read\n%s", path, err.Error())
+	}
+	if !IsLuaSupported() {
+		return fmt.Errorf("LUA_SCRIPTS_PATH is set but HAProxy was built without Lua (haproxy -vv does not list it)")
+	}
+	return nil
+}
+
+// Returns a validation error if the Lua action of the service is not a valid name or HAProxy was built without Lua
+func validateLuaAction(s Service) error {
+	if len(s.LuaAction) == 0 {
+		return nil
+	}
+	if !luaActionRegexp.MatchString(s.LuaAction) {
+		return &ErrValidation{Fields: []string{"luaAction"}, Message: fmt.Sprintf("The Lua action %s can contain only letters, digits, underscores, and dots", s.LuaAction)}
+	}
+	if strings.EqualFold(s.ReqMode, "tcp") {
+		return &ErrValidation{Fields: []string{"luaAction", "reqMode"}, Message: "luaAction can be used only with the http request mode"}
+	}
+	if !IsLuaSupported() {
+		return &ErrValidation{Fields: []string{"luaAction"}, Message: "luaAction requires HAProxy built with Lua but haproxy -vv does not list it"}
+	}
+	return nil
+}
+
+// Returns the lua-load lines of the global section, one for each script (*.lua) in LUA_SCRIPTS_PATH sorted by name.
+// Nothing is rendered if the directory cannot be read.
+func getLuaLoads() string {
+	path := os.Getenv("LUA_SCRIPTS_PATH")
+	if len(path) == 0 {
+		return ""
+	}
+	files, err := readConfigsDir(path)
+	if err != nil {
+		logPrintf("WARNING: The Lua scripts are not loaded since %s could not be read\n%s", path, err.Error())
+		return ""
+	}
+	names := []string{}
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".lua") {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+	loads := ""
+	for _, name := range names {
+		loads += fmt.Sprintf("\n    lua-load %s/%s", strings.TrimSuffix(path, "/"), name)
+	}
+	return loads
+}
+
+// Returns the rule that runs the Lua action of the service on the requests that match its destinations
+func (m *HaProxy) getLuaActionRule(s Service) string {
+	if len(s.LuaAction) == 0 || len(s.ServiceDest) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n    http-request lua.%s if %s", s.LuaAction, m.getRedirectCondition(s, ""))
+}
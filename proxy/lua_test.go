@@ -0,0 +1,164 @@
+// +build !integration
+
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const luaBuildInfo = `HA-Proxy version 2.4.0 2021/05/14 - https://haproxy.org/
+Feature list : +EPOLL -KQUEUE +NETFILTER +PCRE +LUA +OPENSSL`
+
+var haproxyBuildInfoOrig = haproxyBuildInfo
+
+type LuaTestSuite struct {
+	suite.Suite
+	Dir      string
+	dataOrig Data
+}
+
+func TestLuaUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(LuaTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *LuaTestSuite) SetupTest() {
+	s.Dir, _ = ioutil.TempDir("", "lua")
+	s.dataOrig = data
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{}}
+	setHaproxyBuildInfo(luaBuildInfo, nil)
+}
+
+func (s *LuaTestSuite) TearDownTest() {
+	os.Unsetenv("LUA_SCRIPTS_PATH")
+	os.RemoveAll(s.Dir)
+	data = s.dataOrig
+	readConfigsDir = ioutil.ReadDir
+	haproxyBuildInfo = haproxyBuildInfoOrig
+	resetLuaSupport()
+}
+
+// Replaces the output of haproxy -vv and discards the Lua support detected with the previous one
+func setHaproxyBuildInfo(out string, err error) {
+	haproxyBuildInfo = func() (string, error) { return out, err }
+	resetLuaSupport()
+}
+
+// getConfigData
+
+func (s *LuaTestSuite) Test_GetConfigData_LoadsLuaScriptsSortedByName() {
+	os.Setenv("LUA_SCRIPTS_PATH", s.Dir)
+	for _, name := range []string{"jwt.lua", "cors.lua", "README.md"} {
+		ioutil.WriteFile(s.Dir+"/"+name, []byte{}, 0644)
+	}
+	os.Mkdir(s.Dir+"/lib.lua", 0755)
+	expected := fmt.Sprintf(`
+    lua-load %s/cors.lua
+    lua-load %s/jwt.lua`, s.Dir, s.Dir)
+
+	actual := HaProxy{}.getConfigData(map[string]bool{})
+
+	s.Contains(actual.ExtraGlobal, expected)
+	s.NotContains(actual.ExtraGlobal, "README.md")
+	s.NotContains(actual.ExtraGlobal, "lib.lua")
+}
+
+func (s *LuaTestSuite) Test_GetConfigData_DoesNotLoadLuaScripts_WhenDirectoryDoesNotExist() {
+	os.Setenv("LUA_SCRIPTS_PATH", s.Dir+"/missing")
+
+	actual := HaProxy{}.getConfigData(map[string]bool{})
+
+	s.NotContains(actual.ExtraGlobal, "lua-load")
+}
+
+// getFrontTemplate
+
+func (s *LuaTestSuite) Test_GetFrontTemplate_AddsLuaActionLimitedToServiceAcls() {
+	m := HaProxy{}
+	service := Service{
+		ServiceName:   "my-service",
+		ServiceDomain: []string{"example.com"},
+		LuaAction:     "route_by_claim",
+		ServiceDest:   []ServiceDest{{Port: "1111", ServicePath: []string{"/api"}}, {Port: "2222", ServicePath: []string{"/admin"}}},
+	}
+
+	actual := m.getFrontTemplate(service)
+
+	s.Contains(actual, `
+    http-request lua.route_by_claim if url_my-service1111 domain_my-service || url_my-service2222 domain_my-service`)
+}
+
+func (s *LuaTestSuite) Test_GetFrontTemplate_DoesNotAddLuaAction_WhenItIsNotSet() {
+	m := HaProxy{}
+	service := Service{ServiceName: "my-service", ServiceDest: []ServiceDest{{Port: "1111", ServicePath: []string{"/api"}}}}
+
+	s.NotContains(m.getFrontTemplate(service), "lua.")
+}
+
+// ValidateService
+
+func (s *LuaTestSuite) Test_ValidateService_ReturnsNil_WhenHaProxyIsBuiltWithLua() {
+	for _, info := range []string{luaBuildInfo, "HA-Proxy version 1.7.9\nBuilt with Lua version : Lua 5.3.4"} {
+		setHaproxyBuildInfo(info, nil)
+
+		s.NoError(ValidateService(Service{ServiceName: "my-service", LuaAction: "route_by_claim"}), info)
+	}
+}
+
+func (s *LuaTestSuite) Test_ValidateService_ReturnsError_WhenHaProxyIsBuiltWithoutLua() {
+	for _, info := range []string{"HA-Proxy version 2.4.0\nFeature list : +EPOLL -LUA +OPENSSL", "HA-Proxy version 1.7.9\nBuilt with OpenSSL version : OpenSSL 1.0.2"} {
+		setHaproxyBuildInfo(info, nil)
+
+		err := ValidateService(Service{ServiceName: "my-service", LuaAction: "route_by_claim"})
+
+		s.Require().Error(err, info)
+		s.Contains(err.Error(), "Lua")
+	}
+}
+
+func (s *LuaTestSuite) Test_ValidateService_ReturnsError_WhenLuaActionIsInvalid() {
+	err := ValidateService(Service{ServiceName: "my-service", LuaAction: "route if TRUE"})
+
+	s.Equal(&ErrValidation{Fields: []string{"luaAction"}, Message: "The Lua action route if TRUE can contain only letters, digits, underscores, and dots"}, err)
+}
+
+func (s *LuaTestSuite) Test_ValidateService_RunsHaProxyOnce_WhenLuaActionsAreValidated() {
+	calls := 0
+	haproxyBuildInfo = func() (string, error) {
+		calls++
+		return luaBuildInfo, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		s.NoError(ValidateService(Service{ServiceName: "my-service", LuaAction: "route_by_claim"}))
+	}
+
+	s.Equal(1, calls)
+}
+
+// ValidateLuaScripts
+
+func (s *LuaTestSuite) Test_ValidateLuaScripts_ReturnsNil_WhenLuaScriptsPathIsNotSet() {
+	setHaproxyBuildInfo("", fmt.Errorf("haproxy: not found"))
+
+	s.NoError(ValidateLuaScripts())
+}
+
+func (s *LuaTestSuite) Test_ValidateLuaScripts_ReturnsError_WhenHaProxyIsBuiltWithoutLua() {
+	os.Setenv("LUA_SCRIPTS_PATH", s.Dir)
+	setHaproxyBuildInfo("Feature list : +EPOLL -LUA", nil)
+
+	s.Error(ValidateLuaScripts())
+}
+
+func (s *LuaTestSuite) Test_ValidateLuaScripts_ReturnsError_WhenDirectoryDoesNotExist() {
+	os.Setenv("LUA_SCRIPTS_PATH", s.Dir+"/missing")
+
+	s.Error(ValidateLuaScripts())
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Whether mutations are refused (see SetAllowMutations). Mutations are allowed by default.
+var mutationsDenied int32
+
+type mutationsContextKey struct{}
+
+// SetAllowMutations defines whether services and certificates can be added or removed.
+// If false, AddService, RemoveService, AddCert, and the other mutations return ErrReadOnly
+// unless they are invoked on the proxy returned by WithMutations.
+func SetAllowMutations(allowed bool) {
+	denied := int32(1)
+	if allowed {
+		denied = 0
+	}
+	atomic.StoreInt32(&mutationsDenied, denied)
+}
+
+// WithMutations returns a copy of the proxy that can add and remove services and certificates even if mutations are not allowed.
+// It is meant for the operations forwarded by the primary instance. Only the returned copy is allowed to mutate.
+func (m HaProxy) WithMutations() Proxy {
+	m.mutationsAllowed = true
+	return m
+}
+
+// ContextWithMutations returns a copy of the context of a request that is allowed to mutate the proxy
+func ContextWithMutations(ctx context.Context) context.Context {
+	return context.WithValue(ctx, mutationsContextKey{}, true)
+}
+
+// MutationsAllowed returns whether the context was created through ContextWithMutations
+func MutationsAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(mutationsContextKey{}).(bool)
+	return allowed
+}
+
+// ForContext returns the proxy instance that is allowed to mutate if the context allows it
+func ForContext(ctx context.Context) Proxy {
+	return ForMutations(MutationsAllowed(ctx))
+}
+
+// ForMutations returns the proxy instance that is allowed to mutate if allowMutations is true
+func ForMutations(allowMutations bool) Proxy {
+	if allowMutations {
+		return Instance.WithMutations()
+	}
+	return Instance
+}
+
+func (m HaProxy) canMutate() bool {
+	return m.mutationsAllowed || atomic.LoadInt32(&mutationsDenied) == 0
+}
@@ -0,0 +1,94 @@
+// +build !integration
+
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type MutationsTestSuite struct {
+	suite.Suite
+	dataOrig     Data
+	instanceOrig Proxy
+}
+
+func TestMutationsUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(MutationsTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *MutationsTestSuite) SetupTest() {
+	s.dataOrig = data
+	s.instanceOrig = Instance
+	data = Data{Certs: map[string]bool{"my-cert.pem": true}, Services: map[string]Service{"my-service": {ServiceName: "my-service"}}}
+	SetAllowMutations(false)
+}
+
+func (s *MutationsTestSuite) TearDownTest() {
+	data = s.dataOrig
+	SetAllowMutations(true)
+	Instance = s.instanceOrig
+}
+
+func (s *MutationsTestSuite) Test_AddService_ReturnsErrReadOnly_WhenMutationsAreNotAllowed() {
+	err := HaProxy{}.AddService(Service{ServiceName: "other-service"})
+
+	s.Equal(ErrReadOnly, err)
+	s.Len(data.Services, 1)
+}
+
+func (s *MutationsTestSuite) Test_RemoveService_ReturnsErrReadOnly_WhenMutationsAreNotAllowed() {
+	err := HaProxy{}.RemoveService("my-service")
+
+	s.Equal(ErrReadOnly, err)
+	s.Len(data.Services, 1)
+}
+
+func (s *MutationsTestSuite) Test_AddCert_ReturnsErrReadOnly_WhenMutationsAreNotAllowed() {
+	err := HaProxy{}.AddCert("other-cert.pem")
+
+	s.Equal(ErrReadOnly, err)
+	s.Len(data.Certs, 1)
+}
+
+func (s *MutationsTestSuite) Test_RemoveCert_DoesNotRemoveCert_WhenMutationsAreNotAllowed() {
+	HaProxy{}.RemoveCert("my-cert.pem")
+
+	s.Len(data.Certs, 1)
+}
+
+func (s *MutationsTestSuite) Test_WithMutations_AllowsMutations() {
+	p := HaProxy{}.WithMutations()
+
+	s.NoError(p.AddService(Service{ServiceName: "other-service"}))
+	s.NoError(p.RemoveService("my-service"))
+	s.Equal([]string{"other-service"}, s.getServiceNames())
+}
+
+func (s *MutationsTestSuite) Test_WithMutations_DoesNotAllowMutationsOfOtherCopies() {
+	Instance = HaProxy{}
+	p := HaProxy{}
+	p.WithMutations()
+
+	s.Equal(ErrReadOnly, p.RemoveService("my-service"))
+	s.Equal(ErrReadOnly, Instance.RemoveService("my-service"))
+}
+
+func (s *MutationsTestSuite) Test_ForContext_AllowsMutations_WhenContextAllowsThem() {
+	Instance = HaProxy{}
+
+	s.Equal(ErrReadOnly, ForContext(context.Background()).RemoveService("my-service"))
+	s.NoError(ForContext(ContextWithMutations(context.Background())).RemoveService("my-service"))
+}
+
+func (s *MutationsTestSuite) getServiceNames() []string {
+	names := []string{}
+	for name := range data.Services {
+		names = append(names, name)
+	}
+	return names
+}
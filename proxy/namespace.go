@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// GetNamespace returns the namespace (e.g. the Swarm stack) the service belongs to.
+// If it is not set explicitly, it is the prefix of the service name before the first underscore (e.g. mystack_api).
+// Services whose names do not have such a prefix do not belong to any namespace.
+func GetNamespace(s Service) string {
+	if len(s.Namespace) > 0 {
+		return s.Namespace
+	}
+	if index := strings.Index(s.ServiceName, "_"); index > 0 && index < len(s.ServiceName)-1 {
+		return s.ServiceName[:index]
+	}
+	return ""
+}
+
+// GetServicesByNamespace returns a deep copy of the registered services that belong to the namespace
+func (m HaProxy) GetServicesByNamespace(namespace string) map[string]Service {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	services := map[string]Service{}
+	for name, s := range data.Services {
+		if GetNamespace(s) == namespace {
+			services[name] = deepCopy(reflect.ValueOf(s)).Interface().(Service)
+		}
+	}
+	return services
+}
+
+// RemoveNamespace removes all the services that belong to the namespace at once.
+// The configuration should be created and reloaded only once afterwards.
+func (m HaProxy) RemoveNamespace(namespace string) error {
+	if !m.canMutate() {
+		return ErrReadOnly
+	}
+	if len(namespace) == 0 {
+		return &ErrValidation{Fields: []string{"namespace"}, Message: "The namespace is mandatory"}
+	}
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	names := []string{}
+	for name, s := range data.Services {
+		if GetNamespace(s) == namespace {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("%w: no services in the namespace %s", ErrServiceNotFound, namespace)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		delete(data.Services, name)
+		recordPendingOperation(PendingOperation{Action: PendingRemove, Service: Service{ServiceName: name}})
+	}
+	m.writeState()
+	return nil
+}
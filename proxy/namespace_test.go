@@ -0,0 +1,97 @@
+// +build !integration
+
+package proxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type NamespaceTestSuite struct {
+	suite.Suite
+	dataOrig Data
+}
+
+func TestNamespaceUnitTestSuite(t *testing.T) {
+	s := new(NamespaceTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *NamespaceTestSuite) SetupTest() {
+	s.dataOrig = data
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{
+		"mystack_api":   {ServiceName: "mystack_api"},
+		"mystack_web":   {ServiceName: "mystack_web", ServiceDest: []ServiceDest{{Port: "8080"}}},
+		"otherstack_db": {ServiceName: "otherstack_db"},
+		"standalone":    {ServiceName: "standalone"},
+		"legacy-api":    {ServiceName: "legacy-api", Namespace: "mystack"},
+	}}
+}
+
+func (s *NamespaceTestSuite) TearDownTest() {
+	data = s.dataOrig
+	clearPendingChanges()
+}
+
+// GetNamespace
+
+func (s *NamespaceTestSuite) Test_GetNamespace_ReturnsPrefixOfServiceName() {
+	s.Equal("mystack", GetNamespace(Service{ServiceName: "mystack_api"}))
+	s.Equal("mystack", GetNamespace(Service{ServiceName: "mystack_api_v2"}))
+}
+
+func (s *NamespaceTestSuite) Test_GetNamespace_ReturnsNamespace_WhenSetExplicitly() {
+	s.Equal("shop", GetNamespace(Service{ServiceName: "mystack_api", Namespace: "shop"}))
+}
+
+func (s *NamespaceTestSuite) Test_GetNamespace_ReturnsEmptyString_WhenServiceNameHasNoPrefix() {
+	for _, name := range []string{"", "api", "_api", "api_", "my-api"} {
+		s.Empty(GetNamespace(Service{ServiceName: name}), name)
+	}
+}
+
+// GetServicesByNamespace
+
+func (s *NamespaceTestSuite) Test_GetServicesByNamespace_ReturnsServicesOfNamespace() {
+	actual := HaProxy{}.GetServicesByNamespace("mystack")
+
+	s.Len(actual, 3)
+	s.Contains(actual, "mystack_api")
+	s.Contains(actual, "mystack_web")
+	s.Contains(actual, "legacy-api")
+}
+
+func (s *NamespaceTestSuite) Test_GetServicesByNamespace_ReturnsCopies() {
+	actual := HaProxy{}.GetServicesByNamespace("mystack")
+	actual["mystack_web"].ServiceDest[0].Port = "1234"
+
+	s.Equal("8080", data.Services["mystack_web"].ServiceDest[0].Port)
+}
+
+// RemoveNamespace
+
+func (s *NamespaceTestSuite) Test_RemoveNamespace_RemovesServicesOfNamespace() {
+	err := HaProxy{}.RemoveNamespace("mystack")
+
+	s.NoError(err)
+	s.Len(data.Services, 2)
+	s.Contains(data.Services, "otherstack_db")
+	s.Contains(data.Services, "standalone")
+}
+
+func (s *NamespaceTestSuite) Test_RemoveNamespace_ReturnsErrServiceNotFound_WhenNamespaceHasNoServices() {
+	err := HaProxy{}.RemoveNamespace("unknown")
+
+	s.True(errors.Is(err, ErrServiceNotFound))
+	s.Len(data.Services, 5)
+}
+
+func (s *NamespaceTestSuite) Test_RemoveNamespace_ReturnsErrValidation_WhenNamespaceIsEmpty() {
+	err := HaProxy{}.RemoveNamespace("")
+
+	var validation *ErrValidation
+	s.True(errors.As(err, &validation))
+	s.Len(data.Services, 5)
+}
@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AnonymousCaller identifies the API requests without a bearer token.
+// It can be listed in DOMAIN_OWNERSHIP_FILE to allow such requests to register a domain.
+const AnonymousCaller = "anonymous"
+
+var signalNotify = signal.Notify
+
+// DomainOwnership maps domain patterns to the callers allowed to register them.
+// A pattern is a domain (e.g. `payments.example.com`), a wildcard matching its subdomains (e.g. `*.example.com`),
+// or `*` matching all the domains.
+type DomainOwnership struct {
+	Domains map[string][]string `yaml:"domains"`
+}
+
+var domainOwnership = struct {
+	sync.RWMutex
+	policy *DomainOwnership
+}{}
+
+// StartDomainOwnership loads the policy from DOMAIN_OWNERSHIP_FILE and reloads it whenever the process receives SIGHUP.
+// If a reload fails, the previous policy is kept.
+func StartDomainOwnership() error {
+	path := os.Getenv("DOMAIN_OWNERSHIP_FILE")
+	if err := LoadDomainOwnership(path); err != nil {
+		return err
+	}
+	hup := make(chan os.Signal, 1)
+	signalNotify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := LoadDomainOwnership(path); err != nil {
+				logPrintf("Could not reload the domain ownership policy from %s. The previous policy is kept.\n%s", path, err.Error())
+			}
+		}
+	}()
+	return nil
+}
+
+// LoadDomainOwnership parses the policy stored in the file and applies it to the services registered from now on
+func LoadDomainOwnership(path string) error {
+	content, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+	policy, err := ParseDomainOwnership(content)
+	if err != nil {
+		return fmt.Errorf("The domain ownership policy %s is invalid\n%s", path, err.Error())
+	}
+	domainOwnership.Lock()
+	defer domainOwnership.Unlock()
+	domainOwnership.policy = policy
+	logPrintf("Loaded the domain ownership policy with %d patterns from %s", len(policy.Domains), path)
+	return nil
+}
+
+// ParseDomainOwnership parses a YAML policy and validates its patterns
+func ParseDomainOwnership(content []byte) (*DomainOwnership, error) {
+	policy := DomainOwnership{}
+	if err := yaml.Unmarshal(content, &policy); err != nil {
+		return nil, err
+	}
+	domains := map[string][]string{}
+	for pattern, callers := range policy.Domains {
+		normalized := strings.ToLower(strings.TrimSpace(pattern))
+		wildcard := strings.TrimPrefix(normalized, "*.")
+		if len(normalized) == 0 || (normalized != "*" && strings.Contains(wildcard, "*")) {
+			return nil, fmt.Errorf("The pattern %s is not valid. Wildcards are allowed only as the first label (e.g. *.example.com)", pattern)
+		}
+		domains[normalized] = append(domains[normalized], callers...)
+	}
+	policy.Domains = domains
+	return &policy, nil
+}
+
+// ValidateDomainOwnership returns ErrForbidden if the caller that registers the service is not allowed to use one of its domains.
+// A domain is governed by the most specific pattern that matches it. Domains that do not match any of the patterns are unrestricted.
+// Services registered without a caller (e.g. those reloaded from the listener) are not checked.
+func ValidateDomainOwnership(s Service) error {
+	if len(s.Caller) == 0 {
+		return nil
+	}
+	domainOwnership.RLock()
+	defer domainOwnership.RUnlock()
+	if domainOwnership.policy == nil {
+		return nil
+	}
+	for _, domain := range s.ServiceDomain {
+		pattern, callers, found := domainOwnership.policy.match(domain)
+		if !found {
+			continue
+		}
+		allowed := false
+		for _, caller := range callers {
+			if caller == s.Caller {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &ErrForbidden{Domain: domain, Pattern: pattern}
+		}
+	}
+	return nil
+}
+
+// Returns the most specific pattern matching the domain. Exact matches take precedence over the wildcards.
+func (m *DomainOwnership) match(domain string) (pattern string, callers []string, found bool) {
+	domain = strings.ToLower(domain)
+	if index := strings.LastIndex(domain, ":"); index > 0 {
+		domain = domain[:index]
+	}
+	if callers, ok := m.Domains[domain]; ok {
+		return domain, callers, true
+	}
+	for candidate, candidateCallers := range m.Domains {
+		matches := candidate == "*" || (strings.HasPrefix(candidate, "*.") && strings.HasSuffix(domain, candidate[1:]))
+		if matches && len(candidate) > len(pattern) {
+			pattern, callers, found = candidate, candidateCallers, true
+		}
+	}
+	return pattern, callers, found
+}
@@ -0,0 +1,183 @@
+// +build !integration
+
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type OwnershipTestSuite struct {
+	suite.Suite
+	policyOrig *DomainOwnership
+}
+
+func TestOwnershipUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(OwnershipTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *OwnershipTestSuite) SetupTest() {
+	s.policyOrig = domainOwnership.policy
+	policy, err := ParseDomainOwnership([]byte(`
+domains:
+  payments.example.com:
+    - payments-token
+  "*.example.com":
+    - platform-token
+  "*.internal.example.com":
+    - platform-token
+    - anonymous
+`))
+	s.Require().NoError(err)
+	domainOwnership.policy = policy
+}
+
+func (s *OwnershipTestSuite) TearDownTest() {
+	domainOwnership.policy = s.policyOrig
+	ReadFile = ioutil.ReadFile
+	signalNotify = signal.Notify
+}
+
+// ValidateDomainOwnership
+
+func (s *OwnershipTestSuite) Test_ValidateDomainOwnership_ReturnsNil_WhenCallerOwnsTheDomain() {
+	sr := Service{ServiceName: "payments", ServiceDomain: []string{"payments.example.com"}, Caller: "payments-token"}
+
+	s.NoError(ValidateDomainOwnership(sr))
+}
+
+func (s *OwnershipTestSuite) Test_ValidateDomainOwnership_ReturnsError_WhenCallerDoesNotOwnTheDomain() {
+	sr := Service{
+		ServiceName:   "payments",
+		ServiceDomain: []string{"unclaimed.io", "PAYMENTS.example.com"},
+		Caller:        "other-token",
+	}
+
+	err := ValidateDomainOwnership(sr)
+
+	s.Require().Error(err)
+	s.Equal(&ErrForbidden{Domain: "PAYMENTS.example.com", Pattern: "payments.example.com"}, err)
+	s.Contains(err.Error(), "PAYMENTS.example.com")
+}
+
+func (s *OwnershipTestSuite) Test_ValidateDomainOwnership_PrefersExactDomainOverWildcard() {
+	sr := Service{ServiceName: "payments", ServiceDomain: []string{"payments.example.com"}, Caller: "platform-token"}
+
+	s.Error(ValidateDomainOwnership(sr))
+}
+
+func (s *OwnershipTestSuite) Test_ValidateDomainOwnership_MatchesWildcardPatterns() {
+	testData := []struct {
+		domain  string
+		caller  string
+		allowed bool
+	}{
+		{"shop.example.com", "platform-token", true},
+		{"api.shop.example.com:8080", "platform-token", true},
+		{"*.example.com", "platform-token", true},
+		{"shop.example.com", "payments-token", false},
+		{"example.com", "payments-token", true},
+		{"docs.internal.example.com", AnonymousCaller, true},
+		{"docs.example.com", AnonymousCaller, false},
+	}
+	for _, data := range testData {
+		err := ValidateDomainOwnership(Service{ServiceName: "my-service", ServiceDomain: []string{data.domain}, Caller: data.caller})
+
+		s.Equal(data.allowed, err == nil, fmt.Sprintf("%s registered by %s", data.domain, data.caller))
+	}
+}
+
+func (s *OwnershipTestSuite) Test_ValidateDomainOwnership_MatchesAllDomains_WhenPatternIsStar() {
+	domainOwnership.policy, _ = ParseDomainOwnership([]byte("domains:\n  \"*\": [admin-token]\n"))
+
+	s.NoError(ValidateDomainOwnership(Service{ServiceDomain: []string{"any.io"}, Caller: "admin-token"}))
+	s.Error(ValidateDomainOwnership(Service{ServiceDomain: []string{"any.io"}, Caller: "other-token"}))
+}
+
+func (s *OwnershipTestSuite) Test_ValidateDomainOwnership_ReturnsNil_WhenServiceDoesNotHaveDomains() {
+	s.NoError(ValidateDomainOwnership(Service{ServiceName: "my-service", Caller: "other-token"}))
+}
+
+func (s *OwnershipTestSuite) Test_ValidateDomainOwnership_ReturnsNil_WhenCallerIsEmpty() {
+	s.NoError(ValidateDomainOwnership(Service{ServiceName: "payments", ServiceDomain: []string{"payments.example.com"}}))
+}
+
+func (s *OwnershipTestSuite) Test_ValidateDomainOwnership_ReturnsNil_WhenPolicyIsNotLoaded() {
+	domainOwnership.policy = nil
+
+	s.NoError(ValidateDomainOwnership(Service{ServiceDomain: []string{"payments.example.com"}, Caller: "other-token"}))
+}
+
+// AddService
+
+func (s *OwnershipTestSuite) Test_AddService_ReturnsError_WhenCallerDoesNotOwnTheDomain() {
+	dataOrig := data
+	defer func() { data = dataOrig }()
+	data = Data{Services: map[string]Service{}}
+
+	err := HaProxy{}.AddService(Service{ServiceName: "payments", ServiceDomain: []string{"payments.example.com"}, Caller: "other-token"})
+
+	s.IsType(&ErrForbidden{}, err)
+	s.Empty(data.Services)
+}
+
+// ParseDomainOwnership
+
+func (s *OwnershipTestSuite) Test_ParseDomainOwnership_ReturnsError_WhenPatternIsInvalid() {
+	for _, pattern := range []string{"pay*.example.com", "*.*.example.com", "api.*.example.com"} {
+		_, err := ParseDomainOwnership([]byte(fmt.Sprintf("domains:\n  \"%s\": [token]\n", pattern)))
+
+		s.Error(err, pattern)
+	}
+}
+
+func (s *OwnershipTestSuite) Test_ParseDomainOwnership_ReturnsError_WhenYamlIsInvalid() {
+	_, err := ParseDomainOwnership([]byte("domains: [payments.example.com"))
+
+	s.Error(err)
+}
+
+// StartDomainOwnership
+
+func (s *OwnershipTestSuite) Test_StartDomainOwnership_ReloadsPolicy_WhenSighupIsReceived() {
+	defer os.Unsetenv("DOMAIN_OWNERSHIP_FILE")
+	os.Setenv("DOMAIN_OWNERSHIP_FILE", "/run/secrets/domains.yml")
+	content := "domains:\n  payments.example.com: [payments-token]\n"
+	ReadFile = func(filename string) ([]byte, error) {
+		return []byte(content), nil
+	}
+	var hup chan<- os.Signal
+	signalNotify = func(c chan<- os.Signal, sig ...os.Signal) {
+		s.Equal([]os.Signal{syscall.SIGHUP}, sig)
+		hup = c
+	}
+	sr := Service{ServiceDomain: []string{"payments.example.com"}, Caller: "new-payments-token"}
+
+	s.Require().NoError(StartDomainOwnership())
+	s.Error(ValidateDomainOwnership(sr))
+
+	content = "domains:\n  payments.example.com: [new-payments-token]\n"
+	hup <- syscall.SIGHUP
+
+	s.Eventually(func() bool {
+		return ValidateDomainOwnership(sr) == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (s *OwnershipTestSuite) Test_LoadDomainOwnership_KeepsPreviousPolicy_WhenFileIsInvalid() {
+	ReadFile = func(filename string) ([]byte, error) {
+		return []byte("domains:\n  \"pay*.example.com\": [token]\n"), nil
+	}
+
+	s.Error(LoadDomainOwnership("/run/secrets/domains.yml"))
+	s.Error(ValidateDomainOwnership(Service{ServiceDomain: []string{"payments.example.com"}, Caller: "other-token"}))
+}
@@ -0,0 +1,380 @@
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The maximum number of indexed destinations (e.g. port.1, port.2, ..., port.10)
+const MaxIndexedServiceDest = 10
+
+// The parameters of both the service and its destinations that belong to the service when they are not indexed
+var serviceLevelParams = map[string]bool{"outboundHostname": true, "pathType": true}
+
+// ParamSchema describes a query parameter accepted by the reconfigure request.
+// It is generated from the `param` tags of the Service and ServiceDest structs.
+type ParamSchema struct {
+	Name    string
+	Type    string
+	Indexed bool
+	Default string `json:",omitempty"`
+	Min     string `json:",omitempty"`
+	Max     string `json:",omitempty"`
+}
+
+// GetParamsSchema returns the description of all the parameters accepted by the reconfigure request
+func GetParamsSchema() []ParamSchema {
+	schema := getStructSchema(reflect.TypeOf(Service{}), false)
+	return append(schema, getStructSchema(reflect.TypeOf(ServiceDest{}), true)...)
+}
+
+// GetServiceFromParams creates a service from reconfigure request parameters.
+// Destination parameters can be specified without an index and with indexes from 1 to MaxIndexedServiceDest.
+// An indexed destination requires both the path and the port, or the source port range.
+// The destinations stop at the first index without them.
+func GetServiceFromParams(params url.Values) (Service, error) {
+	sr := Service{}
+	if _, err := setFieldsFromParams(reflect.ValueOf(&sr).Elem(), params, ""); err != nil {
+		return Service{}, err
+	}
+	// The unindexed pathType and outboundHostname belong to the service.
+	// Destinations can override them only with an index (e.g. pathType.1).
+	destParams := url.Values{}
+	for key, values := range params {
+		if !serviceLevelParams[key] {
+			destParams[key] = values
+		}
+	}
+	sd := ServiceDest{ServicePath: []string{}}
+	found, err := setFieldsFromParams(reflect.ValueOf(&sd).Elem(), destParams, "")
+	if err != nil {
+		return Service{}, err
+	}
+	if found || (len(sr.ConsulTemplateFePath) > 0 && len(sr.ConsulTemplateBePath) > 0) {
+		sr.ServiceDest = append(sr.ServiceDest, sd)
+	}
+	for i := 1; i <= MaxIndexedServiceDest; i++ {
+		sd := ServiceDest{}
+		_, err := setFieldsFromParams(reflect.ValueOf(&sd).Elem(), params, fmt.Sprintf(".%d", i))
+		if err != nil {
+			return Service{}, err
+		} else if !isCompleteIndexedServiceDest(sd) {
+			break
+		}
+		sr.ServiceDest = append(sr.ServiceDest, sd)
+	}
+	return sr, nil
+}
+
+func isCompleteIndexedServiceDest(sd ServiceDest) bool {
+	return (len(sd.ServicePath) > 0 && len(sd.Port) > 0) || len(sd.SrcPortRange) > 0
+}
+
+// GetParamsFromService converts a service into reconfigure request parameters.
+// It is the reverse of GetServiceFromParams.
+func GetParamsFromService(sr Service) url.Values {
+	params := url.Values{}
+	addParamsFromFields(reflect.ValueOf(sr), params, "")
+	// The unindexed pathType and outboundHostname belong to the service so destinations with their own are indexed
+	offset := 0
+	if len(sr.ServiceDest) > 0 && (len(sr.ServiceDest[0].PathType) > 0 || len(sr.ServiceDest[0].OutboundHostname) > 0) {
+		offset = 1
+	}
+	for i, sd := range sr.ServiceDest {
+		suffix := ""
+		if i+offset > 0 {
+			suffix = fmt.Sprintf(".%d", i+offset)
+		}
+		addParamsFromFields(reflect.ValueOf(sd), params, suffix)
+	}
+	return params
+}
+
+// GetParamsMap returns the parameters of the service keyed by their names so that it can be serialized
+// in the format of the reconfigure request. Destinations are listed under serviceDest.
+// Passwords and certificate contents are redacted.
+func GetParamsMap(sr Service) map[string]interface{} {
+	fields := getParamsMapFromFields(reflect.ValueOf(sr))
+	dests := []map[string]interface{}{}
+	for _, sd := range sr.ServiceDest {
+		dests = append(dests, getParamsMapFromFields(reflect.ValueOf(sd)))
+	}
+	fields["serviceDest"] = dests
+	return fields
+}
+
+// SplitEscaped splits a comma-separated list of values.
+// Commas that are part of a value are escaped with a backslash (\,) and backslashes with another one (\\).
+// Backslashes followed by any other character are kept as they are.
+func SplitEscaped(value string) []string {
+	values := []string{}
+	current := ""
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) && (value[i+1] == ',' || value[i+1] == '\\') {
+			current += string(value[i+1])
+			i++
+		} else if value[i] == ',' {
+			values = append(values, current)
+			current = ""
+		} else {
+			current += string(value[i])
+		}
+	}
+	return append(values, current)
+}
+
+// JoinEscaped joins values into a comma-separated list.
+// It is the reverse of SplitEscaped.
+func JoinEscaped(values []string) string {
+	escaped := []string{}
+	for _, value := range values {
+		value = strings.Replace(value, `\`, `\\`, -1)
+		escaped = append(escaped, strings.Replace(value, ",", `\,`, -1))
+	}
+	return strings.Join(escaped, ",")
+}
+
+func getStructSchema(t reflect.Type, indexed bool) []ParamSchema {
+	schema := []ParamSchema{}
+	for i := 0; i < t.NumField(); i++ {
+		name, opts := parseParamTag(t.Field(i).Tag.Get("param"))
+		if len(name) == 0 {
+			continue
+		}
+		schema = append(schema, ParamSchema{
+			Name:    name,
+			Type:    getParamType(t.Field(i).Type),
+			Indexed: indexed,
+			Default: opts["default"],
+			Min:     opts["min"],
+			Max:     opts["max"],
+		})
+	}
+	return schema
+}
+
+func getParamType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int:
+		return "integer"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice:
+		return "array"
+	case reflect.Ptr:
+		return getParamType(t.Elem())
+	}
+	return "string"
+}
+
+func parseParamTag(tag string) (name string, opts map[string]string) {
+	opts = map[string]string{}
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		keyValue := strings.SplitN(opt, "=", 2)
+		if len(keyValue) == 2 {
+			opts[keyValue[0]] = keyValue[1]
+		}
+	}
+	return parts[0], opts
+}
+
+func setFieldsFromParams(v reflect.Value, params url.Values, suffix string) (found bool, err error) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, opts := parseParamTag(t.Field(i).Tag.Get("param"))
+		if len(name) == 0 {
+			continue
+		}
+		value := params.Get(name + suffix)
+		if len(value) > 0 {
+			found = true
+		} else if value = opts["default"]; len(value) == 0 {
+			continue
+		}
+		if err := setField(v.Field(i), name+suffix, value, opts); err != nil {
+			return false, err
+		}
+	}
+	return found, nil
+}
+
+func setField(field reflect.Value, name, value string, opts map[string]string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("The parameter %s must be a number", name)
+		}
+		if min, err := strconv.Atoi(opts["min"]); err == nil && number < min {
+			return fmt.Errorf("The parameter %s must be greater than or equal to %d", name, min)
+		}
+		if max, err := strconv.Atoi(opts["max"]); err == nil && number > max {
+			return fmt.Errorf("The parameter %s must be less than or equal to %d", name, max)
+		}
+		field.SetInt(int64(number))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("The parameter %s must be true or false", name)
+		}
+		field.SetBool(b)
+	case reflect.Ptr:
+		// Pointers distinguish parameters that are not set from those set to zero values
+		elem := reflect.New(field.Type().Elem())
+		if err := setField(elem.Elem(), name, value, opts); err != nil {
+			return err
+		}
+		field.Set(elem)
+	case reflect.Slice:
+		if field.Type().Elem() == reflect.TypeOf(User{}) {
+			users := []User{}
+			for _, user := range SplitEscaped(value) {
+				userPass := strings.SplitN(user, ":", 2)
+				if len(userPass) != 2 {
+					return fmt.Errorf("The parameter %s must be a comma-separated list of <user>:<pass> pairs", name)
+				}
+				users = append(users, User{Username: userPass[0], Password: userPass[1]})
+			}
+			field.Set(reflect.ValueOf(users))
+		} else {
+			field.Set(reflect.ValueOf(SplitEscaped(value)))
+		}
+	case reflect.Map:
+		codes := map[int]int{}
+		for _, pair := range strings.Split(value, ",") {
+			fromTo := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+			if len(fromTo) != 2 {
+				return fmt.Errorf("The parameter %s must be a comma-separated list of <from>:<to> status codes", name)
+			}
+			from, fromErr := strconv.Atoi(fromTo[0])
+			to, toErr := strconv.Atoi(fromTo[1])
+			if fromErr != nil || toErr != nil {
+				return fmt.Errorf("The parameter %s must be a comma-separated list of <from>:<to> status codes", name)
+			}
+			codes[from] = to
+		}
+		field.Set(reflect.ValueOf(codes))
+	}
+	return nil
+}
+
+// Returns the replaced status codes of the map in ascending order so that the output does not change between runs
+func getSortedResponseCodes(codes map[int]int) []int {
+	froms := []int{}
+	for from := range codes {
+		froms = append(froms, from)
+	}
+	sort.Ints(froms)
+	return froms
+}
+
+// Formats the map of status codes in the <from>:<to> format of the responseCodeMap parameter
+func joinResponseCodeMap(codes map[int]int) string {
+	pairs := []string{}
+	for _, from := range getSortedResponseCodes(codes) {
+		pairs = append(pairs, fmt.Sprintf("%d:%d", from, codes[from]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func addParamsFromFields(v reflect.Value, params url.Values, suffix string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _ := parseParamTag(t.Field(i).Tag.Get("param"))
+		if len(name) == 0 {
+			continue
+		}
+		field := v.Field(i)
+		value := ""
+		switch field.Kind() {
+		case reflect.String:
+			value = field.String()
+		case reflect.Int:
+			if field.Int() != 0 {
+				value = strconv.Itoa(int(field.Int()))
+			}
+		case reflect.Bool:
+			if field.Bool() {
+				value = "true"
+			}
+		case reflect.Ptr:
+			if b, ok := field.Interface().(*bool); ok && b != nil {
+				value = strconv.FormatBool(*b)
+			}
+		case reflect.Slice:
+			if users, ok := field.Interface().([]User); ok {
+				pairs := []string{}
+				for _, user := range users {
+					pairs = append(pairs, fmt.Sprintf("%s:%s", user.Username, user.Password))
+				}
+				value = JoinEscaped(pairs)
+			} else if values, ok := field.Interface().([]string); ok {
+				value = JoinEscaped(values)
+			}
+		case reflect.Map:
+			if codes, ok := field.Interface().(map[int]int); ok {
+				value = joinResponseCodeMap(codes)
+			}
+		}
+		if len(value) > 0 {
+			params.Set(name+suffix, value)
+		}
+	}
+}
+
+// Parameters with zero values are omitted the same way as in GetParamsFromService
+func getParamsMapFromFields(v reflect.Value) map[string]interface{} {
+	fields := map[string]interface{}{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _ := parseParamTag(t.Field(i).Tag.Get("param"))
+		if len(name) == 0 {
+			continue
+		}
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			if len(field.String()) == 0 {
+				continue
+			} else if diffRedactedParams[name] {
+				fields[name] = redacted
+			} else {
+				fields[name] = field.String()
+			}
+		case reflect.Int:
+			if field.Int() != 0 {
+				fields[name] = field.Int()
+			}
+		case reflect.Bool:
+			if field.Bool() {
+				fields[name] = true
+			}
+		case reflect.Ptr:
+			if b, ok := field.Interface().(*bool); ok && b != nil {
+				fields[name] = *b
+			}
+		case reflect.Slice:
+			if users, ok := field.Interface().([]User); ok && len(users) > 0 {
+				pairs := []string{}
+				for _, user := range users {
+					pairs = append(pairs, fmt.Sprintf("%s:%s", user.Username, redacted))
+				}
+				fields[name] = JoinEscaped(pairs)
+			} else if values, ok := field.Interface().([]string); ok && len(values) > 0 {
+				fields[name] = values
+			}
+		case reflect.Map:
+			if codes, ok := field.Interface().(map[int]int); ok && len(codes) > 0 {
+				fields[name] = joinResponseCodeMap(codes)
+			}
+		}
+	}
+	return fields
+}
@@ -0,0 +1,353 @@
+// +build !integration
+
+package proxy
+
+import (
+	"github.com/stretchr/testify/suite"
+	"net/url"
+	"testing"
+)
+
+type ParamsTestSuite struct {
+	suite.Suite
+}
+
+func TestParamsUnitTestSuite(t *testing.T) {
+	s := new(ParamsTestSuite)
+	suite.Run(t, s)
+}
+
+// GetParamsSchema
+
+func (s *ParamsTestSuite) Test_GetParamsSchema_ContainsServiceParams() {
+	actual := GetParamsSchema()
+
+	s.Contains(actual, ParamSchema{Name: "serviceName", Type: "string"})
+	s.Contains(actual, ParamSchema{Name: "distribute", Type: "boolean"})
+	s.Contains(actual, ParamSchema{Name: "users", Type: "array"})
+	s.Contains(actual, ParamSchema{Name: "reqMode", Type: "string", Default: "http"})
+}
+
+func (s *ParamsTestSuite) Test_GetParamsSchema_ContainsIndexedServiceDestParams() {
+	actual := GetParamsSchema()
+
+	s.Contains(actual, ParamSchema{Name: "srcPortRange", Type: "string", Indexed: true})
+	s.Contains(actual, ParamSchema{Name: "servicePath", Type: "array", Indexed: true})
+	s.Contains(actual, ParamSchema{Name: "srcPort", Type: "integer", Indexed: true, Min: "1", Max: "65535"})
+}
+
+// GetServiceFromParams
+
+func (s *ParamsTestSuite) Test_GetServiceFromParams_ReturnsService() {
+	params := url.Values{}
+	params.Set("serviceName", "my-service")
+	params.Set("serviceDomain", "my-domain.com")
+	params.Set("distribute", "true")
+	params.Set("users", "user1:pass1,user2:pass2")
+	params.Set("servicePath", "/path-1,/path-2")
+	params.Set("port", "1234")
+	params.Set("servicePath.1", "/path-3")
+	params.Set("port.1", "4321")
+	params.Set("srcPort.1", "5432")
+	expected := Service{
+		ServiceName:   "my-service",
+		ServiceDomain: []string{"my-domain.com"},
+		ReqMode:       "http",
+		Distribute:    true,
+		Users:         []User{{Username: "user1", Password: "pass1"}, {Username: "user2", Password: "pass2"}},
+		ServiceDest: []ServiceDest{
+			{ServicePath: []string{"/path-1", "/path-2"}, Port: "1234"},
+			{ServicePath: []string{"/path-3"}, Port: "4321", SrcPort: 5432},
+		},
+	}
+
+	actual, err := GetServiceFromParams(params)
+
+	s.NoError(err)
+	s.Equal(expected, actual)
+}
+
+func (s *ParamsTestSuite) Test_GetServiceFromParams_StopsAtTheFirstMissingIndex() {
+	params := url.Values{}
+	params.Set("serviceName", "my-service")
+	params.Set("servicePath.1", "/one")
+	params.Set("port.1", "1111")
+	params.Set("servicePath.3", "/three")
+	params.Set("port.3", "3333")
+
+	actual, _ := GetServiceFromParams(params)
+
+	s.Len(actual.ServiceDest, 1)
+	s.Equal("1111", actual.ServiceDest[0].Port)
+}
+
+func (s *ParamsTestSuite) Test_GetServiceFromParams_StopsAtTheFirstIncompleteIndex() {
+	for _, incomplete := range []map[string]string{
+		{"port.2": "2222"},
+		{"servicePath.2": "/two"},
+		{"srcPort.2": "2222", "sniDomain.2": "two.example.com"},
+	} {
+		params := url.Values{}
+		params.Set("serviceName", "my-service")
+		params.Set("servicePath.1", "/one")
+		params.Set("port.1", "1111")
+		for key, value := range incomplete {
+			params.Set(key, value)
+		}
+		params.Set("servicePath.3", "/three")
+		params.Set("port.3", "3333")
+
+		actual, err := GetServiceFromParams(params)
+
+		s.NoError(err)
+		s.Equal([]ServiceDest{{ServicePath: []string{"/one"}, Port: "1111"}}, actual.ServiceDest, incomplete)
+	}
+}
+
+func (s *ParamsTestSuite) Test_GetServiceFromParams_AddsIndexedServiceDest_WhenOnlySrcPortRangeIsSet() {
+	params := url.Values{}
+	params.Set("serviceName", "my-service")
+	params.Set("srcPortRange.1", "9000-9010")
+
+	actual, _ := GetServiceFromParams(params)
+
+	s.Equal([]ServiceDest{{SrcPortRange: "9000-9010"}}, actual.ServiceDest)
+}
+
+func (s *ParamsTestSuite) Test_GetServiceFromParams_SetsPathTypeOfIndexedServiceDests() {
+	params := url.Values{}
+	params.Set("serviceName", "my-service")
+	params.Set("pathType", "path_beg")
+	params.Set("servicePath.1", "/api/v[0-9]+")
+	params.Set("port.1", "8080")
+	params.Set("pathType.1", "path_reg")
+	params.Set("servicePath.2", "/users")
+	params.Set("port.2", "9090")
+
+	actual, _ := GetServiceFromParams(params)
+
+	s.Equal("path_beg", actual.PathType)
+	s.Equal([]ServiceDest{
+		{ServicePath: []string{"/api/v[0-9]+"}, Port: "8080", PathType: "path_reg"},
+		{ServicePath: []string{"/users"}, Port: "9090"},
+	}, actual.ServiceDest)
+}
+
+func (s *ParamsTestSuite) Test_GetServiceFromParams_SetsOutboundHostnameOfIndexedServiceDests() {
+	params := url.Values{}
+	params.Set("serviceName", "my-service")
+	params.Set("outboundHostname", "my-host")
+	params.Set("servicePath.1", "/api")
+	params.Set("port.1", "8080")
+	params.Set("outboundHostname.1", "external.example.com")
+	params.Set("servicePath.2", "/users")
+	params.Set("port.2", "9090")
+
+	actual, _ := GetServiceFromParams(params)
+
+	s.Equal("my-host", actual.OutboundHostname)
+	s.Equal([]ServiceDest{
+		{ServicePath: []string{"/api"}, Port: "8080", OutboundHostname: "external.example.com"},
+		{ServicePath: []string{"/users"}, Port: "9090"},
+	}, actual.ServiceDest)
+	roundTrip, _ := GetServiceFromParams(GetParamsFromService(actual))
+	s.Equal(actual, roundTrip)
+}
+
+func (s *ParamsTestSuite) Test_GetServiceFromParams_ReturnsError_WhenNumberIsInvalid() {
+	params := url.Values{}
+	params.Set("srcPort", "abc")
+
+	_, err := GetServiceFromParams(params)
+
+	s.Error(err)
+}
+
+func (s *ParamsTestSuite) Test_GetServiceFromParams_ReturnsError_WhenNumberIsOutOfRange() {
+	for _, srcPort := range []string{"0", "65536"} {
+		params := url.Values{}
+		params.Set("srcPort.1", srcPort)
+
+		_, err := GetServiceFromParams(params)
+
+		s.Error(err)
+	}
+}
+
+func (s *ParamsTestSuite) Test_GetServiceFromParams_ReturnsError_WhenBooleanIsInvalid() {
+	params := url.Values{}
+	params.Set("distribute", "maybe")
+
+	_, err := GetServiceFromParams(params)
+
+	s.Error(err)
+}
+
+func (s *ParamsTestSuite) Test_GetServiceFromParams_ReturnsError_WhenUsersAreInvalid() {
+	params := url.Values{}
+	params.Set("users", "user1:pass1,user2")
+
+	_, err := GetServiceFromParams(params)
+
+	s.Error(err)
+}
+
+func (s *ParamsTestSuite) Test_GetServiceFromParams_SetsResponseCodeMap() {
+	params := url.Values{}
+	params.Set("responseCodeMap", "599:502,404:410")
+
+	sr, err := GetServiceFromParams(params)
+
+	s.NoError(err)
+	s.Equal(map[int]int{599: 502, 404: 410}, sr.ResponseCodeMap)
+	s.Equal("404:410,599:502", GetParamsFromService(sr).Get("responseCodeMap"))
+}
+
+func (s *ParamsTestSuite) Test_GetServiceFromParams_ReturnsError_WhenResponseCodeMapIsInvalid() {
+	for _, value := range []string{"599", "599:abc", "x:502"} {
+		params := url.Values{}
+		params.Set("responseCodeMap", value)
+
+		_, err := GetServiceFromParams(params)
+
+		s.Error(err, value)
+	}
+}
+
+func (s *ParamsTestSuite) Test_GetServiceFromParams_UnescapesCommas() {
+	testData := []struct {
+		param    string
+		value    string
+		get      func(sr Service) interface{}
+		expected interface{}
+	}{
+		{"servicePath", `/items;a=1\,2,/other`, func(sr Service) interface{} { return sr.ServiceDest[0].ServicePath }, []string{"/items;a=1,2", "/other"}},
+		{"serviceDomain", `my\,domain.com,other.com`, func(sr Service) interface{} { return sr.ServiceDomain }, []string{"my,domain.com", "other.com"}},
+		{"httpMethods", `GET\,POST`, func(sr Service) interface{} { return sr.ServiceDest[0].HttpMethods }, []string{"GET,POST"}},
+		{"users", `user1:pa\,ss1,user2:pass2`, func(sr Service) interface{} { return sr.Users }, []User{{Username: "user1", Password: "pa,ss1"}, {Username: "user2", Password: "pass2"}}},
+		{"servicePath", `/back\\,/slash\x`, func(sr Service) interface{} { return sr.ServiceDest[0].ServicePath }, []string{`/back\`, `/slash\x`}},
+	}
+	for _, data := range testData {
+		params := url.Values{}
+		params.Set("port", "1234")
+		params.Set(data.param, data.value)
+
+		sr, err := GetServiceFromParams(params)
+
+		s.NoError(err)
+		s.Equal(data.expected, data.get(sr), "%s=%s", data.param, data.value)
+	}
+}
+
+// GetParamsFromService
+
+func (s *ParamsTestSuite) Test_GetParamsFromService_EscapesCommas() {
+	expected := Service{
+		ServiceName:   "my-service",
+		ServiceDomain: []string{"my,domain.com", `back\slash.com`},
+		Users:         []User{{Username: "user1", Password: `pa,ss\1`}},
+		ServiceDest:   []ServiceDest{{ServicePath: []string{"/items;a=1,2", "/other"}, Port: "1234"}},
+	}
+
+	params := GetParamsFromService(expected)
+	actual, err := GetServiceFromParams(params)
+
+	s.NoError(err)
+	s.Equal(`/items;a=1\,2,/other`, params.Get("servicePath"))
+	s.Equal(expected.ServiceDomain, actual.ServiceDomain)
+	s.Equal(expected.Users, actual.Users)
+	s.Equal(expected.ServiceDest[0].ServicePath, actual.ServiceDest[0].ServicePath)
+}
+
+func (s *ParamsTestSuite) Test_GetParamsFromService_IsTheReverseOfGetServiceFromParams() {
+	expected := Service{
+		ServiceName: "my-service",
+		AclName:     "my-acl",
+		ReqMode:     "tcp",
+		Users:       []User{{Username: "user1", Password: "pass1"}},
+		ServiceDest: []ServiceDest{
+			{ServicePath: []string{"/path-1"}, Port: "1234"},
+			{ServicePath: []string{}, Port: "4321", SrcPort: 5432, SrcPortRange: "5000-5010"},
+		},
+	}
+
+	params := GetParamsFromService(expected)
+	actual, err := GetServiceFromParams(params)
+
+	s.NoError(err)
+	s.Equal(expected.ServiceName, actual.ServiceName)
+	s.Equal(expected.AclName, actual.AclName)
+	s.Equal(expected.Users, actual.Users)
+	s.Equal(expected.ServiceDest[0], actual.ServiceDest[0])
+	s.Equal("5000-5010", actual.ServiceDest[1].SrcPortRange)
+	s.Equal(5432, actual.ServiceDest[1].SrcPort)
+	s.Equal(expected.ReqMode, actual.ReqMode)
+}
+
+func (s *ParamsTestSuite) Test_GetParamsFromService_PreservesPathTypesOfServiceDests() {
+	expected := Service{
+		ServiceName: "my-service",
+		PathType:    "path_beg",
+		ServiceDest: []ServiceDest{
+			{ServicePath: []string{"/api/v[0-9]+"}, Port: "1234", PathType: "path_reg"},
+			{ServicePath: []string{"/users"}, Port: "4321"},
+		},
+	}
+
+	params := GetParamsFromService(expected)
+	actual, err := GetServiceFromParams(params)
+
+	s.NoError(err)
+	s.Equal("path_beg", actual.PathType)
+	s.Equal(expected.ServiceDest, actual.ServiceDest)
+}
+
+// GetParamsMap
+
+func (s *ParamsTestSuite) Test_GetParamsMap_UsesParamNames() {
+	sr := Service{
+		ServiceName:     "my-service",
+		AclName:         "01-my-service",
+		ReqMode:         "tcp",
+		HttpsPort:       8443,
+		ServiceDomain:   []string{"example.com", "example.org"},
+		ServiceDest:     []ServiceDest{{Port: "8080", SrcPort: 1234}},
+		FullServiceName: "my-service",
+	}
+
+	actual := GetParamsMap(sr)
+
+	s.Equal(map[string]interface{}{
+		"serviceName":   "my-service",
+		"aclName":       "01-my-service",
+		"reqMode":       "tcp",
+		"httpsPort":     int64(8443),
+		"serviceDomain": []string{"example.com", "example.org"},
+		"serviceDest":   []map[string]interface{}{{"port": "8080", "srcPort": int64(1234)}},
+	}, actual)
+}
+
+func (s *ParamsTestSuite) Test_GetParamsMap_RedactsPasswordsAndCerts() {
+	sr := Service{
+		ServiceName: "my-service",
+		ServiceCert: "-----BEGIN CERTIFICATE-----",
+		Users:       []User{{Username: "user-1", Password: "pass-1"}, {Username: "user-2", Password: "pass-2"}},
+	}
+
+	actual := GetParamsMap(sr)
+
+	s.Equal("*****", actual["serviceCert"])
+	s.Equal("user-1:*****,user-2:*****", actual["users"])
+}
+
+func (s *ParamsTestSuite) Test_GetServiceFromParams_DistinguishesUnsetAndFalseBooleanPointers() {
+	unset, _ := GetServiceFromParams(url.Values{"serviceName": {"my-service"}})
+	disabled, err := GetServiceFromParams(url.Values{"serviceName": {"my-service"}, "setRealIp": {"false"}})
+
+	s.NoError(err)
+	s.Nil(unset.SetRealIp)
+	s.Require().NotNil(disabled.SetRealIp)
+	s.False(*disabled.SetRealIp)
+	s.Equal("false", GetParamsFromService(disabled).Get("setRealIp"))
+	s.Empty(GetParamsFromService(unset).Get("setRealIp"))
+}
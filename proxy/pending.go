@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// The actions of the pending operations
+const (
+	PendingAdd    = "add"
+	PendingRemove = "remove"
+)
+
+// The file the changes of the services are recorded in until the proxy is reloaded with them.
+// The changes recorded before a restart are recovered by LoadPendingChanges.
+var pendingChangesPath = "/cfg/pending-changes.json"
+var removeFile = os.Remove
+
+// PendingOperation is a change of the services that was not applied by a reload yet
+type PendingOperation struct {
+	// PendingAdd or PendingRemove
+	Action string
+	// The added service or, when the service is removed, only its name
+	Service Service
+}
+
+// The time the service was updated is kept since it is not part of the JSON of the services
+type pendingOperationJson struct {
+	Action    string
+	Service   Service
+	UpdatedAt time.Time
+}
+
+// MarshalJSON includes the time the service was updated
+func (o PendingOperation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pendingOperationJson{Action: o.Action, Service: o.Service, UpdatedAt: o.Service.UpdatedAt})
+}
+
+// UnmarshalJSON restores the time the service was updated
+func (o *PendingOperation) UnmarshalJSON(content []byte) error {
+	value := pendingOperationJson{}
+	if err := json.Unmarshal(content, &value); err != nil {
+		return err
+	}
+	*o = PendingOperation{Action: value.Action, Service: value.Service}
+	o.Service.UpdatedAt = value.UpdatedAt
+	return nil
+}
+
+var pending = struct {
+	sync.Mutex
+	// The operations since the last reload
+	operations []PendingOperation
+	// The operations recovered from the previous run that were not applied yet
+	recovered []PendingOperation
+}{}
+
+// LoadPendingChanges recovers the operations that were recorded but not reloaded before the proxy stopped.
+// It must be called before the first reload since reloads discard the recorded operations.
+func LoadPendingChanges() error {
+	content, err := ReadFile(pendingChangesPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	operations := []PendingOperation{}
+	if err := json.Unmarshal(content, &operations); err != nil {
+		return err
+	}
+	pending.Lock()
+	defer pending.Unlock()
+	pending.recovered = operations
+	pending.operations = nil
+	if len(operations) > 0 {
+		logPrintf("WARNING: %d changes of the services were not applied before the proxy stopped", len(operations))
+	}
+	return nil
+}
+
+// HasPendingChanges returns whether there are recovered operations that were not applied
+func HasPendingChanges() bool {
+	pending.Lock()
+	defer pending.Unlock()
+	return len(pending.recovered) > 0
+}
+
+// GetPendingChanges returns the recovered operations that were not applied
+func GetPendingChanges() []PendingOperation {
+	pending.Lock()
+	defer pending.Unlock()
+	return append([]PendingOperation{}, pending.recovered...)
+}
+
+// ApplyPendingChanges invokes apply for each of the recovered operations, the oldest first.
+// It stops at the first operation that fails. That operation and those after it stay pending.
+func ApplyPendingChanges(apply func(operation PendingOperation) error) error {
+	for _, operation := range GetPendingChanges() {
+		logPrintf("Applying the pending %s of the service %s", operation.Action, operation.Service.ServiceName)
+		if err := apply(operation); err != nil {
+			return err
+		}
+		pending.Lock()
+		pending.recovered = pending.recovered[1:]
+		writePendingChanges()
+		pending.Unlock()
+	}
+	return nil
+}
+
+// Records the operation until the next reload
+func recordPendingOperation(operation PendingOperation) {
+	pending.Lock()
+	defer pending.Unlock()
+	pending.operations = append(pending.operations, operation)
+	writePendingChanges()
+}
+
+// Discards the operations applied by the reload. The recovered operations that were not applied are kept.
+func clearPendingChanges() {
+	pending.Lock()
+	defer pending.Unlock()
+	if len(pending.operations) == 0 {
+		return
+	}
+	pending.operations = nil
+	writePendingChanges()
+}
+
+// Writes the operations to the file or removes it when there is nothing pending. Must be called with the lock held.
+func writePendingChanges() {
+	operations := append(append([]PendingOperation{}, pending.recovered...), pending.operations...)
+	if len(operations) == 0 {
+		if err := removeFile(pendingChangesPath); err != nil && !os.IsNotExist(err) {
+			logPrintf("Could not remove the pending changes %s\n%s", pendingChangesPath, err.Error())
+		}
+		return
+	}
+	content, _ := json.Marshal(operations)
+	if err := writeFile(pendingChangesPath, content, 0664); err != nil {
+		logPrintf("Could not record the pending changes in %s\n%s", pendingChangesPath, err.Error())
+	}
+}
@@ -0,0 +1,161 @@
+// +build !integration
+
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PendingTestSuite struct {
+	suite.Suite
+	TemplatesPath string
+	dataOrig      Data
+}
+
+func TestPendingUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(PendingTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *PendingTestSuite) SetupTest() {
+	s.TemplatesPath, _ = ioutil.TempDir("", "pending")
+	ioutil.WriteFile(s.TemplatesPath+"/haproxy.tmpl", []byte("frontend services{{.ContentFrontend}}"), 0644)
+	pendingChangesPath = s.TemplatesPath + "/pending-changes.json"
+	s.dataOrig = data
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{}}
+	s.restart()
+	validateConfig = func(content string) error { return nil }
+	readPidFile = func(fileName string) ([]byte, error) { return []byte("1"), nil }
+	cmdRunHa = func(cmd *exec.Cmd) error { return nil }
+	writeFile = ioutil.WriteFile
+	ReadFile = ioutil.ReadFile
+	removeFile = os.Remove
+	readConfigsDir = ioutil.ReadDir
+	readConfigsFile = ioutil.ReadFile
+}
+
+func (s *PendingTestSuite) TearDownTest() {
+	os.RemoveAll(s.TemplatesPath)
+	pendingChangesPath = "/cfg/pending-changes.json"
+	data = s.dataOrig
+	s.restart()
+	validateConfig = validateConfigOrig
+	readPidFile = ioutil.ReadFile
+}
+
+// Simulates a restart of the process by discarding the state kept in memory
+func (s *PendingTestSuite) restart() {
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{}}
+	pending.operations = nil
+	pending.recovered = nil
+}
+
+// Recovery
+
+func (s *PendingTestSuite) Test_ApplyPendingChanges_RestoresServiceAddedBeforeRestart() {
+	haproxy := NewHaProxy(s.TemplatesPath, s.TemplatesPath, map[string]bool{})
+	s.Require().NoError(haproxy.AddService(Service{
+		ServiceName: "my-service",
+		AclName:     "my-service",
+		PathType:    "path_beg",
+		ServiceDest: []ServiceDest{{Port: "8080", ServicePath: []string{"/api"}}},
+	}))
+	s.restart()
+
+	s.Require().NoError(LoadPendingChanges())
+	s.True(HasPendingChanges())
+	s.Equal(1, haproxy.(HaProxy).DebugState().PendingChanges)
+
+	err := ApplyPendingChanges(func(operation PendingOperation) error {
+		s.Equal(PendingAdd, operation.Action)
+		if err := haproxy.AddService(operation.Service); err != nil {
+			return err
+		}
+		if err := haproxy.CreateConfigFromTemplates(); err != nil {
+			return err
+		}
+		return haproxy.Reload()
+	})
+
+	s.NoError(err)
+	s.False(HasPendingChanges())
+	config, _ := ioutil.ReadFile(s.TemplatesPath + "/haproxy.cfg")
+	s.Contains(string(config), "acl url_my-service8080 path_beg /api")
+	_, err = os.Stat(pendingChangesPath)
+	s.True(os.IsNotExist(err))
+}
+
+func (s *PendingTestSuite) Test_ApplyPendingChanges_KeepsOperations_WhenApplyFails() {
+	HaProxy{}.AddService(Service{ServiceName: "service-1"})
+	HaProxy{}.RemoveService("service-1")
+	s.restart()
+	LoadPendingChanges()
+
+	err := ApplyPendingChanges(func(operation PendingOperation) error {
+		if operation.Action == PendingRemove {
+			return os.ErrPermission
+		}
+		return nil
+	})
+
+	s.Error(err)
+	s.Equal([]PendingOperation{{Action: PendingRemove, Service: Service{ServiceName: "service-1"}}}, GetPendingChanges())
+	s.restart()
+	LoadPendingChanges()
+	s.Len(GetPendingChanges(), 1)
+}
+
+func (s *PendingTestSuite) Test_LoadPendingChanges_ReturnsNil_WhenFileDoesNotExist() {
+	s.NoError(LoadPendingChanges())
+	s.False(HasPendingChanges())
+}
+
+func (s *PendingTestSuite) Test_Reload_KeepsRecoveredOperationsThatWereNotApplied() {
+	HaProxy{}.AddService(Service{ServiceName: "service-1"})
+	s.restart()
+	LoadPendingChanges()
+	HaProxy{}.AddService(Service{ServiceName: "service-2"})
+
+	HaProxy{}.Reload()
+
+	s.restart()
+	LoadPendingChanges()
+	actual := GetPendingChanges()
+	s.Require().Len(actual, 1)
+	s.Equal("service-1", actual[0].Service.ServiceName)
+}
+
+func (s *PendingTestSuite) Test_Reload_RemovesPendingChangesFile() {
+	HaProxy{}.AddService(Service{ServiceName: "service-1"})
+	_, err := os.Stat(pendingChangesPath)
+	s.Require().NoError(err)
+
+	HaProxy{}.Reload()
+
+	_, err = os.Stat(pendingChangesPath)
+	s.True(os.IsNotExist(err))
+}
+
+// Serialization
+
+func (s *PendingTestSuite) Test_PendingOperation_KeepsUpdatedAt() {
+	updatedAt := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	expected := PendingOperation{Action: PendingAdd, Service: Service{ServiceName: "my-service", UpdatedAt: updatedAt}}
+
+	content, err := json.Marshal(expected)
+	s.Require().NoError(err)
+	actual := PendingOperation{}
+	s.Require().NoError(json.Unmarshal(content, &actual))
+
+	s.Equal(expected, actual)
+	s.True(strings.Contains(string(content), `"Action":"add"`))
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Returns a validation error if a source port range of the service is malformed or combined with a port.
+// Requests are forwarded to the port they arrived at so a port of the destination would never be used.
+// Ranges overlapping with BIND_PORTS are rejected with ErrConflict.
+func validateSrcPortRanges(s Service) error {
+	for _, sd := range s.ServiceDest {
+		if len(sd.SrcPortRange) == 0 {
+			continue
+		}
+		from, to, err := parsePortRange(sd.SrcPortRange)
+		if err != nil {
+			return &ErrValidation{Fields: []string{"srcPortRange"}, Message: err.Error()}
+		}
+		if len(sd.Port) > 0 {
+			return &ErrValidation{
+				Fields:  []string{"port", "srcPortRange"},
+				Message: fmt.Sprintf("port %s cannot be used with srcPortRange %s since requests are forwarded to the port they arrived at", sd.Port, sd.SrcPortRange),
+			}
+		}
+		for _, port := range getBindPortNumbers() {
+			if port >= from && port <= to {
+				return &ErrConflict{PortRange: sd.SrcPortRange, Port: port}
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the conflict of a destination of the service with a destination of the other service
+// if a source port range of one of them contains the source ports of the other
+func getSrcPortRangeConflict(service Service, name string, od ServiceDest) error {
+	otherFrom, otherTo, ok := getSrcPorts(od)
+	if !ok {
+		return nil
+	}
+	for _, sd := range service.ServiceDest {
+		if len(sd.SrcPortRange) == 0 && len(od.SrcPortRange) == 0 {
+			continue
+		}
+		if from, to, ok := getSrcPorts(sd); ok && from <= otherTo && otherFrom <= to {
+			portRange := sd.SrcPortRange
+			if len(portRange) == 0 {
+				portRange = od.SrcPortRange
+			}
+			return &ErrConflict{Owner: name, PortRange: portRange}
+		}
+	}
+	return nil
+}
+
+// Returns the first and the last source port of the destination
+func getSrcPorts(sd ServiceDest) (from, to int, ok bool) {
+	if len(sd.SrcPortRange) > 0 {
+		from, to, err := parsePortRange(sd.SrcPortRange)
+		return from, to, err == nil
+	}
+	return sd.SrcPort, sd.SrcPort, sd.SrcPort > 0
+}
+
+func parsePortRange(portRange string) (from, to int, err error) {
+	ports := strings.Split(portRange, "-")
+	if len(ports) == 2 {
+		from, errFrom := strconv.Atoi(ports[0])
+		to, errTo := strconv.Atoi(ports[1])
+		if errFrom == nil && errTo == nil && from > 0 && from <= to && to <= 65535 {
+			return from, to, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("srcPortRange %s is not a valid range (e.g. 10000-10100)", portRange)
+}
+
+// Returns the ports defined through BIND_PORTS.
+// Entries can be bound to an address (e.g. 127.0.0.1:8080), in which case the port follows the last colon.
+func getBindPortNumbers() []int {
+	ports := []int{}
+	if len(os.Getenv("BIND_PORTS")) == 0 {
+		return ports
+	}
+	for _, bindPort := range SplitEscaped(os.Getenv("BIND_PORTS")) {
+		// Options of the bind (e.g. ssl) follow the port
+		fields := strings.Fields(bindPort)
+		if len(fields) == 0 {
+			continue
+		}
+		bindPort = fields[0]
+		if i := strings.LastIndex(bindPort, ":"); i >= 0 {
+			bindPort = bindPort[i+1:]
+		}
+		if port, err := strconv.Atoi(bindPort); err == nil {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
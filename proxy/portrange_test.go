@@ -0,0 +1,139 @@
+// +build !integration
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PortRangeTestSuite struct {
+	suite.Suite
+	dataOrig Data
+}
+
+func TestPortRangeUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(PortRangeTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *PortRangeTestSuite) SetupTest() {
+	s.dataOrig = data
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{}}
+}
+
+func (s *PortRangeTestSuite) TearDownTest() {
+	data = s.dataOrig
+}
+
+// ValidateService
+
+func (s *PortRangeTestSuite) Test_ValidateService_ReturnsErrValidation_WhenSrcPortRangeIsInvalid() {
+	for _, portRange := range []string{"10000", "10100-10000", "a-b", "10000-70000"} {
+		err := ValidateService(Service{ServiceName: "rtp", ReqMode: "tcp", ServiceDest: []ServiceDest{{SrcPortRange: portRange}}})
+
+		var validation *ErrValidation
+		s.Require().True(errors.As(err, &validation), portRange)
+		s.Equal([]string{"srcPortRange"}, validation.Fields)
+	}
+}
+
+func (s *PortRangeTestSuite) Test_ValidateService_ReturnsErrValidation_WhenPortIsUsedWithSrcPortRange() {
+	err := ValidateService(Service{ServiceName: "rtp", ReqMode: "tcp", ServiceDest: []ServiceDest{{SrcPortRange: "10000-10100", Port: "5060"}}})
+
+	var validation *ErrValidation
+	s.Require().True(errors.As(err, &validation))
+	s.Equal([]string{"port", "srcPortRange"}, validation.Fields)
+}
+
+func (s *PortRangeTestSuite) Test_ValidateService_ReturnsErrConflict_WhenSrcPortRangeOverlapsWithBindPorts() {
+	defer os.Unsetenv("BIND_PORTS")
+	for _, bindPorts := range []string{"8085,10010", "8085,127.0.0.1:10010", "::1:10010", "10010 accept-proxy"} {
+		os.Setenv("BIND_PORTS", bindPorts)
+
+		err := ValidateService(Service{ServiceName: "rtp", ReqMode: "tcp", ServiceDest: []ServiceDest{{SrcPortRange: "10000-10100"}}})
+
+		s.Equal(&ErrConflict{PortRange: "10000-10100", Port: 10010}, err, bindPorts)
+		s.Contains(fmt.Sprint(err), "BIND_PORTS")
+	}
+}
+
+func (s *PortRangeTestSuite) Test_ValidateService_ReturnsNil_WhenSrcPortRangeDoesNotOverlapWithBindPorts() {
+	defer os.Unsetenv("BIND_PORTS")
+	os.Setenv("BIND_PORTS", "8085,127.0.0.1:10101")
+
+	err := ValidateService(Service{ServiceName: "rtp", ReqMode: "tcp", ServiceDest: []ServiceDest{{SrcPortRange: "10000-10100"}}})
+
+	s.NoError(err)
+}
+
+// AddService
+
+func (s *PortRangeTestSuite) Test_AddService_ReturnsErrConflict_WhenSrcPortRangeOverlapsWithAnotherService() {
+	others := []Service{
+		{ServiceName: "redis", ReqMode: "tcp", ServiceDest: []ServiceDest{{SrcPort: 10050, Port: "6379"}}},
+		{ServiceName: "sip", ReqMode: "tcp", ServiceDest: []ServiceDest{{SrcPortRange: "9000-10000"}}},
+	}
+	for _, other := range others {
+		data.Services = map[string]Service{}
+		p := HaProxy{}
+		s.Require().NoError(p.AddService(other))
+
+		err := p.AddService(Service{ServiceName: "rtp", ReqMode: "tcp", ServiceDest: []ServiceDest{{SrcPortRange: "10000-10100"}}})
+
+		s.Equal(&ErrConflict{Owner: other.ServiceName, PortRange: "10000-10100"}, err)
+		s.NotContains(data.Services, "rtp")
+	}
+}
+
+func (s *PortRangeTestSuite) Test_AddService_ReturnsErrConflict_WhenSrcPortIsInSrcPortRangeOfAnotherService() {
+	p := HaProxy{}
+	s.Require().NoError(p.AddService(Service{ServiceName: "rtp", ReqMode: "tcp", ServiceDest: []ServiceDest{{SrcPortRange: "10000-10100"}}}))
+
+	err := p.AddService(Service{ServiceName: "redis", ReqMode: "tcp", ServiceDest: []ServiceDest{{SrcPort: 10050, Port: "6379"}}})
+
+	s.Equal(&ErrConflict{Owner: "rtp", PortRange: "10000-10100"}, err)
+}
+
+func (s *PortRangeTestSuite) Test_AddService_AddsService_WhenSrcPortRangeIsUpdated() {
+	p := HaProxy{}
+	s.Require().NoError(p.AddService(Service{ServiceName: "rtp", ReqMode: "tcp", ServiceDest: []ServiceDest{{SrcPortRange: "10000-10100"}}}))
+
+	err := p.AddService(Service{ServiceName: "rtp", ReqMode: "tcp", ServiceDest: []ServiceDest{{SrcPortRange: "10000-10200"}}})
+
+	s.NoError(err)
+	s.Equal("10000-10200", data.Services["rtp"].ServiceDest[0].SrcPortRange)
+}
+
+func (s *PortRangeTestSuite) Test_AddService_TakesOverSrcPorts_WhenServiceIsForced() {
+	p := HaProxy{}
+	s.Require().NoError(p.AddService(Service{ServiceName: "redis", ReqMode: "tcp", ServiceDest: []ServiceDest{{SrcPort: 10050, Port: "6379"}}}))
+
+	err := p.AddService(Service{ServiceName: "rtp", ReqMode: "tcp", Force: true, ServiceDest: []ServiceDest{{SrcPortRange: "10000-10100"}}})
+
+	s.NoError(err)
+	s.NotContains(data.Services, "redis")
+}
+
+// GetBackendName
+
+func (s *PortRangeTestSuite) Test_GetBackendName_IsUsedByTcpFrontendOfSrcPortRange() {
+	service := Service{ServiceName: "my-service", AclName: "my-acl", ReqMode: "tcp", ServiceDest: []ServiceDest{{SrcPortRange: "10000-10100"}}}
+
+	actual := (&HaProxy{}).getFrontTemplateTcp(service)
+
+	s.True(strings.Contains(actual, "default_backend my-acl-be10000-10100"), actual)
+	s.Equal("my-acl-be10000-10100", GetBackendName(service, service.ServiceDest[0]))
+}
+
+func (s *PortRangeTestSuite) Test_GetBackendName_DefaultsToIdentifier_WhenAclNameIsEmpty() {
+	service := Service{ServiceName: "my/service", ServiceDest: []ServiceDest{{SrcPortRange: "10000-10100"}}}
+
+	s.Equal("my_service-be10000-10100", GetBackendName(service, service.ServiceDest[0]))
+}
@@ -1,5 +1,10 @@
 package proxy
 
+import (
+	"sync"
+	"time"
+)
+
 var ProxyInstance Proxy = HaProxy{}
 
 type Data struct {
@@ -9,15 +14,30 @@ type Data struct {
 
 var data = Data{}
 
+// Guards data since requests are handled concurrently.
+// Exported methods lock it while the unexported ones expect the caller to hold it.
+var dataMu sync.RWMutex
+
 type Proxy interface {
 	RunCmd(extraArgs []string) error
 	CreateConfigFromTemplates() error
 	ReadConfig() (string, error)
 	Reload() error
-	AddCert(certName string)
+	ReloadAfter(delay time.Duration) error
+	AddCert(certName string) error
+	RemoveCert(certName string)
 	GetCerts() map[string]string
-	AddService(service Service)
-	RemoveService(service string)
+	AddService(service Service) error
+	RemoveService(service string) error
+	GetServices() map[string]Service
+	GetServicesByNamespace(namespace string) map[string]Service
+	RemoveNamespace(namespace string) error
+	CreateSupportBundle() ([]byte, error)
+	DebugState() DebugState
+	SetServiceReplicas(serviceName string, replicas int) error
+	LoadState() error
+	WithMutations() Proxy
+	GetRenderer() ConfigRenderer
 }
 
 // Mock
@@ -0,0 +1,326 @@
+// Package proxytest provides a harness for the tests of programs that embed the proxy package.
+// The harness replaces all the seams of the proxy with an in-memory file system
+// and records the reloads and the runtime commands instead of running HAProxy.
+package proxytest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"../../proxy"
+)
+
+const (
+	// The directory the proxy reads the templates from
+	TemplatesPath = "/cfg/tmpl"
+	// The directory the proxy writes haproxy.cfg to
+	ConfigsPath = "/cfg"
+	// The content of the pid file read by the proxy on reloads
+	Pid = "1"
+	// The path of the runtime socket of HAProxy. It does not exist until CreateRuntimeSocket is called.
+	SocketPath = "/var/run/haproxy.sock"
+)
+
+// Harness is an instance of the proxy isolated from the system it runs on
+type Harness struct {
+	// The proxy with the services added through the harness
+	Proxy proxy.Proxy
+	// The error returned by HAProxy when the proxy reloads. Reloads succeed if it is nil.
+	ReloadError error
+	// The output HAProxy writes to stderr when the reload fails
+	ReloadOutput string
+	// The error returned by the validation of the configuration. The configuration is valid if it is nil.
+	ValidateError error
+	// The current time of the proxy. Defaults to time.Now.
+	Clock func() time.Time
+	// Answers the HTTP requests of the proxy (e.g. blocklist downloads). The requests fail if it is nil.
+	HttpGet func(url string) (*http.Response, error)
+	// The output of `haproxy -vv` used to detect the features of HAProxy (e.g. Lua). Lua is not supported if it is empty.
+	BuildInfo string
+
+	t        testing.TB
+	mu       sync.Mutex
+	files    map[string][]byte
+	reloads  [][]string
+	commands []string
+	logs     []string
+	orig     proxy.Seams
+}
+
+// New creates the harness and replaces the seams of the proxy.
+// The base template (haproxy.tmpl) is copied from the specified file into the in-memory file system.
+// Close must be called at the end of the test to restore the seams.
+func New(t testing.TB, baseTemplatePath string) *Harness {
+	t.Helper()
+	tmpl, err := ioutil.ReadFile(baseTemplatePath)
+	if err != nil {
+		t.Fatalf("Could not read the base template %s\n%s", baseTemplatePath, err.Error())
+	}
+	h := &Harness{
+		Clock: time.Now,
+		t:     t,
+		files: map[string][]byte{
+			TemplatesPath + "/haproxy.tmpl": tmpl,
+			"/var/run/haproxy.pid":          []byte(Pid),
+		},
+		orig: proxy.GetSeams(),
+	}
+	proxy.SetSeams(proxy.Seams{
+		HaproxySocketPath:  SocketPath,
+		CmdRunHa:           h.runHa,
+		ReadConfigsFile:    h.readFile,
+		WriteFile:          h.writeFile,
+		ReadFile:           h.readFile,
+		LogPrintf:          h.logPrintf,
+		ReadPidFile:        h.readFile,
+		ReadConfigsDir:     h.readDir,
+		TimeNow:            func() time.Time { return h.Clock() },
+		RenameFile:         h.rename,
+		RemoveFile:         h.remove,
+		HttpGet:            h.httpGet,
+		ValidateConfig:     func(content string) error { return h.ValidateError },
+		SendRuntimeCommand: h.sendRuntimeCommand,
+		ReadRuntimeCommand: h.readRuntimeCommand,
+		MkdirAll:           func(path string, perm os.FileMode) error { return nil },
+		StatFile:           h.stat,
+		HaproxyBuildInfo:   func() (string, error) { return h.BuildInfo, nil },
+		// Delayed functions (e.g. the restores of warm-ups) are never run
+		AfterFunc: func(d time.Duration, f func()) (stop func() bool) {
+			return func() bool { return true }
+		},
+	})
+	h.Proxy = proxy.NewHaProxy(TemplatesPath, ConfigsPath, map[string]bool{})
+	return h
+}
+
+// Close restores the seams the proxy used before the harness was created
+func (h *Harness) Close() {
+	proxy.SetSeams(h.orig)
+}
+
+// WriteTemplate stores a template (e.g. my-service-be.cfg) in the templates directory of the proxy
+func (h *Harness) WriteTemplate(name, content string) {
+	h.WriteFile(path.Join(TemplatesPath, name), content)
+}
+
+// WriteFile stores a file (e.g. a certificate) in the in-memory file system
+func (h *Harness) WriteFile(filename, content string) {
+	h.writeFile(filename, []byte(content), 0664)
+}
+
+// CreateRuntimeSocket creates the runtime socket of HAProxy in the in-memory file system.
+// The proxy then changes the running HAProxy through runtime commands (see RuntimeCommands) instead of reloading it.
+func (h *Harness) CreateRuntimeSocket() {
+	h.WriteFile(SocketPath, "")
+}
+
+// RemoveFile deletes a file (e.g. the pid file) from the in-memory file system
+func (h *Harness) RemoveFile(filename string) {
+	h.remove(filename)
+}
+
+// File returns the content of a file of the in-memory file system
+func (h *Harness) File(filename string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	content, ok := h.files[filename]
+	return string(content), ok
+}
+
+// RenderedConfig returns the last haproxy.cfg written by the proxy
+func (h *Harness) RenderedConfig() string {
+	config, _ := h.File(ConfigsPath + "/haproxy.cfg")
+	return config
+}
+
+// Reloads returns the arguments of the HAProxy commands run by the proxy
+func (h *Harness) Reloads() [][]string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([][]string{}, h.reloads...)
+}
+
+// RuntimeCommands returns the commands sent to the runtime socket of HAProxy
+func (h *Harness) RuntimeCommands() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string{}, h.commands...)
+}
+
+// Logs returns the messages logged by the proxy
+func (h *Harness) Logs() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string{}, h.logs...)
+}
+
+// AssertConfigContains fails the test if the rendered configuration does not contain the line
+func (h *Harness) AssertConfigContains(line string) bool {
+	h.t.Helper()
+	if !strings.Contains(h.RenderedConfig(), line) {
+		h.t.Errorf("The configuration does not contain %q\n%s", line, h.RenderedConfig())
+		return false
+	}
+	return true
+}
+
+// AssertBackendContains fails the test if none of the backends of the service contains the line.
+// The backends are found by the ACL name of the service in the rendered configuration.
+func (h *Harness) AssertBackendContains(serviceName, line string) bool {
+	h.t.Helper()
+	aclName := proxy.GetIdentifier(serviceName)
+	if s, ok := h.Proxy.GetServices()[serviceName]; ok && len(s.AclName) > 0 {
+		aclName = s.AclName
+	}
+	backends := h.getBackends(aclName)
+	if len(backends) == 0 {
+		h.t.Errorf("The configuration does not contain backends of the service %s\n%s", serviceName, h.RenderedConfig())
+		return false
+	}
+	for _, backend := range backends {
+		for _, l := range strings.Split(backend, "\n") {
+			if strings.TrimSpace(l) == strings.TrimSpace(line) {
+				return true
+			}
+		}
+	}
+	h.t.Errorf("The backends of the service %s do not contain %q\n%s", serviceName, line, strings.Join(backends, "\n"))
+	return false
+}
+
+// Returns the sections of the backends named after the ACL name (e.g. my-service-be8080 and https-my-service-be8080)
+func (h *Harness) getBackends(aclName string) []string {
+	backends := []string{}
+	for _, section := range strings.Split(h.RenderedConfig(), "\n\n") {
+		section = strings.TrimLeft(section, "\n")
+		name := strings.TrimPrefix(strings.SplitN(section, "\n", 2)[0], "backend ")
+		if name == section || !strings.HasPrefix(strings.TrimPrefix(name, "https-"), aclName+"-be") {
+			continue
+		}
+		backends = append(backends, section)
+	}
+	return backends
+}
+
+func (h *Harness) runHa(cmd *exec.Cmd) error {
+	h.mu.Lock()
+	h.reloads = append(h.reloads, cmd.Args[1:])
+	h.mu.Unlock()
+	if h.ReloadError != nil && len(h.ReloadOutput) > 0 && cmd.Stderr != nil {
+		cmd.Stderr.Write([]byte(h.ReloadOutput))
+	}
+	return h.ReloadError
+}
+
+func (h *Harness) readFile(filename string) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	content, ok := h.files[filename]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: filename, Err: os.ErrNotExist}
+	}
+	return append([]byte{}, content...), nil
+}
+
+func (h *Harness) writeFile(filename string, data []byte, perm os.FileMode) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.files[filename] = append([]byte{}, data...)
+	return nil
+}
+
+func (h *Harness) rename(oldpath, newpath string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	content, ok := h.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	delete(h.files, oldpath)
+	h.files[newpath] = content
+	return nil
+}
+
+func (h *Harness) remove(name string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(h.files, name)
+	return nil
+}
+
+func (h *Harness) readDir(dirname string) ([]os.FileInfo, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	infos := []os.FileInfo{}
+	for filename, content := range h.files {
+		if path.Dir(filename) == path.Clean(dirname) {
+			infos = append(infos, fileInfo{name: path.Base(filename), size: int64(len(content)), modTime: h.Clock()})
+		}
+	}
+	if len(infos) == 0 {
+		return nil, &os.PathError{Op: "open", Path: dirname, Err: os.ErrNotExist}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (h *Harness) stat(name string) (os.FileInfo, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	content, ok := h.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return fileInfo{name: path.Base(name), size: int64(len(content)), modTime: h.Clock()}, nil
+}
+
+func (h *Harness) httpGet(url string) (*http.Response, error) {
+	if h.HttpGet == nil {
+		return nil, fmt.Errorf("The harness does not allow HTTP requests (%s)", url)
+	}
+	return h.HttpGet(url)
+}
+
+func (h *Harness) sendRuntimeCommand(socket, command string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.commands = append(h.commands, command)
+	return nil
+}
+
+func (h *Harness) readRuntimeCommand(socket, command string) (string, error) {
+	h.sendRuntimeCommand(socket, command)
+	return "", nil
+}
+
+func (h *Harness) logPrintf(format string, v ...interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.logs = append(h.logs, fmt.Sprintf(format, v...))
+}
+
+// The information of the files of the in-memory file system
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() os.FileMode  { return 0664 }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return false }
+func (fi fileInfo) Sys() interface{}   { return nil }
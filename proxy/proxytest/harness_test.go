@@ -0,0 +1,200 @@
+// +build !integration
+
+package proxytest
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"../../proxy"
+	"github.com/stretchr/testify/suite"
+)
+
+type HarnessTestSuite struct {
+	suite.Suite
+	harness *Harness
+}
+
+func TestHarnessUnitTestSuite(t *testing.T) {
+	s := new(HarnessTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *HarnessTestSuite) SetupTest() {
+	s.harness = New(s.T(), "../test_configs/tmpl/haproxy.tmpl")
+}
+
+func (s *HarnessTestSuite) TearDownTest() {
+	s.harness.Close()
+}
+
+// AddService > CreateConfigFromTemplates > Reload
+
+func (s *HarnessTestSuite) Test_Harness_RunsAddServiceCreateConfigAndReload() {
+	s.harness.WriteTemplate("my-service-be.cfg", `
+backend my-service-be8080
+    mode http
+    server my-service my-service:8080`)
+
+	err := s.harness.Proxy.AddService(proxy.Service{
+		ServiceName: "my-service",
+		PathType:    "path_beg",
+		ServiceDest: []proxy.ServiceDest{{Port: "8080", ServicePath: []string{"/api"}}},
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(s.harness.Proxy.CreateConfigFromTemplates())
+	s.Require().NoError(s.harness.Proxy.Reload())
+
+	s.harness.AssertConfigContains("    acl url_my-service8080 path_beg /api")
+	s.harness.AssertBackendContains("my-service", "server my-service my-service:8080")
+	s.Equal([][]string{{"-f", "/cfg/haproxy.cfg", "-D", "-p", "/var/run/haproxy.pid", "-sf", Pid}}, s.harness.Reloads())
+}
+
+func (s *HarnessTestSuite) Test_Harness_ReturnsReloadError() {
+	s.harness.ReloadError = fmt.Errorf("This is an error")
+
+	s.Error(s.harness.Proxy.Reload())
+	s.Len(s.harness.Reloads(), 1)
+}
+
+func (s *HarnessTestSuite) Test_Harness_DoesNotWriteConfig_WhenValidationFails() {
+	s.harness.ValidateError = fmt.Errorf("This is an error")
+
+	s.Error(s.harness.Proxy.CreateConfigFromTemplates())
+	s.Empty(s.harness.RenderedConfig())
+}
+
+func (s *HarnessTestSuite) Test_AssertBackendContains_Fails_WhenServiceHasNoBackends() {
+	t := &testing.T{}
+	harness := &Harness{Proxy: s.harness.Proxy, t: t, files: map[string][]byte{}}
+
+	s.False(harness.AssertBackendContains("my-service", "server my-service my-service:8080"))
+}
+
+// AddService > SetServiceReplicas
+
+func (s *HarnessTestSuite) Test_Harness_ScalesServiceWithinReplicaHeadroomThroughRuntimeSocket() {
+	defer func() {
+		os.Unsetenv("CONFIG_FLAVOR")
+		os.Unsetenv("REPLICA_HEADROOM")
+	}()
+	os.Setenv("CONFIG_FLAVOR", "haproxy-2.x")
+	os.Setenv("REPLICA_HEADROOM", "2")
+	harness := New(s.T(), "../test_configs/tmpl/haproxy.tmpl")
+	defer harness.Close()
+	harness.CreateRuntimeSocket()
+	service := proxy.Service{
+		ServiceName: "my-service",
+		AclName:     "my-service",
+		Replicas:    2,
+		ServiceDest: []proxy.ServiceDest{{Port: "8080", ServicePath: []string{"/api"}}},
+	}
+	service.ReplicaSlots = harness.Proxy.GetRenderer().GetReplicaSlots(service)
+	s.Require().Equal(4, service.ReplicaSlots)
+	s.Require().NoError(harness.Proxy.AddService(service))
+
+	err := harness.Proxy.SetServiceReplicas("my-service", 4)
+
+	s.NoError(err)
+	s.Equal(
+		[]string{"set server my-service-be8080/my-service3 state ready", "set server my-service-be8080/my-service4 state ready"},
+		harness.RuntimeCommands(),
+	)
+	s.Equal(4, harness.Proxy.GetServices()["my-service"].Replicas)
+	s.Empty(harness.Reloads())
+	s.Equal(proxy.ErrReconfigureRequired, harness.Proxy.SetServiceReplicas("my-service", 5))
+}
+
+func (s *HarnessTestSuite) Test_Harness_RequiresReconfigure_WhenRuntimeSocketDoesNotExist() {
+	s.Require().NoError(s.harness.Proxy.AddService(proxy.Service{
+		ServiceName:  "my-service",
+		Replicas:     2,
+		ReplicaSlots: 4,
+		ServiceDest:  []proxy.ServiceDest{{Port: "8080", ServicePath: []string{"/api"}}},
+	}))
+
+	err := s.harness.Proxy.SetServiceReplicas("my-service", 3)
+
+	s.Equal(proxy.ErrReconfigureRequired, err)
+	s.Empty(s.harness.RuntimeCommands())
+}
+
+// Seams
+
+func (s *HarnessTestSuite) Test_Seams_UseSocketPathOfHarness() {
+	s.Equal(SocketPath, proxy.GetSeams().HaproxySocketPath)
+	_, err := proxy.GetSeams().StatFile(SocketPath)
+	s.Error(err)
+
+	s.harness.CreateRuntimeSocket()
+
+	_, err = proxy.GetSeams().StatFile(SocketPath)
+	s.NoError(err)
+}
+
+func (s *HarnessTestSuite) Test_Seams_UseInMemoryFileSystem() {
+	seams := proxy.GetSeams()
+
+	s.NoError(seams.WriteFile("/certs/my-cert.pem", []byte("cert"), 0664))
+	s.NoError(seams.RenameFile("/certs/my-cert.pem", "/certs/renamed.pem"))
+	content, err := seams.ReadFile("/certs/renamed.pem")
+	s.NoError(err)
+	s.Equal("cert", string(content))
+	_, err = seams.ReadConfigsFile("/certs/my-cert.pem")
+	s.Error(err)
+	pid, _ := seams.ReadPidFile("/var/run/haproxy.pid")
+	s.Equal(Pid, string(pid))
+	infos, err := seams.ReadConfigsDir(TemplatesPath)
+	s.NoError(err)
+	s.Equal("haproxy.tmpl", infos[0].Name())
+	_, err = seams.StatFile("/certs/renamed.pem")
+	s.NoError(err)
+	s.NoError(seams.MkdirAll("/errorfiles/json", 0755))
+}
+
+func (s *HarnessTestSuite) Test_Seams_RecordCommandsAndLogs() {
+	seams := proxy.GetSeams()
+
+	s.NoError(seams.CmdRunHa(exec.Command("haproxy", "-v")))
+	s.NoError(seams.SendRuntimeCommand("/var/run/haproxy.sock", "set server be/srv state drain"))
+	_, err := seams.ReadRuntimeCommand("/var/run/haproxy.sock", "show stat")
+	s.NoError(err)
+	seams.LogPrintf("Hello %s", "world")
+
+	s.Equal([][]string{{"-v"}}, s.harness.Reloads())
+	s.Equal([]string{"set server be/srv state drain", "show stat"}, s.harness.RuntimeCommands())
+	s.Equal([]string{"Hello world"}, s.harness.Logs())
+}
+
+func (s *HarnessTestSuite) Test_Seams_UseClockAndDoNotRunDelayedFunctions() {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.harness.Clock = func() time.Time { return now }
+	seams := proxy.GetSeams()
+	called := false
+
+	seams.AfterFunc(time.Millisecond, func() { called = true })
+	time.Sleep(5 * time.Millisecond)
+
+	s.Equal(now, seams.TimeNow())
+	s.False(called)
+	s.NoError(seams.ValidateConfig("global"))
+	_, err := seams.HttpGet("http://example.com")
+	s.Error(err)
+}
+
+// Close
+
+func (s *HarnessTestSuite) Test_Close_RestoresSeams() {
+	harness := New(s.T(), "../test_configs/tmpl/haproxy.tmpl")
+
+	harness.Close()
+	proxy.GetSeams().WriteFile("/tmp/file.txt", []byte("content"), 0664)
+
+	_, written := harness.File("/tmp/file.txt")
+	s.False(written)
+	content, _ := s.harness.File("/tmp/file.txt")
+	s.Equal("content", content)
+}
@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"../audit"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// FindBrokenServices returns the smallest set of services that must be excluded for the configuration to be valid.
+// The set is found through a binary search over the services with the configuration validated (not applied)
+// without the snippets of the excluded services. Quarantined services are not searched since they are excluded already.
+func (m HaProxy) FindBrokenServices() ([]string, error) {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	return m.findBrokenServices()
+}
+
+func (m HaProxy) findBrokenServices() ([]string, error) {
+	quarantined := m.getQuarantinedServices()
+	names := []string{}
+	for name := range data.Services {
+		if !quarantined[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if m.isValidWithout(quarantined, nil) {
+		return []string{}, nil
+	}
+	if !m.isValidWithout(quarantined, names) {
+		return nil, fmt.Errorf("The configuration is invalid even without the services")
+	}
+	broken := m.bisectServices(quarantined, names)
+	sort.Strings(broken)
+	return broken, nil
+}
+
+// Returns the smallest subset of candidates that must be excluded together with the base.
+// The configuration must be valid without the base and the candidates and invalid without the base only.
+func (m HaProxy) bisectServices(base map[string]bool, candidates []string) []string {
+	if len(candidates) == 1 {
+		return candidates
+	}
+	left := candidates[:len(candidates)/2]
+	right := candidates[len(candidates)/2:]
+	if m.isValidWithout(base, left) {
+		return m.bisectServices(base, left)
+	}
+	if m.isValidWithout(base, right) {
+		return m.bisectServices(base, right)
+	}
+	// Both halves contain broken services
+	brokenLeft := m.bisectServices(m.mergeExcluded(base, right), left)
+	if m.isValidWithout(base, brokenLeft) {
+		return brokenLeft
+	}
+	return append(brokenLeft, m.bisectServices(m.mergeExcluded(base, brokenLeft), right)...)
+}
+
+func (m HaProxy) isValidWithout(base map[string]bool, services []string) bool {
+	content, err := m.renderConfig(m.mergeExcluded(base, services))
+	if err != nil {
+		return false
+	}
+	return validateConfig(content) == nil
+}
+
+func (m HaProxy) mergeExcluded(base map[string]bool, services []string) map[string]bool {
+	excluded := map[string]bool{}
+	for name := range base {
+		excluded[name] = true
+	}
+	for _, name := range services {
+		excluded[name] = true
+	}
+	return excluded
+}
+
+func (m HaProxy) getQuarantinedServices() map[string]bool {
+	quarantined := map[string]bool{}
+	for name, s := range data.Services {
+		if s.Quarantined {
+			quarantined[name] = true
+		}
+	}
+	return quarantined
+}
+
+// Identifies the services responsible for the failed reload and adds them to the error.
+// If QUARANTINE_BROKEN_SERVICES is true, the services are excluded from the configuration and the proxy is reloaded
+// with the rest of the services. In that case, nil is returned if the reload succeeds.
+func (m HaProxy) isolateBrokenServices(reloadErr error, cmdArgs []string) error {
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	broken, err := m.findBrokenServices()
+	if err != nil {
+		logPrintf("Could not identify the services responsible for the failed reload\n%s", err.Error())
+		return reloadErr
+	}
+	if len(broken) == 0 {
+		return reloadErr
+	}
+	audit.Instance.Append("reload-failed", "The configuration of the services %s is invalid", strings.Join(broken, ", "))
+	var failed *ErrReloadFailed
+	if errors.As(reloadErr, &failed) {
+		failed.BrokenServices = broken
+	}
+	if !isQuarantineEnabled() {
+		return reloadErr
+	}
+	m.quarantineServices(broken)
+	if err := m.createConfigFromTemplates(); err != nil {
+		return err
+	}
+	if err := (HaProxy{}).RunCmd(cmdArgs); err != nil {
+		return err
+	}
+	audit.Instance.Append("services-quarantined", "The services %s were excluded from the configuration", strings.Join(broken, ", "))
+	return nil
+}
+
+// Identifies the services responsible for the invalid configuration and adds them to the error.
+// If QUARANTINE_BROKEN_SERVICES is true, the configuration without the services is returned instead.
+func (m HaProxy) excludeBrokenServices(validationErr error) (string, error) {
+	invalid := &ErrInvalidConfig{Err: validationErr}
+	broken, err := m.findBrokenServices()
+	if err != nil {
+		logPrintf("Could not identify the services responsible for the invalid configuration\n%s", err.Error())
+		return "", invalid
+	}
+	if len(broken) == 0 {
+		return "", invalid
+	}
+	invalid.BrokenServices = broken
+	audit.Instance.Append("config-invalid", "The configuration of the services %s is invalid", strings.Join(broken, ", "))
+	if !isQuarantineEnabled() {
+		return "", invalid
+	}
+	m.quarantineServices(broken)
+	content, err := m.getConfigs()
+	if err != nil {
+		return "", err
+	}
+	if err := validateConfig(content); err != nil {
+		return "", &ErrInvalidConfig{Err: err}
+	}
+	audit.Instance.Append("services-quarantined", "The services %s were excluded from the configuration", strings.Join(broken, ", "))
+	return content, nil
+}
+
+func (m HaProxy) quarantineServices(names []string) {
+	for _, name := range names {
+		s := data.Services[name]
+		s.Quarantined = true
+		data.Services[name] = s
+	}
+}
+
+func isQuarantineEnabled() bool {
+	return strings.EqualFold(os.Getenv("QUARANTINE_BROKEN_SERVICES"), "true")
+}
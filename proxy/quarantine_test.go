@@ -0,0 +1,237 @@
+// +build !integration
+
+package proxy
+
+import (
+	"../audit"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type QuarantineTestSuite struct {
+	suite.Suite
+	TemplatesPath string
+	dataOrig      Data
+}
+
+func TestQuarantineUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(QuarantineTestSuite)
+	suite.Run(t, s)
+}
+
+var validateConfigOrig = validateConfig
+
+func (s *QuarantineTestSuite) SetupTest() {
+	s.TemplatesPath, _ = ioutil.TempDir("", "quarantine")
+	ioutil.WriteFile(s.TemplatesPath+"/haproxy.tmpl", []byte("frontend services"), 0644)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		ioutil.WriteFile(fmt.Sprintf("%s/%s-be.cfg", s.TemplatesPath, name), []byte(fmt.Sprintf("backend %s-be", name)), 0644)
+	}
+	s.dataOrig = data
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{}}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		data.Services[name] = Service{ServiceName: name}
+	}
+	readPidFile = func(fileName string) ([]byte, error) {
+		return []byte("123"), nil
+	}
+	validateConfig = s.getValidator("c")
+}
+
+func (s *QuarantineTestSuite) TearDownTest() {
+	os.RemoveAll(s.TemplatesPath)
+	os.Unsetenv("QUARANTINE_BROKEN_SERVICES")
+	data = s.dataOrig
+	validateConfig = validateConfigOrig
+	writeFile = ioutil.WriteFile
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return cmd.Run()
+	}
+}
+
+// FindBrokenServices
+
+func (s *QuarantineTestSuite) Test_FindBrokenServices_ReturnsTheServiceWithInvalidBackend() {
+	actual, err := s.getProxy().FindBrokenServices()
+
+	s.NoError(err)
+	s.Equal([]string{"c"}, actual)
+}
+
+func (s *QuarantineTestSuite) Test_FindBrokenServices_ReturnsAllServicesWithInvalidBackends() {
+	validateConfig = s.getValidator("a", "d")
+
+	actual, err := s.getProxy().FindBrokenServices()
+
+	s.NoError(err)
+	s.Equal([]string{"a", "d"}, actual)
+}
+
+func (s *QuarantineTestSuite) Test_FindBrokenServices_ReturnsEmptySlice_WhenConfigIsValid() {
+	validateConfig = s.getValidator()
+
+	actual, err := s.getProxy().FindBrokenServices()
+
+	s.NoError(err)
+	s.Empty(actual)
+}
+
+func (s *QuarantineTestSuite) Test_FindBrokenServices_ReturnsError_WhenConfigIsInvalidWithoutServices() {
+	validateConfig = func(content string) error {
+		return fmt.Errorf("This is an error")
+	}
+
+	_, err := s.getProxy().FindBrokenServices()
+
+	s.Error(err)
+}
+
+func (s *QuarantineTestSuite) Test_FindBrokenServices_IgnoresQuarantinedServices() {
+	validateConfig = s.getValidator("a", "c")
+	a := data.Services["a"]
+	a.Quarantined = true
+	data.Services["a"] = a
+
+	actual, _ := s.getProxy().FindBrokenServices()
+
+	s.Equal([]string{"c"}, actual)
+}
+
+// Reload
+
+func (s *QuarantineTestSuite) Test_Reload_ReturnsErrorWithBrokenServices() {
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return fmt.Errorf("This is an error")
+	}
+
+	err := s.getProxy().Reload()
+
+	var failed *ErrReloadFailed
+	s.True(errors.As(err, &failed))
+	s.Equal([]string{"c"}, failed.BrokenServices)
+	s.Contains(err.Error(), "The configuration of the services c is invalid")
+	s.False(data.Services["c"].Quarantined)
+	entries := audit.Instance.GetEntries(1)
+	s.Equal("reload-failed", entries[0].Event)
+	s.Equal("The configuration of the services c is invalid", entries[0].Message)
+}
+
+func (s *QuarantineTestSuite) Test_Reload_QuarantinesBrokenServices_WhenQuarantineIsEnabled() {
+	os.Setenv("QUARANTINE_BROKEN_SERVICES", "true")
+	runs := 0
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		runs++
+		if runs == 1 {
+			return fmt.Errorf("This is an error")
+		}
+		return nil
+	}
+	actualConfig := ""
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actualConfig = string(data)
+		return nil
+	}
+
+	err := s.getProxy().Reload()
+
+	s.NoError(err)
+	s.Equal(2, runs)
+	s.True(s.getProxy().GetServices()["c"].Quarantined)
+	s.False(s.getProxy().GetServices()["a"].Quarantined)
+	s.NotContains(actualConfig, "backend c-be")
+	s.Contains(actualConfig, "backend a-be")
+}
+
+func (s *QuarantineTestSuite) Test_Reload_ReturnsError_WhenReloadWithoutQuarantinedServicesFails() {
+	os.Setenv("QUARANTINE_BROKEN_SERVICES", "true")
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return fmt.Errorf("This is an error")
+	}
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		return nil
+	}
+
+	s.Error(s.getProxy().Reload())
+}
+
+// CreateConfigFromTemplates
+
+func (s *QuarantineTestSuite) Test_CreateConfigFromTemplates_DoesNotWriteConfig_WhenValidationFails() {
+	written := []string{}
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		written = append(written, filename)
+		return nil
+	}
+
+	err := s.getProxy().CreateConfigFromTemplates()
+
+	var invalid *ErrInvalidConfig
+	s.True(errors.As(err, &invalid))
+	s.Equal([]string{"c"}, invalid.BrokenServices)
+	s.Contains(err.Error(), "The backend c-be is invalid")
+	s.NotContains(written, s.TemplatesPath+"/haproxy.cfg")
+	s.False(data.Services["c"].Quarantined)
+	entries := audit.Instance.GetEntries(1)
+	s.Equal("config-invalid", entries[0].Event)
+}
+
+func (s *QuarantineTestSuite) Test_CreateConfigFromTemplates_ReturnsValidationOutput_WhenServicesAreNotResponsible() {
+	validateConfig = func(content string) error {
+		return fmt.Errorf("[ALERT] Error(s) found in configuration file")
+	}
+	written := []string{}
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		written = append(written, filename)
+		return nil
+	}
+
+	err := s.getProxy().CreateConfigFromTemplates()
+
+	var invalid *ErrInvalidConfig
+	s.True(errors.As(err, &invalid))
+	s.Empty(invalid.BrokenServices)
+	s.Contains(err.Error(), "[ALERT] Error(s) found in configuration file")
+	s.Empty(written)
+}
+
+func (s *QuarantineTestSuite) Test_CreateConfigFromTemplates_WritesConfigWithoutBrokenServices_WhenQuarantineIsEnabled() {
+	os.Setenv("QUARANTINE_BROKEN_SERVICES", "true")
+	actualConfig := ""
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		actualConfig = string(data)
+		return nil
+	}
+
+	err := s.getProxy().CreateConfigFromTemplates()
+
+	s.NoError(err)
+	s.True(data.Services["c"].Quarantined)
+	s.NotContains(actualConfig, "backend c-be")
+	s.Contains(actualConfig, "backend a-be")
+}
+
+// Util
+
+func (s *QuarantineTestSuite) getProxy() HaProxy {
+	return HaProxy{TemplatesPath: s.TemplatesPath, ConfigsPath: s.TemplatesPath}
+}
+
+// Returns a validator that rejects configurations with the backends of the services
+func (s *QuarantineTestSuite) getValidator(services ...string) func(content string) error {
+	return func(content string) error {
+		for _, service := range services {
+			if strings.Contains(content, fmt.Sprintf("backend %s-be", service)) {
+				return fmt.Errorf("The backend %s-be is invalid", service)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,176 @@
+// +build !integration
+
+package proxy_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"../proxy"
+	"./proxytest"
+	"github.com/stretchr/testify/suite"
+)
+
+// The tests run the proxy the way programs embedding the package do, through the proxytest harness
+type ReloadTestSuite struct {
+	suite.Suite
+	harness *proxytest.Harness
+}
+
+func TestReloadUnitTestSuite(t *testing.T) {
+	s := new(ReloadTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *ReloadTestSuite) SetupTest() {
+	s.harness = proxytest.New(s.T(), "test_configs/tmpl/haproxy.tmpl")
+}
+
+func (s *ReloadTestSuite) TearDownTest() {
+	s.harness.Close()
+}
+
+// Reload
+
+func (s *ReloadTestSuite) Test_Reload_RunsHaProxyWithPidsOfPidFile() {
+	expected := [][]string{{"-f", "/cfg/haproxy.cfg", "-D", "-p", "/var/run/haproxy.pid", "-sf", proxytest.Pid}}
+
+	s.NoError(s.harness.Proxy.Reload())
+
+	s.Equal(expected, s.harness.Reloads())
+}
+
+func (s *ReloadTestSuite) Test_Reload_FinishesAllOldProcesses_WhenPidFileContainsSeveralPids() {
+	s.harness.WriteFile("/var/run/haproxy.pid", "123\n456 789\n")
+	expected := [][]string{{"-f", "/cfg/haproxy.cfg", "-D", "-p", "/var/run/haproxy.pid", "-sf", "123", "456", "789"}}
+
+	s.harness.Proxy.Reload()
+
+	s.Equal(expected, s.harness.Reloads())
+}
+
+func (s *ReloadTestSuite) Test_Reload_StartsProxy_WhenPidFileDoesNotExist() {
+	s.harness.RemoveFile("/var/run/haproxy.pid")
+	expected := [][]string{{"-f", "/cfg/haproxy.cfg", "-D", "-p", "/var/run/haproxy.pid"}}
+
+	err := s.harness.Proxy.Reload()
+
+	s.NoError(err)
+	s.Equal(expected, s.harness.Reloads())
+}
+
+func (s *ReloadTestSuite) Test_Reload_ReturnsError_WhenHaCommandFails() {
+	s.harness.ReloadError = fmt.Errorf("This is an error")
+
+	err := s.harness.Proxy.Reload()
+
+	s.Error(err)
+}
+
+func (s *ReloadTestSuite) Test_Reload_ReturnsErrReloadFailed_WhenHaCommandFails() {
+	s.harness.ReloadError = fmt.Errorf("This is an error")
+	s.harness.WriteFile(proxytest.ConfigsPath+"/haproxy.cfg", "invalid config")
+
+	err := s.harness.Proxy.Reload()
+
+	var reloadFailed *proxy.ErrReloadFailed
+	s.Require().True(errors.As(err, &reloadFailed))
+	s.Equal("invalid config", reloadFailed.Output)
+	s.Contains(err.Error(), "This is an error")
+}
+
+func (s *ReloadTestSuite) Test_Reload_ReturnsErrorWithOutput_WhenHaCommandFails() {
+	s.harness.ReloadError = fmt.Errorf("exit status 1")
+	s.harness.ReloadOutput = "[ALERT] 123/104512 (27) : parsing [/cfg/haproxy.cfg:123]: unknown keyword 'bindd' in 'frontend' section\n"
+
+	err := s.harness.Proxy.Reload()
+
+	s.Require().Error(err)
+	s.Contains(err.Error(), "exit status 1\n[ALERT] 123/104512 (27) : parsing [/cfg/haproxy.cfg:123]: unknown keyword 'bindd' in 'frontend' section")
+}
+
+func (s *ReloadTestSuite) Test_Reload_TransfersListeningSockets_WhenReloadSocketExists() {
+	defer os.Unsetenv("RELOAD_SOCKET")
+	os.Setenv("RELOAD_SOCKET", "/var/run/haproxy.sock")
+	s.harness.WriteFile("/var/run/haproxy.sock", "")
+	expected := [][]string{{"-f", "/cfg/haproxy.cfg", "-D", "-p", "/var/run/haproxy.pid", "-x", "/var/run/haproxy.sock", "-sf", proxytest.Pid}}
+
+	s.harness.Proxy.Reload()
+
+	s.Equal(expected, s.harness.Reloads())
+}
+
+func (s *ReloadTestSuite) Test_Reload_DoesNotTransferListeningSockets_WhenReloadSocketDoesNotExist() {
+	defer os.Unsetenv("RELOAD_SOCKET")
+	os.Setenv("RELOAD_SOCKET", "/this/socket/does/not/exist.sock")
+
+	s.harness.Proxy.Reload()
+
+	s.Require().Len(s.harness.Reloads(), 1)
+	s.NotContains(s.harness.Reloads()[0], "-x")
+	s.Equal([]string{"-sf", proxytest.Pid}, s.harness.Reloads()[0][len(s.harness.Reloads()[0])-2:])
+}
+
+// CreateConfigFromTemplates
+
+func (s *ReloadTestSuite) Test_CreateConfigFromTemplates_ReturnsErrTemplateMissing_WhenTemplateDoesNotExist() {
+	s.harness.RemoveFile(proxytest.TemplatesPath + "/haproxy.tmpl")
+
+	err := s.harness.Proxy.CreateConfigFromTemplates()
+
+	s.True(errors.Is(err, proxy.ErrTemplateMissing))
+}
+
+func (s *ReloadTestSuite) Test_CreateConfigFromTemplates_AddsDebug() {
+	defer os.Unsetenv("DEBUG")
+	os.Setenv("DEBUG", "true")
+
+	s.Require().NoError(s.harness.Proxy.CreateConfigFromTemplates())
+
+	s.harness.AssertConfigContains("\n    debug\n")
+	s.NotContains(s.harness.RenderedConfig(), "option  dontlognull")
+}
+
+func (s *ReloadTestSuite) Test_CreateConfigFromTemplates_AddsLogging_WhenSyslogListenerAddressIsSet() {
+	defer os.Unsetenv("SYSLOG_LISTENER_ADDRESS")
+	os.Setenv("SYSLOG_LISTENER_ADDRESS", ":1514")
+
+	s.Require().NoError(s.harness.Proxy.CreateConfigFromTemplates())
+
+	s.harness.AssertConfigContains("\n    log 127.0.0.1:1514 local0\n")
+	s.harness.AssertConfigContains("    option  dontlognull\n    log     global\n    option  httplog\n")
+}
+
+func (s *ReloadTestSuite) Test_CreateConfigFromTemplates_AddsStatsSocketWithExposedListeners_WhenReloadSocketIsSet() {
+	defer os.Unsetenv("RELOAD_SOCKET")
+	os.Setenv("RELOAD_SOCKET", "/var/run/haproxy.sock")
+
+	s.Require().NoError(s.harness.Proxy.CreateConfigFromTemplates())
+
+	s.harness.AssertConfigContains("\n    stats socket /var/run/haproxy.sock level admin expose-fd listeners\n")
+}
+
+// AddService > CreateConfigFromTemplates > Reload
+
+func (s *ReloadTestSuite) Test_Reload_UsesConfigOfAddedService() {
+	s.harness.WriteTemplate("my-service-be.cfg", `
+backend my-service-be8080
+    mode http
+    server my-service my-service:8080`)
+	err := s.harness.Proxy.AddService(proxy.Service{
+		ServiceName: "my-service",
+		AclName:     "my-service",
+		PathType:    "path_beg",
+		ServiceDest: []proxy.ServiceDest{{Port: "8080", ServicePath: []string{"/api"}}},
+	})
+	s.Require().NoError(err)
+
+	s.Require().NoError(s.harness.Proxy.CreateConfigFromTemplates())
+	s.Require().NoError(s.harness.Proxy.Reload())
+
+	s.harness.AssertConfigContains("    use_backend my-service-be8080 if url_my-service8080")
+	s.harness.AssertBackendContains("my-service", "server my-service my-service:8080")
+	s.Len(s.harness.Reloads(), 1)
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The categories of the warnings printed by HAProxy while it starts
+const (
+	ReloadWarningSockets = "sockets"
+	ReloadWarningBind    = "bind"
+	ReloadWarningMap     = "map"
+)
+
+// The known messages HAProxy prints when a reload is degraded even though it succeeded.
+// New message formats are supported by adding their patterns.
+var reloadWarningPatterns = []struct {
+	category string
+	pattern  *regexp.Regexp
+}{
+	{ReloadWarningSockets, regexp.MustCompile(`(?i)failed to get the (number of )?sockets`)},
+	{ReloadWarningSockets, regexp.MustCompile(`(?i)failed to connect to the old process`)},
+	{ReloadWarningSockets, regexp.MustCompile(`(?i)unable to (get|retrieve) .*listening sockets`)},
+	{ReloadWarningBind, regexp.MustCompile(`(?i)cannot bind (socket|udp socket)`)},
+	{ReloadWarningBind, regexp.MustCompile(`(?i)address already in use`)},
+	{ReloadWarningMap, regexp.MustCompile(`(?i)(unable|failed) to load (the )?map`)},
+	{ReloadWarningMap, regexp.MustCompile(`(?i)map .*truncated|truncated .*map`)},
+}
+
+// The prefix of HAProxy messages (e.g. `[WARNING] 123/104512 (27) : `)
+var reloadMessagePrefixRegexp = regexp.MustCompile(`^\[(WARNING|ALERT|NOTICE)\]\s+(\(\d+\)|[\d/]+\s+\(\d+\))\s*:\s*`)
+
+// ParseReloadWarnings returns the warnings found in the output of HAProxy formatted as `<category>: <message>`.
+// Lines that do not match any of the known patterns are ignored.
+func ParseReloadWarnings(output string) []string {
+	warnings := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		for _, p := range reloadWarningPatterns {
+			if p.pattern.MatchString(line) {
+				message := reloadMessagePrefixRegexp.ReplaceAllString(line, "")
+				warnings = append(warnings, fmt.Sprintf("%s: %s", p.category, message))
+				break
+			}
+		}
+	}
+	return warnings
+}
+
+// GetReloadWarnings returns the warnings of the last reload
+func GetReloadWarnings() []string {
+	durations.Lock()
+	defer durations.Unlock()
+	return append([]string{}, durations.reloadWarnings...)
+}
+
+// Records the warnings of the last reload. They are logged since HAProxy still reports success.
+func recordReloadWarnings(warnings []string) {
+	durations.Lock()
+	defer durations.Unlock()
+	durations.reloadWarnings = warnings
+	for _, warning := range warnings {
+		logPrintf("WARNING: The reload of the proxy is degraded (%s)", warning)
+	}
+}
@@ -0,0 +1,100 @@
+// +build !integration
+
+package proxy
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ReloadWarningsTestSuite struct {
+	suite.Suite
+}
+
+func TestReloadWarningsUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(ReloadWarningsTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *ReloadWarningsTestSuite) TearDownTest() {
+	recordReloadWarnings(nil)
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return cmd.Run()
+	}
+}
+
+// ParseReloadWarnings
+
+func (s *ReloadWarningsTestSuite) Test_ParseReloadWarnings_ClassifiesKnownMessages() {
+	testData := []struct {
+		output   string
+		expected []string
+	}{
+		{
+			"[WARNING] 123/104512 (27) : Failed to connect to the old process socket '/var/run/haproxy.sock'\n" +
+				"[ALERT] 123/104512 (27) : Failed to get the sockets from the old process!",
+			[]string{
+				"sockets: Failed to connect to the old process socket '/var/run/haproxy.sock'",
+				"sockets: Failed to get the sockets from the old process!",
+			},
+		},
+		{
+			"[WARNING] 045/093012 (9) : Failed to get the number of sockets to be transferred !",
+			[]string{"sockets: Failed to get the number of sockets to be transferred !"},
+		},
+		{
+			"[ALERT] 123/104512 (27) : Starting frontend services: cannot bind socket [0.0.0.0:80]",
+			[]string{"bind: Starting frontend services: cannot bind socket [0.0.0.0:80]"},
+		},
+		{
+			"[ALERT]    (1) : Starting proxy stats: cannot bind socket (Address already in use) [0.0.0.0:8404]",
+			[]string{"bind: Starting proxy stats: cannot bind socket (Address already in use) [0.0.0.0:8404]"},
+		},
+		{
+			"[ALERT] 123/104512 (27) : parsing [/cfg/haproxy.cfg:41] : unable to load map '/cfg/domains.map'.",
+			[]string{"map: parsing [/cfg/haproxy.cfg:41] : unable to load map '/cfg/domains.map'."},
+		},
+		{
+			"[WARNING] 123/104512 (27) : map file '/cfg/domains.map' was truncated at line 2048",
+			[]string{"map: map file '/cfg/domains.map' was truncated at line 2048"},
+		},
+		{
+			"[WARNING] 123/104512 (27) : config : 'option forwardfor' ignored for proxy 'tcp-db' as it requires HTTP mode.\n\n",
+			[]string{},
+		},
+		{"", []string{}},
+	}
+	for _, data := range testData {
+		s.Equal(data.expected, ParseReloadWarnings(data.output), data.output)
+	}
+}
+
+// RunCmd
+
+func (s *ReloadWarningsTestSuite) Test_RunCmd_RecordsReloadWarnings() {
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		fmt.Fprintln(cmd.Stderr, "[WARNING] 123/104512 (27) : Failed to get the number of sockets to be transferred !")
+		return nil
+	}
+
+	s.NoError(HaProxy{}.RunCmd([]string{}))
+
+	expected := []string{"sockets: Failed to get the number of sockets to be transferred !"}
+	s.Equal(expected, GetReloadWarnings())
+	s.Equal(expected, HaProxy{}.DebugState().ReloadWarnings)
+}
+
+func (s *ReloadWarningsTestSuite) Test_RunCmd_ClearsReloadWarnings_WhenOutputHasNoWarnings() {
+	recordReloadWarnings([]string{"bind: cannot bind socket [0.0.0.0:80]"})
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return nil
+	}
+
+	s.NoError(HaProxy{}.RunCmd([]string{}))
+
+	s.Empty(GetReloadWarnings())
+}
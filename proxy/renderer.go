@@ -0,0 +1,527 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const defaultConfigFlavor = "haproxy-1.7"
+
+// ConfigRenderer generates the snippets of the proxy configuration.
+// Each implementation targets a version (flavor) of HAProxy selected through CONFIG_FLAVOR.
+type ConfigRenderer interface {
+	// RenderFrontend returns the rules the service adds to the services frontend (http)
+	// or the frontends of the service (tcp)
+	RenderFrontend(s Service) string
+	// RenderBackend returns the options rendered in the backends of the service before the server lines
+	RenderBackend(s Service) string
+	// RenderGlobal returns the additional lines of the global section
+	RenderGlobal(env map[string]string, certs map[string]bool) string
+	// RenderServers returns the server lines of the backends of the service for the protocol (http or https).
+	// They are executed inside the range of the destinations of the service.
+	RenderServers(s Service, mode, protocol string) string
+	// GetReplicaSlots returns the number of server slots rendered for the replicas of the service.
+	// It is zero if the servers of the service are not created from a template.
+	GetReplicaSlots(s Service) int
+}
+
+var configRenderers = map[string]ConfigRenderer{
+	"haproxy-1.7": haProxy17Renderer{},
+	"haproxy-2.x": haProxy2Renderer{},
+}
+
+// GetConfigRenderer returns the renderer of the flavor defined through CONFIG_FLAVOR.
+// The haproxy-1.7 flavor is used when the variable is not set or its value is unknown.
+// The proxy keeps the renderer it was created with, so the rest of the code uses Proxy.GetRenderer instead.
+func GetConfigRenderer() ConfigRenderer {
+	flavor := os.Getenv("CONFIG_FLAVOR")
+	if len(flavor) == 0 {
+		flavor = defaultConfigFlavor
+	}
+	renderer, ok := configRenderers[strings.ToLower(flavor)]
+	if !ok {
+		logPrintf("The config flavor %s is not supported. %s is used instead.", flavor, defaultConfigFlavor)
+		return configRenderers[defaultConfigFlavor]
+	}
+	return renderer
+}
+
+func getEnvMap() map[string]string {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if parts := strings.SplitN(kv, "=", 2); len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+	return env
+}
+
+// HAProxy 1.7
+
+type haProxy17Renderer struct{}
+
+func (r haProxy17Renderer) RenderFrontend(s Service) string {
+	m := &HaProxy{}
+	if len(s.ReqMode) == 0 || strings.EqualFold(s.ReqMode, "http") {
+		return m.getFrontTemplate(s)
+	}
+	return m.getFrontTemplateTcp(s)
+}
+
+// The options of the backends that differ between the flavors
+type backendParts struct {
+	SessionCookie string
+	Retries       string
+	MaxBodySize   string
+	PathRewrites  string
+}
+
+func (r haProxy17Renderer) RenderBackend(s Service) string {
+	parts := backendParts{SessionCookie: r.getSessionCookie(s)}
+	if s.MaxBodySize > 0 {
+		parts.MaxBodySize = fmt.Sprintf(`
+    http-request deny deny_status 413 if { req.hdr_val(content-length) gt %d }`, s.MaxBodySize)
+	}
+	// TODO: Deprecated (dec. 2016).
+	if len(s.ReqRepSearch) > 0 && len(s.ReqRepReplace) > 0 {
+		parts.PathRewrites += fmt.Sprintf(`
+    reqrep %s     %s`, QuoteValue(s.ReqRepSearch), QuoteValue(s.ReqRepReplace))
+	}
+	for i := 0; i < len(s.ReqPathSearch) && i < len(s.ReqPathReplace); i++ {
+		parts.PathRewrites += fmt.Sprintf(`
+    http-request set-path %%[path,regsub(%s,%s)]`, s.ReqPathSearch[i], s.ReqPathReplace[i])
+	}
+	return r.renderBackend(s, parts)
+}
+
+// Renders the options of the backends shared by all the flavors around the parts that are specific to a flavor
+func (r haProxy17Renderer) renderBackend(s Service, parts backendParts) string {
+	options := r.getBalance(s) + r.getDefaultServer(s) + parts.SessionCookie + r.getHealthCheck(s) + r.getTimeouts(s) + r.getReqRateTable(s) + r.getCompressionExclusions(s) + parts.Retries
+	if s.BufferRequest {
+		options += `
+    option http-buffer-request`
+	}
+	options += parts.MaxBodySize + parts.PathRewrites
+	return options + r.getLocationRewrites(s) + r.getResponseCodeRewrites(s) + r.getRequestDeadline(s) + getErrorFiles(s)
+}
+
+// HAProxy 1.7 does not support server templates so the service is reached through its VIP (swarm)
+// or the servers registered in Consul, regardless of the number of replicas.
+func (r haProxy17Renderer) RenderServers(s Service, mode, protocol string) string {
+	if isSwarmMode(mode) {
+		return r.renderServers(s, r.getVipServer(s, protocol))
+	}
+	return r.renderServers(s, r.getConsulServers(s))
+}
+
+func (r haProxy17Renderer) GetReplicaSlots(s Service) int {
+	return 0
+}
+
+// Sockets are named after their paths so that the servers of different sockets can be told apart.
+// They are checked only on request since a socket cannot be port-checked.
+func (r haProxy17Renderer) renderServers(s Service, servers string) string {
+	socketCheck := ""
+	if s.CheckSocket {
+		socketCheck = GetHealthCheckServerOptions(s)
+		if len(socketCheck) == 0 {
+			socketCheck = " check"
+		}
+	}
+	socketCookie := ""
+	if isStickyService(s) {
+		socketCookie = " cookie {{$.Identifier}}_{{.SocketHash}}"
+	}
+	return `{{if .IsUnixSocket}}
+    server {{$.Identifier}}_{{.SocketHash}} {{.Port}}` + socketCheck + socketCookie + `{{else}}` + servers + `{{end}}`
+}
+
+func (r haProxy17Renderer) getVipServer(s Service, protocol string) string {
+	healthCheck := GetHealthCheckServerOptions(s)
+	cookie := ""
+	if isStickyService(s) {
+		cookie = " cookie {{$.Identifier}}"
+	}
+	// Destinations can send the requests to a host other than the one of the service
+	host := "{{if .OutboundHostname}}{{.OutboundHostname}}{{else}}{{$.Host}}{{end}}"
+	// The address is resolved again when the VIP of the service changes
+	if s.Resolvers {
+		healthCheck += " resolvers docker resolve-prefer ipv4"
+	}
+	if strings.EqualFold(protocol, "https") {
+		return `
+    server {{$.Identifier}} ` + host + `:{{$.HttpsPort}}` + healthCheck + cookie + serverSource
+	}
+	// Without a port, HAProxy forwards to the port the client connected to
+	return `
+    server {{$.Identifier}} ` + host + `{{if not .SrcPortRange}}:{{.Port}}{{end}}` + healthCheck + cookie + serverSource
+}
+
+func (r haProxy17Renderer) getConsulServers(s Service) string {
+	cookie := ""
+	if isStickyService(s) {
+		cookie = ` cookie {{"{{$e.Node}}_{{$i}}_{{$e.Port}}"}}`
+	}
+	// Consul servers are checked unless skipCheck is set
+	healthCheck := GetHealthCheckServerOptions(s)
+	if len(healthCheck) == 0 {
+		healthCheck = "{{if eq $.SkipCheck false}} check{{end}}"
+	}
+	return `
+    {{"{{"}}range $i, $e := service "{{$.FullServiceName}}" "any"{{"}}"}}
+    server {{"{{$e.Node}}_{{$i}}_{{$e.Port}} {{$e.Address}}:{{$e.Port}}"}}` + healthCheck + cookie + serverSource + `
+    {{"{{end}}"}}`
+}
+
+// The options of the server lines that set the deployment grace period and the source address of the connections
+const serverSource = `{{.DeploymentGraceServer}}{{if $.SourceAddress}} source {{$.SourceAddress}}{{if $.TransparentProxy}} usesrc clientip{{end}}` +
+	`{{else if $.TransparentProxy}} source 0.0.0.0 usesrc clientip{{end}}`
+
+// The server names are used as the values of the session cookie
+func isStickyService(s Service) bool {
+	return len(s.SessionCookie) > 0 && (len(s.ReqMode) == 0 || strings.EqualFold(s.ReqMode, "http"))
+}
+
+func isSwarmMode(mode string) bool {
+	return strings.EqualFold(mode, "service") || strings.EqualFold(mode, "swarm")
+}
+
+func (r haProxy17Renderer) RenderGlobal(env map[string]string, certs map[string]bool) string {
+	global := ""
+	if strings.EqualFold(env["DEBUG"], "true") {
+		global += `
+    debug`
+	}
+	if address := env["SYSLOG_LISTENER_ADDRESS"]; len(address) > 0 {
+		if strings.HasPrefix(address, ":") || strings.HasPrefix(address, "0.0.0.0:") {
+			address = "127.0.0.1:" + address[strings.LastIndex(address, ":")+1:]
+		}
+		global += fmt.Sprintf(`
+    log %s local0`, address)
+	}
+	if socket := env["RELOAD_SOCKET"]; len(socket) > 0 {
+		global += fmt.Sprintf(`
+    stats socket %s level admin expose-fd listeners`, socket)
+	}
+	return global
+}
+
+// The options are applied to all the servers of the service.
+// If not specified, DEFAULT_SERVER_OPTIONS are used instead.
+func (r haProxy17Renderer) getDefaultServer(s Service) string {
+	options := s.DefaultServerOptions
+	if len(options) == 0 {
+		options = os.Getenv("DEFAULT_SERVER_OPTIONS")
+	}
+	if len(options) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(`
+    default-server %s`, options)
+}
+
+func (r haProxy17Renderer) getBalance(s Service) string {
+	if len(strings.TrimSpace(s.BalanceMode)) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(`
+    balance %s`, strings.TrimSpace(s.BalanceMode))
+}
+
+// The deadline is enforced through the server timeout and sent to the servers as the Unix timestamp
+// (in seconds) at which the proxy stops waiting. Timeouts are answered with the 504 error file.
+// Disables the compression of the responses to the excluded paths, of all the responses of websocket services,
+// and of the responses smaller than the minimum size. Since HAProxy does not compress the responses to requests
+// without the Accept-Encoding header or with the Cache-Control no-transform header, the rules work regardless
+// of where the compression is enabled.
+func (r haProxy17Renderer) getCompressionExclusions(s Service) string {
+	if len(s.ReqMode) > 0 && !strings.EqualFold(s.ReqMode, "http") {
+		return ""
+	}
+	rules := ""
+	if s.Websocket {
+		rules += `
+    http-request del-header Accept-Encoding`
+	} else if len(s.CompressionExcludePaths) > 0 {
+		rules += fmt.Sprintf(`
+    acl compression_excluded path_beg %s
+    http-request del-header Accept-Encoding if compression_excluded`, strings.Join(s.CompressionExcludePaths, " "))
+	}
+	if size, err := parseSize(s.CompressionMinSize); err == nil && size > 0 {
+		rules += fmt.Sprintf(`
+    http-response add-header Cache-Control no-transform if { res.hdr_val(content-length) lt %d }`, size)
+	}
+	return rules
+}
+
+// Declares the table tracking the request rates of the clients of the service.
+// The rates are tracked and limited by the frontend rules of the service.
+func (r haProxy17Renderer) getReqRateTable(s Service) string {
+	if s.ReqRateLimit <= 0 {
+		return ""
+	}
+	window := getReqRateWindow(s)
+	return fmt.Sprintf(`
+    stick-table type ip size 100k expire %ds store http_req_rate(%ds)`, window, window)
+}
+
+func (r haProxy17Renderer) getRequestDeadline(s Service) string {
+	deadline, err := parseDuration(s.RequestDeadline)
+	if err != nil || deadline < time.Second {
+		return ""
+	}
+	options := fmt.Sprintf(`
+    timeout server %dms`, deadline/time.Millisecond)
+	if len(s.ReqMode) > 0 && !strings.EqualFold(s.ReqMode, "http") {
+		return options
+	}
+	options += fmt.Sprintf(`
+    http-request set-header X-Request-Deadline %%[date(%d)]`, deadline/time.Second)
+	if !strings.EqualFold(s.ErrorResponseFormat, "json") {
+		options += fmt.Sprintf(`
+    errorfile 504 %s/504.http`, errorFilesPath)
+	}
+	return options
+}
+
+// The cookie is inserted into responses and used for routing only, so it is not forwarded to the servers (indirect)
+// nor cached by intermediaries (nocache). The values are set on the server lines.
+func (r haProxy17Renderer) getSessionCookie(s Service) string {
+	if !isStickyService(s) {
+		return ""
+	}
+	return fmt.Sprintf(`
+    cookie %s insert indirect nocache`, s.SessionCookie)
+}
+
+// Reverses the path rewrites in the Location headers of the responses, in the opposite order of the rewrites.
+// Only rewrites of literal path prefixes (e.g. ^/api/svc/ replaced with /) can be reversed. Others are skipped.
+// Absolute paths are rewritten, and so are absolute URLs if they point to one of the domains of the service.
+func (r haProxy17Renderer) getLocationRewrites(s Service) string {
+	if s.RewriteResponseLocation != nil && !*s.RewriteResponseLocation {
+		return ""
+	}
+	if len(s.ReqMode) > 0 && !strings.EqualFold(s.ReqMode, "http") {
+		return ""
+	}
+	hosts := r.getLocationHosts(s)
+	rewrites := ""
+	for i := len(s.ReqPathSearch) - 1; i >= 0; i-- {
+		if i >= len(s.ReqPathReplace) {
+			continue
+		}
+		prefix, ok := getLiteralPrefix(s.ReqPathSearch[i])
+		replace := s.ReqPathReplace[i]
+		if !ok || !strings.HasPrefix(prefix, "/") || !strings.HasPrefix(replace, "/") || strings.ContainsAny(replace, `\$`) {
+			logPrintf(
+				"The Location headers of the service %s are not rewritten for %s since only literal prefixes can be reversed",
+				s.ServiceName,
+				s.ReqPathSearch[i],
+			)
+			continue
+		}
+		prefix = strings.Replace(prefix, "%", "%%", -1)
+		if len(hosts) == 0 {
+			rewrites += fmt.Sprintf(`
+    http-response replace-header Location %s %s`, QuoteValue("^"+regexp.QuoteMeta(replace)+"(.*)"), QuoteValue(prefix+`\1`))
+		} else {
+			rewrites += fmt.Sprintf(
+				`
+    http-response replace-header Location %s %s`,
+				QuoteValue("^((?:https?://(?:"+strings.Join(hosts, "|")+")(?::[0-9]+)?)?)"+regexp.QuoteMeta(replace)+"(.*)"),
+				QuoteValue(`\1`+prefix+`\2`),
+			)
+		}
+	}
+	return rewrites
+}
+
+// Replaces the status codes of the responses of the servers listed in the responseCodeMap of the service
+func (r haProxy17Renderer) getResponseCodeRewrites(s Service) string {
+	if len(s.ReqMode) > 0 && !strings.EqualFold(s.ReqMode, "http") {
+		return ""
+	}
+	rewrites := ""
+	for _, from := range getSortedResponseCodes(s.ResponseCodeMap) {
+		rewrites += fmt.Sprintf(`
+    http-response set-status %d if { status %d }`, s.ResponseCodeMap[from], from)
+	}
+	return rewrites
+}
+
+// Returns the patterns of the hosts of the absolute URLs in the Location headers that are rewritten
+func (r haProxy17Renderer) getLocationHosts(s Service) []string {
+	domains := append([]string{}, s.ServiceDomain...)
+	if s.RedirectToWww {
+		domains = append(domains, (&HaProxy{}).getWwwDomains(s)...)
+	}
+	hosts := []string{}
+	for _, domain := range domains {
+		if strings.HasPrefix(domain, "*") {
+			hosts = append(hosts, "[^/]*"+regexp.QuoteMeta(strings.TrimLeft(domain, "*")))
+		} else {
+			hosts = append(hosts, regexp.QuoteMeta(domain))
+		}
+	}
+	return hosts
+}
+
+// Returns the prefix matched by the search expression if the expression matches only that prefix
+func getLiteralPrefix(search string) (string, bool) {
+	re, err := regexp.Compile(strings.TrimPrefix(search, "^"))
+	if err != nil {
+		return "", false
+	}
+	prefix, complete := re.LiteralPrefix()
+	return prefix, complete && len(prefix) > 0
+}
+
+// The servers are checked with HTTP requests only when the check path is set.
+// The check parameters are set on the server lines (see GetHealthCheckServerOptions).
+func (r haProxy17Renderer) getHealthCheck(s Service) string {
+	if len(s.CheckPath) == 0 {
+		return ""
+	}
+	method := strings.ToUpper(s.CheckMethod)
+	if len(method) == 0 {
+		method = "GET"
+	}
+	return fmt.Sprintf(`
+    option httpchk %s %s`, method, s.CheckPath)
+}
+
+// GetHealthCheckServerOptions returns the options of the server lines that enable the HTTP health check of the service.
+// They are empty if the check path is not set.
+func GetHealthCheckServerOptions(s Service) string {
+	if len(s.CheckPath) == 0 {
+		return ""
+	}
+	options := " check"
+	if interval, err := parseDuration(s.CheckInterval); err == nil && interval > 0 {
+		options += " inter " + formatDuration(interval)
+	}
+	return options + " rise 2 fall 3"
+}
+
+// Formats the duration in the units accepted by HAProxy, in seconds when possible
+func formatDuration(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
+
+// The timeouts of the service override those of the defaults section in its backend only
+func (r haProxy17Renderer) getTimeouts(s Service) string {
+	options := ""
+	if timeout, err := parseDuration(s.TimeoutServer); err == nil && timeout > 0 {
+		options += fmt.Sprintf(`
+    timeout server %s`, formatDuration(timeout))
+	}
+	tunnel := s.TimeoutTunnel
+	if len(tunnel) == 0 && s.Websocket {
+		tunnel = getTimeoutTunnel()
+	}
+	if timeout, err := parseDuration(tunnel); err == nil && timeout > 0 {
+		options += fmt.Sprintf(`
+    timeout tunnel %s`, formatDuration(timeout))
+	}
+	if s.Websocket {
+		// HAProxy switches to the tunnel mode when the server accepts the upgrade (101) unless the connections are closed after each request
+		options += `
+    no option httpclose`
+	}
+	return options
+}
+
+// HAProxy 2.x
+
+// Replaces deny rules with http-request return, retries failed requests with retry-on,
+// rewrites paths with http-request replace-path, and creates the servers of the replicas from a template.
+// reqrep was removed in HAProxy 2.1 and is not rendered.
+type haProxy2Renderer struct {
+	haProxy17Renderer
+}
+
+func (r haProxy2Renderer) RenderFrontend(s Service) string {
+	return strings.Replace(
+		r.haProxy17Renderer.RenderFrontend(s),
+		"http-request deny deny_status 405 if",
+		"http-request return status 405 default-errorfiles if",
+		-1,
+	)
+}
+
+func (r haProxy2Renderer) RenderBackend(s Service) string {
+	parts := backendParts{SessionCookie: r.getSessionCookie(s)}
+	if len(s.ReqMode) == 0 || strings.EqualFold(s.ReqMode, "http") {
+		parts.Retries = `
+    retry-on all-retryable-errors`
+	}
+	if s.MaxBodySize > 0 {
+		parts.MaxBodySize = fmt.Sprintf(`
+    http-request return status 413 default-errorfiles if { req.hdr_val(content-length) gt %d }`, s.MaxBodySize)
+	}
+	if len(s.ReqRepSearch) > 0 && len(s.ReqRepReplace) > 0 {
+		logPrintf("The service %s uses reqRepSearch and reqRepReplace, which are not supported by HAProxy 2.x. Please use reqPathSearch and reqPathReplace instead.", s.ServiceName)
+	}
+	for i := 0; i < len(s.ReqPathSearch) && i < len(s.ReqPathReplace); i++ {
+		parts.PathRewrites += fmt.Sprintf(`
+    http-request replace-path %s %s`, QuoteValue(s.ReqPathSearch[i]), QuoteValue(s.ReqPathReplace[i]))
+	}
+	return r.renderBackend(s, parts)
+}
+
+// Servers created from a template have no values of their own so the values of the cookie are generated from their addresses
+func (r haProxy2Renderer) getSessionCookie(s Service) string {
+	if !isStickyService(s) || s.Replicas == 0 {
+		return r.haProxy17Renderer.getSessionCookie(s)
+	}
+	return fmt.Sprintf(`
+    cookie %s insert indirect nocache dynamic
+    dynamic-cookie-key %s`, s.SessionCookie, getIdentifier(s))
+}
+
+// Each task of a swarm service with replicas gets its own server so that it is balanced and checked individually.
+// The addresses are resolved at runtime since tasks come and go.
+func (r haProxy2Renderer) RenderServers(s Service, mode, protocol string) string {
+	if !isSwarmMode(mode) || s.Replicas == 0 {
+		return r.haProxy17Renderer.RenderServers(s, mode, protocol)
+	}
+	healthCheck := GetHealthCheckServerOptions(s)
+	if len(healthCheck) == 0 {
+		healthCheck = " check"
+	}
+	healthCheck += " resolvers docker init-addr none"
+	address := "tasks.{{$.Host}}{{if not .SrcPortRange}}:{{.Port}}{{end}}"
+	if strings.EqualFold(protocol, "https") {
+		address = "tasks.{{$.Host}}:{{$.HttpsPort}}"
+	}
+	servers := `
+    server-template {{$.Identifier}} {{$.Replicas}} ` + address + healthCheck + serverSource
+	// The slots above the replicas are enabled through the runtime socket when the service scales up
+	if slots := r.GetReplicaSlots(s); slots > s.Replicas {
+		servers += fmt.Sprintf(`
+    server-template {{$.Identifier}} %d-%d `, s.Replicas+1, slots) + address + healthCheck + serverSource + " disabled"
+	}
+	return r.renderServers(s, servers)
+}
+
+func (r haProxy2Renderer) GetReplicaSlots(s Service) int {
+	if s.Replicas == 0 {
+		return 0
+	}
+	return s.Replicas + GetReplicaHeadroom()
+}
+
+func (r haProxy2Renderer) RenderGlobal(env map[string]string, certs map[string]bool) string {
+	global := r.haProxy17Renderer.RenderGlobal(env, certs)
+	if len(certs) > 0 {
+		global += `
+    ssl-default-bind-options ssl-min-ver TLSv1.2`
+	}
+	return global
+}
@@ -0,0 +1,459 @@
+// +build !integration
+
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RendererTestSuite struct {
+	suite.Suite
+}
+
+func TestRendererUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(RendererTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *RendererTestSuite) TearDownTest() {
+	os.Unsetenv("CONFIG_FLAVOR")
+}
+
+// GetConfigRenderer
+
+func (s *RendererTestSuite) Test_GetConfigRenderer_ReturnsHaProxy17_WhenFlavorIsNotSet() {
+	s.Equal(haProxy17Renderer{}, GetConfigRenderer())
+}
+
+func (s *RendererTestSuite) Test_GetConfigRenderer_ReturnsHaProxy2_WhenFlavorIsHaProxy2() {
+	os.Setenv("CONFIG_FLAVOR", "haproxy-2.x")
+
+	s.Equal(haProxy2Renderer{}, GetConfigRenderer())
+}
+
+func (s *RendererTestSuite) Test_GetConfigRenderer_ReturnsHaProxy17_WhenFlavorIsUnknown() {
+	os.Setenv("CONFIG_FLAVOR", "nginx")
+
+	s.Equal(haProxy17Renderer{}, GetConfigRenderer())
+}
+
+// NewHaProxy
+
+func (s *RendererTestSuite) Test_NewHaProxy_UsesRendererOfTheFlavor() {
+	os.Setenv("CONFIG_FLAVOR", "haproxy-2.x")
+
+	p := NewHaProxy("templates", "configs", map[string]bool{}).(HaProxy)
+
+	s.Equal(haProxy2Renderer{}, p.Renderer)
+}
+
+// Location rewrites
+
+func (s *RendererTestSuite) Test_RenderBackend_RewritesLocationPaths_WhenPathIsRewritten() {
+	sr := Service{
+		ServiceName:    "my-service",
+		ReqPathSearch:  []string{"^/api/svc/"},
+		ReqPathReplace: []string{"/"},
+	}
+	expected := `
+    http-response replace-header Location "^/(.*)" "/api/svc/\\1"`
+
+	for flavor, renderer := range configRenderers {
+		actual := renderer.RenderBackend(sr)
+
+		s.Contains(actual, expected, flavor)
+		s.Equal("/api/svc/login?next=%2F", s.applyLocationRewrites(actual, "/login?next=%2F"), flavor)
+	}
+}
+
+func (s *RendererTestSuite) Test_RenderBackend_RewritesLocationUrls_WhenUrlIsOnServiceDomain() {
+	sr := Service{
+		ServiceName:    "my-service",
+		ServiceDomain:  []string{"example.com", "*.acme.com"},
+		ReqPathSearch:  []string{`^/api/svc\.v1/`},
+		ReqPathReplace: []string{"/"},
+	}
+
+	actual := configRenderers["haproxy-2.x"].RenderBackend(sr)
+
+	s.Equal("https://example.com/api/svc.v1/login", s.applyLocationRewrites(actual, "https://example.com/login"))
+	s.Equal("http://www.acme.com:8080/api/svc.v1/login", s.applyLocationRewrites(actual, "http://www.acme.com:8080/login"))
+	s.Equal("/api/svc.v1/login", s.applyLocationRewrites(actual, "/login"))
+	s.Equal("https://other.com/login", s.applyLocationRewrites(actual, "https://other.com/login"))
+	s.Equal("https://exampleXcom/login", s.applyLocationRewrites(actual, "https://exampleXcom/login"))
+}
+
+func (s *RendererTestSuite) Test_RenderBackend_ReversesRewritesInOppositeOrder() {
+	sr := Service{
+		ServiceName:    "my-service",
+		ReqPathSearch:  []string{"^/api/v1/", "^/api/"},
+		ReqPathReplace: []string{"/v1/", "/"},
+	}
+
+	actual := configRenderers["haproxy-1.7"].RenderBackend(sr)
+
+	s.Equal("/api/v1/login", s.applyLocationRewrites(actual, "/v1/login"))
+	s.Equal("/api/login", s.applyLocationRewrites(actual, "/login"))
+}
+
+func (s *RendererTestSuite) Test_RenderBackend_DoesNotRewriteLocation_WhenRewriteResponseLocationIsFalse() {
+	rewrite := false
+	sr := Service{
+		ServiceName:             "my-service",
+		ReqPathSearch:           []string{"^/api/svc/"},
+		ReqPathReplace:          []string{"/"},
+		RewriteResponseLocation: &rewrite,
+	}
+
+	for flavor, renderer := range configRenderers {
+		s.NotContains(renderer.RenderBackend(sr), "Location", flavor)
+	}
+}
+
+func (s *RendererTestSuite) Test_RenderBackend_DoesNotRewriteLocation_WhenSearchIsNotLiteralPrefix() {
+	sr := Service{
+		ServiceName:    "my-service",
+		ReqPathSearch:  []string{"^/api/v[0-9]+/"},
+		ReqPathReplace: []string{"/"},
+	}
+
+	s.NotContains(configRenderers["haproxy-2.x"].RenderBackend(sr), "Location")
+}
+
+// Timeouts
+
+func (s *RendererTestSuite) Test_RenderBackend_AddsTimeoutsOnlyToOverridingService() {
+	slow := Service{ServiceName: "reports", TimeoutServer: "600", TimeoutTunnel: "1500ms"}
+	other := Service{ServiceName: "other"}
+
+	for _, renderer := range []ConfigRenderer{haProxy17Renderer{}, haProxy2Renderer{}} {
+		actual := renderer.RenderBackend(slow)
+
+		s.Contains(actual, "\n    timeout server 600s")
+		s.Contains(actual, "\n    timeout tunnel 1500ms")
+		s.NotContains(renderer.RenderBackend(other), "timeout")
+	}
+}
+
+func (s *RendererTestSuite) Test_RenderBackend_AddsTunnelTimeout_WhenWebsocketIsTrue() {
+	defer os.Unsetenv("TIMEOUT_TUNNEL")
+	os.Setenv("TIMEOUT_TUNNEL", "7200")
+	testData := []struct {
+		service  Service
+		expected string
+	}{
+		{Service{ServiceName: "chat", Websocket: true}, "\n    timeout tunnel 7200s\n    no option httpclose"},
+		{Service{ServiceName: "chat", Websocket: true, TimeoutTunnel: "30m"}, "\n    timeout tunnel 1800s\n    no option httpclose"},
+	}
+	for _, data := range testData {
+		for _, renderer := range []ConfigRenderer{haProxy17Renderer{}, haProxy2Renderer{}} {
+			s.Contains(renderer.RenderBackend(data.service), data.expected)
+		}
+	}
+	s.NotContains(haProxy17Renderer{}.RenderBackend(Service{ServiceName: "other"}), "tunnel")
+}
+
+func (s *RendererTestSuite) Test_ValidateService_ReturnsError_WhenUseGlobalUsersIsTrueAndUsersEnvIsNotSet() {
+	defer os.Unsetenv("USERS")
+	os.Unsetenv("USERS")
+
+	err := ValidateService(Service{UseGlobalUsers: true})
+
+	s.Require().Error(err)
+	s.Equal([]string{"useGlobalUsers"}, err.(*ErrValidation).Fields)
+
+	os.Setenv("USERS", "user-1:pass-1")
+
+	s.NoError(ValidateService(Service{UseGlobalUsers: true}))
+}
+
+func (s *RendererTestSuite) Test_ValidateService_ReturnsError_WhenWebsocketIsUsedWithTcp() {
+	err := ValidateService(Service{ReqMode: "tcp", Websocket: true})
+
+	s.Require().Error(err)
+	s.Equal([]string{"websocket", "reqMode"}, err.(*ErrValidation).Fields)
+}
+
+func (s *RendererTestSuite) Test_RenderFrontend_AddsClientTimeoutToTcpFrontend() {
+	sr := Service{
+		ServiceName:   "my-db",
+		ReqMode:       "tcp",
+		TimeoutClient: "1h",
+		ServiceDest:   []ServiceDest{{Port: "5432", SrcPort: 5432}},
+	}
+
+	actual := haProxy17Renderer{}.RenderFrontend(sr)
+
+	s.Contains(actual, "\n    mode tcp\n    timeout client 3600s\n")
+}
+
+func (s *RendererTestSuite) Test_ValidateService_ReturnsError_WhenTimeoutIsNotPositive() {
+	for _, sr := range []Service{
+		{ReqMode: "tcp", TimeoutClient: "0"},
+		{TimeoutServer: "abc"},
+		{TimeoutTunnel: "-5s"},
+	} {
+		err := ValidateService(sr)
+
+		s.Require().Error(err)
+		s.IsType(&ErrValidation{}, err)
+	}
+}
+
+func (s *RendererTestSuite) Test_ValidateService_ReturnsError_WhenTimeoutClientIsUsedWithHttp() {
+	err := ValidateService(Service{TimeoutClient: "60"})
+
+	s.Require().Error(err)
+	s.Equal([]string{"timeoutClient", "reqMode"}, err.(*ErrValidation).Fields)
+	s.NoError(ValidateService(Service{ReqMode: "tcp", TimeoutClient: "60"}))
+}
+
+func (s *RendererTestSuite) Test_ValidateService_ReturnsError_WhenTimeoutServerIsUsedWithRequestDeadline() {
+	err := ValidateService(Service{TimeoutServer: "60", RequestDeadline: "30"})
+
+	s.Require().Error(err)
+	s.Equal([]string{"timeoutServer", "requestDeadline"}, err.(*ErrValidation).Fields)
+}
+
+func (s *RendererTestSuite) Test_RenderBackend_AddsStickTable_WhenReqRateLimitIsSet() {
+	login := Service{ServiceName: "login", ReqRateLimit: 5, ReqRateWindow: 60}
+	defaultWindow := Service{ServiceName: "login", ReqRateLimit: 5}
+
+	for _, renderer := range []ConfigRenderer{haProxy17Renderer{}, haProxy2Renderer{}} {
+		s.Contains(renderer.RenderBackend(login), "\n    stick-table type ip size 100k expire 60s store http_req_rate(60s)")
+		s.Contains(renderer.RenderBackend(defaultWindow), "\n    stick-table type ip size 100k expire 10s store http_req_rate(10s)")
+		s.NotContains(renderer.RenderBackend(Service{ServiceName: "other"}), "stick-table")
+	}
+}
+
+func (s *RendererTestSuite) Test_RenderFrontend_AddsReqRateLimitRules_WhenReqRateLimitIsSet() {
+	login := Service{
+		ServiceName:   "login",
+		AclName:       "login",
+		ServiceDomain: []string{"example.com"},
+		ReqRateLimit:  5,
+		ReqRateWindow: 60,
+		ServiceDest:   []ServiceDest{{Port: "8080", ServicePath: []string{"/login"}}},
+	}
+	other := Service{ServiceName: "other", AclName: "other", ServiceDest: []ServiceDest{{Port: "8080", ServicePath: []string{"/"}}}}
+
+	for _, renderer := range []ConfigRenderer{haProxy17Renderer{}, haProxy2Renderer{}} {
+		s.Contains(renderer.RenderFrontend(login), `
+    use_backend login-be8080 if url_login8080 domain_login
+    http-request track-sc0 src table login-be8080 if url_login8080 domain_login
+    http-request deny deny_status 429 if url_login8080 domain_login { sc_http_req_rate(0) gt 5 }`)
+		s.NotContains(renderer.RenderFrontend(other), "sc_http_req_rate")
+		s.NotContains(renderer.RenderFrontend(other), "track-sc0")
+	}
+}
+
+func (s *RendererTestSuite) Test_ValidateService_ReturnsError_WhenReqRateLimitIsInvalid() {
+	testData := []struct {
+		service Service
+		fields  []string
+	}{
+		{Service{ReqMode: "tcp", ReqRateLimit: 5}, []string{"reqRateLimit", "reqMode"}},
+		{Service{ReqRateWindow: 60}, []string{"reqRateWindow", "reqRateLimit"}},
+	}
+	for _, data := range testData {
+		err := ValidateService(data.service)
+
+		s.Require().Error(err)
+		s.Equal(data.fields, err.(*ErrValidation).Fields)
+	}
+	s.NoError(ValidateService(Service{ReqRateLimit: 5, ReqRateWindow: 60}))
+}
+
+func (s *RendererTestSuite) Test_RenderBackend_DisablesCompression_WhenPathIsExcluded() {
+	sr := Service{ServiceName: "feed", CompressionExcludePaths: []string{"/events", "/stream"}}
+
+	for _, renderer := range []ConfigRenderer{haProxy17Renderer{}, haProxy2Renderer{}} {
+		s.Contains(renderer.RenderBackend(sr), `
+    acl compression_excluded path_beg /events /stream
+    http-request del-header Accept-Encoding if compression_excluded`)
+		s.NotContains(renderer.RenderBackend(Service{ServiceName: "other"}), "Accept-Encoding")
+	}
+}
+
+func (s *RendererTestSuite) Test_RenderBackend_DisablesCompressionOfAllPaths_WhenWebsocketIsTrue() {
+	sr := Service{ServiceName: "chat", Websocket: true, CompressionExcludePaths: []string{"/events"}}
+
+	actual := haProxy17Renderer{}.RenderBackend(sr)
+
+	s.True(strings.HasSuffix(actual, "\n    http-request del-header Accept-Encoding"), actual)
+	s.NotContains(actual, "compression_excluded")
+}
+
+func (s *RendererTestSuite) Test_RenderBackend_DisablesCompressionOfSmallResponses_WhenCompressionMinSizeIsSet() {
+	testData := []struct {
+		minSize  string
+		expected int
+	}{
+		{"512", 512},
+		{"1k", 1024},
+		{"2M", 2097152},
+	}
+	for _, data := range testData {
+		actual := haProxy17Renderer{}.RenderBackend(Service{ServiceName: "api", CompressionMinSize: data.minSize})
+
+		s.Contains(actual, fmt.Sprintf("\n    http-response add-header Cache-Control no-transform if { res.hdr_val(content-length) lt %d }", data.expected))
+	}
+}
+
+func (s *RendererTestSuite) Test_ValidateService_ReturnsError_WhenCompressionExclusionsAreInvalid() {
+	for _, sr := range []Service{
+		{CompressionExcludePaths: []string{"events"}},
+		{CompressionMinSize: "small"},
+		{ReqMode: "tcp", CompressionMinSize: "1k"},
+	} {
+		err := ValidateService(sr)
+
+		s.Require().Error(err)
+		s.IsType(&ErrValidation{}, err)
+	}
+}
+
+func (s *RendererTestSuite) Test_RenderBackend_ReplacesStatusCodes_WhenResponseCodeMapIsSet() {
+	sr := Service{ServiceName: "legacy", ResponseCodeMap: map[int]int{599: 502, 404: 410}}
+	expected := `
+    http-response set-status 410 if { status 404 }
+    http-response set-status 502 if { status 599 }`
+
+	for _, renderer := range []ConfigRenderer{haProxy17Renderer{}, haProxy2Renderer{}} {
+		s.Contains(renderer.RenderBackend(sr), expected)
+	}
+}
+
+func (s *RendererTestSuite) Test_ValidateService_ReturnsError_WhenResponseCodeMapIsInvalid() {
+	for _, sr := range []Service{
+		{ResponseCodeMap: map[int]int{99: 200}},
+		{ResponseCodeMap: map[int]int{599: 600}},
+		{ResponseCodeMap: map[int]int{599: 502, 502: 503}},
+		{ResponseCodeMap: map[int]int{404: 404}},
+		{ReqMode: "tcp", ResponseCodeMap: map[int]int{599: 502}},
+	} {
+		err := ValidateService(sr)
+
+		s.Require().Error(err)
+		s.Contains(err.(*ErrValidation).Fields, "responseCodeMap")
+	}
+	s.NoError(ValidateService(Service{ResponseCodeMap: map[int]int{599: 502, 404: 502}}))
+}
+
+// Servers
+
+func (s *RendererTestSuite) Test_RenderServers_RendersVipServer_WhenFlavorIsHaProxy17() {
+	sr := Service{ServiceName: "my-service", Replicas: 3}
+
+	actual := haProxy17Renderer{}.RenderServers(sr, "swarm", "http")
+
+	s.Contains(actual, "server {{$.Identifier}} {{if .OutboundHostname}}")
+	s.NotContains(actual, "server-template")
+	s.Equal(0, haProxy17Renderer{}.GetReplicaSlots(sr))
+}
+
+func (s *RendererTestSuite) Test_RenderServers_RendersServerTemplate_WhenFlavorIsHaProxy2AndReplicasIsSet() {
+	defer os.Unsetenv("REPLICA_HEADROOM")
+	os.Setenv("REPLICA_HEADROOM", "2")
+	sr := Service{ServiceName: "my-service", Replicas: 3}
+
+	actual := haProxy2Renderer{}.RenderServers(sr, "swarm", "http")
+
+	s.Contains(actual, `
+    server-template {{$.Identifier}} {{$.Replicas}} tasks.{{$.Host}}{{if not .SrcPortRange}}:{{.Port}}{{end}} check resolvers docker init-addr none`)
+	s.Contains(actual, `
+    server-template {{$.Identifier}} 4-5 tasks.{{$.Host}}`)
+	s.Equal(5, haProxy2Renderer{}.GetReplicaSlots(sr))
+}
+
+func (s *RendererTestSuite) Test_RenderServers_RendersConsulServers_WhenModeIsNotSwarm() {
+	sr := Service{ServiceName: "my-service", Replicas: 3}
+
+	for _, renderer := range []ConfigRenderer{haProxy17Renderer{}, haProxy2Renderer{}} {
+		actual := renderer.RenderServers(sr, "default", "http")
+
+		s.Contains(actual, `range $i, $e := service "{{$.FullServiceName}}" "any"`)
+		s.NotContains(actual, "server-template")
+	}
+}
+
+// Golden files
+
+func (s *RendererTestSuite) Test_Render_MatchesGoldenFiles() {
+	for _, flavor := range []string{"haproxy-1.7", "haproxy-2.x"} {
+		expected, err := ioutil.ReadFile("test_configs/golden/" + flavor + ".cfg")
+		s.NoError(err)
+
+		actual := s.render(configRenderers[flavor])
+
+		s.Equal(string(expected), actual, flavor)
+	}
+}
+
+// Util
+
+// Renders a representative catalog of services
+func (s *RendererTestSuite) render(renderer ConfigRenderer) string {
+	env := map[string]string{"DEBUG": "true", "SYSLOG_LISTENER_ADDRESS": ":1514"}
+	certs := map[string]bool{"my-cert.pem": true}
+	services := []Service{
+		{
+			ServiceName: "plain",
+			AclName:     "plain",
+			PathType:    "path_beg",
+			BalanceMode: "source",
+			ServiceDest: []ServiceDest{{Port: "8080", ServicePath: []string{"/plain"}}},
+		},
+		{
+			ServiceName:          "api",
+			AclName:              "api",
+			PathType:             "path_beg",
+			ServiceDomain:        []string{"example.com"},
+			RedirectToWww:        true,
+			HttpsPort:            8443,
+			DefaultServerOptions: "inter 2s fall 3",
+			BalanceMode:          "leastconn",
+			RequestDeadline:      "2s",
+			BufferRequest:        true,
+			MaxBodySize:          1024,
+			ReqPathSearch:        []string{"^/api/"},
+			ReqPathReplace:       []string{"/"},
+			ServiceDest: []ServiceDest{
+				{Port: "8080", ServicePath: []string{"/api"}, HttpMethods: []string{"GET", "HEAD"}},
+				{Port: "8081", ServicePath: []string{"/api"}, HttpMethods: []string{"POST"}},
+			},
+		},
+		{
+			ServiceName: "db",
+			ReqMode:     "tcp",
+			ServiceDest: []ServiceDest{{Port: "5432", SrcPort: 5432}},
+		},
+	}
+	out := "global" + renderer.RenderGlobal(env, certs) + "\n"
+	for _, service := range services {
+		out += "\n# " + service.ServiceName + " frontend" + renderer.RenderFrontend(service) + "\n"
+		out += "\n# " + service.ServiceName + " backend" + renderer.RenderBackend(service) + "\n"
+	}
+	return out
+}
+
+// Applies the rendered Location rewrites the way HAProxy does
+func (s *RendererTestSuite) applyLocationRewrites(backend, location string) string {
+	rewriteRegexp := regexp.MustCompile(`replace-header Location "(.+)" "(.+)"`)
+	for _, match := range rewriteRegexp.FindAllStringSubmatch(backend, -1) {
+		search := strings.Replace(match[1], `\\`, `\`, -1)
+		replace := regexp.MustCompile(`\\\\(\d)`).ReplaceAllString(match[2], "$${$1}")
+		if re := regexp.MustCompile(search); re.MatchString(location) {
+			location = re.ReplaceAllString(location, replace)
+		}
+	}
+	return location
+}
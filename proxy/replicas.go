@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// GetReplicaHeadroom returns the number of disabled server template slots rendered above the replicas of services.
+// The slots let services scale up without a reload. It is set through REPLICA_HEADROOM and defaults to zero.
+func GetReplicaHeadroom() int {
+	headroom, err := strconv.Atoi(os.Getenv("REPLICA_HEADROOM"))
+	if err != nil || headroom < 0 {
+		return 0
+	}
+	return headroom
+}
+
+// SetServiceReplicas changes the number of replicas of the service.
+// If the service scales up within the slots rendered at its last reconfiguration,
+// the slots are enabled through the runtime socket and the proxy is not reloaded.
+// Otherwise, ErrReconfigureRequired is returned and the service needs to be reconfigured with the new number.
+func (m HaProxy) SetServiceReplicas(serviceName string, replicas int) error {
+	if !m.canMutate() {
+		return ErrReadOnly
+	}
+	if replicas < 1 {
+		return &ErrValidation{Fields: []string{"replicas"}, Message: fmt.Sprintf("The number of replicas %d must be at least 1", replicas)}
+	}
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	s, ok := data.Services[serviceName]
+	if !ok {
+		return ErrServiceNotFound
+	}
+	if replicas == s.Replicas {
+		return nil
+	}
+	if s.Replicas == 0 || replicas < s.Replicas || replicas > s.ReplicaSlots {
+		return ErrReconfigureRequired
+	}
+	if _, err := statFile(haproxySocketPath); err != nil {
+		logPrintf("The runtime socket %s does not exist. The service %s needs to be reconfigured.", haproxySocketPath, serviceName)
+		return ErrReconfigureRequired
+	}
+	id := getIdentifier(s)
+	for _, backend := range getServiceBackendNames(s) {
+		for slot := s.Replicas + 1; slot <= replicas; slot++ {
+			command := fmt.Sprintf("set server %s/%s%d state ready", backend, id, slot)
+			if err := sendRuntimeCommand(haproxySocketPath, command); err != nil {
+				return fmt.Errorf("Could not enable the server %s/%s%d\n%s", backend, id, slot, err.Error())
+			}
+		}
+	}
+	logPrintf("The service %s was scaled from %d to %d replicas", serviceName, s.Replicas, replicas)
+	s.Replicas = replicas
+	data.Services[serviceName] = s
+	m.writeState()
+	return nil
+}
+
+// GetBackendServiceNames returns the names of the registered services keyed by the names of their backends
+func GetBackendServiceNames() map[string]string {
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	names := map[string]string{}
+	for name, s := range data.Services {
+		for _, backend := range getServiceBackendNames(s) {
+			names[backend] = name
+		}
+	}
+	return names
+}
+
+// Returns the names of the HTTP and HTTPS backends of the destinations of the service
+func getServiceBackendNames(s Service) []string {
+	names := []string{}
+	for _, sd := range s.ServiceDest {
+		name := GetBackendName(s, sd)
+		names = append(names, name)
+		if s.HttpsPort > 0 {
+			names = append(names, "https-"+name)
+		}
+	}
+	return names
+}
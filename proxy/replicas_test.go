@@ -0,0 +1,150 @@
+// +build !integration
+
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ReplicasTestSuite struct {
+	suite.Suite
+	Commands   []string
+	SocketPath string
+	dataOrig   Data
+}
+
+func TestReplicasUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(ReplicasTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *ReplicasTestSuite) SetupTest() {
+	s.dataOrig = data
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{
+		"my-service": {
+			ServiceName:  "my-service",
+			HttpsPort:    8443,
+			Replicas:     3,
+			ReplicaSlots: 5,
+			ServiceDest:  []ServiceDest{{Port: "8080"}},
+		},
+	}}
+	s.Commands = []string{}
+	sendRuntimeCommand = func(socket, command string) error {
+		s.Commands = append(s.Commands, command)
+		return nil
+	}
+	socket, _ := ioutil.TempFile("", "haproxy-sock")
+	s.SocketPath = socket.Name()
+	haproxySocketPath = s.SocketPath
+}
+
+func (s *ReplicasTestSuite) TearDownTest() {
+	data = s.dataOrig
+	os.Remove(s.SocketPath)
+	haproxySocketPath = "/var/run/haproxy.sock"
+	sendRuntimeCommand = sendRuntimeCommandOrig
+	os.Unsetenv("REPLICA_HEADROOM")
+}
+
+// GetReplicaHeadroom
+
+func (s *ReplicasTestSuite) Test_GetReplicaHeadroom_ReturnsZero_WhenNotSetOrInvalid() {
+	for _, value := range []string{"", "abc", "-1"} {
+		os.Setenv("REPLICA_HEADROOM", value)
+
+		s.Equal(0, GetReplicaHeadroom(), value)
+	}
+}
+
+func (s *ReplicasTestSuite) Test_GetReplicaHeadroom_ReturnsEnvVar() {
+	os.Setenv("REPLICA_HEADROOM", "5")
+
+	s.Equal(5, GetReplicaHeadroom())
+}
+
+// SetServiceReplicas
+
+func (s *ReplicasTestSuite) Test_SetServiceReplicas_EnablesSlots_WhenGrowingWithinHeadroom() {
+	err := HaProxy{}.SetServiceReplicas("my-service", 5)
+
+	s.NoError(err)
+	s.Equal([]string{
+		"set server my-service-be8080/my-service4 state ready",
+		"set server my-service-be8080/my-service5 state ready",
+		"set server https-my-service-be8080/my-service4 state ready",
+		"set server https-my-service-be8080/my-service5 state ready",
+	}, s.Commands)
+	s.Equal(5, data.Services["my-service"].Replicas)
+}
+
+func (s *ReplicasTestSuite) Test_SetServiceReplicas_ReturnsErrReconfigureRequired_WhenGrowingBeyondHeadroom() {
+	err := HaProxy{}.SetServiceReplicas("my-service", 6)
+
+	s.Equal(ErrReconfigureRequired, err)
+	s.Empty(s.Commands)
+	s.Equal(3, data.Services["my-service"].Replicas)
+}
+
+func (s *ReplicasTestSuite) Test_SetServiceReplicas_ReturnsErrReconfigureRequired_WhenShrinking() {
+	err := HaProxy{}.SetServiceReplicas("my-service", 2)
+
+	s.Equal(ErrReconfigureRequired, err)
+	s.Empty(s.Commands)
+}
+
+func (s *ReplicasTestSuite) Test_SetServiceReplicas_ReturnsErrReconfigureRequired_WhenSocketDoesNotExist() {
+	haproxySocketPath = "/this/socket/does/not/exist"
+
+	err := HaProxy{}.SetServiceReplicas("my-service", 4)
+
+	s.Equal(ErrReconfigureRequired, err)
+	s.Empty(s.Commands)
+}
+
+func (s *ReplicasTestSuite) Test_SetServiceReplicas_ReturnsError_WhenRuntimeCommandFails() {
+	sendRuntimeCommand = func(socket, command string) error {
+		return fmt.Errorf("This is an error")
+	}
+
+	err := HaProxy{}.SetServiceReplicas("my-service", 4)
+
+	s.Error(err)
+	s.Equal(3, data.Services["my-service"].Replicas)
+}
+
+func (s *ReplicasTestSuite) Test_SetServiceReplicas_ReturnsErrServiceNotFound() {
+	s.Equal(ErrServiceNotFound, HaProxy{}.SetServiceReplicas("other-service", 4))
+}
+
+func (s *ReplicasTestSuite) Test_SetServiceReplicas_ReturnsValidationError_WhenReplicasIsLessThanOne() {
+	err := HaProxy{}.SetServiceReplicas("my-service", 0)
+
+	s.Require().Error(err)
+	s.Equal([]string{"replicas"}, err.(*ErrValidation).Fields)
+}
+
+// GetBackendServiceNames
+
+func (s *ReplicasTestSuite) Test_GetBackendServiceNames_ReturnsServiceNamesKeyedByBackends() {
+	data.Services["my.service"] = Service{
+		ServiceName: "my.service",
+		AclName:     "my-acl",
+		ServiceDest: []ServiceDest{{Port: "8080"}, {Port: "9090"}},
+	}
+
+	actual := GetBackendServiceNames()
+
+	s.Equal(map[string]string{
+		"my-service-be8080":       "my-service",
+		"https-my-service-be8080": "my-service",
+		"my-acl-be8080":           "my.service",
+		"my-acl-be9090":           "my.service",
+	}, actual)
+}
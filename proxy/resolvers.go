@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The embedded DNS server of Docker that resolves the tasks.<service> names
+const defaultResolver = "127.0.0.11:53"
+
+// Returns the resolvers section used by the backends of the services with replicas or with resolvers enabled.
+// It is empty if none of the services needs it.
+// The name servers are taken from the CHECK_RESOLVERS environment variable and default to the Docker DNS server.
+func (m HaProxy) getResolvers() string {
+	required := false
+	for _, s := range data.Services {
+		if s.Replicas > 0 || s.Resolvers {
+			required = true
+			break
+		}
+	}
+	if !required {
+		return ""
+	}
+	nameservers := []string{}
+	for _, ns := range strings.Split(os.Getenv("CHECK_RESOLVERS"), ",") {
+		if ns = strings.TrimSpace(ns); len(ns) > 0 {
+			nameservers = append(nameservers, ns)
+		}
+	}
+	if len(nameservers) == 0 {
+		nameservers = []string{defaultResolver}
+	}
+	resolvers := "\nresolvers docker"
+	for i, ns := range nameservers {
+		resolvers += fmt.Sprintf("\n    nameserver dns%d %s", i+1, ns)
+	}
+	return resolvers + `
+    resolve_retries 3
+    hold valid 10s
+    hold obsolete 30s
+`
+}
@@ -0,0 +1,95 @@
+// +build !integration
+
+package proxy
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ResolversTestSuite struct {
+	suite.Suite
+}
+
+func TestResolversUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	validateConfig = func(content string) error { return nil }
+	s := new(ResolversTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *ResolversTestSuite) TearDownTest() {
+	os.Unsetenv("CHECK_RESOLVERS")
+}
+
+// CreateConfigFromTemplates
+
+func (s *ResolversTestSuite) Test_CreateConfigFromTemplates_AddsResolvers_WhenServiceHasReplicas() {
+	expected := `
+resolvers docker
+    nameserver dns1 127.0.0.11:53
+    resolve_retries 3
+    hold valid 10s
+    hold obsolete 30s
+
+frontend services`
+
+	actual := s.createConfig(map[string]Service{
+		"my-service": {ServiceName: "my-service", Replicas: 3, ServiceDest: []ServiceDest{{Port: "1111"}}},
+	})
+
+	s.Contains(actual, expected)
+}
+
+func (s *ResolversTestSuite) Test_CreateConfigFromTemplates_AddsResolversOnce_WhenSeveralServicesHaveResolvers() {
+	actual := s.createConfig(map[string]Service{
+		"service-1": {ServiceName: "service-1", Resolvers: true, ServiceDest: []ServiceDest{{Port: "1111"}}},
+		"service-2": {ServiceName: "service-2", Resolvers: true, ServiceDest: []ServiceDest{{Port: "2222"}}},
+		"service-3": {ServiceName: "service-3", Replicas: 2, ServiceDest: []ServiceDest{{Port: "3333"}}},
+	})
+
+	s.Equal(1, strings.Count(actual, "resolvers docker\n"))
+}
+
+func (s *ResolversTestSuite) Test_CreateConfigFromTemplates_UsesCheckResolvers() {
+	os.Setenv("CHECK_RESOLVERS", "10.0.0.1:53, 10.0.0.2:53")
+
+	actual := s.createConfig(map[string]Service{
+		"my-service": {ServiceName: "my-service", Replicas: 3, ServiceDest: []ServiceDest{{Port: "1111"}}},
+	})
+
+	s.Contains(actual, "\n    nameserver dns1 10.0.0.1:53\n    nameserver dns2 10.0.0.2:53\n")
+}
+
+func (s *ResolversTestSuite) Test_CreateConfigFromTemplates_DoesNotAddResolvers_WhenNoServiceHasReplicas() {
+	actual := s.createConfig(map[string]Service{
+		"my-service": {ServiceName: "my-service", ServiceDest: []ServiceDest{{Port: "1111"}}},
+	})
+
+	s.NotContains(actual, "resolvers docker")
+}
+
+func (s *ResolversTestSuite) createConfig(services map[string]Service) string {
+	dataOrig := data
+	writeFileOrig := writeFile
+	defer func() {
+		data = dataOrig
+		writeFile = writeFileOrig
+	}()
+	actual := ""
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		if strings.HasSuffix(filename, "haproxy.cfg") {
+			actual = string(data)
+		}
+		return nil
+	}
+	p := NewHaProxy("test_configs/tmpl", "test_configs", map[string]bool{})
+	data.Services = services
+
+	p.CreateConfigFromTemplates()
+
+	return actual
+}
@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Seams are the functions through which the proxy reaches the file system, HAProxy, the network, and the clock.
+// Programs embedding the package replace them in their tests (see the proxytest package).
+type Seams struct {
+	// The path of the runtime socket of HAProxy. Runtime commands are sent only if StatFile finds it.
+	HaproxySocketPath  string
+	CmdRunHa           func(cmd *exec.Cmd) error
+	ReadConfigsFile    func(filename string) ([]byte, error)
+	WriteFile          func(filename string, data []byte, perm os.FileMode) error
+	ReadFile           func(filename string) ([]byte, error)
+	LogPrintf          func(format string, v ...interface{})
+	ReadPidFile        func(filename string) ([]byte, error)
+	ReadConfigsDir     func(dirname string) ([]os.FileInfo, error)
+	TimeNow            func() time.Time
+	RenameFile         func(oldpath, newpath string) error
+	RemoveFile         func(name string) error
+	HttpGet            func(url string) (*http.Response, error)
+	ValidateConfig     func(content string) error
+	SendRuntimeCommand func(socket, command string) error
+	ReadRuntimeCommand func(socket, command string) (string, error)
+	MkdirAll           func(path string, perm os.FileMode) error
+	StatFile           func(name string) (os.FileInfo, error)
+	AfterFunc          func(d time.Duration, f func()) (stop func() bool)
+	StartShadowProcess func(configPath string) (stop func() string, err error)
+	HaproxyBuildInfo   func() (string, error)
+}
+
+// GetSeams returns the functions currently used by the proxy
+func GetSeams() Seams {
+	return Seams{
+		HaproxySocketPath:  haproxySocketPath,
+		CmdRunHa:           cmdRunHa,
+		ReadConfigsFile:    readConfigsFile,
+		WriteFile:          writeFile,
+		ReadFile:           ReadFile,
+		LogPrintf:          logPrintf,
+		ReadPidFile:        readPidFile,
+		ReadConfigsDir:     readConfigsDir,
+		TimeNow:            timeNow,
+		RenameFile:         renameFile,
+		RemoveFile:         removeFile,
+		HttpGet:            httpGet,
+		ValidateConfig:     validateConfig,
+		SendRuntimeCommand: sendRuntimeCommand,
+		ReadRuntimeCommand: readRuntimeCommand,
+		MkdirAll:           mkdirAll,
+		StatFile:           statFile,
+		AfterFunc:          afterFunc,
+		StartShadowProcess: startShadowProcess,
+		HaproxyBuildInfo:   haproxyBuildInfo,
+	}
+}
+
+// SetSeams replaces the functions used by the proxy. The functions that are nil and an empty socket path are left unchanged.
+// It is not safe to call while the proxy is in use.
+func SetSeams(s Seams) {
+	if len(s.HaproxySocketPath) > 0 {
+		haproxySocketPath = s.HaproxySocketPath
+	}
+	if s.CmdRunHa != nil {
+		cmdRunHa = s.CmdRunHa
+	}
+	if s.ReadConfigsFile != nil {
+		readConfigsFile = s.ReadConfigsFile
+	}
+	if s.WriteFile != nil {
+		writeFile = s.WriteFile
+	}
+	if s.ReadFile != nil {
+		ReadFile = s.ReadFile
+	}
+	if s.LogPrintf != nil {
+		logPrintf = s.LogPrintf
+	}
+	if s.ReadPidFile != nil {
+		readPidFile = s.ReadPidFile
+	}
+	if s.ReadConfigsDir != nil {
+		readConfigsDir = s.ReadConfigsDir
+	}
+	if s.TimeNow != nil {
+		timeNow = s.TimeNow
+	}
+	if s.RenameFile != nil {
+		renameFile = s.RenameFile
+	}
+	if s.RemoveFile != nil {
+		removeFile = s.RemoveFile
+	}
+	if s.HttpGet != nil {
+		httpGet = s.HttpGet
+	}
+	if s.ValidateConfig != nil {
+		validateConfig = s.ValidateConfig
+	}
+	if s.SendRuntimeCommand != nil {
+		sendRuntimeCommand = s.SendRuntimeCommand
+	}
+	if s.ReadRuntimeCommand != nil {
+		readRuntimeCommand = s.ReadRuntimeCommand
+	}
+	if s.MkdirAll != nil {
+		mkdirAll = s.MkdirAll
+	}
+	if s.StatFile != nil {
+		statFile = s.StatFile
+	}
+	if s.AfterFunc != nil {
+		afterFunc = s.AfterFunc
+	}
+	if s.StartShadowProcess != nil {
+		startShadowProcess = s.StartShadowProcess
+	}
+	if s.HaproxyBuildInfo != nil {
+		haproxyBuildInfo = s.HaproxyBuildInfo
+		resetLuaSupport()
+	}
+}
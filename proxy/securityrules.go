@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The version of the security rule pack. It is increased whenever the rules change.
+const SecurityRulesVersion = 1
+
+// The paths probed by scanners that are denied when their category is listed in SECURITY_RULES.
+// The categories are rendered in this order regardless of the order they are listed in.
+var securityRuleCategories = []struct {
+	Name  string
+	Paths []string
+}{
+	{"basic", []string{"/.env", "/.git", "/.hg", "/.svn", "/cgi-bin/", "/server-status"}},
+	{"php", []string{"/phpinfo.php", "/phpmyadmin", "/pma", "/vendor/phpunit", "/wp-admin", "/wp-login.php", "/xmlrpc.php"}},
+	{"dotfiles", []string{"/.aws", "/.bash_history", "/.docker", "/.DS_Store", "/.htaccess", "/.htpasswd", "/.npmrc", "/.ssh"}},
+}
+
+// The variable set for the requests of the services that opted out of the security rules
+const securityRulesSkippedVar = "txn.security_rules_skipped"
+
+// Returns the categories listed in SECURITY_RULES, in the order they are rendered, and the unknown ones
+func getSecurityRuleCategories() (categories, unknown []string) {
+	listed := map[string]bool{}
+	for _, name := range strings.Split(os.Getenv("SECURITY_RULES"), ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); len(name) > 0 {
+			listed[name] = true
+		}
+	}
+	for _, category := range securityRuleCategories {
+		if listed[category.Name] {
+			categories = append(categories, category.Name)
+			delete(listed, category.Name)
+		}
+	}
+	for name := range listed {
+		unknown = append(unknown, name)
+	}
+	sort.Strings(unknown)
+	return categories, unknown
+}
+
+// Returns the rules that deny the requests to the paths of the categories listed in SECURITY_RULES.
+// The requests of services with SkipSecurityRules are excluded through the variable set by their frontend rules.
+func (m HaProxy) getSecurityRules(skipped bool) string {
+	categories, unknown := getSecurityRuleCategories()
+	for _, name := range unknown {
+		logPrintf("WARNING: The security rule category %s does not exist", name)
+	}
+	if len(categories) == 0 {
+		return ""
+	}
+	condition := ""
+	if skipped {
+		condition = fmt.Sprintf(" !{ var(%s) -m bool }", securityRulesSkippedVar)
+	}
+	rules := fmt.Sprintf(`
+    # security rules v%d (%s)`, SecurityRulesVersion, strings.Join(categories, ","))
+	for _, name := range categories {
+		for _, category := range securityRuleCategories {
+			if category.Name == name {
+				rules += fmt.Sprintf(`
+    http-request deny deny_status 403 if { path_beg %s }%s`, strings.Join(category.Paths, " "), condition)
+			}
+		}
+	}
+	return rules
+}
+
+// Returns the rule that marks the requests of the service as excluded from the security rules
+func (m *HaProxy) getSecurityRulesSkipRule(s Service) string {
+	if categories, _ := getSecurityRuleCategories(); !s.SkipSecurityRules || len(categories) == 0 {
+		return ""
+	}
+	id := getIdentifier(s)
+	conditions := []string{}
+	for i, sd := range s.ServiceDest {
+		condition := m.getUrlAclName(s, i)
+		if len(sd.HttpMethods) > 0 {
+			condition += fmt.Sprintf(" method_%s%s", id, sd.PortName())
+		}
+		conditions = appendCondition(conditions, condition+s.AclCondition+sd.SrcPortAclName)
+	}
+	return fmt.Sprintf(`
+    http-request set-var(%s) bool(true) if %s`, securityRulesSkippedVar, strings.Join(conditions, " || "))
+}
@@ -0,0 +1,144 @@
+// +build !integration
+
+package proxy
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SecurityRulesTestSuite struct {
+	suite.Suite
+	dataOrig Data
+}
+
+func TestSecurityRulesUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(SecurityRulesTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *SecurityRulesTestSuite) SetupTest() {
+	s.dataOrig = data
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{}}
+}
+
+func (s *SecurityRulesTestSuite) TearDownTest() {
+	os.Unsetenv("SECURITY_RULES")
+	data = s.dataOrig
+}
+
+const (
+	basicSecurityRule    = "\n    http-request deny deny_status 403 if { path_beg /.env /.git /.hg /.svn /cgi-bin/ /server-status }"
+	phpSecurityRule      = "\n    http-request deny deny_status 403 if { path_beg /phpinfo.php /phpmyadmin /pma /vendor/phpunit /wp-admin /wp-login.php /xmlrpc.php }"
+	dotfilesSecurityRule = "\n    http-request deny deny_status 403 if { path_beg /.aws /.bash_history /.docker /.DS_Store /.htaccess /.htpasswd /.npmrc /.ssh }"
+)
+
+// getSecurityRules
+
+func (s *SecurityRulesTestSuite) Test_GetSecurityRules_ReturnsEmptyString_WhenSecurityRulesIsNotSet() {
+	s.Empty(HaProxy{}.getSecurityRules(false))
+}
+
+func (s *SecurityRulesTestSuite) Test_GetSecurityRules_ReturnsRulesOfCategories() {
+	testData := []struct {
+		value    string
+		expected string
+	}{
+		{"basic", "\n    # security rules v1 (basic)" + basicSecurityRule},
+		{"php", "\n    # security rules v1 (php)" + phpSecurityRule},
+		{"dotfiles", "\n    # security rules v1 (dotfiles)" + dotfilesSecurityRule},
+		{"basic,php", "\n    # security rules v1 (basic,php)" + basicSecurityRule + phpSecurityRule},
+		{"basic,dotfiles", "\n    # security rules v1 (basic,dotfiles)" + basicSecurityRule + dotfilesSecurityRule},
+		{"dotfiles, PHP", "\n    # security rules v1 (php,dotfiles)" + phpSecurityRule + dotfilesSecurityRule},
+		{"dotfiles,php,basic", "\n    # security rules v1 (basic,php,dotfiles)" + basicSecurityRule + phpSecurityRule + dotfilesSecurityRule},
+	}
+	for _, d := range testData {
+		os.Setenv("SECURITY_RULES", d.value)
+
+		s.Equal(d.expected, HaProxy{}.getSecurityRules(false), d.value)
+	}
+}
+
+func (s *SecurityRulesTestSuite) Test_GetSecurityRules_IgnoresUnknownCategories() {
+	messages := []string{}
+	logPrintf = func(format string, v ...interface{}) { messages = append(messages, format) }
+	defer func() { logPrintf = func(format string, v ...interface{}) {} }()
+	os.Setenv("SECURITY_RULES", "basic,unknown")
+
+	actual := HaProxy{}.getSecurityRules(false)
+
+	s.Equal("\n    # security rules v1 (basic)"+basicSecurityRule, actual)
+	s.Len(messages, 1)
+
+	os.Setenv("SECURITY_RULES", "unknown")
+
+	s.Empty(HaProxy{}.getSecurityRules(false))
+}
+
+func (s *SecurityRulesTestSuite) Test_GetSecurityRules_ExcludesSkippedRequests() {
+	os.Setenv("SECURITY_RULES", "basic")
+
+	actual := HaProxy{}.getSecurityRules(true)
+
+	s.Contains(actual, "/server-status } !{ var(txn.security_rules_skipped) -m bool }")
+}
+
+// getConfigData
+
+func (s *SecurityRulesTestSuite) Test_GetConfigData_RendersSecurityRulesAfterServices() {
+	os.Setenv("SECURITY_RULES", "basic")
+	data.Services["my-service"] = Service{
+		ServiceName: "my-service",
+		AclName:     "my-service",
+		ServiceDest: []ServiceDest{{Port: "8080", ServicePath: []string{"/api"}}},
+	}
+
+	actual := HaProxy{}.getConfigData(map[string]bool{}).ContentFrontend
+
+	s.Contains(actual, "use_backend my-service-be8080 if url_my-service8080\n    # security rules v1 (basic)"+basicSecurityRule)
+	s.NotContains(actual, "security_rules_skipped")
+}
+
+func (s *SecurityRulesTestSuite) Test_GetConfigData_ExcludesServicesThatSkipSecurityRules() {
+	os.Setenv("SECURITY_RULES", "basic,php")
+	data.Services["blog"] = Service{
+		ServiceName:       "blog",
+		AclName:           "blog",
+		ServiceDomain:     []string{"blog.example.com"},
+		SkipSecurityRules: true,
+		ServiceDest: []ServiceDest{
+			{Port: "8080", ServicePath: []string{"/"}},
+			{Port: "9090", ServicePath: []string{"/admin"}, HttpMethods: []string{"GET"}},
+		},
+	}
+	data.Services["shop"] = Service{
+		ServiceName: "shop",
+		AclName:     "shop",
+		ServiceDest: []ServiceDest{{Port: "8080", ServicePath: []string{"/shop"}}},
+	}
+
+	actual := HaProxy{}.getConfigData(map[string]bool{}).ContentFrontend
+
+	s.Contains(actual, "\n    http-request set-var(txn.security_rules_skipped) bool(true) if url_blog8080 domain_blog || url_blog9090 method_blog9090 domain_blog")
+	s.Contains(actual, "\n    # security rules v1 (basic,php)"+
+		basicSecurityRule+" !{ var(txn.security_rules_skipped) -m bool }"+
+		phpSecurityRule+" !{ var(txn.security_rules_skipped) -m bool }")
+	s.Equal(1, strings.Count(actual, "set-var(txn.security_rules_skipped)"))
+}
+
+func (s *SecurityRulesTestSuite) Test_GetConfigData_DoesNotExcludeServices_WhenSecurityRulesIsNotSet() {
+	data.Services["blog"] = Service{
+		ServiceName:       "blog",
+		AclName:           "blog",
+		SkipSecurityRules: true,
+		ServiceDest:       []ServiceDest{{Port: "8080", ServicePath: []string{"/"}}},
+	}
+
+	actual := HaProxy{}.getConfigData(map[string]bool{}).ContentFrontend
+
+	s.NotContains(actual, "security")
+}
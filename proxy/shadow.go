@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The directory of the configuration and the runtime socket of the shadow process
+var shadowDir = os.TempDir()
+
+// The first of the throwaway ports the shadow process binds to instead of the ports of the configuration
+var shadowBasePort = 49152
+
+// The time the shadow process has to answer through its runtime socket
+var shadowStartTimeout = 5 * time.Second
+
+// The time between two attempts to reach the runtime socket of the shadow process
+var shadowPollInterval = 100 * time.Millisecond
+
+var shadowSleep = time.Sleep
+
+// Starts HAProxy in the foreground with the configuration.
+// The returned function stops the process and returns what it printed.
+var startShadowProcess = func(configPath string) (stop func() string, err error) {
+	cmd := exec.Command("haproxy", "-f", configPath, "-db")
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return func() string {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return output.String()
+	}, nil
+}
+
+var shadowBindRegexp = regexp.MustCompile(`^(\s*bind\s+)(\S+)(.*)$`)
+var shadowRemovedRegexp = regexp.MustCompile(`^\s*(pidfile|stats\s+socket)\s`)
+
+// Returns whether the configuration is started by a shadow process before the proxy is reloaded (DEEP_VALIDATION).
+// It catches issues that `haproxy -c` does not, like certificates that do not match their keys.
+func isDeepValidationEnabled() bool {
+	return strings.EqualFold(os.Getenv("DEEP_VALIDATION"), "true")
+}
+
+// Starts a shadow process with a copy of the configuration and stops it once it answers through its runtime socket.
+// The copy binds to throwaway local ports and has its own runtime socket so that it does not interfere with the proxy.
+func (m HaProxy) validateWithShadow(content string) error {
+	configPath := fmt.Sprintf("%s/haproxy-shadow.cfg", shadowDir)
+	socketPath := fmt.Sprintf("%s/haproxy-shadow.sock", shadowDir)
+	defer removeFile(socketPath)
+	if err := writeFile(configPath, []byte(getShadowConfig(content, socketPath, shadowBasePort)), 0600); err != nil {
+		return err
+	}
+	defer removeFile(configPath)
+	stop, err := startShadowProcess(configPath)
+	if err != nil {
+		return fmt.Errorf("Could not start the shadow process\n%s", err.Error())
+	}
+	deadline := timeNow().Add(shadowStartTimeout)
+	for {
+		_, err = readRuntimeCommand(socketPath, "show info")
+		if err == nil || !timeNow().Before(deadline) {
+			break
+		}
+		shadowSleep(shadowPollInterval)
+	}
+	output := stop()
+	if err != nil {
+		return fmt.Errorf("The shadow process did not start within %s\n%s", shadowStartTimeout, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// Returns the configuration of the shadow process.
+// Binds are moved to consecutive local ports starting from basePort, the PID file and the runtime sockets are removed,
+// and a runtime socket of the shadow process is added to the global section.
+func getShadowConfig(content, socketPath string, basePort int) string {
+	port := basePort
+	lines := []string{}
+	socketAdded := false
+	for _, line := range strings.Split(content, "\n") {
+		if shadowRemovedRegexp.MatchString(line) {
+			continue
+		}
+		if matches := shadowBindRegexp.FindStringSubmatch(line); matches != nil {
+			line = fmt.Sprintf("%s127.0.0.1:%d%s", matches[1], port, matches[3])
+			port++
+		}
+		lines = append(lines, line)
+		if !socketAdded && strings.TrimSpace(line) == "global" {
+			lines = append(lines, fmt.Sprintf("    stats socket %s level admin", socketPath))
+			socketAdded = true
+		}
+	}
+	if !socketAdded {
+		lines = append([]string{"global", fmt.Sprintf("    stats socket %s level admin", socketPath)}, lines...)
+	}
+	return strings.Join(lines, "\n")
+}
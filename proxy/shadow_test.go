@@ -0,0 +1,196 @@
+// +build !integration
+
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+var startShadowProcessOrig = startShadowProcess
+
+type ShadowTestSuite struct {
+	suite.Suite
+	Dir           string
+	Now           time.Time
+	ShadowConfig  string
+	ShadowStopped bool
+	Reloads       int
+}
+
+func TestShadowUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(ShadowTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *ShadowTestSuite) SetupTest() {
+	os.Setenv("DEEP_VALIDATION", "true")
+	s.Dir, _ = ioutil.TempDir("", "shadow")
+	shadowDir = s.Dir
+	s.Now = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.ShadowConfig = ""
+	s.ShadowStopped = false
+	s.Reloads = 0
+	timeNow = func() time.Time { return s.Now }
+	shadowSleep = func(d time.Duration) { s.Now = s.Now.Add(d) }
+	writeFile = ioutil.WriteFile
+	readConfigsFile = func(filename string) ([]byte, error) {
+		return []byte("global\n    pidfile /var/run/haproxy.pid\n\nfrontend services\n    bind *:80\n    bind *:443 ssl crt /certs"), nil
+	}
+	readPidFile = func(fileName string) ([]byte, error) { return []byte("1"), nil }
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		s.Reloads++
+		return nil
+	}
+	startShadowProcess = func(configPath string) (func() string, error) {
+		content, _ := ioutil.ReadFile(configPath)
+		s.ShadowConfig = string(content)
+		return func() string {
+			s.ShadowStopped = true
+			return "[ALERT] unable to load SSL certificate"
+		}, nil
+	}
+	readRuntimeCommand = func(socket, command string) (string, error) {
+		return "Name: HAProxy", nil
+	}
+}
+
+func (s *ShadowTestSuite) TearDownTest() {
+	os.Unsetenv("DEEP_VALIDATION")
+	os.RemoveAll(s.Dir)
+	shadowDir = os.TempDir()
+	timeNow = time.Now
+	shadowSleep = time.Sleep
+	startShadowProcess = startShadowProcessOrig
+	readRuntimeCommand = readRuntimeCommandOrig
+	readConfigsFile = ioutil.ReadFile
+	readPidFile = ioutil.ReadFile
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return cmd.Run()
+	}
+}
+
+// Reload
+
+func (s *ShadowTestSuite) Test_Reload_StartsShadowBeforeReloading() {
+	socket := ""
+	readRuntimeCommand = func(sock, command string) (string, error) {
+		socket = sock
+		s.Equal(0, s.Reloads)
+		return "Name: HAProxy", nil
+	}
+
+	err := HaProxy{}.Reload()
+
+	s.NoError(err)
+	s.Equal(1, s.Reloads)
+	s.True(s.ShadowStopped)
+	s.Equal(s.Dir+"/haproxy-shadow.sock", socket)
+	s.Contains(s.ShadowConfig, "bind 127.0.0.1:49152\n")
+	s.Contains(s.ShadowConfig, "bind 127.0.0.1:49153 ssl crt /certs")
+	s.NotContains(s.ShadowConfig, "pidfile")
+}
+
+func (s *ShadowTestSuite) Test_Reload_WaitsForShadowSocket() {
+	attempts := 0
+	readRuntimeCommand = func(socket, command string) (string, error) {
+		attempts++
+		if attempts < 3 {
+			return "", fmt.Errorf("connection refused")
+		}
+		return "Name: HAProxy", nil
+	}
+
+	err := HaProxy{}.Reload()
+
+	s.NoError(err)
+	s.Equal(3, attempts)
+	s.Equal(1, s.Reloads)
+}
+
+func (s *ShadowTestSuite) Test_Reload_ReturnsErrorWithoutReloading_WhenShadowDoesNotAnswer() {
+	shadowStartTimeout = time.Second
+	defer func() { shadowStartTimeout = 5 * time.Second }()
+	readRuntimeCommand = func(socket, command string) (string, error) {
+		return "", fmt.Errorf("connection refused")
+	}
+
+	err := HaProxy{}.Reload()
+
+	s.Error(err)
+	s.Contains(err.Error(), "unable to load SSL certificate")
+	s.Equal(0, s.Reloads)
+	s.True(s.ShadowStopped)
+	s.Equal(time.Second, s.Now.Sub(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func (s *ShadowTestSuite) Test_Reload_ReturnsErrorWithoutReloading_WhenShadowCannotStart() {
+	startShadowProcess = func(configPath string) (func() string, error) {
+		return nil, fmt.Errorf("executable file not found")
+	}
+
+	err := HaProxy{}.Reload()
+
+	s.Error(err)
+	s.Contains(err.Error(), "executable file not found")
+	s.Equal(0, s.Reloads)
+}
+
+func (s *ShadowTestSuite) Test_Reload_RemovesShadowFiles() {
+	readRuntimeCommand = func(socket, command string) (string, error) {
+		ioutil.WriteFile(socket, []byte{}, 0600)
+		return "", fmt.Errorf("connection refused")
+	}
+
+	HaProxy{}.Reload()
+
+	files, _ := ioutil.ReadDir(s.Dir)
+	s.Empty(files)
+	s.NotEmpty(s.ShadowConfig)
+}
+
+func (s *ShadowTestSuite) Test_Reload_DoesNotStartShadow_WhenDeepValidationIsDisabled() {
+	os.Unsetenv("DEEP_VALIDATION")
+
+	err := HaProxy{}.Reload()
+
+	s.NoError(err)
+	s.Empty(s.ShadowConfig)
+	s.Equal(1, s.Reloads)
+}
+
+// getShadowConfig
+
+func (s *ShadowTestSuite) Test_GetShadowConfig_ReplacesStatsSocket() {
+	content := `global
+    pidfile /var/run/haproxy.pid
+    stats socket /var/run/haproxy.sock mode 660 level admin expose-fd listeners
+
+frontend services
+    bind *:80`
+	expected := `global
+    stats socket /tmp/shadow.sock level admin
+
+frontend services
+    bind 127.0.0.1:50000`
+
+	s.Equal(expected, getShadowConfig(content, "/tmp/shadow.sock", 50000))
+}
+
+func (s *ShadowTestSuite) Test_GetShadowConfig_AddsGlobalSection_WhenItDoesNotExist() {
+	content := `frontend services
+    bind :80`
+	expected := `global
+    stats socket /tmp/shadow.sock level admin
+frontend services
+    bind 127.0.0.1:50000`
+
+	s.Equal(expected, getShadowConfig(content, "/tmp/shadow.sock", 50000))
+}
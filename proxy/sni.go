@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A destination of a tcp service whose source port is used by other services
+type sharedTcpDest struct {
+	service Service
+	dest    ServiceDest
+}
+
+// Returns the frontends of the tcp services. HAProxy cannot bind a port more than once so the destinations
+// of different services sharing a source port are merged into one frontend that routes the connections by SNI.
+func (m HaProxy) getTcpFrontends(renderer ConfigRenderer, services []Service) string {
+	owners := map[int]map[string]bool{}
+	for _, s := range services {
+		for _, sd := range s.ServiceDest {
+			if !isSharableSrcPort(sd) {
+				continue
+			}
+			if owners[sd.SrcPort] == nil {
+				owners[sd.SrcPort] = map[string]bool{}
+			}
+			owners[sd.SrcPort][s.ServiceName] = true
+		}
+	}
+	shared := map[int][]sharedTcpDest{}
+	front := ""
+	for _, s := range services {
+		dests := []ServiceDest{}
+		for _, sd := range s.ServiceDest {
+			if isSharableSrcPort(sd) && len(owners[sd.SrcPort]) > 1 {
+				shared[sd.SrcPort] = append(shared[sd.SrcPort], sharedTcpDest{service: s, dest: sd})
+				continue
+			}
+			dests = append(dests, sd)
+		}
+		if len(dests) > 0 {
+			s.ServiceDest = dests
+			front += renderer.RenderFrontend(s)
+		}
+	}
+	ports := []int{}
+	for port := range shared {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	for _, port := range ports {
+		front += m.getSharedFrontendTcp(port, shared[port])
+	}
+	return front
+}
+
+// Returns the frontend of the destinations of different services sharing the source port.
+// Connections are routed by the SNI of the TLS handshake to the destinations with domains (sniDomain or serviceDomain).
+// The default destination (isDefault) or, if there is none, the destination without domains handles the rest of the connections.
+func (m HaProxy) getSharedFrontendTcp(port int, dests []sharedTcpDest) string {
+	front := fmt.Sprintf("\n\nfrontend tcp_%d%s\n    mode tcp", port, getBindLines(strconv.Itoa(port), ""))
+	if len(os.Getenv("SYSLOG_LISTENER_ADDRESS")) > 0 {
+		front += "\n    log global\n    option tcplog"
+	}
+	front += `
+    tcp-request inspect-delay 5s
+    tcp-request content accept if { req_ssl_hello_type 1 }`
+	rules := ""
+	def := ""
+	for _, shared := range dests {
+		if shared.dest.IsDefault {
+			def = fmt.Sprintf("%s-be%s", getIdentifier(shared.service), shared.dest.PortName())
+			break
+		}
+	}
+	for _, shared := range dests {
+		id := getIdentifier(shared.service)
+		backend := fmt.Sprintf("%s-be%s", id, shared.dest.PortName())
+		if backend == def {
+			continue
+		}
+		domains := getSniDomains(shared.service, shared.dest)
+		if len(domains) == 0 {
+			if len(def) > 0 {
+				logPrintf("WARNING: The service %s shares the port %d without serviceDomain or sniDomain. Its connections are sent to %s.", shared.service.ServiceName, port, def)
+				continue
+			}
+			def = backend
+			continue
+		}
+		acl := fmt.Sprintf("sni_%s%s", id, shared.dest.PortName())
+		exact := []string{}
+		for _, domain := range domains {
+			if strings.HasPrefix(domain, "*") {
+				front += fmt.Sprintf("\n    acl %s req_ssl_sni -m end -i %s", acl, strings.TrimPrefix(domain, "*"))
+			} else {
+				exact = append(exact, domain)
+			}
+		}
+		if len(exact) > 0 {
+			front += fmt.Sprintf("\n    acl %s req_ssl_sni -i %s", acl, strings.Join(exact, " "))
+		}
+		rules += fmt.Sprintf("\n    use_backend %s if %s", backend, acl)
+	}
+	front += rules
+	if len(def) > 0 {
+		front += "\n    default_backend " + def
+	}
+	return front
+}
+
+// Returns whether a destination of the tcp service uses the source port of a destination of the other tcp service
+// and both of them would handle the connections that are not routed by domains
+func (m HaProxy) hasTcpPortConflict(service, other Service, od ServiceDest) bool {
+	if !strings.EqualFold(service.ReqMode, "tcp") || !strings.EqualFold(other.ReqMode, "tcp") || !isSharableSrcPort(od) {
+		return false
+	}
+	if !isCatchAllTcpDest(other, od) {
+		return false
+	}
+	for _, sd := range service.ServiceDest {
+		if isSharableSrcPort(sd) && sd.SrcPort == od.SrcPort && isCatchAllTcpDest(service, sd) {
+			return true
+		}
+	}
+	return false
+}
+
+// Destinations without domains and the default destinations receive the connections that do not match any domain
+func isCatchAllTcpDest(s Service, sd ServiceDest) bool {
+	return sd.IsDefault || len(getSniDomains(s, sd)) == 0
+}
+
+// The domains of the destination take precedence over those of the service
+func getSniDomains(s Service, sd ServiceDest) []string {
+	if len(sd.SniDomain) > 0 {
+		return sd.SniDomain
+	}
+	return s.ServiceDomain
+}
+
+// Destinations with a source port range always have their own frontend
+func isSharableSrcPort(sd ServiceDest) bool {
+	return sd.SrcPort > 0 && len(sd.SrcPortRange) == 0
+}
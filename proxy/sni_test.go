@@ -0,0 +1,150 @@
+// +build !integration
+
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SniTestSuite struct {
+	suite.Suite
+	dataOrig Data
+}
+
+func TestSniUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(SniTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *SniTestSuite) SetupTest() {
+	s.dataOrig = data
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{}}
+}
+
+func (s *SniTestSuite) TearDownTest() {
+	data = s.dataOrig
+}
+
+// getConfigData
+
+func (s *SniTestSuite) Test_GetConfigData_MergesTcpServicesSharingSrcPortIntoSniFrontend() {
+	p := HaProxy{}
+	s.Require().NoError(p.AddService(Service{
+		ServiceName:   "web",
+		ReqMode:       "tcp",
+		ServiceDomain: []string{"web.example.com", "*.web.example.org"},
+		ServiceDest:   []ServiceDest{{Port: "8443", SrcPort: 443}},
+	}))
+	s.Require().NoError(p.AddService(Service{
+		ServiceName:   "api",
+		ReqMode:       "tcp",
+		ServiceDomain: []string{"api.example.com"},
+		ServiceDest:   []ServiceDest{{Port: "9443", SrcPort: 443}, {Port: "5432", SrcPort: 5432}},
+	}))
+	s.Require().NoError(p.AddService(Service{
+		ServiceName: "legacy",
+		ReqMode:     "tcp",
+		ServiceDest: []ServiceDest{{Port: "443", SrcPort: 443}},
+	}))
+	expected := `
+
+frontend tcp_443
+    bind *:443
+    mode tcp
+    tcp-request inspect-delay 5s
+    tcp-request content accept if { req_ssl_hello_type 1 }
+    acl sni_api9443 req_ssl_sni -i api.example.com
+    acl sni_web8443 req_ssl_sni -m end -i .web.example.org
+    acl sni_web8443 req_ssl_sni -i web.example.com
+    use_backend api-be9443 if sni_api9443
+    use_backend web-be8443 if sni_web8443
+    default_backend legacy-be443`
+
+	actual := p.getConfigData(map[string]bool{}).ContentFrontendTcp
+
+	s.Contains(actual, expected)
+	s.Contains(actual, "frontend api_5432")
+	s.NotContains(actual, "frontend api_443")
+	s.NotContains(actual, "frontend web_443")
+	s.NotContains(actual, "frontend legacy_443")
+}
+
+func (s *SniTestSuite) Test_GetConfigData_UsesDefaultDestinationWithDomain_WhenSrcPortIsShared() {
+	p := HaProxy{}
+	s.Require().NoError(p.AddService(Service{
+		ServiceName:   "web",
+		ReqMode:       "tcp",
+		ServiceDomain: []string{"web.example.com"},
+		ServiceDest:   []ServiceDest{{Port: "8443", SrcPort: 443, IsDefault: true}},
+	}))
+	s.Require().NoError(p.AddService(Service{
+		ServiceName:   "api",
+		ReqMode:       "tcp",
+		ServiceDomain: []string{"api.example.com"},
+		ServiceDest:   []ServiceDest{{Port: "9443", SrcPort: 443}},
+	}))
+	expected := `
+    tcp-request content accept if { req_ssl_hello_type 1 }
+    acl sni_api9443 req_ssl_sni -i api.example.com
+    use_backend api-be9443 if sni_api9443
+    default_backend web-be8443`
+
+	actual := p.getConfigData(map[string]bool{}).ContentFrontendTcp
+
+	s.Contains(actual, expected)
+	s.NotContains(actual, "sni_web8443")
+}
+
+func (s *SniTestSuite) Test_GetConfigData_RendersOwnFrontend_WhenSrcPortIsNotShared() {
+	p := HaProxy{}
+	s.Require().NoError(p.AddService(Service{ServiceName: "web", ReqMode: "tcp", ServiceDest: []ServiceDest{{Port: "8443", SrcPort: 443}}}))
+
+	actual := p.getConfigData(map[string]bool{}).ContentFrontendTcp
+
+	s.Contains(actual, "frontend web_443")
+	s.NotContains(actual, "frontend tcp_443")
+}
+
+// AddService
+
+func (s *SniTestSuite) Test_AddService_ReturnsConflict_WhenTcpServicesWithoutDomainsShareSrcPort() {
+	p := HaProxy{}
+	s.Require().NoError(p.AddService(Service{ServiceName: "web", ReqMode: "tcp", ServiceDest: []ServiceDest{{Port: "8443", SrcPort: 443}}}))
+
+	err := p.AddService(Service{ServiceName: "api", ReqMode: "tcp", ServiceDest: []ServiceDest{{Port: "9443", SrcPort: 443}}})
+
+	s.Equal(&ErrConflict{Owner: "web", Port: 443}, err)
+	s.Contains(err.Error(), "port 443")
+	s.NotContains(data.Services, "api")
+}
+
+func (s *SniTestSuite) Test_AddService_ReturnsConflict_WhenTcpServicesSharingSrcPortAreBothDefault() {
+	p := HaProxy{}
+	s.Require().NoError(p.AddService(Service{ServiceName: "web", ReqMode: "tcp", ServiceDomain: []string{"web.example.com"}, ServiceDest: []ServiceDest{{Port: "8443", SrcPort: 443, IsDefault: true}}}))
+
+	err := p.AddService(Service{ServiceName: "api", ReqMode: "tcp", ServiceDest: []ServiceDest{{Port: "9443", SrcPort: 443}}})
+
+	s.Equal(&ErrConflict{Owner: "web", Port: 443}, err)
+}
+
+func (s *SniTestSuite) Test_AddService_TakesOverSrcPort_WhenTcpServiceIsForced() {
+	p := HaProxy{}
+	s.Require().NoError(p.AddService(Service{ServiceName: "web", ReqMode: "tcp", ServiceDest: []ServiceDest{{Port: "8443", SrcPort: 443}}}))
+
+	err := p.AddService(Service{ServiceName: "api", ReqMode: "tcp", Force: true, ServiceDest: []ServiceDest{{Port: "9443", SrcPort: 443}}})
+
+	s.NoError(err)
+	s.NotContains(data.Services, "web")
+	s.Contains(data.Services, "api")
+}
+
+func (s *SniTestSuite) Test_AddService_DoesNotReturnConflict_WhenOneOfTcpServicesHasDomains() {
+	p := HaProxy{}
+	s.Require().NoError(p.AddService(Service{ServiceName: "web", ReqMode: "tcp", ServiceDest: []ServiceDest{{Port: "8443", SrcPort: 443}}}))
+
+	s.NoError(p.AddService(Service{ServiceName: "api", ReqMode: "tcp", ServiceDest: []ServiceDest{{Port: "9443", SrcPort: 443, SniDomain: []string{"api.example.com"}}}}))
+	s.NoError(p.AddService(Service{ServiceName: "http", ServiceDest: []ServiceDest{{Port: "80", SrcPort: 443}}}))
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// The prefix of the destination ports that are unix domain sockets (e.g. unix@/var/run/app.sock)
+const unixSocketPrefix = "unix@"
+
+// IsUnixSocket returns whether the destination is a unix domain socket of a sidecar instead of a port
+func (sd ServiceDest) IsUnixSocket() bool {
+	return strings.HasPrefix(sd.Port, unixSocketPrefix)
+}
+
+// SocketHash returns a short hash of the path of the unix domain socket.
+// It keeps the names of ACLs, backends, and servers of different sockets of the same service apart.
+func (sd ServiceDest) SocketHash() string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.TrimPrefix(sd.Port, unixSocketPrefix))))[:8]
+}
+
+// PortName returns the port as it is used in the names of ACLs and backends.
+// The paths of unix domain sockets are replaced with their hashes since HAProxy does not accept them in names.
+func (sd ServiceDest) PortName() string {
+	if sd.IsUnixSocket() {
+		return "sock" + sd.SocketHash()
+	}
+	return sd.Port
+}
+
+// Returns a validation error if a destination is a unix domain socket that cannot be used
+func validateUnixSockets(s Service) error {
+	for _, sd := range s.ServiceDest {
+		if !sd.IsUnixSocket() {
+			continue
+		}
+		if !strings.HasPrefix(strings.TrimPrefix(sd.Port, unixSocketPrefix), "/") {
+			return &ErrValidation{Fields: []string{"port"}, Message: fmt.Sprintf("The unix socket %s must be an absolute path", sd.Port)}
+		}
+		if s.Replicas > 0 {
+			return &ErrValidation{
+				Fields:  []string{"port", "replicas"},
+				Message: fmt.Sprintf("The unix socket %s cannot be used with replicas", sd.Port),
+			}
+		}
+		if len(sd.SrcPortRange) > 0 {
+			return &ErrValidation{
+				Fields:  []string{"port", "srcPortRange"},
+				Message: fmt.Sprintf("The unix socket %s cannot be used with a source port range", sd.Port),
+			}
+		}
+	}
+	return nil
+}
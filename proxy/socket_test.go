@@ -0,0 +1,76 @@
+// +build !integration
+
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SocketTestSuite struct {
+	suite.Suite
+}
+
+func TestSocketUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(SocketTestSuite)
+	suite.Run(t, s)
+}
+
+// PortName
+
+func (s *SocketTestSuite) Test_PortName_ReturnsPort_WhenDestinationIsNotUnixSocket() {
+	s.Equal("8080", ServiceDest{Port: "8080"}.PortName())
+}
+
+func (s *SocketTestSuite) Test_PortName_ReturnsHashOfPath_WhenDestinationIsUnixSocket() {
+	sd := ServiceDest{Port: "unix@/var/run/app.sock"}
+
+	s.True(sd.IsUnixSocket())
+	s.Equal("fd49e30f", sd.SocketHash())
+	s.Equal("sockfd49e30f", sd.PortName())
+	s.NotEqual(sd.PortName(), ServiceDest{Port: "unix@/var/run/admin.sock"}.PortName())
+}
+
+// ValidateService
+
+func (s *SocketTestSuite) Test_ValidateService_ReturnsNil_WhenUnixSocketIsAbsolute() {
+	s.NoError(ValidateService(Service{ServiceDest: []ServiceDest{{Port: "unix@/var/run/app.sock"}}}))
+}
+
+func (s *SocketTestSuite) Test_ValidateService_ReturnsError_WhenUnixSocketIsNotAbsolute() {
+	err := ValidateService(Service{ServiceDest: []ServiceDest{{Port: "unix@app.sock"}}})
+
+	s.Require().Error(err)
+	s.Equal([]string{"port"}, err.(*ErrValidation).Fields)
+}
+
+func (s *SocketTestSuite) Test_ValidateService_ReturnsError_WhenUnixSocketIsUsedWithReplicas() {
+	err := ValidateService(Service{Replicas: 3, ServiceDest: []ServiceDest{{Port: "unix@/var/run/app.sock"}}})
+
+	s.Require().Error(err)
+	s.Equal([]string{"port", "replicas"}, err.(*ErrValidation).Fields)
+}
+
+// Rendering
+
+func (s *SocketTestSuite) Test_RenderFrontend_UsesHashesOfUnixSockets() {
+	sr := Service{
+		ServiceName: "my-service",
+		AclName:     "my-service",
+		PathType:    "path_beg",
+		ServiceDest: []ServiceDest{
+			{Port: "unix@/var/run/app.sock", ServicePath: []string{"/api"}},
+			{Port: "unix@/var/run/admin.sock", ServicePath: []string{"/admin"}},
+		},
+	}
+
+	actual := haProxy17Renderer{}.RenderFrontend(sr)
+
+	s.Equal(`
+    acl url_my-servicesockfd49e30f path_beg /api
+    acl url_my-servicesock9b76c293 path_beg /admin
+    use_backend my-service-besockfd49e30f if url_my-servicesockfd49e30f
+    use_backend my-service-besock9b76c293 if url_my-servicesock9b76c293`, actual)
+}
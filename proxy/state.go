@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// The time the service was updated is kept since it is not part of the JSON of the services
+type serviceStateJson struct {
+	Service   Service
+	UpdatedAt time.Time
+}
+
+type stateJson struct {
+	Certs    map[string]bool
+	Services []serviceStateJson
+}
+
+// Returns the path of the file the services and certificates are stored in so that they survive restarts.
+// It is empty if the proxy does not have a configs path.
+func (m HaProxy) getStatePath() string {
+	if len(m.ConfigsPath) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s/state.json", m.ConfigsPath)
+}
+
+// LoadState restores the services and certificates stored before the proxy stopped and generates the configuration with them.
+// A missing or corrupt state file does not prevent the proxy from starting without services.
+func (m HaProxy) LoadState() error {
+	path := m.getStatePath()
+	if len(path) == 0 {
+		return nil
+	}
+	content, err := ReadFile(path)
+	if os.IsNotExist(err) {
+		logPrintf("The state %s does not exist. Starting without services.", path)
+		return nil
+	} else if err != nil {
+		logPrintf("WARNING: Could not read the state %s. Starting without services.\n%s", path, err.Error())
+		return nil
+	}
+	state := stateJson{}
+	if err := json.Unmarshal(content, &state); err != nil {
+		logPrintf("WARNING: The state %s is corrupt. Starting without services.\n%s", path, err.Error())
+		return nil
+	}
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	if data.Certs == nil {
+		data.Certs = map[string]bool{}
+	}
+	for cert := range state.Certs {
+		data.Certs[cert] = true
+	}
+	data.Services = map[string]Service{}
+	for _, s := range state.Services {
+		s.Service.UpdatedAt = s.UpdatedAt
+		data.Services[s.Service.ServiceName] = s.Service
+	}
+	logPrintf("Restored %d services and %d certificates from %s", len(state.Services), len(state.Certs), path)
+	if len(data.Services) == 0 {
+		return nil
+	}
+	return m.createConfigFromTemplates()
+}
+
+// Writes the services and certificates to the state file. Must be called with dataMu held.
+// The file is replaced only once it is written completely so that a crash does not leave it corrupt.
+func (m HaProxy) writeState() {
+	path := m.getStatePath()
+	if len(path) == 0 {
+		return
+	}
+	state := stateJson{Certs: data.Certs, Services: []serviceStateJson{}}
+	names := []string{}
+	for name := range data.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := data.Services[name]
+		state.Services = append(state.Services, serviceStateJson{Service: s, UpdatedAt: s.UpdatedAt})
+	}
+	content, _ := json.Marshal(state)
+	tmpPath := path + ".tmp"
+	if err := writeFile(tmpPath, content, 0600); err != nil {
+		logPrintf("Could not store the state in %s\n%s", tmpPath, err.Error())
+		return
+	}
+	if err := renameFile(tmpPath, path); err != nil {
+		logPrintf("Could not store the state in %s\n%s", path, err.Error())
+	}
+}
@@ -0,0 +1,142 @@
+// +build !integration
+
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type StateTestSuite struct {
+	suite.Suite
+	Path     string
+	dataOrig Data
+}
+
+func TestStateUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(StateTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *StateTestSuite) SetupTest() {
+	s.Path, _ = ioutil.TempDir("", "state")
+	ioutil.WriteFile(s.Path+"/haproxy.tmpl", []byte("frontend services{{.ContentFrontend}}"), 0644)
+	s.dataOrig = data
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{}}
+	validateConfig = func(content string) error { return nil }
+	cmdRunHa = func(cmd *exec.Cmd) error { return nil }
+	writeFile = ioutil.WriteFile
+	renameFile = os.Rename
+	ReadFile = ioutil.ReadFile
+	readConfigsDir = ioutil.ReadDir
+	readConfigsFile = ioutil.ReadFile
+}
+
+func (s *StateTestSuite) TearDownTest() {
+	os.RemoveAll(s.Path)
+	data = s.dataOrig
+	validateConfig = validateConfigOrig
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return cmd.Run()
+	}
+}
+
+// LoadState
+
+func (s *StateTestSuite) Test_LoadState_RestoresStoredServicesAndCerts() {
+	updatedAt := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	services := []Service{
+		{
+			ServiceName:   "api",
+			ServiceDomain: []string{"api.example.com", "api.example.org"},
+			ServiceDest: []ServiceDest{
+				{Port: "8080", ServicePath: []string{"/v1", "/v2"}},
+				{Port: "8443", ServicePath: []string{"/admin"}, HttpMethods: []string{"GET"}},
+			},
+		},
+		{
+			ServiceName:     "web",
+			ServiceDest:     []ServiceDest{{Port: "80", ServicePath: []string{"/"}}},
+			ResponseCodeMap: map[int]int{599: 502},
+		},
+	}
+	p := HaProxy{TemplatesPath: s.Path, ConfigsPath: s.Path}
+	for _, sr := range services {
+		s.Require().NoError(p.AddService(sr))
+	}
+	s.Require().NoError(p.AddCert("example.com.pem"))
+	sr := data.Services["web"]
+	sr.UpdatedAt = updatedAt
+	data.Services["web"] = sr
+	p.writeState()
+	expected := p.GetServices()
+
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{}}
+	err := p.LoadState()
+
+	s.NoError(err)
+	s.Equal(expected, p.GetServices())
+	s.Equal(updatedAt, data.Services["web"].UpdatedAt)
+	s.Equal(map[string]bool{"example.com.pem": true}, data.Certs)
+	config, _ := ioutil.ReadFile(s.Path + "/haproxy.cfg")
+	s.Contains(string(config), "acl url_api8080")
+	s.Contains(string(config), "acl url_web80")
+}
+
+func (s *StateTestSuite) Test_LoadState_RestoresRemovalOfServices() {
+	p := HaProxy{TemplatesPath: s.Path, ConfigsPath: s.Path}
+	s.Require().NoError(p.AddService(Service{ServiceName: "api", ServiceDest: []ServiceDest{{Port: "8080"}}}))
+	s.Require().NoError(p.AddService(Service{ServiceName: "web", ServiceDest: []ServiceDest{{Port: "80"}}}))
+	s.Require().NoError(p.RemoveService("api"))
+
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{}}
+	s.NoError(p.LoadState())
+
+	s.Len(data.Services, 1)
+	s.Contains(data.Services, "web")
+}
+
+func (s *StateTestSuite) Test_LoadState_StartsWithoutServices_WhenStateDoesNotExist() {
+	p := HaProxy{TemplatesPath: s.Path, ConfigsPath: s.Path}
+
+	s.NoError(p.LoadState())
+	s.Empty(data.Services)
+}
+
+func (s *StateTestSuite) Test_LoadState_StartsWithoutServices_WhenStateIsCorrupt() {
+	ioutil.WriteFile(s.Path+"/state.json", []byte(`{"Services": [{"Service": {"ServiceName": "api"`), 0600)
+	logged := ""
+	logPrintf = func(format string, v ...interface{}) { logged = format }
+	defer func() { logPrintf = func(format string, v ...interface{}) {} }()
+	p := HaProxy{TemplatesPath: s.Path, ConfigsPath: s.Path}
+
+	s.NoError(p.LoadState())
+	s.Empty(data.Services)
+	s.Contains(logged, "corrupt")
+}
+
+// writeState
+
+func (s *StateTestSuite) Test_WriteState_KeepsPreviousState_WhenWriteFails() {
+	p := HaProxy{TemplatesPath: s.Path, ConfigsPath: s.Path}
+	s.Require().NoError(p.AddService(Service{ServiceName: "api", ServiceDest: []ServiceDest{{Port: "8080"}}}))
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		if filename == s.Path+"/state.json.tmp" {
+			return os.ErrPermission
+		}
+		return ioutil.WriteFile(filename, data, perm)
+	}
+	s.Require().NoError(p.AddService(Service{ServiceName: "web", ServiceDest: []ServiceDest{{Port: "80"}}}))
+
+	data = Data{Certs: map[string]bool{}, Services: map[string]Service{}}
+	s.NoError(p.LoadState())
+
+	s.Len(data.Services, 1)
+	s.Contains(data.Services, "api")
+}
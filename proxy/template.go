@@ -1 +1,27 @@
 package proxy
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// TemplateFuncs are the functions available to the templates used for generating the proxy configuration
+var TemplateFuncs = template.FuncMap{
+	"quote":     QuoteValue,
+	"directive": SanitizeDirective,
+	"bind": func(port interface{}) string {
+		return getBindLines(fmt.Sprint(port), "")
+	},
+	"backendName": GetBackendName,
+}
+
+// QuoteValue converts a value into a single HAProxy configuration argument.
+// The value is wrapped in double quotes with embedded quotes and backslashes escaped.
+// Since HAProxy expands environment variables inside double quotes, dollar signs are placed inside single quotes.
+func QuoteValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	value = strings.Replace(value, `$`, `"'$'"`, -1)
+	return `"` + value + `"`
+}
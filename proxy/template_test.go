@@ -0,0 +1,37 @@
+// +build !integration
+
+package proxy
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type TemplateTestSuite struct {
+	suite.Suite
+}
+
+func TestTemplateUnitTestSuite(t *testing.T) {
+	s := new(TemplateTestSuite)
+	suite.Run(t, s)
+}
+
+// QuoteValue
+
+func (s *TemplateTestSuite) Test_QuoteValue_WrapsValueInDoubleQuotes() {
+	s.Equal(`"my-value"`, QuoteValue("my-value"))
+	s.Equal(`""`, QuoteValue(""))
+	s.Equal(`"  leading spaces"`, QuoteValue("  leading spaces"))
+	s.Equal(`"not # a comment"`, QuoteValue("not # a comment"))
+}
+
+func (s *TemplateTestSuite) Test_QuoteValue_EscapesQuotesAndBackslashes() {
+	s.Equal(`"say \"hi\""`, QuoteValue(`say "hi"`))
+	s.Equal(`"C:\\path\\"`, QuoteValue(`C:\path\`))
+	s.Equal(`"'single'"`, QuoteValue(`'single'`))
+}
+
+func (s *TemplateTestSuite) Test_QuoteValue_PreventsEnvironmentVariableExpansion() {
+	s.Equal(`"cost: "'$'"HOME"`, QuoteValue(`cost: $HOME`))
+	s.Equal(`"/api"'$'""`, QuoteValue(`/api$`))
+}
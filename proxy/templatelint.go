@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// TemplateLintWarning describes a part of the base template the proxy depends on that is missing or misconfigured
+type TemplateLintWarning struct {
+	// The name of the rule that produced the warning (e.g. pidfile)
+	Rule    string
+	Message string
+}
+
+// A check of the content of the base template. It returns the messages of the issues it found.
+type templateLintRule struct {
+	Name  string
+	Check func(content string) []string
+}
+
+// The rules applied to the base template in this order. New checks are added by registering their functions.
+var templateLintRules = []templateLintRule{
+	{"pidfile", lintPidFile},
+	{"services-frontend", lintServicesFrontend},
+	{"default-binds", lintDefaultBinds},
+	{"errorfiles", lintErrorFiles},
+	{"duplicate-sections", lintDuplicateSections},
+}
+
+var templateLint = struct {
+	sync.Mutex
+	warnings []TemplateLintWarning
+}{}
+
+var templateSectionRegexp = regexp.MustCompile(`^(global|defaults|frontend|backend|listen|userlist|resolvers|peers|cache|program|mailers)(\s+(\S+))?`)
+
+// LintTemplate checks the base template (haproxy.tmpl) in the templates path and records the warnings.
+// The warnings are logged. If STRICT_TEMPLATE is true, an error is returned instead.
+func LintTemplate(templatesPath string) error {
+	path := fmt.Sprintf("%s/haproxy.tmpl", templatesPath)
+	content, err := readConfigsFile(path)
+	if err != nil {
+		logPrintf("WARNING: Could not lint the template %s\n%s", path, err.Error())
+		return nil
+	}
+	warnings := lintTemplateContent(string(content))
+	templateLint.Lock()
+	templateLint.warnings = warnings
+	templateLint.Unlock()
+	if len(warnings) == 0 {
+		return nil
+	}
+	messages := []string{}
+	for _, warning := range warnings {
+		messages = append(messages, fmt.Sprintf("%s: %s", warning.Rule, warning.Message))
+	}
+	if strings.EqualFold(os.Getenv("STRICT_TEMPLATE"), "true") {
+		return fmt.Errorf("The template %s has the following issues:\n%s", path, strings.Join(messages, "\n"))
+	}
+	for _, message := range messages {
+		logPrintf("WARNING: The template %s might not work as expected (%s)", path, message)
+	}
+	return nil
+}
+
+// GetTemplateLintWarnings returns the warnings of the last lint of the base template
+func GetTemplateLintWarnings() []TemplateLintWarning {
+	templateLint.Lock()
+	defer templateLint.Unlock()
+	return append([]TemplateLintWarning{}, templateLint.warnings...)
+}
+
+func lintTemplateContent(content string) []TemplateLintWarning {
+	warnings := []TemplateLintWarning{}
+	for _, rule := range templateLintRules {
+		for _, message := range rule.Check(content) {
+			warnings = append(warnings, TemplateLintWarning{Rule: rule.Name, Message: message})
+		}
+	}
+	return warnings
+}
+
+// The proxy reads the PID of HAProxy from the pidfile when it reloads
+func lintPidFile(content string) []string {
+	matches := regexp.MustCompile(`(?m)^\s*pidfile\s+(\S+)`).FindStringSubmatch(content)
+	if matches == nil {
+		return []string{fmt.Sprintf("The pidfile directive is missing. The proxy reads the PID of HAProxy from %s when it reloads.", pidFilePath)}
+	}
+	if matches[1] != pidFilePath {
+		return []string{fmt.Sprintf("The pidfile %s does not match %s the proxy reads the PID of HAProxy from.", matches[1], pidFilePath)}
+	}
+	return nil
+}
+
+// The rules of the services are rendered into the services frontend
+func lintServicesFrontend(content string) []string {
+	messages := []string{}
+	if _, ok := getTemplateSections(content)["frontend services"]; !ok {
+		messages = append(messages, "The frontend services section is missing.")
+	}
+	if !strings.Contains(content, "{{.ContentFrontend}}") {
+		messages = append(messages, "The {{.ContentFrontend}} placeholder is missing. The rules of the services are not rendered.")
+	}
+	return messages
+}
+
+// The services frontend must listen on the default ports either through the BindServices placeholder or its own bind lines
+func lintDefaultBinds(content string) []string {
+	section, ok := getTemplateSections(content)["frontend services"]
+	if !ok || strings.Contains(section, "{{.BindServices}}") {
+		return nil
+	}
+	messages := []string{}
+	for _, port := range []string{"80", "443"} {
+		if !regexp.MustCompile(`(?m)^\s*bind\s+\S*:` + port + `(\s|$)`).MatchString(section) {
+			messages = append(messages, fmt.Sprintf("The frontend services section does not bind the port %s.", port))
+		}
+	}
+	return messages
+}
+
+// Services with the json error response format replace the errorfiles of the defaults section
+func lintErrorFiles(content string) []string {
+	messages := []string{}
+	for _, code := range errorFileCodes {
+		if !regexp.MustCompile(fmt.Sprintf(`(?m)^\s*errorfile\s+%d\s`, code)).MatchString(content) {
+			messages = append(messages, fmt.Sprintf("The errorfile of the status %d is missing. HAProxy responds with its built-in page.", code))
+		}
+	}
+	return messages
+}
+
+// Named sections (e.g. frontend services) must be unique
+func lintDuplicateSections(content string) []string {
+	messages := []string{}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(content, "\n") {
+		matches := templateSectionRegexp.FindStringSubmatch(line)
+		if matches == nil || len(getTemplateSectionName(matches[3])) == 0 {
+			continue
+		}
+		header := matches[1] + " " + getTemplateSectionName(matches[3])
+		if seen[header] {
+			messages = append(messages, fmt.Sprintf("The %s section is defined more than once.", header))
+		}
+		seen[header] = true
+	}
+	return messages
+}
+
+// Returns the content of the sections of the template, including their header lines, keyed by their headers (e.g. frontend services)
+func getTemplateSections(content string) map[string]string {
+	sections := map[string]string{}
+	header := ""
+	for _, line := range strings.Split(content, "\n") {
+		if matches := templateSectionRegexp.FindStringSubmatch(line); matches != nil {
+			header = strings.TrimSpace(matches[1] + " " + getTemplateSectionName(matches[3]))
+		}
+		if len(header) > 0 {
+			sections[header] += line + "\n"
+		}
+	}
+	return sections
+}
+
+// Placeholders can follow the name in the header (e.g. frontend services{{.BindServices}})
+func getTemplateSectionName(name string) string {
+	return strings.SplitN(name, "{{", 2)[0]
+}
@@ -0,0 +1,134 @@
+// +build !integration
+
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TemplateLintTestSuite struct {
+	suite.Suite
+	Template string
+}
+
+func TestTemplateLintUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(TemplateLintTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *TemplateLintTestSuite) SetupTest() {
+	content, _ := ioutil.ReadFile("../haproxy.tmpl")
+	s.Template = string(content)
+	readConfigsFile = ioutil.ReadFile
+}
+
+func (s *TemplateLintTestSuite) TearDownTest() {
+	os.Unsetenv("STRICT_TEMPLATE")
+	templateLint.warnings = nil
+}
+
+// lintPidFile
+
+func (s *TemplateLintTestSuite) Test_LintPidFile_ReturnsNothing_WhenPidFileMatches() {
+	s.Empty(lintPidFile(s.Template))
+}
+
+func (s *TemplateLintTestSuite) Test_LintPidFile_ReturnsMessage_WhenPidFileIsMissingOrDifferent() {
+	s.Len(lintPidFile(strings.Replace(s.Template, "    pidfile /var/run/haproxy.pid\n", "", 1)), 1)
+	s.Len(lintPidFile(strings.Replace(s.Template, "/var/run/haproxy.pid", "/run/haproxy.pid", 1)), 1)
+}
+
+// lintServicesFrontend
+
+func (s *TemplateLintTestSuite) Test_LintServicesFrontend_ReturnsNothing_WhenSectionAndPlaceholderExist() {
+	s.Empty(lintServicesFrontend(s.Template))
+}
+
+func (s *TemplateLintTestSuite) Test_LintServicesFrontend_ReturnsMessages_WhenSectionOrPlaceholderIsMissing() {
+	s.Len(lintServicesFrontend(strings.Replace(s.Template, "frontend services", "frontend my-services", 1)), 1)
+	s.Len(lintServicesFrontend(strings.Replace(s.Template, "{{.ContentFrontend}}", "", 1)), 1)
+}
+
+// lintDefaultBinds
+
+func (s *TemplateLintTestSuite) Test_LintDefaultBinds_ReturnsNothing_WhenBindsAreRendered() {
+	s.Empty(lintDefaultBinds(s.Template))
+	s.Empty(lintDefaultBinds("frontend services\n    bind *:80\n    bind *:443 ssl crt /certs\n"))
+}
+
+func (s *TemplateLintTestSuite) Test_LintDefaultBinds_ReturnsMessage_ForEachMissingPort() {
+	s.Equal(
+		[]string{"The frontend services section does not bind the port 443."},
+		lintDefaultBinds("frontend services\n    bind *:80\n    bind *:4433\n\nbackend other\n    bind *:443\n"),
+	)
+	s.Len(lintDefaultBinds("frontend services\n    mode http\n"), 2)
+}
+
+// lintErrorFiles
+
+func (s *TemplateLintTestSuite) Test_LintErrorFiles_ReturnsMessage_ForEachMissingErrorFile() {
+	s.Empty(lintErrorFiles(s.Template))
+
+	actual := lintErrorFiles(strings.Replace(s.Template, "    errorfile 503 /errorfiles/503.http\n", "", 1))
+
+	s.Equal([]string{"The errorfile of the status 503 is missing. HAProxy responds with its built-in page."}, actual)
+}
+
+// lintDuplicateSections
+
+func (s *TemplateLintTestSuite) Test_LintDuplicateSections_ReturnsMessage_WhenNamedSectionIsDuplicated() {
+	s.Empty(lintDuplicateSections(s.Template))
+
+	actual := lintDuplicateSections(s.Template + "\nfrontend services\n    bind *:8080\ndefaults\n    mode http\n")
+
+	s.Equal([]string{"The frontend services section is defined more than once."}, actual)
+}
+
+// LintTemplate
+
+func (s *TemplateLintTestSuite) Test_LintTemplate_RecordsNothing_ForDefaultTemplate() {
+	s.NoError(LintTemplate(".."))
+
+	s.Empty(GetTemplateLintWarnings())
+}
+
+func (s *TemplateLintTestSuite) Test_LintTemplate_RecordsWarnings() {
+	readConfigsFile = func(filename string) ([]byte, error) {
+		return []byte(strings.Replace(s.Template, "pidfile /var/run/haproxy.pid", "", 1)), nil
+	}
+
+	s.NoError(LintTemplate("/cfg/tmpl"))
+
+	actual := GetTemplateLintWarnings()
+	s.Len(actual, 1)
+	s.Equal("pidfile", actual[0].Rule)
+	s.Equal(actual, HaProxy{}.getConfigData(map[string]bool{}).TemplateLintWarnings)
+}
+
+func (s *TemplateLintTestSuite) Test_LintTemplate_ReturnsError_WhenStrictTemplateIsTrue() {
+	os.Setenv("STRICT_TEMPLATE", "true")
+	readConfigsFile = func(filename string) ([]byte, error) {
+		return []byte("global\n    maxconn 100\n"), nil
+	}
+
+	err := LintTemplate("/cfg/tmpl")
+
+	s.Error(err)
+	s.Contains(err.Error(), "pidfile: ")
+	s.Contains(err.Error(), "services-frontend: ")
+}
+
+func (s *TemplateLintTestSuite) Test_LintTemplate_ReturnsNil_WhenTemplateCannotBeRead() {
+	os.Setenv("STRICT_TEMPLATE", "true")
+	readConfigsFile = func(filename string) ([]byte, error) {
+		return nil, os.ErrNotExist
+	}
+
+	s.NoError(LintTemplate("/cfg/tmpl"))
+}
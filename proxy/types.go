@@ -1,84 +1,264 @@
 package proxy
 
+import "time"
+
 type ServiceDest struct {
+	// The networks (CIDRs or IPs) the requests to the destination are accepted from (e.g. 10.0.0.0/8,192.168.1.0/24).
+	// Requests from other addresses are rejected with the status 403. If not specified, requests from any address are accepted.
+	AllowedSourceNetworks []string `param:"allowedSourceNetworks"`
+	// The duration after an update of the service during which failed connections to the server are retried
+	// and redispatched (e.g. 30s). Useful during rolling updates when the address of the server briefly points to stopped tasks.
+	DeploymentGrace string `param:"deploymentGrace"`
+	// The HTTP methods the destination accepts (e.g. GET,POST).
+	// If not specified, requests with any method are forwarded to the destination.
+	HttpMethods 	[]string `param:"httpMethods"`
 	// The internal port of a service that should be reconfigured.
 	// The port is used only in the *swarm* mode.
-	Port 			string
+	// A unix domain socket of a sidecar can be specified instead with the unix@ prefix (e.g. unix@/var/run/app.sock).
+	Port 			string `param:"port"`
+	// Whether the destination receives the connections that do not match the sniDomain of the other destinations
+	// with the same source port. Used only with the *tcp* request mode.
+	IsDefault 		bool `param:"isDefault"`
+	// The hostname the requests to the destination are sent to (e.g. a host outside of the swarm).
+	// If not specified, the outboundHostname of the service or, if that is not set either, the service name is used.
+	// The service name is still used for the names of ACLs and backends.
+	OutboundHostname 	string `param:"outboundHostname"`
+	// The ACL derivative used for the paths of the destination (e.g. path_reg).
+	// If not specified, the pathType of the service is used instead.
+	PathType 		string `param:"pathType"`
 	// The URL path of the service.
-	ServicePath 	[]string
+	ServicePath 	[]string `param:"servicePath"`
 	// The source (entry) port of a service.
 	// Useful only when specifying multiple destinations of a single service.
-	SrcPort        	int
+	SrcPort        	int `param:"srcPort,min=1,max=65535"`
+	// The server names (SNI) of the TLS connections routed to the destination when multiple destinations
+	// share the same source port. Used only with the *tcp* request mode.
+	SniDomain 		[]string `param:"sniDomain"`
+	// The range of source (entry) ports of a service (e.g. 10000-10100).
+	// Useful only with the *tcp* request mode when a service exposes many ports.
+	// Requests are forwarded to the same port of the service they arrived at.
+	SrcPortRange   	string `param:"srcPortRange"`
+	// Whether to skip logging of connections to the destination.
+	// Useful for chatty ports (e.g. health-checked ones). Used only with the *tcp* request mode.
+	SkipLogging    	bool `param:"skipLogging"`
 	SrcPortAcl     	string
 	SrcPortAclName 	string
+	// The name of the ACL that matches the paths of the destination and whether it is shared with a preceding destination
+	UrlAclName   	string
+	UrlAclShared 	bool
+	// The backend and server options rendered while the destination is in its deployment grace period
+	DeploymentGraceBackend 	string
+	DeploymentGraceServer 	string
+	// The parameters of the destination set from SERVICE_DEFAULTS_FILE instead of the request
+	Defaulted 				[]string `json:",omitempty"`
 }
 
 type Service struct {
 	// ACLs are ordered alphabetically by their names.
 	// If not specified, serviceName is used instead.
-	AclName 				string
+	AclName 				string `param:"aclName"`
+	// The evaluation order of the ACLs and use_backend rules of the service.
+	// Services with higher values are evaluated first. Services with the same priority are ordered by their ACL names.
+	AclPriority 			int `param:"aclPriority,min=0"`
+	// The first label of certificate domains that belong to the service.
+	// Used only when AUTO_DOMAIN_FROM_CERT is set to true. If not specified, serviceName is used instead.
+	CertDomainAlias 		string `param:"certDomainAlias"`
+	// The paths whose responses are never compressed (e.g. /events for server-sent events).
+	// Compression is disabled for all the paths of websocket services.
+	CompressionExcludePaths []string `param:"compressionExcludePaths"`
+	// The size of the smallest response that is compressed (e.g. 1k). Smaller responses with a known length are not compressed.
+	CompressionMinSize 		string `param:"compressionMinSize"`
 	// The path to the Consul Template representing a snippet of the backend configuration.
 	// If set, proxy template will be loaded from the specified file.
-	ConsulTemplateFePath 	string
+	ConsulTemplateFePath 	string `param:"consulTemplateFePath"`
 	// The path to the Consul Template representing a snippet of the frontend configuration.
 	// If specified, proxy template will be loaded from the specified file.
-	ConsulTemplateBePath 	string
+	ConsulTemplateBePath 	string `param:"consulTemplateBePath"`
+	// Additional directives rendered at the end of the backends of the service (e.g. `http-send-name-header X-Server`).
+	// Only the directives listed in EXTRA_DIRECTIVE_ALLOWLIST are accepted.
+	BackendExtra 			[]string `param:"backendExtra"`
+	// The load balancing algorithm of the backends of the service (e.g. leastconn, source, uri, hdr(host)).
+	// If not specified, roundrobin defined in the defaults section is used.
+	BalanceMode 			string `param:"balanceMode"`
+	// Whether to wait for the request body before the request is forwarded to the servers (option http-buffer-request).
+	// Useful when the body is inspected (e.g. by a Lua script). Should not be used by services receiving large uploads.
+	BufferRequest 			bool `param:"bufferRequest"`
+	// The interval between the HTTP health checks of the servers (e.g. 5s or 500ms).
+	// Used only when CheckPath is set. If not specified, the HAProxy default (2s) is used.
+	CheckInterval 			string `param:"checkInterval"`
+	// The method of the HTTP health check requests. Used only when CheckPath is set. Defaults to GET.
+	CheckMethod 			string `param:"checkMethod"`
+	// The path the HTTP health check requests are sent to (e.g. /health).
+	// If not specified, the servers are not checked.
+	CheckPath 				string `param:"checkPath"`
+	// Whether to check the servers listening on unix domain sockets (see the port parameter).
+	// They are not checked by default.
+	CheckSocket 			bool `param:"checkSocket"`
 	// Whether to distribute a request to all the instances of the proxy.
 	// Used only in the swarm mode.
-	Distribute 				bool
+	Distribute 				bool `param:"distribute"`
+	// The options applied to all the servers of the service (e.g. `inter 2s fall 3 rise 2`).
+	// If not specified, the value of the DEFAULT_SERVER_OPTIONS environment variable is used instead.
+	DefaultServerOptions 	string `param:"defaultServerOptions"`
+	// Additional directives rendered in the frontend after the rules of the service.
+	// Directives that accept conditions (e.g. http-request) are limited to the service ACLs unless they have their own condition.
+	FrontendExtra 			[]string `param:"frontendExtra"`
+	// The Lua action (registered by a script in LUA_SCRIPTS_PATH) run on the requests of the service.
+	// It is rendered as `http-request lua.<action>` limited to the service ACLs.
+	LuaAction 				string `param:"luaAction"`
+	// The format of the error pages returned by the backends of the service (json or html).
+	// The json error files are generated when the proxy starts. Defaults to html.
+	ErrorResponseFormat 	string `param:"errorResponseFormat"`
+	// Whether to take over the domain and path combinations already used by other services.
+	// Conflicting destinations are removed from the services that used them.
+	Force 					bool `param:"force"`
 	// The internal HTTPS port of a service that should be reconfigured.
 	// The port is used only in the swarm mode.
 	// If not specified, the `port` parameter will be used instead.
-	HttpsPort 				int
+	HttpsPort 				int `param:"httpsPort,min=1,max=65535"`
+	// The maximum size of request bodies in bytes. Requests with a larger Content-Length are denied with the status 413.
+	MaxBodySize 			int `param:"maxBodySize,min=0"`
+	// The namespace the service belongs to (e.g. the name of the Swarm stack).
+	// If not specified, it is the prefix of the service name before the first underscore (e.g. mystack in mystack_api).
+	Namespace 				string `param:"namespace"`
 	// The request mode. The proxy should be able to work with any mode supported by HAProxy. However, actively supported and tested modes are *http* and *tcp*. Please open an GitHub issue if the mode you're using does not work as expected. The default value is *http*.
-	ReqMode 				string
+	ReqMode 				string `param:"reqMode,default=http"`
+	// The format of the logs of connections to the service (see the log-format HAProxy option).
+	// Used only with the *tcp* request mode when SYSLOG_LISTENER_ADDRESS is set. Defaults to the `option tcplog` format.
+	TcpLogFormat 			string `param:"tcpLogFormat"`
+	// The source IP address used for connections to the servers of the service.
+	// Useful on multi-homed hosts when traffic to a service must leave the proxy from a specific address.
+	SourceAddress 			string `param:"sourceAddress"`
+	// Whether to connect to the servers of the service using the IP address of the client (usesrc clientip).
+	// Requires a kernel with TPROXY support and the proxy running with the NET_ADMIN capability.
+	TransparentProxy 		bool `param:"transparentProxy"`
+	// How to normalize trailing slashes of request paths. If set to add, requests to paths without a trailing slash
+	// are redirected to the same path with it. If set to strip, the trailing slash is removed instead.
+	NormalizeTrailingSlash 	string `param:"normalizeTrailingSlash"`
+	// Whether to redirect requests to the service that are not sent over HTTPS to the same address with the https scheme.
+	RedirectWhenHttpProto 	bool `param:"redirectWhenHttpProto"`
+	// Whether to redirect requests to bare domains of the service (e.g. example.com) to their www variants over HTTPS.
+	RedirectToWww 			bool `param:"redirectToWww"`
 	// The hostname where the service is running, for instance on a separate swarm.
 	// If specified, the proxy will dispatch requests to that domain.
-	OutboundHostname 		string
+	OutboundHostname 		string `param:"outboundHostname"`
 	// The ACL derivative. Defaults to path_beg.
 	// See https://cbonte.github.io/haproxy-dconv/configuration-1.5.html#7.3.6-path for more info.
-	PathType 				string
+	PathType 				string `param:"pathType"`
+	// The position of the frontend rules of the service among the services with the same aclPriority.
+	// Services with lower values are rendered first, followed by the services without it sorted by their ACL names.
+	Priority 				int `param:"priority,min=0"`
 	// Deprecated in favor of ReqPathReplace
-	ReqRepReplace 			string
+	ReqRepReplace 			string `param:"reqRepReplace"`
 	// Deprecated in favor of ReqPathSearch
-	ReqRepSearch 			string
-	// A regular expression to apply the modification.
+	ReqRepSearch 			string `param:"reqRepSearch"`
+	// The maximum number of requests a client can send to the service within ReqRateWindow.
+	// Requests above the limit are denied with the status 429. If not specified, the requests are not limited.
+	ReqRateLimit 			int `param:"reqRateLimit,min=0"`
+	// The window in seconds the requests of a client are counted in. Used only with ReqRateLimit. Defaults to 10.
+	ReqRateWindow 			int `param:"reqRateWindow,min=0"`
+	// The maximum duration of requests to the service (e.g. 2s or 1500ms). Must be at least one second.
+	// The remaining time is sent to the servers as a Unix timestamp in the X-Request-Deadline header.
+	RequestDeadline 		string `param:"requestDeadline"`
+	// The status codes of the responses of the servers replaced by the proxy (e.g. 599:502,404:410).
+	// The codes must be between 100 and 599, and a code cannot be both replaced and a replacement.
+	ResponseCodeMap 		map[int]int `param:"responseCodeMap"`
+	// The replacements of the request paths matching the expressions in ReqPathSearch, in the same order.
 	// If specified, `reqPathSearch` needs to be set as well.
-	ReqPathReplace 			string
-	// A regular expression to search the content to be replaced.
+	ReqPathReplace 			[]string `param:"reqPathReplace"`
+	// Regular expressions to search the content of request paths to be replaced.
+	// Each expression is replaced with the value at the same position of ReqPathReplace.
 	// If specified, `reqPathReplace` needs to be set as well.
-	ReqPathSearch 			string
+	ReqPathSearch 			[]string `param:"reqPathSearch"`
+	// Whether to reverse the rewrites of ReqPathSearch and ReqPathReplace in the Location headers of the responses
+	// so that redirects of the servers point to the paths of the proxy. Enabled by default when the paths are rewritten.
+	RewriteResponseLocation *bool `param:"rewriteResponseLocation"`
 	// Content of the PEM-encoded certificate to be used by the proxy when serving traffic over SSL.
-	ServiceCert 			string
+	ServiceCert 			string `param:"serviceCert"`
 	// The domain of the service.
 	// If set, the proxy will allow access only to requests coming to that domain.
-	ServiceDomain 			[]string
+	ServiceDomain 			[]string `param:"serviceDomain"`
+	// Whether to set the X-Real-IP header of the requests to the service to the address of the client.
+	// If not specified, the value of the SET_REAL_IP environment variable is used instead.
+	SetRealIp 				*bool `param:"setRealIp"`
+	// The number of tasks of the service the proxy balances the requests between.
+	// If set, the backend gets a server for each task resolved through the tasks.<serviceName> DNS name
+	// instead of a single server pointing to the service VIP. Used only in the swarm mode.
+	Replicas 				int `param:"replicas,min=0"`
+	// Whether the server address is resolved again while the proxy is running so that the proxy follows the service
+	// when its VIP changes after a redeployment. Used only in the swarm mode.
+	Resolvers 				bool `param:"resolvers"`
+	// The name of the cookie inserted by the proxy to route the subsequent requests of a client to the same server.
+	// If not specified, sessions are not sticky. Used only with the *http* request mode.
+	SessionCookie 			string `param:"sessionCookie"`
 	// The name of the service.
 	// It must match the name of the Swarm service or the one stored in Consul.
-	ServiceName 			string
+	ServiceName 			string `param:"serviceName"`
 	// The path to the template representing a snippet of the backend configuration.
 	// If specified, the backend template will be loaded from the specified file.
 	// If specified, `templateFePath` must be set as well.
 	// See the https://github.com/vfarcic/docker-flow-proxy#templates section for more info.
-	TemplateBePath 			string
+	TemplateBePath 			string `param:"templateBePath"`
 	// The path to the template representing a snippet of the frontend configuration.
 	// If specified, the frontend template will be loaded from the specified file.
 	// If specified, `templateBePath` must be set as well.
 	// See the https://github.com/vfarcic/docker-flow-proxy#templates section for more info.
-	TemplateFePath 			string
+	TemplateFePath 			string `param:"templateFePath"`
+	// The maximum inactivity time on the client side of the connections to the service (e.g. 600s or 600).
+	// If not specified, TIMEOUT_CLIENT is used. Used only with the tcp request mode since http services share the frontend.
+	TimeoutClient 			string `param:"timeoutClient"`
+	// The maximum inactivity time on the server side of the connections to the service (e.g. 600s or 600).
+	// If not specified, TIMEOUT_SERVER is used.
+	TimeoutServer 			string `param:"timeoutServer"`
+	// The maximum inactivity time of tunnels (e.g. WebSockets) to the service.
+	// If not specified, TIMEOUT_TUNNEL is used.
+	TimeoutTunnel 			string `param:"timeoutTunnel"`
+	// Whether the service uses WebSockets.
+	// If true, the tunnel timeout is set in the backend of the service so that it applies even if the defaults are customized.
+	Websocket 			bool `param:"websocket"`
 	// Whether to skip adding proxy checks.
 	// This option is used only in the default mode.
-	SkipCheck bool
+	SkipCheck bool `param:"skipCheck"`
+	// Whether the requests to the service are excluded from the security rules enabled through SECURITY_RULES.
+	SkipSecurityRules bool `param:"skipSecurityRules"`
 	// A comma-separated list of credentials(<user>:<pass>) for HTTP basic auth, which applies only to the service that will be reconfigured.
-	Users               	[]User
-	ServiceColor        	string
+	Users               	[]User `param:"users"`
+	// Whether the passwords of the users are crypt(3) hashes (e.g. SHA-512) instead of plain text.
+	UsersPassEncrypted  	bool `param:"usersPassEncrypted"`
+	// Whether the users defined through the USERS environment variable can access the service.
+	// If the service has its own users as well, both are accepted.
+	UseGlobalUsers      	bool `param:"useGlobalUsers"`
+	// The realm shown by browsers when asking for the credentials of the service users.
+	// If not specified, `<serviceName>Realm` is used instead.
+	AuthRealm           	string `param:"authRealm"`
+	// The path to the file returned when the service users are not authenticated (401).
+	// The file must contain the full HTTP response, including headers.
+	AuthErrorFile       	string `param:"authErrorFile"`
+	ServiceColor        	string `param:"serviceColor"`
 	ServicePort         	string
 	AclCondition        	string
 	FullServiceName     	string
+	// The form of the service name used in the names of ACLs, frontends, backends, and servers
+	Identifier          	string
 	Host                	string
 	LookupRetry         	int
 	LookupRetryInterval 	int
 	ServiceDest         	[]ServiceDest
+	// Whether the service is excluded from the configuration since its snippets are invalid.
+	// Set only when QUARANTINE_BROKEN_SERVICES is true.
+	Quarantined         	bool
+	// Domains added to ServiceDomain from certificates, keyed by the certificate name
+	CertDomains         	map[string][]string
+	// The time the parameters of the service last changed
+	UpdatedAt           	time.Time `json:"-"`
+	// The number of server template slots rendered for the replicas of the service.
+	// The slots above Replicas are disabled and enabled through the runtime socket when the service scales up.
+	ReplicaSlots        	int
+	// The identity of the API caller that registers the service. It is used to enforce DOMAIN_OWNERSHIP_FILE.
+	// Empty when the service is not registered through the API (e.g. when the services are reloaded).
+	Caller              	string `json:"-"`
+	// The parameters of the service set from SERVICE_DEFAULTS_FILE instead of the request
+	Defaulted           	[]string `json:",omitempty"`
 }
 
 type User struct {
@@ -1,9 +1,14 @@
 package proxy
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
+	"os"
 	"os/exec"
+	"time"
 )
 
 var cmdRunHa = func(cmd *exec.Cmd) error {
@@ -15,3 +20,46 @@ var ReadFile = ioutil.ReadFile
 var logPrintf = log.Printf
 var readPidFile = ioutil.ReadFile
 var readConfigsDir = ioutil.ReadDir
+var timeNow = time.Now
+var renameFile = os.Rename
+var httpGet = http.Get
+var validateConfig = func(content string) error {
+	file, err := ioutil.TempFile("", "haproxy-cfg")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return err
+	}
+	file.Close()
+	if out, err := exec.Command("haproxy", "-c", "-f", file.Name()).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s\n%s", err.Error(), string(out))
+	}
+	return nil
+}
+var sendRuntimeCommand = func(socket, command string) error {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(command + "\n")); err != nil {
+		return err
+	}
+	_, err = ioutil.ReadAll(conn)
+	return err
+}
+var readRuntimeCommand = func(socket, command string) (string, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(command + "\n")); err != nil {
+		return "", err
+	}
+	out, err := ioutil.ReadAll(conn)
+	return string(out), err
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The number of attempts to restore the maximum number of connections after the warm-up
+const warmupRestoreAttempts = 5
+
+// The time between two attempts to restore the maximum number of connections
+var warmupRetryInterval = 5 * time.Second
+
+// Runs the function after the duration and returns the function that cancels it
+var afterFunc = func(d time.Duration, f func()) (stop func() bool) {
+	return time.AfterFunc(d, f).Stop
+}
+
+// The warm-up of the latest reload. Restores scheduled by previous reloads are cancelled or ignored.
+var warmup = struct {
+	sync.Mutex
+	generation int
+	stop       func() bool
+}{}
+
+// Lowers the maximum number of connections of the new process for WARMUP_DURATION seconds
+// so that it is not overwhelmed by the clients reconnecting right after a reload.
+// The limit is set to WARMUP_MAXCONN (a tenth of the configured one by default) through the runtime socket.
+func (m HaProxy) startWarmup() {
+	duration, _ := strconv.Atoi(os.Getenv("WARMUP_DURATION"))
+	if duration <= 0 {
+		return
+	}
+	if _, err := statFile(haproxySocketPath); err != nil {
+		return
+	}
+	info, err := readRuntimeCommand(haproxySocketPath, "show info")
+	if err != nil {
+		logPrintf("Could not read the maximum number of connections through the runtime socket\n%s", err.Error())
+		return
+	}
+	maxconn := getRuntimeInfoValue(info, "Maxconn")
+	if maxconn <= 0 {
+		logPrintf("Could not find the maximum number of connections in the output of the runtime socket")
+		return
+	}
+	warmupMaxconn, _ := strconv.Atoi(os.Getenv("WARMUP_MAXCONN"))
+	if warmupMaxconn <= 0 {
+		warmupMaxconn = maxconn / 10
+	}
+	if warmupMaxconn <= 0 || warmupMaxconn >= maxconn {
+		return
+	}
+	warmup.Lock()
+	defer warmup.Unlock()
+	if warmup.stop != nil {
+		warmup.stop()
+	}
+	warmup.generation++
+	generation := warmup.generation
+	warmup.stop = nil
+	if err := sendRuntimeCommand(haproxySocketPath, fmt.Sprintf("set maxconn global %d", warmupMaxconn)); err != nil {
+		logPrintf("Could not lower the maximum number of connections through the runtime socket\n%s", err.Error())
+		return
+	}
+	logPrintf("The maximum number of connections is set to %d for %d seconds", warmupMaxconn, duration)
+	warmup.stop = afterFunc(time.Duration(duration)*time.Second, func() {
+		restoreMaxconn(generation, maxconn, 1)
+	})
+}
+
+// Restores the maximum number of connections unless a newer reload started its own warm-up.
+// Failed attempts are retried every warmupRetryInterval.
+func restoreMaxconn(generation, maxconn, attempt int) {
+	warmup.Lock()
+	defer warmup.Unlock()
+	if generation != warmup.generation {
+		return
+	}
+	warmup.stop = nil
+	err := sendRuntimeCommand(haproxySocketPath, fmt.Sprintf("set maxconn global %d", maxconn))
+	if err == nil {
+		logPrintf("The maximum number of connections is restored to %d", maxconn)
+		return
+	}
+	if attempt >= warmupRestoreAttempts {
+		logPrintf("ERROR: Could not restore the maximum number of connections to %d after %d attempts\n%s", maxconn, attempt, err.Error())
+		return
+	}
+	logPrintf("Could not restore the maximum number of connections to %d. Retrying in %s\n%s", maxconn, warmupRetryInterval, err.Error())
+	warmup.stop = afterFunc(warmupRetryInterval, func() {
+		restoreMaxconn(generation, maxconn, attempt+1)
+	})
+}
+
+// Returns the numeric value of a field of the `show info` output (e.g. `Maxconn: 5000`)
+func getRuntimeInfoValue(info, name string) int {
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == name {
+			value, _ := strconv.Atoi(strings.TrimSpace(parts[1]))
+			return value
+		}
+	}
+	return 0
+}
@@ -0,0 +1,164 @@
+// +build !integration
+
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WarmupTestSuite struct {
+	suite.Suite
+	SocketPath string
+	Commands   []string
+	Timers     []func()
+	Durations  []time.Duration
+	Stopped    int
+}
+
+func TestWarmupUnitTestSuite(t *testing.T) {
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(WarmupTestSuite)
+	suite.Run(t, s)
+}
+
+var afterFuncOrig = afterFunc
+var readRuntimeCommandOrig = readRuntimeCommand
+
+func (s *WarmupTestSuite) SetupTest() {
+	os.Setenv("WARMUP_DURATION", "30")
+	os.Setenv("WARMUP_MAXCONN", "100")
+	s.Commands = []string{}
+	s.Timers = []func(){}
+	s.Durations = []time.Duration{}
+	s.Stopped = 0
+	readPidFile = func(fileName string) ([]byte, error) {
+		return []byte("123"), nil
+	}
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return nil
+	}
+	readRuntimeCommand = func(socket, command string) (string, error) {
+		return "Name: HAProxy\nMaxconn: 5000\nMaxsock: 10009\n", nil
+	}
+	sendRuntimeCommand = func(socket, command string) error {
+		s.Commands = append(s.Commands, command)
+		return nil
+	}
+	afterFunc = func(d time.Duration, f func()) func() bool {
+		s.Timers = append(s.Timers, f)
+		s.Durations = append(s.Durations, d)
+		return func() bool {
+			s.Stopped++
+			return true
+		}
+	}
+	socket, _ := ioutil.TempFile("", "haproxy-sock")
+	s.SocketPath = socket.Name()
+	haproxySocketPath = s.SocketPath
+}
+
+func (s *WarmupTestSuite) TearDownTest() {
+	os.Unsetenv("WARMUP_DURATION")
+	os.Unsetenv("WARMUP_MAXCONN")
+	os.Remove(s.SocketPath)
+	haproxySocketPath = "/var/run/haproxy.sock"
+	sendRuntimeCommand = sendRuntimeCommandOrig
+	readRuntimeCommand = readRuntimeCommandOrig
+	afterFunc = afterFuncOrig
+	cmdRunHa = func(cmd *exec.Cmd) error {
+		return cmd.Run()
+	}
+}
+
+// Reload
+
+func (s *WarmupTestSuite) Test_Reload_LowersMaxconnAndRestoresItAfterWarmupDuration() {
+	err := HaProxy{}.Reload()
+
+	s.NoError(err)
+	s.Equal([]string{"set maxconn global 100"}, s.Commands)
+	s.Equal([]time.Duration{30 * time.Second}, s.Durations)
+
+	s.Timers[0]()
+
+	s.Equal([]string{"set maxconn global 100", "set maxconn global 5000"}, s.Commands)
+}
+
+func (s *WarmupTestSuite) Test_Reload_UsesTenthOfMaxconn_WhenWarmupMaxconnIsNotSet() {
+	os.Unsetenv("WARMUP_MAXCONN")
+
+	HaProxy{}.Reload()
+
+	s.Equal([]string{"set maxconn global 500"}, s.Commands)
+}
+
+func (s *WarmupTestSuite) Test_Reload_DoesNotWarmUp_WhenWarmupDurationIsNotSet() {
+	os.Unsetenv("WARMUP_DURATION")
+
+	HaProxy{}.Reload()
+
+	s.Empty(s.Commands)
+	s.Empty(s.Timers)
+}
+
+func (s *WarmupTestSuite) Test_Reload_DoesNotWarmUp_WhenSocketDoesNotExist() {
+	os.Remove(s.SocketPath)
+
+	HaProxy{}.Reload()
+
+	s.Empty(s.Commands)
+}
+
+func (s *WarmupTestSuite) Test_Reload_RestoresMaxconnOnlyOnce_WhenReloadsOverlap() {
+	HaProxy{}.Reload()
+	HaProxy{}.Reload()
+
+	s.Equal(1, s.Stopped)
+	s.Timers[0]()
+	s.Equal([]string{"set maxconn global 100", "set maxconn global 100"}, s.Commands)
+
+	s.Timers[1]()
+	s.Equal([]string{"set maxconn global 100", "set maxconn global 100", "set maxconn global 5000"}, s.Commands)
+}
+
+func (s *WarmupTestSuite) Test_Reload_RetriesRestore_WhenItFails() {
+	failures := 2
+	HaProxy{}.Reload()
+	sendRuntimeCommand = func(socket, command string) error {
+		s.Commands = append(s.Commands, command)
+		if failures > 0 {
+			failures--
+			return fmt.Errorf("This is an error")
+		}
+		return nil
+	}
+
+	s.Timers[0]()
+	s.Timers[1]()
+	s.Timers[2]()
+
+	s.Len(s.Timers, 3)
+	s.Equal(warmupRetryInterval, s.Durations[1])
+	s.Equal([]string{"set maxconn global 100", "set maxconn global 5000", "set maxconn global 5000", "set maxconn global 5000"}, s.Commands)
+}
+
+func (s *WarmupTestSuite) Test_Reload_StopsRetryingRestore_AfterTheLastAttempt() {
+	HaProxy{}.Reload()
+	sendRuntimeCommand = func(socket, command string) error {
+		s.Commands = append(s.Commands, command)
+		return fmt.Errorf("This is an error")
+	}
+
+	for i := 0; i < len(s.Timers); i++ {
+		s.Timers[i]()
+	}
+
+	s.Len(s.Timers, warmupRestoreAttempts)
+}
@@ -1,6 +1,7 @@
 package registry
 
 import (
+	"../proxy"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -33,8 +34,8 @@ func (m Consul) PutService(addresses []string, instanceName string, r Registry)
 	type data struct{ key, value string }
 	d := []data{
 		data{COLOR_KEY, r.ServiceColor},
-		data{PATH_KEY, strings.Join(r.ServicePath, ",")},
-		data{DOMAIN_KEY, strings.Join(r.ServiceDomain, ",")},
+		data{PATH_KEY, proxy.JoinEscaped(r.ServicePath)},
+		data{DOMAIN_KEY, proxy.JoinEscaped(r.ServiceDomain)},
 		data{HOSTNAME_KEY, r.OutboundHostname},
 		data{PATH_TYPE_KEY, r.PathType},
 		data{SKIP_CHECK_KEY, fmt.Sprintf("%t", r.SkipCheck)},
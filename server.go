@@ -2,11 +2,18 @@ package main
 
 import (
 	"./actions"
+	"./metrics"
 	"./proxy"
 	"./server"
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"strconv"
 	"strings"
@@ -39,20 +46,71 @@ var cert server.Certer = server.NewCert("/certs")
 var reload actions.Reloader = actions.NewReload()
 
 func (m *Serve) Execute(args []string) error {
+	if err := checkEnvVars(); err != nil {
+		return err
+	}
+	if err := proxy.ValidateBindAddresses(); err != nil {
+		return err
+	}
+	if err := proxy.ValidateLuaScripts(); err != nil {
+		return err
+	}
+	if err := proxyLintTemplate(m.TemplatesPath); err != nil {
+		return err
+	}
 	// TODO: Change map[string]bool{} env vars
 	if proxy.Instance == nil {
 		proxy.Instance = proxy.NewHaProxy(m.TemplatesPath, m.ConfigsPath, map[string]bool{})
 	}
+	// The services stored before the restart are routed as soon as HAProxy starts
+	if err := proxy.Instance.LoadState(); err != nil {
+		logPrintf("WARNING: Could not generate the configuration with the restored services\n%s", err.Error())
+	}
+	// Pending changes are recovered before the first reload discards them
+	if err := proxyLoadPendingChanges(); err != nil {
+		logPrintf("WARNING: Could not recover the pending changes\n%s", err.Error())
+	}
 	logPrintf("Starting HAProxy")
+	proxy.RecordServiceChanges()
 	m.setConsulAddresses()
+	if len(os.Getenv("BLOCKLIST_URL")) > 0 {
+		if err := proxyStartBlocklistRefresher(); err != nil {
+			return err
+		}
+	}
+	if len(os.Getenv("DOMAIN_OWNERSHIP_FILE")) > 0 {
+		if err := proxyStartDomainOwnership(); err != nil {
+			return err
+		}
+	}
+	if len(os.Getenv("SERVICE_DEFAULTS_FILE")) > 0 {
+		if err := proxyStartServiceDefaults(); err != nil {
+			return err
+		}
+	}
+	if err := proxyGenerateErrorFiles(); err != nil {
+		logPrintf("WARNING: Could not generate the json error files. Services with the json error response format will be rejected.\n%s", err.Error())
+	}
 	NewRun().Execute([]string{})
-	address := fmt.Sprintf("%s:%s", m.IP, m.Port)
 	recon := actions.NewReconfigure(m.BaseReconfigure, proxy.Service{}, m.Mode)
 	lAddr := ""
 	if len(m.ListenerAddress) > 0 {
 		lAddr = fmt.Sprintf("http://%s:8080", m.ListenerAddress)
 	}
 	cert.Init()
+	if strings.EqualFold(os.Getenv("SYNC_FROM_PEERS"), "true") {
+		m.syncFromPeers()
+	}
+	if len(os.Getenv("SYSLOG_LISTENER_ADDRESS")) > 0 {
+		if _, err := metricsListenSyslog(os.Getenv("SYSLOG_LISTENER_ADDRESS")); err != nil {
+			return err
+		}
+	}
+	if len(os.Getenv("HEALTH_NOTIFY_URLS")) > 0 || strings.EqualFold(os.Getenv("SERVICE_BYTES_METRICS"), "true") {
+		if err := metricsStartHealthNotifier(); err != nil {
+			return err
+		}
+	}
 	if err := recon.ReloadAllServices(
 		m.ConsulAddresses,
 		m.InstanceName,
@@ -61,41 +119,206 @@ func (m *Serve) Execute(args []string) error {
 	); err != nil {
 		return err
 	}
+	m.applyPendingChanges()
+	// Services and certificates are loaded before the read-only mode is enforced
+	proxy.SetAllowMutations(!isReadOnlyMode())
+	var handler http.Handler = m
+	limiter, err := server.NewApiRateLimiter()
+	if err != nil {
+		return err
+	} else if limiter != nil {
+		handler = limiter.Middleware(m, m.isRateLimited)
+	}
+	cors, err := server.NewApiCors(m.getRouteMethods)
+	if err != nil {
+		return err
+	} else if cors != nil {
+		handler = cors.Middleware(handler)
+	}
+	srv, err := server.NewApiServer(handler, m.IP, m.Port, "/certs")
+	if err != nil {
+		return err
+	}
 	logPrintf(`Starting "Docker Flow: Proxy"`)
-	if err := httpListenAndServe(address, m); err != nil {
+	if err := httpListenAndServe(srv); err != nil {
 		return err
 	}
 	return nil
 }
 
+// Applies the changes that were not reloaded before the previous run stopped if APPLY_PENDING_ON_START is true.
+// Otherwise, the changes are only reported.
+func (m *Serve) applyPendingChanges() {
+	if !strings.EqualFold(os.Getenv("APPLY_PENDING_ON_START"), "true") {
+		for _, operation := range proxy.GetPendingChanges() {
+			logPrintf("WARNING: The %s of the service %s is pending. Set APPLY_PENDING_ON_START to true to apply it on start.", operation.Action, operation.Service.ServiceName)
+		}
+		return
+	}
+	err := proxyApplyPendingChanges(func(operation proxy.PendingOperation) error {
+		if operation.Action == proxy.PendingRemove {
+			action := actions.NewRemove(operation.Service.ServiceName, operation.Service.AclName, m.ConfigsPath, m.TemplatesPath, m.ConsulAddresses, m.InstanceName, m.Mode, false)
+			return action.Execute([]string{})
+		}
+		return actions.NewReconfigure(m.BaseReconfigure, operation.Service, m.Mode).Execute([]string{})
+	})
+	if err != nil {
+		logPrintf("WARNING: Could not apply the pending changes\n%s", err.Error())
+	}
+}
+
 func (m *Serve) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if !strings.EqualFold(req.URL.Path, "/v1/test") {
 		logPrintf("Processing request %s", req.URL)
 	}
+	if isReadOnlyMode() && m.isMutation(req) {
+		if !server.IsForwarded(req) {
+			m.writeReadOnlyError(w)
+			return
+		}
+		// Only the forwarded request is allowed to mutate the proxy
+		m.handleIdempotent(w, req.WithContext(proxy.ContextWithMutations(req.Context())))
+		return
+	}
+	if m.isMutation(req) {
+		m.handleIdempotent(w, req)
+		return
+	}
+	m.handle(w, req)
+}
+
+// Applies a mutation only once for each idempotency key (the Idempotency-Key header or the requestId query).
+// Keys are scoped to the method and the path of the request.
+// Repeated requests get the stored response. Those sent while the first one is processed wait until it finishes.
+// Requests that reuse a key with different parameters or a different body are rejected with ErrIdempotencyKeyReused.
+func (m *Serve) handleIdempotent(w http.ResponseWriter, req *http.Request) {
+	key := m.getIdempotencyKey(req)
+	if len(key) == 0 {
+		m.handle(w, req)
+		return
+	}
+	fingerprint := m.getRequestFingerprint(req)
+	cacheKey := getIdempotencyCacheKey(req.Method, req.URL.Path, key)
+	resp, ok, err := proxy.Idempotency.Reserve(req.Context(), cacheKey)
+	if err == nil && ok && resp.Request != fingerprint {
+		err = proxy.ErrIdempotencyKeyReused
+	}
+	if err != nil {
+		m.writeJson(w, getErrorStatus(err), server.Response{Status: "NOK", Message: err.Error()})
+		return
+	}
+	if ok {
+		logPrintf("The request with the idempotency key %s was already processed", key)
+		for name, values := range resp.Header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(resp.Status)
+		w.Write(resp.Body)
+		return
+	}
+	rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	// Failed requests are not stored so that they can be retried
+	defer func() {
+		if rec.status < http.StatusInternalServerError {
+			proxy.Idempotency.Put(cacheKey, proxy.IdempotentResponse{Status: rec.status, Header: rec.header, Body: rec.body, Request: fingerprint})
+		} else {
+			proxy.Idempotency.Release(cacheKey)
+		}
+	}()
+	m.handle(rec, req)
+}
+
+// Returns the key of the idempotency cache. The same key sent to different endpoints identifies different requests.
+func getIdempotencyCacheKey(method, path, key string) string {
+	return method + " " + path + " " + key
+}
+
+// Returns the hash of the query without the requestId and of the body of the request.
+// The body is read and replaced so that the request can still be handled.
+func (m *Serve) getRequestFingerprint(req *http.Request) string {
+	query := req.URL.Query()
+	query.Del("requestId")
+	body := []byte{}
+	if req.Body != nil {
+		body, _ = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(append([]byte(query.Encode()+"\n"), body...)))
+}
+
+func (m *Serve) handle(w http.ResponseWriter, req *http.Request) {
 	switch req.URL.Path {
 	case "/v1/docker-flow-proxy/cert":
 		if req.Method == "PUT" {
 			cert.Put(w, req)
+		} else if req.Method == "DELETE" {
+			cert.Remove(w, req)
 		} else {
-			logPrintf("/v1/docker-flow-proxy/cert endpoint allows only PUT requests. Your was %s", req.Method)
+			logPrintf("/v1/docker-flow-proxy/cert endpoint allows only PUT and DELETE requests. Your was %s", req.Method)
 			w.WriteHeader(http.StatusNotFound)
 		}
 	case "/v1/docker-flow-proxy/certs":
 		cert.GetAll(w, req)
+	case "/v1/docker-flow-proxy/certs/prune":
+		if req.Method == "DELETE" {
+			cert.Prune(w, req)
+		} else {
+			logPrintf("/v1/docker-flow-proxy/certs/prune endpoint allows only DELETE requests. Your was %s", req.Method)
+			w.WriteHeader(http.StatusNotFound)
+		}
 	case "/v1/docker-flow-proxy/config":
 		m.config(w, req)
+	case "/v1/docker-flow-proxy/config-hash":
+		m.configHash(w, req)
+	case "/v1/docker-flow-proxy/consistency":
+		m.consistency(w, req)
+	case "/v1/docker-flow-proxy/debug/state":
+		m.debugState(w, req)
+	case "/v1/docker-flow-proxy/metrics":
+		var buf bytes.Buffer
+		metrics.Instance.WritePrometheus(&buf)
+		httpWriterSetContentType(w, "text/plain; version=0.0.4")
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.Bytes())
 	case "/v1/docker-flow-proxy/reconfigure":
 		m.reconfigure(w, req)
 	case "/v1/docker-flow-proxy/remove":
 		m.remove(w, req)
 	case "/v1/docker-flow-proxy/reload":
 		reload.Execute()
+	case "/v1/docker-flow-proxy/schema":
+		js, _ := json.Marshal(proxy.GetParamsSchema())
+		httpWriterSetContentType(w, "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(js)
+	case "/v1/docker-flow-proxy/services":
+		m.services(w, req)
+	case "/v1/docker-flow-proxy/support-bundle":
+		m.supportBundle(w, req)
 	case "/v1/test", "/v2/test":
-		js, _ := json.Marshal(server.Response{Status: "OK"})
+		// The reload warnings let monitoring alert on degraded reloads that HAProxy reported as successful
+		js, _ := json.Marshal(server.Response{Status: "OK", ReloadWarnings: proxyGetReloadWarnings()})
 		httpWriterSetContentType(w, "application/json")
 		w.WriteHeader(http.StatusOK)
 		w.Write(js)
 	default:
+		if strings.HasPrefix(req.URL.Path, "/v1/docker-flow-proxy/services/") && strings.HasSuffix(req.URL.Path, "/diff") {
+			m.diffService(w, req)
+			return
+		}
+		if strings.HasPrefix(req.URL.Path, "/v1/docker-flow-proxy/services/") && strings.HasSuffix(req.URL.Path, "/replicas") {
+			m.setServiceReplicas(w, req)
+			return
+		}
+		if strings.HasPrefix(req.URL.Path, "/v1/docker-flow-proxy/services/") && strings.HasSuffix(req.URL.Path, "/stats") {
+			m.serviceStats(w, req)
+			return
+		}
+		if strings.HasPrefix(req.URL.Path, "/debug/pprof/") {
+			m.pprof(w, req)
+			return
+		}
 		logPrintf("The endpoint %s is not supported", req.URL.Path)
 		w.WriteHeader(http.StatusNotFound)
 	}
@@ -108,12 +331,34 @@ func (m *Serve) isValidReconf(service *proxy.Service) (bool, string) {
 	hasPath := len(service.ServiceDest[0].ServicePath) > 0
 	hasSrcPort := service.ServiceDest[0].SrcPort > 0
 	hasPort := len(service.ServiceDest[0].Port) > 0
+	hasSrcPortRange := len(service.ServiceDest[0].SrcPortRange) > 0
 	if strings.EqualFold(service.ReqMode, "http") {
 		if (!hasPath && len(service.ConsulTemplateFePath) == 0) {
 			return false, "When using reqMode http, servicePath or (consulTemplateFePath and consulTemplateBePath) are mandatory"
 		}
-	} else if !hasSrcPort || !hasPort {
-		return false, "When NOT using reqMode http (e.g. tcp), srcPort and port parameters are mandatory."
+		for _, sd := range service.ServiceDest {
+			if len(sd.SrcPortRange) > 0 {
+				return false, "srcPortRange can be used only with reqMode tcp"
+			}
+		}
+	} else if !hasSrcPortRange && (!hasSrcPort || !hasPort) {
+		return false, "When NOT using reqMode http (e.g. tcp), srcPort and port (or srcPortRange) parameters are mandatory."
+	}
+	if len(service.SourceAddress) > 0 && net.ParseIP(service.SourceAddress) == nil {
+		return false, fmt.Sprintf("sourceAddress %s is not a valid IP address", service.SourceAddress)
+	}
+	switch service.NormalizeTrailingSlash {
+	case "", "add", "strip":
+	default:
+		return false, fmt.Sprintf("normalizeTrailingSlash %s is not supported. Use add or strip", service.NormalizeTrailingSlash)
+	}
+	if len(service.AuthErrorFile) > 0 {
+		if _, err := osStat(service.AuthErrorFile); err != nil {
+			return false, fmt.Sprintf("authErrorFile %s does not exist", service.AuthErrorFile)
+		}
+	}
+	if service.TransparentProxy {
+		logPrintf("WARNING: The service %s uses transparentProxy. It requires a kernel with TPROXY support and the proxy running with the NET_ADMIN capability.", service.ServiceName)
 	}
 	return true, ""
 }
@@ -123,112 +368,28 @@ func (m *Serve) isSwarm(mode string) bool {
 }
 
 func (m *Serve) hasPort(sd []proxy.ServiceDest) bool {
-	return len(sd) > 0 && len(sd[0].Port) > 0
+	return len(sd) > 0 && (len(sd[0].Port) > 0 || len(sd[0].SrcPortRange) > 0)
 }
 
 func (m *Serve) reconfigure(w http.ResponseWriter, req *http.Request) {
-	path := []string{}
-	if len(req.URL.Query().Get("servicePath")) > 0 {
-		path = strings.Split(req.URL.Query().Get("servicePath"), ",")
-	}
-	port := req.URL.Query().Get("port")
-	srcPort, _ := strconv.Atoi(req.URL.Query().Get("srcPort"))
-	sd := []proxy.ServiceDest{}
-	ctmplFePath := req.URL.Query().Get("consulTemplateFePath")
-	ctmplBePath := req.URL.Query().Get("consulTemplateBePath")
-	if len(path) > 0 || len(port) > 0 || (len(ctmplFePath) > 0 && len(ctmplBePath) > 0) {
-		sd = append(
-			sd,
-			proxy.ServiceDest{Port: port, SrcPort: srcPort, ServicePath: path},
-		)
-	}
-	for i := 1; i <= 10; i++ {
-		port := req.URL.Query().Get(fmt.Sprintf("port.%d", i))
-		path := req.URL.Query().Get(fmt.Sprintf("servicePath.%d", i))
-		srcPort, _ := strconv.Atoi(req.URL.Query().Get(fmt.Sprintf("srcPort.%d", i)))
-		if len(path) > 0 && len(port) > 0 {
-			sd = append(
-				sd,
-				proxy.ServiceDest{Port: port, SrcPort: srcPort, ServicePath: strings.Split(path, ",")},
-			)
-		} else {
-			break
-		}
-	}
-	sr := proxy.Service{
-		ServiceDest:          sd,
-		ServiceName:          req.URL.Query().Get("serviceName"),
-		AclName:              req.URL.Query().Get("aclName"),
-		ServiceColor:         req.URL.Query().Get("serviceColor"),
-		ServiceCert:          req.URL.Query().Get("serviceCert"),
-		OutboundHostname:     req.URL.Query().Get("outboundHostname"),
-		ConsulTemplateFePath: ctmplFePath,
-		ConsulTemplateBePath: ctmplBePath,
-		PathType:             req.URL.Query().Get("pathType"),
-		ReqRepSearch:         req.URL.Query().Get("reqRepSearch"),  // TODO: Deprecated (dec. 2016).
-		ReqRepReplace:        req.URL.Query().Get("reqRepReplace"), // TODO: Deprecated (dec. 2016).
-		ReqPathSearch:        req.URL.Query().Get("reqPathSearch"),
-		ReqPathReplace:       req.URL.Query().Get("reqPathReplace"),
-		TemplateFePath:       req.URL.Query().Get("templateFePath"),
-		TemplateBePath:       req.URL.Query().Get("templateBePath"),
-	}
-	if len(req.URL.Query().Get("reqMode")) > 0 {
-		sr.ReqMode = req.URL.Query().Get("reqMode")
-	} else {
-		sr.ReqMode = "http"
-	}
-	if len(req.URL.Query().Get("httpsPort")) > 0 {
-		sr.HttpsPort, _ = strconv.Atoi(req.URL.Query().Get("httpsPort"))
-	}
-	if len(req.URL.Query().Get("serviceDomain")) > 0 {
-		sr.ServiceDomain = strings.Split(req.URL.Query().Get("serviceDomain"), ",")
-	}
-	if len(req.URL.Query().Get("skipCheck")) > 0 {
-		sr.SkipCheck, _ = strconv.ParseBool(req.URL.Query().Get("skipCheck"))
-	}
-	if len(req.URL.Query().Get("distribute")) > 0 {
-		sr.Distribute, _ = strconv.ParseBool(req.URL.Query().Get("distribute"))
+	sr, err := proxy.GetServiceFromParams(req.URL.Query())
+	sr.Caller = m.getCaller(req)
+	response := server.Response{
+		Mode:        m.Mode,
+		Status:      "OK",
+		ServiceName: sr.ServiceName,
+		Service:     sr,
 	}
-	if len(req.URL.Query().Get("users")) > 0 {
-		users := strings.Split(req.URL.Query().Get("users"), ",")
-		for _, user := range users {
-			userPass := strings.Split(user, ":")
-			sr.Users = append(sr.Users, proxy.User{Username: userPass[0], Password: userPass[1]})
-		}
+	ok, msg := false, ""
+	if err != nil {
+		msg = err.Error()
+	} else {
+		ok, msg = m.isValidReconf(&sr)
 	}
-	response := server.Response{
-		Mode:       	m.Mode,
-		Status:     	"OK",
-		ServiceName:    sr.ServiceName,
-		Service: 	proxy.Service{
-			ServiceName:          sr.ServiceName,
-			AclName:              sr.AclName,
-			ServiceColor:         sr.ServiceColor,
-			ServiceDomain:        sr.ServiceDomain,
-			ServiceCert:          sr.ServiceCert,
-			OutboundHostname:     sr.OutboundHostname,
-			ConsulTemplateFePath: sr.ConsulTemplateFePath,
-			ConsulTemplateBePath: sr.ConsulTemplateBePath,
-			PathType:             sr.PathType,
-			SkipCheck:            sr.SkipCheck,
-			HttpsPort:            sr.HttpsPort,
-			Distribute:           sr.Distribute,
-			Users:                sr.Users,
-			ReqRepSearch:         sr.ReqRepSearch, // TODO: Deprecated (dec. 2016).
-			ReqRepReplace:        sr.ReqRepReplace, // TODO: Deprecated (dec. 2016).
-			ReqPathSearch:        sr.ReqPathSearch,
-			ReqPathReplace:       sr.ReqPathReplace,
-			TemplateFePath:       sr.TemplateFePath,
-			TemplateBePath:       sr.TemplateBePath,
-			ServiceDest:          sd,
-			ReqMode:              sr.ReqMode,
-		},
-	}
-	ok, msg := m.isValidReconf(&sr)
 	if ok {
-		if m.isSwarm(m.Mode) && !m.hasPort(sd) {
+		if m.isSwarm(m.Mode) && !m.hasPort(sr.ServiceDest) {
 			m.writeBadRequest(w, &response, `When MODE is set to "service" or "swarm", the port query is mandatory`)
-		} else if sr.Distribute {
+		} else if sr.Distribute && !server.IsDistributed(req) {
 			srv := server.Serve{}
 			if status, err := srv.SendDistributeRequests(req, m.Port, m.ServiceName); err != nil || status >= 300 {
 				m.writeInternalServerError(w, &response, err.Error())
@@ -246,9 +407,12 @@ func (m *Serve) reconfigure(w http.ResponseWriter, req *http.Request) {
 					cert.PutCert(sr.ServiceName, []byte(sr.ServiceCert))
 				}
 			}
-			action := actions.NewReconfigure(m.BaseReconfigure, sr, m.Mode)
+			base := m.BaseReconfigure
+			base.ReloadDelay = server.GetReloadDelay(req)
+			base.AllowMutations = proxy.MutationsAllowed(req.Context())
+			action := actions.NewReconfigure(base, sr, m.Mode)
 			if err := action.Execute([]string{}); err != nil {
-				m.writeInternalServerError(w, &response, err.Error())
+				m.writeError(w, &response, err)
 			} else {
 				w.WriteHeader(http.StatusOK)
 			}
@@ -261,12 +425,154 @@ func (m *Serve) reconfigure(w http.ResponseWriter, req *http.Request) {
 	w.Write(js)
 }
 
+func (m *Serve) getIdempotencyKey(req *http.Request) string {
+	if key := req.Header.Get("Idempotency-Key"); len(key) > 0 {
+		return key
+	}
+	return req.URL.Query().Get("requestId")
+}
+
+// Returns the identity of the caller used by the domain ownership policy.
+// Callers are identified by the bearer token in the Authorization header.
+// The identity is empty when DOMAIN_OWNERSHIP_FILE is not set.
+func (m *Serve) getCaller(req *http.Request) string {
+	if len(os.Getenv("DOMAIN_OWNERSHIP_FILE")) == 0 {
+		return ""
+	}
+	auth := req.Header.Get("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		if token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")); len(token) > 0 {
+			return token
+		}
+	}
+	return proxy.AnonymousCaller
+}
+
 func (m *Serve) writeBadRequest(w http.ResponseWriter, resp *server.Response, msg string) {
 	resp.Status = "NOK"
 	resp.Message = msg
 	w.WriteHeader(http.StatusBadRequest)
 }
 
+func isReadOnlyMode() bool {
+	return strings.EqualFold(os.Getenv("READ_ONLY_MODE"), "true")
+}
+
+// Returns whether the request changes services or certificates
+func (m *Serve) isMutation(req *http.Request) bool {
+	switch req.URL.Path {
+	case "/v1/docker-flow-proxy/reconfigure", "/v1/docker-flow-proxy/remove":
+		return true
+	case "/v1/docker-flow-proxy/cert":
+		return req.Method == "PUT" || req.Method == "DELETE"
+	case "/v1/docker-flow-proxy/certs/prune":
+		return req.Method == "DELETE"
+	}
+	return strings.HasPrefix(req.URL.Path, "/v1/docker-flow-proxy/services/") && strings.HasSuffix(req.URL.Path, "/replicas")
+}
+
+// The methods of the endpoints that accept other methods than GET
+var routeMethods = map[string][]string{
+	"/v1/docker-flow-proxy/cert":        {"PUT", "DELETE"},
+	"/v1/docker-flow-proxy/certs/prune": {"DELETE"},
+}
+
+// The endpoints that accept only GET requests
+var getRoutes = []string{
+	"/v1/docker-flow-proxy/certs",
+	"/v1/docker-flow-proxy/config",
+	"/v1/docker-flow-proxy/config-hash",
+	"/v1/docker-flow-proxy/consistency",
+	"/v1/docker-flow-proxy/debug/state",
+	"/v1/docker-flow-proxy/metrics",
+	"/v1/docker-flow-proxy/reconfigure",
+	"/v1/docker-flow-proxy/reload",
+	"/v1/docker-flow-proxy/remove",
+	"/v1/docker-flow-proxy/schema",
+	"/v1/docker-flow-proxy/services",
+	"/v1/docker-flow-proxy/support-bundle",
+	"/v1/test",
+	"/v2/test",
+}
+
+// Returns the methods of the endpoint with the path or nil if the API does not serve it.
+// Used to answer the CORS preflight requests.
+func (m *Serve) getRouteMethods(path string) []string {
+	if methods, ok := routeMethods[path]; ok {
+		return append([]string{}, methods...)
+	}
+	for _, route := range getRoutes {
+		if path == route {
+			return []string{"GET"}
+		}
+	}
+	if strings.HasPrefix(path, "/v1/docker-flow-proxy/services/") {
+		switch {
+		case strings.HasSuffix(path, "/diff"):
+			return []string{"POST"}
+		case strings.HasSuffix(path, "/replicas"):
+			return []string{"PUT"}
+		case strings.HasSuffix(path, "/stats"):
+			return []string{"GET"}
+		}
+	}
+	return nil
+}
+
+// Returns whether the request counts against API_RATE_LIMIT.
+// Only the requests that change the configuration or reload the proxy are limited.
+// Requests distributed by other instances are not since they were limited by the instance that received them.
+func (m *Serve) isRateLimited(req *http.Request) bool {
+	if server.IsForwarded(req) {
+		return false
+	}
+	return m.isMutation(req) || req.URL.Path == "/v1/docker-flow-proxy/reload"
+}
+
+// Rejects requests that change the configuration of a replica and points to the primary instance
+func (m *Serve) writeReadOnlyError(w http.ResponseWriter) {
+	msg := "The proxy is in read-only mode. Please send the request to the primary instance"
+	if primary := os.Getenv("PRIMARY_ADDRESS"); len(primary) > 0 {
+		msg = fmt.Sprintf("%s %s", msg, primary)
+	}
+	logPrintf("%s", msg)
+	js, _ := json.Marshal(server.Response{Status: "NOK", Message: msg})
+	httpWriterSetContentType(w, "application/json")
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	w.Write(js)
+}
+
+// Writes the error with the status code matching its type
+func (m *Serve) writeError(w http.ResponseWriter, resp *server.Response, err error) {
+	resp.Status = "NOK"
+	resp.Message = err.Error()
+	w.WriteHeader(getErrorStatus(err))
+}
+
+// Returns the HTTP status code matching the type of the error returned by the proxy package
+func getErrorStatus(err error) int {
+	var validation *proxy.ErrValidation
+	var conflict *proxy.ErrConflict
+	var forbidden *proxy.ErrForbidden
+	switch {
+	case errors.Is(err, proxy.ErrServiceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, proxy.ErrReadOnly):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, proxy.ErrIdempotencyKeyInFlight):
+		return http.StatusConflict
+	case errors.Is(err, proxy.ErrIdempotencyKeyReused):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &validation):
+		return http.StatusBadRequest
+	case errors.As(err, &conflict):
+		return http.StatusConflict
+	case errors.As(err, &forbidden):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
 func (m *Serve) writeInternalServerError(w http.ResponseWriter, resp *server.Response, msg string) {
 	resp.Status = "NOK"
 	resp.Message = msg
@@ -282,54 +588,392 @@ func (m *Serve) remove(w http.ResponseWriter, req *http.Request) {
 	}
 	if len(req.URL.Query().Get("distribute")) > 0 {
 		distribute, _ = strconv.ParseBool(req.URL.Query().Get("distribute"))
+		distribute = distribute && !server.IsDistributed(req)
 		if distribute {
 			response.Distribute = distribute
 			response.Message = DISTRIBUTED
 		}
 	}
-	if len(serviceName) == 0 {
+	namespace := req.URL.Query().Get("namespace")
+	if len(serviceName) == 0 && len(namespace) == 0 {
 		response.Status = "NOK"
-		response.Message = "The serviceName query is mandatory"
+		response.Message = "The serviceName or namespace query is mandatory"
 		w.WriteHeader(http.StatusBadRequest)
 	} else if distribute {
-		srv := server.Serve{}
-		if status, err := srv.SendDistributeRequests(req, m.Port, m.ServiceName); err != nil || status >= 300 {
+		results, err := distributor.DistributeRequests(req, m.Port, m.ServiceName)
+		failed := server.GetFailedAddresses(results)
+		response.Peers = results
+		if err != nil {
 			m.writeInternalServerError(w, &response, err.Error())
+		} else if len(failed) == len(results) {
+			m.writeInternalServerError(w, &response, fmt.Sprintf("Could not send distribute request to any of the addresses: %s", failed))
 		} else {
-			response.Message = DISTRIBUTED
+			if len(failed) > 0 {
+				response.Message = fmt.Sprintf("%s except the following addresses: %s", DISTRIBUTED, failed)
+			}
 			w.WriteHeader(http.StatusOK)
 		}
 	} else {
 		logPrintf("Processing remove request %s", req.URL.Path)
-		aclName := req.URL.Query().Get("aclName")
-		action := actions.NewRemove(
-			serviceName,
-			aclName,
-			m.BaseReconfigure.ConfigsPath,
-			m.BaseReconfigure.TemplatesPath,
-			m.ConsulAddresses,
-			m.InstanceName,
-			m.Mode,
-		)
-		action.Execute([]string{})
-		w.WriteHeader(http.StatusOK)
+		var action actions.Removable
+		if len(serviceName) == 0 {
+			action = actions.NewRemoveNamespace(
+				namespace,
+				m.BaseReconfigure.ConfigsPath,
+				m.BaseReconfigure.TemplatesPath,
+				m.ConsulAddresses,
+				m.InstanceName,
+				m.Mode,
+				proxy.MutationsAllowed(req.Context()),
+			)
+		} else {
+			aclName := req.URL.Query().Get("aclName")
+			action = actions.NewRemove(
+				serviceName,
+				aclName,
+				m.BaseReconfigure.ConfigsPath,
+				m.BaseReconfigure.TemplatesPath,
+				m.ConsulAddresses,
+				m.InstanceName,
+				m.Mode,
+				proxy.MutationsAllowed(req.Context()),
+			)
+		}
+		if err := action.Execute([]string{}); err != nil {
+			m.writeError(w, &response, err)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
 	}
 	httpWriterSetContentType(w, "application/json")
 	js, _ := json.Marshal(response)
 	w.Write(js)
 }
 
+// Returns the configuration file as it was written by the last successful CreateConfigFromTemplates run.
+// The file is read on each request.
 func (m *Serve) config(w http.ResponseWriter, req *http.Request) {
-	httpWriterSetContentType(w, "text/html")
+	if req.Method != "GET" {
+		logPrintf("%s endpoint allows only GET requests. Your was %s", req.URL.Path, req.Method)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	httpWriterSetContentType(w, "text/plain")
 	out, err := proxy.Instance.ReadConfig()
 	if err != nil {
+		logPrintf("Could not read the configuration\n%s", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
-	} else {
-		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(err.Error()))
+		return
 	}
+	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(out))
 }
 
+// Returns the hashes of the configuration and of the services of this instance
+func (m *Serve) configHash(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		logPrintf("%s endpoint allows only GET requests. Your was %s", req.URL.Path, req.Method)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	hash, err := m.getConfigHash()
+	if err != nil {
+		m.writeJson(w, http.StatusInternalServerError, server.Response{Status: "NOK", Message: err.Error()})
+		return
+	}
+	m.writeJson(w, http.StatusOK, hash)
+}
+
+// Compares the hashes of this instance with those of all the other instances of the proxy service
+func (m *Serve) consistency(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		logPrintf("%s endpoint allows only GET requests. Your was %s", req.URL.Path, req.Method)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	hash, err := m.getConfigHash()
+	if err != nil {
+		m.writeJson(w, http.StatusInternalServerError, server.Response{Status: "NOK", Message: err.Error()})
+		return
+	}
+	results, err := distributor.GetConfigHashes(m.Port, m.ServiceName)
+	if err != nil {
+		logPrintf("Could not retrieve the configuration hashes of the other instances\n%s", err.Error())
+		m.writeJson(w, http.StatusInternalServerError, server.Response{Status: "NOK", Message: err.Error()})
+		return
+	}
+	m.writeJson(w, http.StatusOK, server.NewConsistencyReport(hash, results))
+}
+
+func (m *Serve) getConfigHash() (proxy.ConfigHash, error) {
+	config, err := proxy.Instance.ReadConfig()
+	if err != nil {
+		logPrintf("Could not read the configuration\n%s", err.Error())
+		return proxy.ConfigHash{}, err
+	}
+	return proxy.GetConfigHash(proxy.Instance.GetRenderer(), config, proxy.Instance.GetServices()), nil
+}
+
+// Returns the registered services keyed by their names.
+// The fields of each service are named after the reconfigure parameters.
+// If the namespace query is set, only the services that belong to it are returned.
+func (m *Serve) services(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		logPrintf("%s endpoint allows only GET requests. Your was %s", req.URL.Path, req.Method)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var registered map[string]proxy.Service
+	if namespace := req.URL.Query().Get("namespace"); len(namespace) > 0 {
+		registered = proxy.Instance.GetServicesByNamespace(namespace)
+	} else {
+		registered = proxy.Instance.GetServices()
+	}
+	// The internal format includes the credentials so that the instances can restore the services of each other
+	if req.URL.Query().Get("format") == "internal" {
+		if !server.IsForwarded(req) {
+			logPrintf("The services in the internal format are returned only to the proxy instances with DISTRIBUTE_SECRET")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		m.writeJson(w, http.StatusOK, registered)
+		return
+	}
+	services := map[string]map[string]interface{}{}
+	for name, s := range registered {
+		services[name] = proxy.GetParamsMap(s)
+	}
+	m.writeJson(w, http.StatusOK, services)
+}
+
+// Registers the services of another instance of the proxy so that a new instance routes the requests as soon as it starts.
+// The certificates are retrieved from the instances by cert.Init.
+// Failures are only logged since the services are also sent by the Swarm Listener.
+func (m *Serve) syncFromPeers() {
+	if len(os.Getenv("DISTRIBUTE_SECRET")) == 0 {
+		logPrintf("WARNING: The services are not retrieved from the other instances since DISTRIBUTE_SECRET is not set")
+		return
+	}
+	services, err := distributor.GetPeerServices(m.Port, m.ServiceName)
+	if err != nil {
+		logPrintf("WARNING: Could not retrieve the services from the other instances\n%s", err.Error())
+		return
+	}
+	added := 0
+	for name, s := range services {
+		if err := proxy.Instance.AddService(s); err != nil {
+			logPrintf("WARNING: Could not add the service %s retrieved from the other instances\n%s", name, err.Error())
+			continue
+		}
+		added++
+	}
+	logPrintf("Added %d of the %d services retrieved from the other instances", added, len(services))
+	if added == 0 {
+		return
+	}
+	if err := proxy.Instance.CreateConfigFromTemplates(); err != nil {
+		logPrintf("WARNING: Could not create the configuration with the services retrieved from the other instances\n%s", err.Error())
+		return
+	}
+	reload.Execute()
+}
+
+// Returns the snapshot of the internal state of the proxy
+func (m *Serve) debugState(w http.ResponseWriter, req *http.Request) {
+	if !isDebugEnabled() {
+		logPrintf("The endpoint %s is disabled. Set ENABLE_DEBUG_ENDPOINTS to true to enable it.", req.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if req.Method != "GET" {
+		logPrintf("%s endpoint allows only GET requests. Your was %s", req.URL.Path, req.Method)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	m.writeJson(w, http.StatusOK, proxy.Instance.DebugState())
+}
+
+// Serves the runtime profiling data in the format expected by the pprof tool
+func (m *Serve) pprof(w http.ResponseWriter, req *http.Request) {
+	if !isDebugEnabled() {
+		logPrintf("The endpoint %s is disabled. Set ENABLE_DEBUG_ENDPOINTS to true to enable it.", req.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch req.URL.Path {
+	case "/debug/pprof/cmdline":
+		pprof.Cmdline(w, req)
+	case "/debug/pprof/profile":
+		pprof.Profile(w, req)
+	case "/debug/pprof/symbol":
+		pprof.Symbol(w, req)
+	case "/debug/pprof/trace":
+		pprof.Trace(w, req)
+	default:
+		pprof.Index(w, req)
+	}
+}
+
+func isDebugEnabled() bool {
+	return strings.EqualFold(os.Getenv("ENABLE_DEBUG_ENDPOINTS"), "true")
+}
+
+// The bundle is returned only to the requests that carry DISTRIBUTE_SECRET in the secret header
+func (m *Serve) supportBundle(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		logPrintf("%s endpoint allows only GET requests. Your was %s", req.URL.Path, req.Method)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !server.HasSecret(req) {
+		logPrintf("The support bundle is returned only to the requests with the %s header set to DISTRIBUTE_SECRET", server.SecretHeader)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	bundle, err := proxy.Instance.CreateSupportBundle()
+	if err != nil {
+		logPrintf("Could not create the support bundle\n%s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	httpWriterSetContentType(w, "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="docker-flow-proxy-support-bundle.tar.gz"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(bundle)
+}
+
+func (m *Serve) diffService(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		logPrintf("%s endpoint allows only POST requests. Your was %s", req.URL.Path, req.Method)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	serviceName := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/v1/docker-flow-proxy/services/"), "/diff")
+	response := server.Response{Status: "NOK", ServiceName: serviceName}
+	current, ok := proxy.Instance.GetServices()[serviceName]
+	if !ok {
+		response.Message = fmt.Sprintf("The service %s is not registered", serviceName)
+		m.writeJson(w, http.StatusNotFound, response)
+		return
+	}
+	proposed := proxy.Service{}
+	if req.Body == nil {
+		response.Message = "The body must contain the proposed service"
+		m.writeJson(w, http.StatusBadRequest, response)
+		return
+	}
+	defer req.Body.Close()
+	if err := json.NewDecoder(req.Body).Decode(&proposed); err != nil {
+		response.Message = fmt.Sprintf("Could not parse the proposed service\n%s", err.Error())
+		m.writeJson(w, http.StatusBadRequest, response)
+		return
+	}
+	if len(proposed.ServiceName) == 0 {
+		proposed.ServiceName = serviceName
+	}
+	// The proposed service gets the defaults it would get if it were registered
+	proposed = proxy.ApplyServiceDefaults(proposed)
+	diff := proxy.DiffService(current, proposed)
+	currentSnippet, err := m.getServiceSnippet(current)
+	if err == nil {
+		var proposedSnippet string
+		if proposedSnippet, err = m.getServiceSnippet(proposed); err == nil {
+			diff.SnippetDiff = proxy.DiffLines(currentSnippet, proposedSnippet)
+		}
+	}
+	if err != nil {
+		response.Message = err.Error()
+		m.writeJson(w, http.StatusInternalServerError, response)
+		return
+	}
+	m.writeJson(w, http.StatusOK, diff)
+}
+
+// Changes the number of replicas of the service.
+// Scale-ups within the headroom are applied through the runtime socket. Other changes reconfigure the service.
+func (m *Serve) setServiceReplicas(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "PUT" {
+		logPrintf("%s endpoint allows only PUT requests. Your was %s", req.URL.Path, req.Method)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	serviceName := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/v1/docker-flow-proxy/services/"), "/replicas")
+	response := server.Response{Mode: m.Mode, Status: "OK", ServiceName: serviceName}
+	replicas, err := strconv.Atoi(req.URL.Query().Get("replicas"))
+	if err != nil {
+		response.Status = "NOK"
+		response.Message = "The replicas parameter must be a number"
+		m.writeJson(w, http.StatusBadRequest, response)
+		return
+	}
+	err = proxy.ForContext(req.Context()).SetServiceReplicas(serviceName, replicas)
+	sr := proxy.Instance.GetServices()[serviceName]
+	sr.Replicas = replicas
+	base := m.BaseReconfigure
+	base.AllowMutations = proxy.MutationsAllowed(req.Context())
+	if err == nil {
+		// The templates are written so that the next reload does not disable the enabled slots
+		err = actions.NewReconfigure(base, sr, m.Mode).CreateConfigs()
+		response.Message = fmt.Sprintf("The service was scaled to %d replicas without a reload", replicas)
+	} else if errors.Is(err, proxy.ErrReconfigureRequired) {
+		err = actions.NewReconfigure(base, sr, m.Mode).Execute([]string{})
+		response.Message = fmt.Sprintf("The service was reconfigured with %d replicas", replicas)
+	}
+	if err != nil {
+		response.Status = "NOK"
+		response.Message = err.Error()
+		m.writeJson(w, getErrorStatus(err), response)
+		return
+	}
+	m.writeJson(w, http.StatusOK, response)
+}
+
+// The statistics of a service accumulated across reloads
+type serviceStatsResponse struct {
+	ServiceName string
+	metrics.ServiceBytes
+}
+
+// Returns the numbers of bytes transferred by the service.
+// They are collected only if SERVICE_BYTES_METRICS is true or HEALTH_NOTIFY_URLS is set.
+func (m *Serve) serviceStats(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		logPrintf("%s endpoint allows only GET requests. Your was %s", req.URL.Path, req.Method)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	serviceName := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/v1/docker-flow-proxy/services/"), "/stats")
+	transferred, ok := metricsGetServiceBytes(serviceName)
+	if _, registered := proxy.Instance.GetServices()[serviceName]; !ok && !registered {
+		m.writeJson(w, http.StatusNotFound, server.Response{
+			Status:      "NOK",
+			ServiceName: serviceName,
+			Message:     fmt.Sprintf("The service %s is not registered", serviceName),
+		})
+		return
+	}
+	m.writeJson(w, http.StatusOK, serviceStatsResponse{ServiceName: serviceName, ServiceBytes: transferred})
+}
+
+// Renders the frontend and backend snippets of the service without storing them.
+// Destinations are copied since rendering modifies them.
+func (m *Serve) getServiceSnippet(sr proxy.Service) (string, error) {
+	sr.ServiceDest = append([]proxy.ServiceDest{}, sr.ServiceDest...)
+	front, back, err := actions.NewReconfigure(m.BaseReconfigure, sr, m.Mode).GetTemplates(&sr)
+	if err != nil {
+		return "", err
+	}
+	return front + "\n" + back, nil
+}
+
+func (m *Serve) writeJson(w http.ResponseWriter, status int, value interface{}) {
+	httpWriterSetContentType(w, "application/json")
+	w.WriteHeader(status)
+	js, _ := json.Marshal(value)
+	w.Write(js)
+}
+
 func (m *Serve) setConsulAddresses() {
 	m.ConsulAddresses = []string{}
 	if len(os.Getenv("CONSUL_ADDRESS")) > 0 {
@@ -341,3 +985,32 @@ func (m *Serve) setConsulAddresses() {
 		}
 	}
 }
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   []byte
+}
+
+// The headers are copied when they are sent since they cannot change afterwards
+func (m *responseRecorder) WriteHeader(status int) {
+	m.status = status
+	m.recordHeader()
+	m.ResponseWriter.WriteHeader(status)
+}
+
+func (m *responseRecorder) Write(data []byte) (int, error) {
+	m.recordHeader()
+	m.body = append(m.body, data...)
+	return m.ResponseWriter.Write(data)
+}
+
+func (m *responseRecorder) recordHeader() {
+	if m.header == nil {
+		m.header = http.Header{}
+		for name, values := range m.ResponseWriter.Header() {
+			m.header[name] = append([]string{}, values...)
+		}
+	}
+}
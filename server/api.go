@@ -0,0 +1,75 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// The certificate used by the API server.
+// It is set by NewApiServer and reset by Cert whenever the certificate file is replaced.
+var apiCertInstance *apiCert
+
+type apiCert struct {
+	certsDir string
+	certName string
+	mu       sync.Mutex
+	cert     *tls.Certificate
+}
+
+// NewApiServer returns the server exposing the proxy API.
+// The address and the port can be overwritten through API_BIND_ADDRESS and API_PORT environment variables.
+// If API_CERT_NAME is set, the server uses TLS with the certificate of that name stored in the certs directory.
+func NewApiServer(handler http.Handler, address, port, certsDir string) (*http.Server, error) {
+	if len(os.Getenv("API_BIND_ADDRESS")) > 0 {
+		address = os.Getenv("API_BIND_ADDRESS")
+	}
+	if len(os.Getenv("API_PORT")) > 0 {
+		port = os.Getenv("API_PORT")
+	}
+	srv := &http.Server{
+		Addr:    fmt.Sprintf("%s:%s", address, port),
+		Handler: handler,
+	}
+	apiCertInstance = nil
+	if certName := os.Getenv("API_CERT_NAME"); len(certName) > 0 {
+		c := &apiCert{certsDir: certsDir, certName: certName}
+		if _, err := c.GetCertificate(nil); err != nil {
+			return nil, err
+		}
+		apiCertInstance = c
+		srv.TLSConfig = &tls.Config{GetCertificate: c.GetCertificate}
+	}
+	return srv, nil
+}
+
+// GetCertificate returns the API certificate, loading it from the certs directory if it was not loaded already
+func (m *apiCert) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cert == nil {
+		content, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", m.certsDir, m.certName))
+		if err != nil {
+			return nil, err
+		}
+		cert, err := tls.X509KeyPair(content, content)
+		if err != nil {
+			return nil, fmt.Errorf("Could not load the API certificate %s\n%s", m.certName, err.Error())
+		}
+		m.cert = &cert
+	}
+	return m.cert, nil
+}
+
+// Makes the certificate load again on the next request if the certificate with the same name was replaced
+func (m *apiCert) reset(certsDir, certName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.certsDir == certsDir && m.certName == certName {
+		logPrintf("Reloading the API certificate %s", certName)
+		m.cert = nil
+	}
+}
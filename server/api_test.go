@@ -0,0 +1,140 @@
+// +build !integration
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ApiTestSuite struct {
+	suite.Suite
+	CertsDir string
+	Handler  http.Handler
+}
+
+func TestApiUnitTestSuite(t *testing.T) {
+	logPrintfOrig := logPrintf
+	defer func() { logPrintf = logPrintfOrig }()
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(ApiTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *ApiTestSuite) SetupTest() {
+	s.CertsDir, _ = ioutil.TempDir("", "api-certs")
+	s.Handler = http.NewServeMux()
+}
+
+func (s *ApiTestSuite) TearDownTest() {
+	os.RemoveAll(s.CertsDir)
+	os.Unsetenv("API_BIND_ADDRESS")
+	os.Unsetenv("API_PORT")
+	os.Unsetenv("API_CERT_NAME")
+	apiCertInstance = nil
+}
+
+// NewApiServer
+
+func (s *ApiTestSuite) Test_NewApiServer_ReturnsPlainHttpServer() {
+	srv, err := NewApiServer(s.Handler, "0.0.0.0", "8080", s.CertsDir)
+
+	s.NoError(err)
+	s.Equal("0.0.0.0:8080", srv.Addr)
+	s.Equal(s.Handler, srv.Handler)
+	s.Nil(srv.TLSConfig)
+}
+
+func (s *ApiTestSuite) Test_NewApiServer_UsesAddressAndPortFromEnvVars() {
+	os.Setenv("API_BIND_ADDRESS", "10.0.0.1")
+	os.Setenv("API_PORT", "9090")
+
+	srv, _ := NewApiServer(s.Handler, "0.0.0.0", "8080", s.CertsDir)
+
+	s.Equal("10.0.0.1:9090", srv.Addr)
+}
+
+func (s *ApiTestSuite) Test_NewApiServer_UsesTls_WhenCertNameIsSet() {
+	os.Setenv("API_CERT_NAME", "api.pem")
+	s.writeCert("api.pem", "api.example.com")
+
+	srv, err := NewApiServer(s.Handler, "0.0.0.0", "8080", s.CertsDir)
+
+	s.NoError(err)
+	s.Require().NotNil(srv.TLSConfig)
+	s.Equal("api.example.com", s.getCommonName(srv))
+}
+
+func (s *ApiTestSuite) Test_NewApiServer_ReturnsError_WhenCertDoesNotExist() {
+	os.Setenv("API_CERT_NAME", "api.pem")
+
+	_, err := NewApiServer(s.Handler, "0.0.0.0", "8080", s.CertsDir)
+
+	s.Error(err)
+}
+
+func (s *ApiTestSuite) Test_NewApiServer_ReturnsError_WhenCertIsInvalid() {
+	os.Setenv("API_CERT_NAME", "api.pem")
+	ioutil.WriteFile(s.CertsDir+"/api.pem", []byte("not a cert"), 0644)
+
+	_, err := NewApiServer(s.Handler, "0.0.0.0", "8080", s.CertsDir)
+
+	s.Error(err)
+}
+
+func (s *ApiTestSuite) Test_NewApiServer_ReloadsCert_WhenCertIsReplaced() {
+	os.Setenv("API_CERT_NAME", "api.pem")
+	s.writeCert("api.pem", "old.example.com")
+	srv, _ := NewApiServer(s.Handler, "0.0.0.0", "8080", s.CertsDir)
+	c := NewCert(s.CertsDir)
+
+	c.writeFile("other.pem", s.createCert("other.example.com"))
+	s.Equal("old.example.com", s.getCommonName(srv))
+
+	c.writeFile("api.pem", s.createCert("new.example.com"))
+	s.Equal("new.example.com", s.getCommonName(srv))
+}
+
+// Util
+
+func (s *ApiTestSuite) getCommonName(srv *http.Server) string {
+	cert, err := srv.TLSConfig.GetCertificate(&tls.ClientHelloInfo{})
+	s.Require().NoError(err)
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	s.Require().NoError(err)
+	return parsed.Subject.CommonName
+}
+
+func (s *ApiTestSuite) writeCert(certName, commonName string) {
+	ioutil.WriteFile(s.CertsDir+"/"+certName, s.createCert(commonName), 0644)
+}
+
+func (s *ApiTestSuite) createCert(commonName string) []byte {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	s.Require().NoError(err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	s.Require().NoError(err)
+	content := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return append(content, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})...)
+}
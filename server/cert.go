@@ -8,20 +8,29 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"../proxy"
 )
 
 var mu = &sync.Mutex{}
 
+// The time certificates were added through the API. Such certificates are not pruned during the grace period.
+var certsAddedAt = map[string]time.Time{}
+
 type Certer interface {
 	Put(w http.ResponseWriter, req *http.Request) (string, error)
 	PutCert(certName string, certContent []byte) (string, error)
 	GetAll(w http.ResponseWriter, req *http.Request) (CertResponse, error)
 	Init() error
+	Prune(w http.ResponseWriter, req *http.Request) ([]string, error)
+	PruneCerts(dryRun bool) ([]string, error)
+	Remove(w http.ResponseWriter, req *http.Request) error
+	RemoveCert(certName string) error
 }
 
 type Cert struct {
@@ -35,6 +44,8 @@ type CertResponse struct {
 	Status  string
 	Message string
 	Certs   []Cert
+	Pruned  []string           `json:",omitempty"`
+	Peers   []DistributeResult `json:",omitempty"`
 }
 
 func (m *Cert) GetAll(w http.ResponseWriter, req *http.Request) (CertResponse, error) {
@@ -50,11 +61,17 @@ func (m *Cert) GetAll(w http.ResponseWriter, req *http.Request) (CertResponse, e
 }
 
 func (m *Cert) PutCert(certName string, certContent []byte) (string, error) {
+	return m.putCert(proxy.Instance, certName, certContent)
+}
+
+func (m *Cert) putCert(p proxy.Proxy, certName string, certContent []byte) (string, error) {
 	path, err := m.writeFile(certName, certContent)
 	if err != nil {
 		return "", err
 	} else {
-		proxy.Instance.AddCert(certName)
+		if err := p.AddCert(certName); err != nil {
+			return "", err
+		}
 		logPrintf("Stored certificate %s", certName)
 
 		return path, nil
@@ -72,11 +89,14 @@ func (m *Cert) Put(w http.ResponseWriter, req *http.Request) (string, error) {
 		return "", err
 	}
 
-	path, err := m.PutCert(certName, certContent)
+	path, err := m.putCert(proxy.ForContext(req.Context()), certName, certContent)
 	if err != nil {
 		m.writeError(w, err)
 		return "", err
 	}
+	mu.Lock()
+	certsAddedAt[certName] = timeNow()
+	mu.Unlock()
 
 	proxy.Instance.CreateConfigFromTemplates()
 	proxy.Instance.Reload()
@@ -123,6 +143,147 @@ func (m *Cert) Init() error {
 	return nil
 }
 
+// Remove removes the certificate specified through the certName query parameter.
+// If the query parameter distribute is true, the request is sent to all the instances of the proxy.
+// Instances that could not be reached are listed in the response without failing the request
+// unless none of the instances removed the certificate.
+func (m *Cert) Remove(w http.ResponseWriter, req *http.Request) error {
+	certName := req.URL.Query().Get("certName")
+	if len(certName) == 0 {
+		return m.writeError(w, fmt.Errorf("certName parameter is mandatory"))
+	}
+	distribute, _ := strconv.ParseBool(req.URL.Query().Get("distribute"))
+	if distribute && !IsDistributed(req) {
+		_, port, err := net.SplitHostPort(req.URL.Host)
+		if err != nil {
+			port = "8080"
+		}
+		results, err := server.DistributeRequests(req, port, m.ProxyServiceName)
+		if err != nil {
+			return m.writeError(w, err)
+		}
+		failed := GetFailedAddresses(results)
+		if len(failed) == len(results) {
+			return m.writeError(w, fmt.Errorf("Could not send distribute request to any of the addresses: %s", failed))
+		}
+		msg := CertResponse{Status: "OK", Message: "", Peers: results}
+		if len(failed) > 0 {
+			msg.Message = fmt.Sprintf("Could not send distribute request to the following addresses: %s", failed)
+		}
+		m.writeOK(w, msg)
+		return nil
+	}
+	if err := m.removeCert(proxy.ForContext(req.Context()), certName); err != nil {
+		return m.writeError(w, err)
+	}
+	m.writeOK(w, CertResponse{Status: "OK", Message: ""})
+	return nil
+}
+
+// RemoveCert removes the certificate from the certs directory and the proxy configuration
+func (m *Cert) RemoveCert(certName string) error {
+	return m.removeCert(proxy.Instance, certName)
+}
+
+func (m *Cert) removeCert(p proxy.Proxy, certName string) error {
+	if err := m.removeFile(certName); err != nil {
+		return err
+	}
+	p.RemoveCert(certName)
+	logPrintf("Removed certificate %s", certName)
+	proxy.Instance.CreateConfigFromTemplates()
+	return proxy.Instance.Reload()
+}
+
+// Prune removes certificates that are not used by any of the services.
+// If the query parameter dryRun is true, the certificates are only listed.
+func (m *Cert) Prune(w http.ResponseWriter, req *http.Request) ([]string, error) {
+	dryRun, _ := strconv.ParseBool(req.URL.Query().Get("dryRun"))
+	pruned, err := m.pruneCerts(proxy.ForContext(req.Context()), dryRun)
+	if err != nil {
+		m.writeError(w, err)
+		return []string{}, err
+	}
+	m.writeOK(w, CertResponse{Status: "OK", Message: "", Pruned: pruned})
+	return pruned, nil
+}
+
+// PruneCerts removes certificates that are neither used by services nor referenced through DEFAULT_CERT or API_CERT_NAME.
+// Certificates added through the API are kept during the grace period defined through CERTS_PRUNE_GRACE_PERIOD.
+// If dryRun is true, certificates that would be removed are returned without removing them.
+func (m *Cert) PruneCerts(dryRun bool) ([]string, error) {
+	return m.pruneCerts(proxy.Instance, dryRun)
+}
+
+func (m *Cert) pruneCerts(p proxy.Proxy, dryRun bool) ([]string, error) {
+	gracePeriod, err := m.getPruneGracePeriod()
+	if err != nil {
+		return []string{}, err
+	}
+	referenced := m.getReferencedCerts()
+	pruned := []string{}
+	mu.Lock()
+	for certName := range proxy.Instance.GetCerts() {
+		if referenced[certName] {
+			continue
+		}
+		if addedAt, ok := certsAddedAt[certName]; ok && timeNow().Sub(addedAt) < gracePeriod {
+			continue
+		}
+		pruned = append(pruned, certName)
+	}
+	mu.Unlock()
+	sort.Strings(pruned)
+	if dryRun || len(pruned) == 0 {
+		return pruned, nil
+	}
+	for _, certName := range pruned {
+		if err := m.removeFile(certName); err != nil {
+			return []string{}, err
+		}
+		p.RemoveCert(certName)
+		logPrintf("Pruned certificate %s", certName)
+	}
+	proxy.Instance.CreateConfigFromTemplates()
+	proxy.Instance.Reload()
+	return pruned, nil
+}
+
+// Returns the names of certificates used by the services (directly or through cert domains) and environment variables
+func (m *Cert) getReferencedCerts() map[string]bool {
+	referenced := map[string]bool{}
+	for _, env := range []string{"DEFAULT_CERT", "API_CERT_NAME"} {
+		if len(os.Getenv(env)) > 0 {
+			referenced[os.Getenv(env)] = true
+		}
+	}
+	for _, s := range proxy.Instance.GetServices() {
+		if len(s.ServiceCert) > 0 {
+			if len(s.ServiceDomain) > 0 {
+				referenced[s.ServiceDomain[0]] = true
+			} else {
+				referenced[s.ServiceName] = true
+			}
+		}
+		for certName := range s.CertDomains {
+			referenced[certName] = true
+		}
+	}
+	return referenced
+}
+
+func (m *Cert) getPruneGracePeriod() (time.Duration, error) {
+	value := os.Getenv("CERTS_PRUNE_GRACE_PERIOD")
+	if len(value) == 0 {
+		return time.Hour, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("CERTS_PRUNE_GRACE_PERIOD must be a number of seconds\n%s", err.Error())
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
 func (m *Cert) getCertFromRequest(w http.ResponseWriter, req *http.Request) (certName string, certContent []byte, err error) {
 	certName = req.URL.Query().Get("certName")
 	if len(certName) == 0 {
@@ -162,11 +323,25 @@ func (m *Cert) writeFile(certName string, certContent []byte) (path string, err
 		return "", err
 	} else {
 		f.Write(certContent)
+		f.Close()
+	}
+	if apiCertInstance != nil {
+		apiCertInstance.reset(m.CertsDir, certName)
 	}
 	path, _ = filepath.Abs(fmt.Sprintf("%s/%s", m.CertsDir, certName))
 	return path, nil
 }
 
+func (m *Cert) removeFile(certName string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(certsAddedAt, certName)
+	if err := os.Remove(fmt.Sprintf("%s/%s", m.CertsDir, certName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (m *Cert) writeOK(w http.ResponseWriter, msg interface{}) {
 	httpWriterSetContentType(w, "application/json")
 	w.WriteHeader(http.StatusOK)
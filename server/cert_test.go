@@ -14,13 +14,20 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 type CertTestSuite struct {
 	suite.Suite
+	CertsDir string
 }
 
 func (s *CertTestSuite) SetupTest() {
+	s.CertsDir, _ = ioutil.TempDir("", "certs")
+}
+
+func (s *CertTestSuite) TearDownTest() {
+	os.RemoveAll(s.CertsDir)
 }
 
 func TestCertUnitTestSuite(t *testing.T) {
@@ -46,7 +53,7 @@ func (s *CertTestSuite) Test_GetAll_SetsContentTypeToJson() {
 	httpWriterSetContentType = func(w http.ResponseWriter, value string) {
 		actual = value
 	}
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	req, _ := http.NewRequest(
 		"GET",
@@ -60,7 +67,7 @@ func (s *CertTestSuite) Test_GetAll_SetsContentTypeToJson() {
 }
 
 func (s *CertTestSuite) Test_GetAll_WritesHeaderStatus200() {
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	req, _ := http.NewRequest(
 		"GET",
@@ -94,7 +101,7 @@ func (s *CertTestSuite) Test_GetAll_WritesReturnsCert() {
 		Message: "",
 		Certs:   certs,
 	}
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	req, _ := http.NewRequest(
 		"GET",
@@ -107,6 +114,110 @@ func (s *CertTestSuite) Test_GetAll_WritesReturnsCert() {
 	s.EqualValues(expected, actual)
 }
 
+// PruneCerts
+
+func (s *CertTestSuite) Test_PruneCerts_RemovesCertsNotReferencedByServices() {
+	dir, _ := ioutil.TempDir("", "certs")
+	defer os.RemoveAll(dir)
+	for _, certName := range []string{"orphan.pem", "my-domain.com", "my-service", "auto.pem", "default.pem"} {
+		ioutil.WriteFile(fmt.Sprintf("%s/%s", dir, certName), []byte("Content of the cert"), 0644)
+	}
+	os.Setenv("DEFAULT_CERT", "default.pem")
+	defer os.Unsetenv("DEFAULT_CERT")
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxyMock := new(ProxyMock)
+	proxyMock.On("GetServices").Return(map[string]proxy.Service{
+		"with-domain":  {ServiceName: "with-domain", ServiceDomain: []string{"my-domain.com"}, ServiceCert: "cert"},
+		"my-service":   {ServiceName: "my-service", ServiceCert: "cert"},
+		"auto-service": {ServiceName: "auto-service", CertDomains: map[string][]string{"auto.pem": {"auto.example.com"}}},
+	})
+	proxyMock.On("RemoveCert", mock.Anything)
+	proxyMock.On("CreateConfigFromTemplates").Return(nil)
+	proxyMock.On("Reload").Return(nil)
+	proxyMock.On("GetCerts").Return(map[string]string{
+		"orphan.pem": "", "my-domain.com": "", "my-service": "", "auto.pem": "", "default.pem": "",
+	})
+	proxy.Instance = proxyMock
+	c := NewCert(dir)
+
+	actual, err := c.PruneCerts(false)
+
+	s.NoError(err)
+	s.Equal([]string{"orphan.pem"}, actual)
+	_, err = os.Stat(fmt.Sprintf("%s/orphan.pem", dir))
+	s.True(os.IsNotExist(err))
+	_, err = os.Stat(fmt.Sprintf("%s/my-domain.com", dir))
+	s.NoError(err)
+	proxyMock.AssertCalled(s.T(), "RemoveCert", "orphan.pem")
+	proxyMock.AssertNotCalled(s.T(), "RemoveCert", "default.pem")
+	proxyMock.AssertCalled(s.T(), "Reload")
+}
+
+func (s *CertTestSuite) Test_PruneCerts_DoesNotRemoveCerts_WhenDryRun() {
+	dir, _ := ioutil.TempDir("", "certs")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(fmt.Sprintf("%s/orphan.pem", dir), []byte("Content of the cert"), 0644)
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxyMock := getProxyMock("GetCerts")
+	proxyMock.On("GetCerts").Return(map[string]string{"orphan.pem": ""})
+	proxy.Instance = proxyMock
+	c := NewCert(dir)
+
+	actual, _ := c.PruneCerts(true)
+
+	s.Equal([]string{"orphan.pem"}, actual)
+	_, err := os.Stat(fmt.Sprintf("%s/orphan.pem", dir))
+	s.NoError(err)
+	proxyMock.AssertNotCalled(s.T(), "RemoveCert", "orphan.pem")
+}
+
+func (s *CertTestSuite) Test_PruneCerts_DoesNotRemoveCertsAddedWithinGracePeriod() {
+	dir, _ := ioutil.TempDir("", "certs")
+	defer os.RemoveAll(dir)
+	timeNowOrig := timeNow
+	defer func() {
+		timeNow = timeNowOrig
+		certsAddedAt = map[string]time.Time{}
+	}()
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxyMock := getProxyMock("GetCerts")
+	proxyMock.On("GetCerts").Return(map[string]string{"new.pem": "", "old.pem": ""})
+	proxy.Instance = proxyMock
+	c := NewCert(dir)
+	for _, certName := range []string{"old.pem", "new.pem"} {
+		req, _ := http.NewRequest(
+			"PUT",
+			"http://acme.com/v1/docker-flow-proxy/cert?certName="+certName,
+			strings.NewReader("Content of the cert"),
+		)
+		c.Put(getResponseWriterMock(), req)
+		now = now.Add(30 * time.Minute)
+	}
+
+	actual, _ := c.PruneCerts(true)
+	s.Equal([]string{"old.pem"}, actual)
+
+	os.Setenv("CERTS_PRUNE_GRACE_PERIOD", "3600")
+	defer os.Unsetenv("CERTS_PRUNE_GRACE_PERIOD")
+	now = now.Add(30 * time.Minute)
+	actual, _ = c.PruneCerts(true)
+	s.Equal([]string{"new.pem", "old.pem"}, actual)
+}
+
+func (s *CertTestSuite) Test_PruneCerts_ReturnsError_WhenGracePeriodIsInvalid() {
+	os.Setenv("CERTS_PRUNE_GRACE_PERIOD", "1h")
+	defer os.Unsetenv("CERTS_PRUNE_GRACE_PERIOD")
+
+	_, err := NewCert(s.CertsDir).PruneCerts(true)
+
+	s.Error(err)
+}
+
 // Init
 
 func (s *ServerTestSuite) Test_Init_InvokesLookupHost() {
@@ -117,7 +228,7 @@ func (s *ServerTestSuite) Test_Init_InvokesLookupHost() {
 		actualHost = host
 		return []string{}, nil
 	}
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	c.ProxyServiceName = s.ServiceName
 
 	c.Init()
@@ -131,7 +242,7 @@ func (s *ServerTestSuite) Test_Init_ReturnsError_WhenLookupHostFails() {
 	lookupHost = func(host string) (addrs []string, err error) {
 		return []string{}, fmt.Errorf("This is an LookupHost error")
 	}
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 
 	err := c.Init()
 
@@ -157,7 +268,7 @@ func (s *ServerTestSuite) Test_Init_SendsHttpRequestForEachIp() {
 	proxyMock := getProxyMock("")
 	proxy.Instance = proxyMock
 
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	c.ProxyServiceName = s.ServiceName
 
 	c.Init()
@@ -171,7 +282,7 @@ func (s *ServerTestSuite) Test_Init_DoesNotFail_WhenRequestFails() {
 	lookupHost = func(host string) (addrs []string, err error) {
 		return []string{"unknown-address"}, nil
 	}
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	c.ProxyServiceName = s.ServiceName
 
 	err := c.Init()
@@ -191,7 +302,7 @@ func (s *ServerTestSuite) Test_Init_WritesCertToFile() {
 		return []string{hostPort}, nil
 	}
 
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	path := fmt.Sprintf("%s/%s", c.CertsDir, "my-cert-3.pem")
 	os.Remove(path)
 	c.ProxyServiceName = s.ServiceName
@@ -219,7 +330,7 @@ func (s *ServerTestSuite) Test_Init_InvokesProxyAddCert() {
 		hostPort := net.JoinHostPort(ip, port)
 		return []string{hostPort}, nil
 	}
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	c.ProxyServiceName = s.ServiceName
 	proxyOrig := proxy.Instance
 	defer func() { proxy.Instance = proxyOrig }()
@@ -242,7 +353,7 @@ func (s *ServerTestSuite) Test_Init_InvokesProxyCreateConfigFromTemplates() {
 		hostPort := net.JoinHostPort(ip, port)
 		return []string{hostPort}, nil
 	}
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	c.ProxyServiceName = s.ServiceName
 	c.ServicePort = port
 	proxyOrig := proxy.Instance
@@ -266,7 +377,7 @@ func (s *ServerTestSuite) Test_Init_InvokesProxyReload() {
 		hostPort := net.JoinHostPort(ip, port)
 		return []string{hostPort}, nil
 	}
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	c.ProxyServiceName = s.ServiceName
 	c.ServicePort = port
 	proxyOrig := proxy.Instance
@@ -297,7 +408,7 @@ func (s *ServerTestSuite) Test_Init_WritesCertToFile_WhenItComesFromTheBiggestRe
 		hostPort2 := net.JoinHostPort(ip2, port2)
 		return []string{hostPort1, hostPort2}, nil
 	}
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	path2 := fmt.Sprintf("%s/%s", c.CertsDir, "my-cert-2.pem")
 	os.Remove(path2)
 	path3 := fmt.Sprintf("%s/%s", c.CertsDir, "my-cert-3.pem")
@@ -338,7 +449,7 @@ func (s *ServerTestSuite) getCertGetAllMockServer(from, to int) *httptest.Server
 // Put
 
 func (s *CertTestSuite) Test_Put_SavesBodyAsFile() {
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	certName := "test.pem"
 	expected := "THIS IS A CERTIFICATE"
 	path := fmt.Sprintf("%s/%s", c.CertsDir, certName)
@@ -362,7 +473,7 @@ func (s *CertTestSuite) Test_Put_InvokesProxyAddCert() {
 	defer func() { proxy.Instance = proxyOrig }()
 	proxyMock := getProxyMock("")
 	proxy.Instance = proxyMock
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	certName := "test.pem"
 	w := getResponseWriterMock()
 	req, _ := http.NewRequest(
@@ -383,7 +494,7 @@ func (s *CertTestSuite) Test_Put_SetsContentTypeToJson() {
 	httpWriterSetContentType = func(w http.ResponseWriter, value string) {
 		actual = value
 	}
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	req, _ := http.NewRequest(
 		"PUT",
@@ -400,7 +511,7 @@ func (s *CertTestSuite) Test_Put_WritesHeaderStatus200() {
 	expected, _ := json.Marshal(CertResponse{
 		Status: "OK",
 	})
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	req, _ := http.NewRequest(
 		"PUT",
@@ -419,7 +530,7 @@ func (s *CertTestSuite) Test_Put_SendsDistributeRequests_WhenDistruibuteParamIsP
 	serviceNameOrig := os.Getenv("SERVICE_NAME")
 	defer func() { os.Setenv("SERVICE_NAME", serviceNameOrig) }()
 	os.Setenv("SERVICE_NAME", serviceName)
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	req, _ := http.NewRequest(
 		"PUT",
@@ -437,7 +548,7 @@ func (s *CertTestSuite) Test_Put_SendsDistributeRequests_WhenDistruibuteParamIsP
 }
 
 func (s *CertTestSuite) Test_Put_ReturnsError_WhenCertNameIsNotPresent() {
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	req, _ := http.NewRequest(
 		"PUT",
@@ -455,7 +566,7 @@ func (s *CertTestSuite) Test_Put_SendsDistributeRequestsToPort8080_WhenPortIsNot
 	serviceNameOrig := os.Getenv("SERVICE_NAME")
 	defer func() { os.Setenv("SERVICE_NAME", serviceNameOrig) }()
 	os.Setenv("SERVICE_NAME", serviceName)
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	req, _ := http.NewRequest(
 		"PUT",
@@ -477,7 +588,7 @@ func (s *CertTestSuite) Test_Put_ReturnsError_WhenSendDistributeRequestsReturnsE
 	serviceNameOrig := os.Getenv("SERVICE_NAME")
 	defer func() { os.Setenv("SERVICE_NAME", serviceNameOrig) }()
 	os.Setenv("SERVICE_NAME", serviceName)
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	req, _ := http.NewRequest(
 		"PUT",
@@ -500,7 +611,7 @@ func (s *CertTestSuite) Test_Put_ReturnsError_WhenSendDistributeRequestsReturnsN
 	serviceNameOrig := os.Getenv("SERVICE_NAME")
 	defer func() { os.Setenv("SERVICE_NAME", serviceNameOrig) }()
 	os.Setenv("SERVICE_NAME", serviceName)
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	req, _ := http.NewRequest(
 		"PUT",
@@ -547,7 +658,7 @@ func (s *CertTestSuite) Test_Put_WritesHeaderStatus400_WhenDirectoryDoesNotExist
 }
 
 func (s *CertTestSuite) Test_Put_ReturnsError_WhenCannotReadBody() {
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	r := ReaderMock{
 		ReadMock: func([]byte) (int, error) { return 0, fmt.Errorf("This is an error") },
@@ -560,7 +671,7 @@ func (s *CertTestSuite) Test_Put_ReturnsError_WhenCannotReadBody() {
 }
 
 func (s *CertTestSuite) Test_Put_WritesHeaderStatus40_WhenCannotReadBody() {
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	r := ReaderMock{
 		ReadMock: func([]byte) (int, error) { return 0, fmt.Errorf("This is an error") },
@@ -573,7 +684,7 @@ func (s *CertTestSuite) Test_Put_WritesHeaderStatus40_WhenCannotReadBody() {
 }
 
 func (s *CertTestSuite) Test_Put_ReturnsCertPath() {
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	certName := "test.pem"
 	expected, _ := filepath.Abs(fmt.Sprintf("%s/%s", c.CertsDir, certName))
 	w := getResponseWriterMock()
@@ -589,7 +700,7 @@ func (s *CertTestSuite) Test_Put_ReturnsCertPath() {
 }
 
 func (s *CertTestSuite) Test_Put_ReturnsError_WhenCertNameDoesNotExist() {
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	req, _ := http.NewRequest(
 		"PUT",
@@ -603,7 +714,7 @@ func (s *CertTestSuite) Test_Put_ReturnsError_WhenCertNameDoesNotExist() {
 }
 
 func (s *CertTestSuite) Test_Put_ReturnsError_WhenBodyIsEmpty() {
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	req, _ := http.NewRequest(
 		"PUT",
@@ -617,7 +728,7 @@ func (s *CertTestSuite) Test_Put_ReturnsError_WhenBodyIsEmpty() {
 }
 
 func (s *CertTestSuite) Test_Put_InvokesProxyCreateConfigFromTemplates() {
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	req, _ := http.NewRequest(
 		"PUT",
@@ -633,7 +744,7 @@ func (s *CertTestSuite) Test_Put_InvokesProxyCreateConfigFromTemplates() {
 }
 
 func (s *CertTestSuite) Test_Put_InvokesProxyReload() {
-	c := NewCert("../certs")
+	c := NewCert(s.CertsDir)
 	w := getResponseWriterMock()
 	req, _ := http.NewRequest(
 		"PUT",
@@ -648,6 +759,105 @@ func (s *CertTestSuite) Test_Put_InvokesProxyReload() {
 	proxyMock.AssertCalled(s.T(), "Reload")
 }
 
+// Remove
+
+func (s *CertTestSuite) Test_Remove_RemovesCert() {
+	dir, _ := ioutil.TempDir("", "certs")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(fmt.Sprintf("%s/my-cert.pem", dir), []byte("Content of the cert"), 0644)
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxyMock := getProxyMock("")
+	proxy.Instance = proxyMock
+	c := NewCert(dir)
+	w := getResponseWriterMock()
+	req, _ := http.NewRequest("DELETE", "http://acme.com/v1/docker-flow-proxy/cert?certName=my-cert.pem", nil)
+
+	err := c.Remove(w, req)
+
+	s.NoError(err)
+	_, err = os.Stat(fmt.Sprintf("%s/my-cert.pem", dir))
+	s.True(os.IsNotExist(err))
+	proxyMock.AssertCalled(s.T(), "RemoveCert", "my-cert.pem")
+	proxyMock.AssertCalled(s.T(), "Reload")
+	w.AssertCalled(s.T(), "WriteHeader", 200)
+}
+
+func (s *CertTestSuite) Test_Remove_ReturnsError_WhenCertNameIsNotPresent() {
+	c := NewCert(s.CertsDir)
+	w := getResponseWriterMock()
+	req, _ := http.NewRequest("DELETE", "http://acme.com/v1/docker-flow-proxy/cert", nil)
+
+	err := c.Remove(w, req)
+
+	s.Error(err)
+	w.AssertCalled(s.T(), "WriteHeader", 400)
+}
+
+func (s *CertTestSuite) Test_Remove_ReportsFailedPeers_WhenSomePeersAreUnreachable() {
+	c := NewCert(s.CertsDir)
+	w := getResponseWriterMock()
+	req, _ := http.NewRequest("DELETE", "http://acme.com:1234/v1/docker-flow-proxy/cert?certName=my-cert.pem&distribute=true", nil)
+	results := []DistributeResult{
+		{Address: "10.0.0.1", Status: 200},
+		{Address: "10.0.0.2", Error: "connection refused"},
+	}
+	serverOrig := server
+	defer func() { server = serverOrig }()
+	mockObj := new(ServerMock)
+	mockObj.On("DistributeRequests", req, "1234", mock.Anything).Return(results, nil)
+	server = mockObj
+	expected, _ := json.Marshal(CertResponse{
+		Status:  "OK",
+		Message: "Could not send distribute request to the following addresses: [10.0.0.2]",
+		Peers:   results,
+	})
+
+	err := c.Remove(w, req)
+
+	s.NoError(err)
+	w.AssertCalled(s.T(), "WriteHeader", 200)
+	w.AssertCalled(s.T(), "Write", expected)
+}
+
+func (s *CertTestSuite) Test_Remove_ReturnsError_WhenAllPeersAreUnreachable() {
+	c := NewCert(s.CertsDir)
+	w := getResponseWriterMock()
+	req, _ := http.NewRequest("DELETE", "http://acme.com/v1/docker-flow-proxy/cert?certName=my-cert.pem&distribute=true", nil)
+	serverOrig := server
+	defer func() { server = serverOrig }()
+	mockObj := new(ServerMock)
+	mockObj.On("DistributeRequests", req, "8080", mock.Anything).Return([]DistributeResult{{Address: "10.0.0.1", Error: "connection refused"}}, nil)
+	server = mockObj
+
+	err := c.Remove(w, req)
+
+	s.Error(err)
+	w.AssertCalled(s.T(), "WriteHeader", 400)
+}
+
+func (s *CertTestSuite) Test_Remove_DoesNotDistribute_WhenRequestWasDistributed() {
+	dir, _ := ioutil.TempDir("", "certs")
+	defer os.RemoveAll(dir)
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxyMock := getProxyMock("")
+	proxy.Instance = proxyMock
+	serverOrig := server
+	defer func() { server = serverOrig }()
+	mockObj := new(ServerMock)
+	server = mockObj
+	c := NewCert(dir)
+	w := getResponseWriterMock()
+	req, _ := http.NewRequest("DELETE", "http://acme.com/v1/docker-flow-proxy/cert?certName=my-cert.pem&distribute=true", nil)
+	req.Header.Set(DistributedHeader, "true")
+
+	c.Remove(w, req)
+
+	mockObj.AssertNotCalled(s.T(), "DistributeRequests", mock.Anything, mock.Anything, mock.Anything)
+	proxyMock.AssertCalled(s.T(), "RemoveCert", "my-cert.pem")
+}
+
 // NewCert
 
 func (s *CertTestSuite) Test_NewCert_SetsCertsDir() {
@@ -663,7 +873,7 @@ func (s *CertTestSuite) Test_NewCert_SetsServiceName() {
 	defer func() { os.Setenv("SERVICE_NAME", serviceNameOrig) }()
 	os.Setenv("SERVICE_NAME", serviceName)
 
-	cert := NewCert("../certs")
+	cert := NewCert(s.CertsDir)
 
 	s.Equal(serviceName, cert.ProxyServiceName)
 }
@@ -732,7 +942,12 @@ func (m *ProxyMock) Reload() error {
 	return params.Error(0)
 }
 
-func (m *ProxyMock) AddCert(certName string) {
+func (m *ProxyMock) AddCert(certName string) error {
+	params := m.Called(certName)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) RemoveCert(certName string) {
 	m.Called(certName)
 }
 
@@ -741,16 +956,75 @@ func (m *ProxyMock) GetCerts() map[string]string {
 	return params.Get(0).(map[string]string)
 }
 
-func (m *ProxyMock) AddService(service proxy.Service) {
-	m.Called(service)
+func (m *ProxyMock) AddService(service proxy.Service) error {
+	params := m.Called(service)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) RemoveService(service string) error {
+	params := m.Called(service)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) GetServices() map[string]proxy.Service {
+	params := m.Called()
+	return params.Get(0).(map[string]proxy.Service)
+}
+
+func (m *ProxyMock) GetServicesByNamespace(namespace string) map[string]proxy.Service {
+	params := m.Called(namespace)
+	return params.Get(0).(map[string]proxy.Service)
+}
+
+func (m *ProxyMock) RemoveNamespace(namespace string) error {
+	params := m.Called(namespace)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) CreateSupportBundle() ([]byte, error) {
+	params := m.Called()
+	return params.Get(0).([]byte), params.Error(1)
+}
+
+func (m *ProxyMock) DebugState() proxy.DebugState {
+	params := m.Called()
+	return params.Get(0).(proxy.DebugState)
+}
+
+func (m *ProxyMock) SetServiceReplicas(serviceName string, replicas int) error {
+	params := m.Called(serviceName, replicas)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) ReloadAfter(delay time.Duration) error {
+	params := m.Called(delay)
+	return params.Error(0)
+}
+
+func (m *ProxyMock) LoadState() error {
+	params := m.Called()
+	return params.Error(0)
 }
 
-func (m *ProxyMock) RemoveService(service string) {
-	m.Called(service)
+func (m *ProxyMock) WithMutations() proxy.Proxy {
+	m.Called()
+	return m
+}
+
+// Without a renderer of the test, the mock uses the renderer of the flavor defined through CONFIG_FLAVOR
+func (m *ProxyMock) GetRenderer() proxy.ConfigRenderer {
+	params := m.Called()
+	if renderer, ok := params.Get(0).(proxy.ConfigRenderer); ok {
+		return renderer
+	}
+	return proxy.HaProxy{}.GetRenderer()
 }
 
 func getProxyMock(skipMethod string) *ProxyMock {
 	mockObj := new(ProxyMock)
+	if skipMethod != "GetRenderer" {
+		mockObj.On("GetRenderer").Return(nil)
+	}
 	if skipMethod != "RunCmd" {
 		mockObj.On("RunCmd", mock.Anything).Return(nil)
 	}
@@ -766,14 +1040,44 @@ func getProxyMock(skipMethod string) *ProxyMock {
 	if skipMethod != "AddCert" {
 		mockObj.On("AddCert", mock.Anything).Return(nil)
 	}
+	if skipMethod != "RemoveCert" {
+		mockObj.On("RemoveCert", mock.Anything)
+	}
 	if skipMethod != "GetCerts" {
 		mockObj.On("GetCerts").Return(map[string]string{})
 	}
 	if skipMethod != "AddService" {
-		mockObj.On("AddService", mock.Anything)
+		mockObj.On("AddService", mock.Anything).Return(nil)
 	}
 	if skipMethod != "RemoveService" {
-		mockObj.On("RemoveService", mock.Anything)
+		mockObj.On("RemoveService", mock.Anything).Return(nil)
+	}
+	if skipMethod != "GetServices" {
+		mockObj.On("GetServices").Return(map[string]proxy.Service{})
+	}
+	if skipMethod != "GetServicesByNamespace" {
+		mockObj.On("GetServicesByNamespace", mock.Anything).Return(map[string]proxy.Service{})
+	}
+	if skipMethod != "RemoveNamespace" {
+		mockObj.On("RemoveNamespace", mock.Anything).Return(nil)
+	}
+	if skipMethod != "CreateSupportBundle" {
+		mockObj.On("CreateSupportBundle").Return([]byte{}, nil)
+	}
+	if skipMethod != "DebugState" {
+		mockObj.On("DebugState").Return(proxy.DebugState{})
+	}
+	if skipMethod != "SetServiceReplicas" {
+		mockObj.On("SetServiceReplicas", mock.Anything, mock.Anything).Return(nil)
+	}
+	if skipMethod != "ReloadAfter" {
+		mockObj.On("ReloadAfter", mock.Anything).Return(nil)
+	}
+	if skipMethod != "LoadState" {
+		mockObj.On("LoadState").Return(nil)
+	}
+	if skipMethod != "WithMutations" {
+		mockObj.On("WithMutations")
 	}
 	return mockObj
 }
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// The request headers the API reads. Browsers send only those listed in the preflight responses.
+var corsAllowedHeaders = []string{"Authorization", "Content-Type", "Idempotency-Key"}
+
+// The number of seconds browsers cache the preflight responses
+const corsMaxAge = 600
+
+// Cors adds the CORS headers to the responses of the API so that it can be called by browser-based dashboards.
+// It answers the preflight requests itself so that they never reach the endpoints.
+// It does not authorize requests. Requests from origins that are not allowed are still processed
+// and only the browsers refuse to expose their responses.
+type Cors struct {
+	// The allowed origins (e.g. https://dashboard.acme.com). An origin `*` allows all of them.
+	Origins []string
+	// Whether browsers send the credentials (e.g. cookies) of the origin. Allowed only with explicit origins.
+	Credentials bool
+
+	methods func(path string) []string
+}
+
+// NewCors returns the middleware allowing the origins.
+// The methods function returns the methods of the endpoint with the path or nil if there is no such endpoint.
+func NewCors(origins []string, credentials bool, methods func(path string) []string) (*Cors, error) {
+	for _, origin := range origins {
+		if origin == "*" && credentials {
+			return nil, fmt.Errorf("The credentials cannot be allowed with the origin *. Please list the allowed origins")
+		}
+	}
+	return &Cors{Origins: origins, Credentials: credentials, methods: methods}, nil
+}
+
+// NewApiCors returns the middleware configured through API_CORS_ORIGINS and API_CORS_CREDENTIALS.
+// It returns nil if API_CORS_ORIGINS is not set.
+func NewApiCors(methods func(path string) []string) (*Cors, error) {
+	origins := []string{}
+	for _, origin := range strings.Split(os.Getenv("API_CORS_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); len(origin) > 0 {
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	if len(origins) == 0 {
+		return nil, nil
+	}
+	return NewCors(origins, strings.EqualFold(os.Getenv("API_CORS_CREDENTIALS"), "true"), methods)
+}
+
+// Middleware answers the preflight requests and adds the CORS headers to the responses to the allowed origins
+func (m *Cors) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		if len(origin) == 0 {
+			next.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allowed := m.isAllowed(origin)
+		if req.Method == "OPTIONS" && len(req.Header.Get("Access-Control-Request-Method")) > 0 {
+			methods := m.methods(req.URL.Path)
+			if !allowed {
+				logPrintf("The preflight request %s from the origin %s was rejected since the origin is not allowed", req.URL.Path, origin)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			} else if methods == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			m.setOriginHeaders(w, origin)
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(append(methods, "OPTIONS"), ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsAllowedHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", fmt.Sprintf("%d", corsMaxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if allowed {
+			m.setOriginHeaders(w, origin)
+			w.Header().Set("Access-Control-Expose-Headers", "Retry-After")
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (m *Cors) isAllowed(origin string) bool {
+	for _, o := range m.Origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Cors) setOriginHeaders(w http.ResponseWriter, origin string) {
+	if m.isWildcard() {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if m.Credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (m *Cors) isWildcard() bool {
+	for _, o := range m.Origins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
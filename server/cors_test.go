@@ -0,0 +1,178 @@
+// +build !integration
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CorsTestSuite struct {
+	suite.Suite
+	Handled int
+}
+
+func TestCorsUnitTestSuite(t *testing.T) {
+	logPrintfOrig := logPrintf
+	defer func() { logPrintf = logPrintfOrig }()
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(CorsTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *CorsTestSuite) SetupTest() {
+	s.Handled = 0
+}
+
+func (s *CorsTestSuite) methods(path string) []string {
+	switch path {
+	case "/v1/docker-flow-proxy/services":
+		return []string{"GET"}
+	case "/v1/docker-flow-proxy/cert":
+		return []string{"PUT", "DELETE"}
+	}
+	return nil
+}
+
+func (s *CorsTestSuite) handler(origins []string, credentials bool) http.Handler {
+	cors, err := NewCors(origins, credentials, s.methods)
+	s.Require().NoError(err)
+	return cors.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.Handled++
+	}))
+}
+
+func (s *CorsTestSuite) preflight(path, origin string) *http.Request {
+	req := httptest.NewRequest("OPTIONS", path, nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	return req
+}
+
+// Middleware
+
+func (s *CorsTestSuite) Test_Middleware_AnswersPreflight_WithMethodsOfRoute() {
+	rw := httptest.NewRecorder()
+
+	s.handler([]string{"https://dashboard.acme.com"}, true).ServeHTTP(rw, s.preflight("/v1/docker-flow-proxy/cert", "https://dashboard.acme.com"))
+
+	s.Equal(http.StatusNoContent, rw.Code)
+	s.Equal(0, s.Handled)
+	s.Equal("https://dashboard.acme.com", rw.Header().Get("Access-Control-Allow-Origin"))
+	s.Equal("PUT, DELETE, OPTIONS", rw.Header().Get("Access-Control-Allow-Methods"))
+	s.Equal("Authorization, Content-Type, Idempotency-Key", rw.Header().Get("Access-Control-Allow-Headers"))
+	s.Equal("true", rw.Header().Get("Access-Control-Allow-Credentials"))
+	s.Equal("Origin", rw.Header().Get("Vary"))
+}
+
+func (s *CorsTestSuite) Test_Middleware_Returns404ToPreflight_WhenRouteDoesNotExist() {
+	rw := httptest.NewRecorder()
+
+	s.handler([]string{"*"}, false).ServeHTTP(rw, s.preflight("/v1/unknown", "https://dashboard.acme.com"))
+
+	s.Equal(http.StatusNotFound, rw.Code)
+	s.Equal(0, s.Handled)
+}
+
+func (s *CorsTestSuite) Test_Middleware_AddsHeaders_WhenOriginIsAllowed() {
+	req := httptest.NewRequest("GET", "/v1/docker-flow-proxy/services", nil)
+	req.Header.Set("Origin", "https://dashboard.acme.com")
+	rw := httptest.NewRecorder()
+
+	s.handler([]string{"https://other.acme.com", "https://dashboard.acme.com"}, false).ServeHTTP(rw, req)
+
+	s.Equal(1, s.Handled)
+	s.Equal("https://dashboard.acme.com", rw.Header().Get("Access-Control-Allow-Origin"))
+	s.Empty(rw.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func (s *CorsTestSuite) Test_Middleware_UsesWildcard_WhenAllOriginsAreAllowed() {
+	req := httptest.NewRequest("GET", "/v1/docker-flow-proxy/services", nil)
+	req.Header.Set("Origin", "https://dashboard.acme.com")
+	rw := httptest.NewRecorder()
+
+	s.handler([]string{"*"}, false).ServeHTTP(rw, req)
+
+	s.Equal(1, s.Handled)
+	s.Equal("*", rw.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func (s *CorsTestSuite) Test_Middleware_DoesNotAddHeaders_WhenOriginIsNotAllowed() {
+	req := httptest.NewRequest("GET", "/v1/docker-flow-proxy/services", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rw := httptest.NewRecorder()
+
+	s.handler([]string{"https://dashboard.acme.com"}, true).ServeHTTP(rw, req)
+
+	s.Equal(1, s.Handled)
+	s.Empty(rw.Header().Get("Access-Control-Allow-Origin"))
+	s.Empty(rw.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func (s *CorsTestSuite) Test_Middleware_RejectsPreflight_WhenOriginIsNotAllowed() {
+	rw := httptest.NewRecorder()
+
+	s.handler([]string{"https://dashboard.acme.com"}, false).ServeHTTP(rw, s.preflight("/v1/docker-flow-proxy/cert", "https://evil.example.com"))
+
+	s.Equal(http.StatusForbidden, rw.Code)
+	s.Equal(0, s.Handled)
+	s.Empty(rw.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func (s *CorsTestSuite) Test_Middleware_PassesRequestsWithoutOrigin() {
+	rw := httptest.NewRecorder()
+
+	s.handler([]string{"*"}, false).ServeHTTP(rw, httptest.NewRequest("OPTIONS", "/v1/docker-flow-proxy/services", nil))
+
+	s.Equal(1, s.Handled)
+	s.Empty(rw.Header().Get("Vary"))
+}
+
+// NewCors
+
+func (s *CorsTestSuite) Test_NewCors_ReturnsError_WhenCredentialsAreAllowedWithWildcard() {
+	_, err := NewCors([]string{"https://dashboard.acme.com", "*"}, true, s.methods)
+
+	s.Error(err)
+}
+
+// NewApiCors
+
+func (s *CorsTestSuite) Test_NewApiCors_ReturnsNil_WhenOriginsAreNotSet() {
+	cors, err := NewApiCors(s.methods)
+
+	s.NoError(err)
+	s.Nil(cors)
+}
+
+func (s *CorsTestSuite) Test_NewApiCors_UsesEnvVars() {
+	defer func() {
+		os.Unsetenv("API_CORS_ORIGINS")
+		os.Unsetenv("API_CORS_CREDENTIALS")
+	}()
+	os.Setenv("API_CORS_ORIGINS", "https://dashboard.acme.com/, https://other.acme.com")
+	os.Setenv("API_CORS_CREDENTIALS", "true")
+
+	cors, err := NewApiCors(s.methods)
+
+	s.Require().NoError(err)
+	s.Equal([]string{"https://dashboard.acme.com", "https://other.acme.com"}, cors.Origins)
+	s.True(cors.Credentials)
+}
+
+func (s *CorsTestSuite) Test_NewApiCors_ReturnsError_WhenCredentialsAreAllowedWithWildcard() {
+	defer func() {
+		os.Unsetenv("API_CORS_ORIGINS")
+		os.Unsetenv("API_CORS_CREDENTIALS")
+	}()
+	os.Setenv("API_CORS_ORIGINS", "*")
+	os.Setenv("API_CORS_CREDENTIALS", "true")
+
+	_, err := NewApiCors(s.methods)
+
+	s.Error(err)
+}
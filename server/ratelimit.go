@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The number of clients above which the buckets that refilled completely are discarded
+const maxRateLimitBuckets = 10000
+
+// RateLimiter limits the rate of requests with token buckets.
+// Each request takes a token. Tokens are added at the rate up to the burst.
+type RateLimiter struct {
+	// Tokens added per second
+	Rate float64
+	// The maximum number of tokens, that is, of requests accepted at once
+	Burst float64
+	// Whether each client IP has its own bucket. Otherwise, all the clients share one.
+	PerIp bool
+
+	now     func() time.Time
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter returns a limiter that accepts rate requests per second and up to burst requests at once.
+// The clock is used to refill the buckets.
+func NewRateLimiter(rate float64, burst int, perIp bool, now func() time.Time) *RateLimiter {
+	return &RateLimiter{
+		Rate:    rate,
+		Burst:   float64(burst),
+		PerIp:   perIp,
+		now:     now,
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// NewApiRateLimiter returns the limiter of the API configured through API_RATE_LIMIT and API_RATE_LIMIT_PER_IP.
+// It returns nil if API_RATE_LIMIT is not set.
+func NewApiRateLimiter() (*RateLimiter, error) {
+	value := os.Getenv("API_RATE_LIMIT")
+	if len(value) == 0 {
+		return nil, nil
+	}
+	rate, burst, err := ParseRateLimit(value)
+	if err != nil {
+		return nil, err
+	}
+	perIp := strings.EqualFold(os.Getenv("API_RATE_LIMIT_PER_IP"), "true")
+	return NewRateLimiter(rate, burst, perIp, timeNow), nil
+}
+
+// ParseRateLimit parses the rate limit in the `<rate>[:<burst>]` format (e.g. `5:10`).
+// The rate is the number of requests per second. If the burst is omitted, it matches the rate, rounded up.
+func ParseRateLimit(value string) (rate float64, burst int, err error) {
+	parts := strings.SplitN(value, ":", 2)
+	rate, err = strconv.ParseFloat(parts[0], 64)
+	if err != nil || rate <= 0 {
+		return 0, 0, fmt.Errorf("The rate limit %s is invalid. The rate must be a positive number of requests per second", value)
+	}
+	burst = int(math.Ceil(rate))
+	if len(parts) > 1 {
+		burst, err = strconv.Atoi(parts[1])
+		if err != nil || burst < 1 {
+			return 0, 0, fmt.Errorf("The rate limit %s is invalid. The burst must be a positive number of requests", value)
+		}
+	}
+	return rate, burst, nil
+}
+
+// Allow takes a token from the bucket of the client.
+// If the bucket is empty, it returns false and the time until a token is available.
+func (m *RateLimiter) Allow(client string) (allowed bool, retryAfter time.Duration) {
+	if !m.PerIp {
+		client = ""
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	bucket, ok := m.buckets[client]
+	if !ok {
+		m.pruneBuckets(now)
+		bucket = &tokenBucket{tokens: m.Burst, updated: now}
+		m.buckets[client] = bucket
+	}
+	bucket.tokens = math.Min(m.Burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*m.Rate)
+	bucket.updated = now
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / m.Rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// Middleware rejects the requests above the rate with the status 429 and the Retry-After header.
+// Only the requests for which limited returns true take tokens.
+func (m *RateLimiter) Middleware(next http.Handler, limited func(req *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !limited(req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		client, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			client = req.RemoteAddr
+		}
+		if allowed, retryAfter := m.Allow(client); !allowed {
+			logPrintf("The request %s from %s exceeded the API rate limit", req.URL.Path, client)
+			js, _ := json.Marshal(Response{Status: "NOK", Message: "Too many requests. Please retry later."})
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			httpWriterSetContentType(w, "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write(js)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// Discards the buckets of the clients that would have refilled completely. Must be called with the lock held.
+func (m *RateLimiter) pruneBuckets(now time.Time) {
+	if len(m.buckets) < maxRateLimitBuckets {
+		return
+	}
+	for client, bucket := range m.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*m.Rate >= m.Burst {
+			delete(m.buckets, client)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// +build !integration
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RateLimitTestSuite struct {
+	suite.Suite
+	Now time.Time
+}
+
+func TestRateLimitUnitTestSuite(t *testing.T) {
+	logPrintfOrig := logPrintf
+	defer func() { logPrintf = logPrintfOrig }()
+	logPrintf = func(format string, v ...interface{}) {}
+	s := new(RateLimitTestSuite)
+	suite.Run(t, s)
+}
+
+func (s *RateLimitTestSuite) SetupTest() {
+	s.Now = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+}
+
+func (s *RateLimitTestSuite) clock() time.Time {
+	return s.Now
+}
+
+// Allow
+
+func (s *RateLimitTestSuite) Test_Allow_AcceptsBurst() {
+	limiter := NewRateLimiter(1, 3, false, s.clock)
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.Allow("10.0.0.1")
+		s.True(allowed, "request %d", i)
+	}
+	allowed, retryAfter := limiter.Allow("10.0.0.1")
+
+	s.False(allowed)
+	s.Equal(time.Second, retryAfter)
+}
+
+func (s *RateLimitTestSuite) Test_Allow_RefillsAtRate() {
+	limiter := NewRateLimiter(2, 2, false, s.clock)
+	limiter.Allow("10.0.0.1")
+	limiter.Allow("10.0.0.1")
+
+	for i := 0; i < 10; i++ {
+		allowed, retryAfter := limiter.Allow("10.0.0.1")
+		s.False(allowed)
+		s.Equal(500*time.Millisecond, retryAfter)
+
+		s.Now = s.Now.Add(500 * time.Millisecond)
+
+		allowed, _ = limiter.Allow("10.0.0.1")
+		s.True(allowed, "request %d", i)
+	}
+}
+
+func (s *RateLimitTestSuite) Test_Allow_DoesNotExceedBurst_WhenIdle() {
+	limiter := NewRateLimiter(1, 2, false, s.clock)
+	s.Now = s.Now.Add(time.Hour)
+
+	limiter.Allow("10.0.0.1")
+	limiter.Allow("10.0.0.1")
+	allowed, _ := limiter.Allow("10.0.0.1")
+
+	s.False(allowed)
+}
+
+func (s *RateLimitTestSuite) Test_Allow_SharesBucket_WhenPerIpIsFalse() {
+	limiter := NewRateLimiter(1, 1, false, s.clock)
+
+	allowed1, _ := limiter.Allow("10.0.0.1")
+	allowed2, _ := limiter.Allow("10.0.0.2")
+
+	s.True(allowed1)
+	s.False(allowed2)
+}
+
+func (s *RateLimitTestSuite) Test_Allow_IsolatesClients_WhenPerIpIsTrue() {
+	limiter := NewRateLimiter(1, 1, true, s.clock)
+
+	allowed1, _ := limiter.Allow("10.0.0.1")
+	denied1, _ := limiter.Allow("10.0.0.1")
+	allowed2, _ := limiter.Allow("10.0.0.2")
+
+	s.True(allowed1)
+	s.False(denied1)
+	s.True(allowed2)
+}
+
+// Middleware
+
+func (s *RateLimitTestSuite) Test_Middleware_Returns429WithRetryAfter_WhenLimitIsExceeded() {
+	limiter := NewRateLimiter(0.5, 1, false, s.clock)
+	handled := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handled++
+	})
+	handler := limiter.Middleware(next, func(req *http.Request) bool { return true })
+	req := httptest.NewRequest("GET", "/v1/docker-flow-proxy/reconfigure", nil)
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+
+	s.Equal(1, handled)
+	s.Equal(http.StatusTooManyRequests, rw.Code)
+	s.Equal("2", rw.Header().Get("Retry-After"))
+	s.Contains(rw.Body.String(), `"Status":"NOK"`)
+}
+
+func (s *RateLimitTestSuite) Test_Middleware_DoesNotLimitExemptRequests() {
+	limiter := NewRateLimiter(1, 1, false, s.clock)
+	handled := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handled++
+	})
+	handler := limiter.Middleware(next, func(req *http.Request) bool {
+		return req.URL.Path != "/v1/test"
+	})
+
+	for i := 0; i < 5; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/test", nil))
+	}
+
+	s.Equal(5, handled)
+}
+
+func (s *RateLimitTestSuite) Test_Middleware_LimitsByClientIp_WhenPerIpIsTrue() {
+	limiter := NewRateLimiter(1, 1, true, s.clock)
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}), func(req *http.Request) bool { return true })
+	statuses := []int{}
+
+	for _, addr := range []string{"10.0.0.1:1234", "10.0.0.1:5678", "10.0.0.2:1234"} {
+		req := httptest.NewRequest("GET", "/v1/docker-flow-proxy/reconfigure", nil)
+		req.RemoteAddr = addr
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		statuses = append(statuses, rw.Code)
+	}
+
+	s.Equal([]int{200, 429, 200}, statuses)
+}
+
+// ParseRateLimit
+
+func (s *RateLimitTestSuite) Test_ParseRateLimit_ReturnsRateAndBurst() {
+	rate, burst, err := ParseRateLimit("5:20")
+	s.NoError(err)
+	s.Equal(5.0, rate)
+	s.Equal(20, burst)
+
+	rate, burst, err = ParseRateLimit("0.5")
+	s.NoError(err)
+	s.Equal(0.5, rate)
+	s.Equal(1, burst)
+}
+
+func (s *RateLimitTestSuite) Test_ParseRateLimit_ReturnsError_WhenValueIsInvalid() {
+	for _, value := range []string{"", "abc", "0", "-1", "5:0", "5:x"} {
+		_, _, err := ParseRateLimit(value)
+
+		s.Error(err, value)
+	}
+}
+
+// NewApiRateLimiter
+
+func (s *RateLimitTestSuite) Test_NewApiRateLimiter_ReturnsNil_WhenApiRateLimitIsNotSet() {
+	limiter, err := NewApiRateLimiter()
+
+	s.NoError(err)
+	s.Nil(limiter)
+}
+
+func (s *RateLimitTestSuite) Test_NewApiRateLimiter_UsesEnvVars() {
+	defer func() {
+		os.Unsetenv("API_RATE_LIMIT")
+		os.Unsetenv("API_RATE_LIMIT_PER_IP")
+	}()
+	os.Setenv("API_RATE_LIMIT", "5:20")
+	os.Setenv("API_RATE_LIMIT_PER_IP", "true")
+
+	limiter, err := NewApiRateLimiter()
+
+	s.Require().NoError(err)
+	s.Equal(5.0, limiter.Rate)
+	s.Equal(20.0, limiter.Burst)
+	s.True(limiter.PerIp)
+}
@@ -2,16 +2,41 @@ package server
 
 import (
 	"../proxy"
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"strings"
+	"time"
 )
 
+// DistributedHeader marks requests distributed by one of the proxy instances.
+// Such requests are never distributed again.
+const DistributedHeader = "X-Docker-Flow-Proxy-Distributed"
+
+// SecretHeader contains the DISTRIBUTE_SECRET of the instance that distributed the request
+const SecretHeader = "X-Docker-Flow-Proxy-Secret"
+
+// ReloadDelayHeader contains the duration (e.g. 4s) the instance receiving a distributed request waits before it reloads.
+// The instance that distributes the request staggers the delays so that the instances do not reload at the same time.
+const ReloadDelayHeader = "X-Reload-Delay"
+
 var server Server = NewServer()
 
+// The number of attempts to send a distributed request to an instance and the pause between them
+var distributeAttempts = 3
+var distributeRetryInterval = time.Second
+
+// The client used to retrieve the state of the other instances
+var peerClient = &http.Client{Timeout: 5 * time.Second}
+
 type Server interface {
 	SendDistributeRequests(req *http.Request, port, proxyServiceName string) (status int, err error)
+	DistributeRequests(req *http.Request, port, proxyServiceName string) ([]DistributeResult, error)
+	GetConfigHashes(port, proxyServiceName string) ([]ConfigHashResult, error)
+	GetPeerServices(port, proxyServiceName string) (map[string]proxy.Service, error)
 }
 
 type Serve struct{}
@@ -25,15 +50,131 @@ type Response struct {
 	Status               string
 	Message              string
 	ServiceName          string
+	Peers                []DistributeResult `json:",omitempty"`
+	// The warnings HAProxy printed during the last reload. Returned only by the test (ping) endpoint.
+	ReloadWarnings []string `json:",omitempty"`
 	proxy.Service
 }
 
+// DistributeResult is the outcome of a request distributed to one of the proxy instances
+type DistributeResult struct {
+	Address string
+	Status  int
+	Error   string `json:",omitempty"`
+}
+
+// ConfigHashResult contains the configuration hashes returned by one of the proxy instances
+type ConfigHashResult struct {
+	Address string
+	proxy.ConfigHash
+	Error string `json:",omitempty"`
+}
+
+// ConsistencyReport lists the instances whose configuration hashes match those of the instance that created the report
+// and the instances whose hashes differ or could not be retrieved
+type ConsistencyReport struct {
+	Consistent bool
+	Hash       proxy.ConfigHash
+	Agreeing   []string
+	Diverging  []ConfigHashResult
+}
+
+// NewConsistencyReport compares the hashes of the instances with the local ones
+func NewConsistencyReport(local proxy.ConfigHash, results []ConfigHashResult) ConsistencyReport {
+	report := ConsistencyReport{Hash: local, Agreeing: []string{}, Diverging: []ConfigHashResult{}}
+	for _, result := range results {
+		if len(result.Error) == 0 && result.ConfigHash == local {
+			report.Agreeing = append(report.Agreeing, result.Address)
+		} else {
+			report.Diverging = append(report.Diverging, result)
+		}
+	}
+	report.Consistent = len(report.Diverging) == 0
+	return report
+}
+
+// IsDistributed returns whether the request was distributed by another proxy instance
+func IsDistributed(req *http.Request) bool {
+	return len(req.Header.Get(DistributedHeader)) > 0
+}
+
+// IsForwarded returns whether the request was distributed by another proxy instance that knows DISTRIBUTE_SECRET.
+// Requests are never considered forwarded if the secret is not set.
+func IsForwarded(req *http.Request) bool {
+	return IsDistributed(req) && HasSecret(req)
+}
+
+// HasSecret returns whether the request carries DISTRIBUTE_SECRET in the secret header.
+// Requests never carry it if the secret is not set.
+func HasSecret(req *http.Request) bool {
+	secret := os.Getenv("DISTRIBUTE_SECRET")
+	if len(secret) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(req.Header.Get(SecretHeader)), []byte(secret)) == 1
+}
+
+// GetReloadDelay returns the delay the reload caused by the distributed request should wait for.
+// Requests that were not distributed by another proxy instance and invalid delays are not delayed.
+func GetReloadDelay(req *http.Request) time.Duration {
+	value := req.Header.Get(ReloadDelayHeader)
+	if len(value) == 0 || !IsDistributed(req) {
+		return 0
+	}
+	delay, err := time.ParseDuration(value)
+	if err != nil || delay < 0 {
+		logPrintf("The reload delay %s is not valid. The reload is not delayed.", value)
+		return 0
+	}
+	return delay
+}
+
+// Returns the interval between the reloads of consecutive instances caused by a distributed request.
+// It is defined through RELOAD_SPREAD_INTERVAL (e.g. 2s). The reloads are not staggered if it is not set or is invalid.
+func getReloadSpreadInterval() time.Duration {
+	value := os.Getenv("RELOAD_SPREAD_INTERVAL")
+	if len(value) == 0 {
+		return 0
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < 0 {
+		logPrintf("The reload spread interval %s is not valid. The reloads are not staggered.", value)
+		return 0
+	}
+	return interval
+}
+
+// GetFailedAddresses returns the addresses of the instances the request could not be distributed to
+func GetFailedAddresses(results []DistributeResult) []string {
+	failed := []string{}
+	for _, result := range results {
+		if len(result.Error) > 0 {
+			failed = append(failed, result.Address)
+		}
+	}
+	return failed
+}
+
 func (m *Serve) SendDistributeRequests(req *http.Request, port, proxyServiceName string) (status int, err error) {
+	results, err := m.DistributeRequests(req, port, proxyServiceName)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if failedDns := GetFailedAddresses(results); len(failedDns) > 0 {
+		return http.StatusBadRequest, fmt.Errorf("Could not send distribute request to the following addresses: %s", failedDns)
+	}
+	return http.StatusOK, nil
+}
+
+// DistributeRequests sends the request to all the instances of the proxy and returns the result for each of them.
+// Requests that fail because an instance is unreachable or returns a server error are retried.
+// If RELOAD_SPREAD_INTERVAL is set, each instance is asked to delay its reload by one interval more than the previous one.
+// The error is returned only if the instances could not be found.
+func (m *Serve) DistributeRequests(req *http.Request, port, proxyServiceName string) ([]DistributeResult, error) {
 	values := req.URL.Query()
 	values.Set("distribute", "false")
 	req.URL.RawQuery = values.Encode()
 	dns := fmt.Sprintf("tasks.%s", proxyServiceName)
-	failedDns := []string{}
 	method := req.Method
 	body := ""
 	if req.Body != nil {
@@ -41,22 +182,129 @@ func (m *Serve) SendDistributeRequests(req *http.Request, port, proxyServiceName
 		reqBody, _ := ioutil.ReadAll(req.Body)
 		body = string(reqBody)
 	}
-	if ips, err := lookupHost(dns); err == nil {
-		for i := 0; i < len(ips); i++ {
-			req.URL.Host = fmt.Sprintf("%s:%s", ips[i], port)
-			client := &http.Client{}
-			addr := fmt.Sprintf("http://%s:%s%s?%s", ips[i], port, req.URL.Path, req.URL.RawQuery)
+	ips, err := lookupHost(dns)
+	if err != nil {
+		return []DistributeResult{}, fmt.Errorf("Could not perform DNS %s lookup. If the proxy is not called 'proxy', you must set SERVICE_NAME=<name-of-the-proxy>.", dns)
+	}
+	results := []DistributeResult{}
+	spread := getReloadSpreadInterval()
+	for i, ip := range ips {
+		delay := time.Duration(i) * spread
+		req.URL.Host = fmt.Sprintf("%s:%s", ip, port)
+		addr := fmt.Sprintf("http://%s:%s%s?%s", ip, port, req.URL.Path, req.URL.RawQuery)
+		result := DistributeResult{Address: ip}
+		for attempt := 1; attempt <= distributeAttempts; attempt++ {
 			logPrintf("Sending distribution request to %s", addr)
-			req, _ := http.NewRequest(method, addr, strings.NewReader(body))
-			if resp, err := client.Do(req); err != nil || resp.StatusCode >= 300 {
-				failedDns = append(failedDns, ips[i])
+			result.Status, result.Error = m.sendDistributeRequest(method, addr, body, req.Header.Get("Authorization"), delay)
+			if len(result.Error) == 0 || (result.Status > 0 && result.Status < 500) {
+				break
+			}
+			if attempt < distributeAttempts {
+				time.Sleep(distributeRetryInterval)
 			}
 		}
-	} else {
-		return http.StatusBadRequest, fmt.Errorf("Could not perform DNS %s lookup. If the proxy is not called 'proxy', you must set SERVICE_NAME=<name-of-the-proxy>.", dns)
+		results = append(results, result)
 	}
-	if len(failedDns) > 0 {
-		return http.StatusBadRequest, fmt.Errorf("Could not send distribute request to the following addresses: %s", failedDns)
+	return results, nil
+}
+
+// GetConfigHashes retrieves the configuration hashes of all the instances of the proxy.
+// The error is returned only if the instances could not be found.
+func (m *Serve) GetConfigHashes(port, proxyServiceName string) ([]ConfigHashResult, error) {
+	dns := fmt.Sprintf("tasks.%s", proxyServiceName)
+	ips, err := lookupHost(dns)
+	if err != nil {
+		return []ConfigHashResult{}, fmt.Errorf("Could not perform DNS %s lookup. If the proxy is not called 'proxy', you must set SERVICE_NAME=<name-of-the-proxy>.", dns)
+	}
+	results := []ConfigHashResult{}
+	for _, ip := range ips {
+		result := ConfigHashResult{Address: ip}
+		addr := fmt.Sprintf("http://%s:%s/v1/docker-flow-proxy/config-hash", ip, port)
+		if err := m.getConfigHash(addr, &result.ConfigHash); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// GetPeerServices retrieves the services registered in the instances of the proxy and returns those of the instance with the most services.
+// Each instance is asked once. Those that are unreachable or respond with an error are skipped.
+// The error is returned only if the instances could not be found or none of them returned the services.
+func (m *Serve) GetPeerServices(port, proxyServiceName string) (map[string]proxy.Service, error) {
+	dns := fmt.Sprintf("tasks.%s", proxyServiceName)
+	ips, err := lookupHost(dns)
+	if err != nil {
+		return nil, fmt.Errorf("Could not perform DNS %s lookup. If the proxy is not called 'proxy', you must set SERVICE_NAME=<name-of-the-proxy>.", dns)
+	}
+	var services map[string]proxy.Service
+	for _, ip := range ips {
+		addr := fmt.Sprintf("http://%s:%s/v1/docker-flow-proxy/services?format=internal", ip, port)
+		peerServices := map[string]proxy.Service{}
+		if err := m.getPeerServices(addr, &peerServices); err != nil {
+			logPrintf("Could not retrieve the services from %s\n%s", addr, err.Error())
+			continue
+		}
+		if services == nil || len(peerServices) > len(services) {
+			services = peerServices
+		}
+	}
+	if services == nil {
+		return nil, fmt.Errorf("None of the %d instances returned the services", len(ips))
+	}
+	return services, nil
+}
+
+// The instances return the services in their internal format, including the credentials, only to the requests with DISTRIBUTE_SECRET
+func (m *Serve) getPeerServices(addr string, services *map[string]proxy.Service) error {
+	req, _ := http.NewRequest("GET", addr, nil)
+	req.Header.Set(DistributedHeader, "true")
+	req.Header.Set(SecretHeader, os.Getenv("DISTRIBUTE_SECRET"))
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("The request failed with status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(services)
+}
+
+func (m *Serve) getConfigHash(addr string, hash *proxy.ConfigHash) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(addr)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("The request failed with status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(hash)
+}
+
+// The Authorization header is forwarded so that the instances identify the same caller
+func (m *Serve) sendDistributeRequest(method, addr, body, authorization string, reloadDelay time.Duration) (status int, errMsg string) {
+	client := &http.Client{}
+	req, _ := http.NewRequest(method, addr, strings.NewReader(body))
+	req.Header.Set(DistributedHeader, "true")
+	if len(authorization) > 0 {
+		req.Header.Set("Authorization", authorization)
+	}
+	if secret := os.Getenv("DISTRIBUTE_SECRET"); len(secret) > 0 {
+		req.Header.Set(SecretHeader, secret)
+	}
+	if reloadDelay > 0 {
+		req.Header.Set(ReloadDelayHeader, reloadDelay.String())
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Sprintf("The request failed with status %d", resp.StatusCode)
 	}
-	return http.StatusOK, err
+	return resp.StatusCode, ""
 }
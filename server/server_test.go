@@ -1,6 +1,8 @@
 package server
 
 import (
+	"../proxy"
+	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
@@ -8,8 +10,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 type ServerTestSuite struct {
@@ -18,10 +22,16 @@ type ServerTestSuite struct {
 	ServiceName    string
 	Server         *httptest.Server
 	DnsIps         []string
+	CertsDir       string
 	suite.Suite
 }
 
 func (s *ServerTestSuite) SetupTest() {
+	s.CertsDir, _ = ioutil.TempDir("", "certs")
+}
+
+func (s *ServerTestSuite) TearDownTest() {
+	os.RemoveAll(s.CertsDir)
 }
 
 func TestServerUnitTestSuite(t *testing.T) {
@@ -69,6 +79,10 @@ func TestServerUnitTestSuite(t *testing.T) {
 	defer func() { logPrintf = logPrintfOrig }()
 	logPrintf = func(format string, v ...interface{}) {}
 
+	distributeRetryIntervalOrig := distributeRetryInterval
+	defer func() { distributeRetryInterval = distributeRetryIntervalOrig }()
+	distributeRetryInterval = 0
+
 	addr := strings.Replace(s.Server.URL, "http://", "", -1)
 	s.DnsIps = []string{strings.Split(addr, ":")[0]}
 
@@ -198,6 +212,396 @@ func (s *ServerTestSuite) Test_SendDistributeRequests_ReturnsError_WhenRequestFa
 	s.Assertions.Error(err)
 }
 
+// DistributeRequests
+
+func (s *ServerTestSuite) Test_DistributeRequests_ReturnsResultForEachPeer() {
+	actualHeaders := []string{}
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actualHeaders = append(actualHeaders, r.Header.Get(DistributedHeader))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer func() { testServer.Close() }()
+	port := strings.Split(testServer.URL, ":")[2]
+	dnsIpsOrig := s.DnsIps
+	defer func() { s.DnsIps = dnsIpsOrig }()
+	s.DnsIps = []string{"127.0.0.1", "127.0.0.1"}
+	req, _ := http.NewRequest("DELETE", "http://initial-proxy-address/v1/docker-flow-proxy/remove?serviceName=my-service&distribute=true", nil)
+
+	srv := Serve{}
+	actual, err := srv.DistributeRequests(req, port, s.ServiceName)
+
+	s.NoError(err)
+	s.Equal([]DistributeResult{{Address: "127.0.0.1", Status: 200}, {Address: "127.0.0.1", Status: 200}}, actual)
+	s.Equal([]string{"true", "true"}, actualHeaders)
+}
+
+func (s *ServerTestSuite) Test_DistributeRequests_StaggersReloadDelays_WhenReloadSpreadIntervalIsSet() {
+	defer os.Unsetenv("RELOAD_SPREAD_INTERVAL")
+	os.Setenv("RELOAD_SPREAD_INTERVAL", "2s")
+	actualDelays := []time.Duration{}
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actualDelays = append(actualDelays, GetReloadDelay(r))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer func() { testServer.Close() }()
+	port := strings.Split(testServer.URL, ":")[2]
+	dnsIpsOrig := s.DnsIps
+	defer func() { s.DnsIps = dnsIpsOrig }()
+	s.DnsIps = []string{"127.0.0.1", "127.0.0.1", "127.0.0.1"}
+	req, _ := http.NewRequest("GET", "http://initial-proxy-address/v1/docker-flow-proxy/reconfigure?serviceName=my-service&distribute=true", nil)
+
+	srv := Serve{}
+	srv.DistributeRequests(req, port, s.ServiceName)
+
+	s.Equal([]time.Duration{0, 2 * time.Second, 4 * time.Second}, actualDelays)
+}
+
+func (s *ServerTestSuite) Test_DistributeRequests_DoesNotSendReloadDelay_WhenReloadSpreadIntervalIsInvalid() {
+	defer os.Unsetenv("RELOAD_SPREAD_INTERVAL")
+	os.Setenv("RELOAD_SPREAD_INTERVAL", "soon")
+	actualHeaders := []string{}
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actualHeaders = append(actualHeaders, r.Header.Get(ReloadDelayHeader))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer func() { testServer.Close() }()
+	port := strings.Split(testServer.URL, ":")[2]
+	dnsIpsOrig := s.DnsIps
+	defer func() { s.DnsIps = dnsIpsOrig }()
+	s.DnsIps = []string{"127.0.0.1", "127.0.0.1"}
+	req, _ := http.NewRequest("GET", "http://initial-proxy-address/v1/docker-flow-proxy/reconfigure?serviceName=my-service&distribute=true", nil)
+
+	srv := Serve{}
+	srv.DistributeRequests(req, port, s.ServiceName)
+
+	s.Equal([]string{"", ""}, actualHeaders)
+}
+
+func (s *ServerTestSuite) Test_DistributeRequests_SendsSecret_WhenDistributeSecretIsSet() {
+	defer os.Unsetenv("DISTRIBUTE_SECRET")
+	os.Setenv("DISTRIBUTE_SECRET", "my-secret")
+	actualSecret := ""
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actualSecret = r.Header.Get(SecretHeader)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer func() { testServer.Close() }()
+	port := strings.Split(testServer.URL, ":")[2]
+	req, _ := http.NewRequest("GET", "http://initial-proxy-address/v1/docker-flow-proxy/reconfigure?serviceName=my-service", nil)
+
+	srv := Serve{}
+	srv.DistributeRequests(req, port, s.ServiceName)
+
+	s.Equal("my-secret", actualSecret)
+}
+
+func (s *ServerTestSuite) Test_DistributeRequests_ForwardsAuthorizationHeader() {
+	actual := ""
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actual = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer func() { testServer.Close() }()
+	port := strings.Split(testServer.URL, ":")[2]
+	req, _ := http.NewRequest("GET", "http://initial-proxy-address/v1/docker-flow-proxy/reconfigure?serviceName=my-service", nil)
+	req.Header.Set("Authorization", "Bearer payments-token")
+
+	srv := Serve{}
+	srv.DistributeRequests(req, port, s.ServiceName)
+
+	s.Equal("Bearer payments-token", actual)
+}
+
+// GetReloadDelay
+
+func (s *ServerTestSuite) Test_GetReloadDelay_ReturnsDelayOfDistributedRequest() {
+	testData := []struct {
+		distributed bool
+		delay       string
+		expected    time.Duration
+	}{
+		{true, "4s", 4 * time.Second},
+		{true, "1500ms", 1500 * time.Millisecond},
+		{false, "4s", 0},
+		{true, "soon", 0},
+		{true, "-4s", 0},
+		{true, "", 0},
+	}
+	for _, data := range testData {
+		req, _ := http.NewRequest("GET", "http://proxy/v1/docker-flow-proxy/reconfigure", nil)
+		if data.distributed {
+			req.Header.Set(DistributedHeader, "true")
+		}
+		req.Header.Set(ReloadDelayHeader, data.delay)
+
+		s.Equal(data.expected, GetReloadDelay(req), data.delay)
+	}
+}
+
+// IsForwarded
+
+func (s *ServerTestSuite) Test_IsForwarded_ReturnsTrue_WhenSecretMatches() {
+	defer os.Unsetenv("DISTRIBUTE_SECRET")
+	os.Setenv("DISTRIBUTE_SECRET", "my-secret")
+	req, _ := http.NewRequest("GET", "http://proxy/v1/docker-flow-proxy/reconfigure", nil)
+	req.Header.Set(DistributedHeader, "true")
+	req.Header.Set(SecretHeader, "my-secret")
+
+	s.True(IsForwarded(req))
+}
+
+func (s *ServerTestSuite) Test_IsForwarded_ReturnsFalse_WhenSecretDoesNotMatch() {
+	defer os.Unsetenv("DISTRIBUTE_SECRET")
+	os.Setenv("DISTRIBUTE_SECRET", "my-secret")
+	req, _ := http.NewRequest("GET", "http://proxy/v1/docker-flow-proxy/reconfigure", nil)
+	req.Header.Set(DistributedHeader, "true")
+	req.Header.Set(SecretHeader, "other-secret")
+
+	s.False(IsForwarded(req))
+}
+
+func (s *ServerTestSuite) Test_IsForwarded_ReturnsFalse_WhenSecretIsNotSet() {
+	req, _ := http.NewRequest("GET", "http://proxy/v1/docker-flow-proxy/reconfigure", nil)
+	req.Header.Set(DistributedHeader, "true")
+	req.Header.Set(SecretHeader, "")
+
+	s.False(IsForwarded(req))
+}
+
+// HasSecret
+
+func (s *ServerTestSuite) Test_HasSecret_ReturnsTrue_WhenSecretMatchesWithoutDistributedHeader() {
+	defer os.Unsetenv("DISTRIBUTE_SECRET")
+	os.Setenv("DISTRIBUTE_SECRET", "my-secret")
+	req, _ := http.NewRequest("GET", "http://proxy/v1/docker-flow-proxy/support-bundle", nil)
+	req.Header.Set(SecretHeader, "my-secret")
+
+	s.True(HasSecret(req))
+	s.False(IsForwarded(req))
+}
+
+func (s *ServerTestSuite) Test_HasSecret_ReturnsFalse_WhenSecretIsNotSet() {
+	req, _ := http.NewRequest("GET", "http://proxy/v1/docker-flow-proxy/support-bundle", nil)
+	req.Header.Set(SecretHeader, "")
+
+	s.False(HasSecret(req))
+}
+
+func (s *ServerTestSuite) Test_DistributeRequests_ReportsUnreachablePeers() {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer func() { testServer.Close() }()
+	port := strings.Split(testServer.URL, ":")[2]
+	dnsIpsOrig := s.DnsIps
+	defer func() { s.DnsIps = dnsIpsOrig }()
+	s.DnsIps = []string{"127.0.0.1", "127.0.0.2"}
+	req, _ := http.NewRequest("DELETE", "http://initial-proxy-address/v1/docker-flow-proxy/remove?serviceName=my-service&distribute=true", nil)
+
+	srv := Serve{}
+	actual, err := srv.DistributeRequests(req, port, s.ServiceName)
+
+	s.NoError(err)
+	s.Require().Len(actual, 2)
+	s.Empty(actual[0].Error)
+	s.NotEmpty(actual[1].Error)
+	s.Equal([]string{"127.0.0.2"}, GetFailedAddresses(actual))
+}
+
+func (s *ServerTestSuite) Test_DistributeRequests_RetriesServerErrors() {
+	requests := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer func() { testServer.Close() }()
+	port := strings.Split(testServer.URL, ":")[2]
+	req, _ := http.NewRequest("GET", "http://initial-proxy-address/v1/docker-flow-proxy/remove?serviceName=my-service&distribute=true", nil)
+
+	srv := Serve{}
+	actual, _ := srv.DistributeRequests(req, port, s.ServiceName)
+
+	s.Equal(3, requests)
+	s.Empty(GetFailedAddresses(actual))
+}
+
+func (s *ServerTestSuite) Test_DistributeRequests_DoesNotRetryClientErrors() {
+	requests := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer func() { testServer.Close() }()
+	port := strings.Split(testServer.URL, ":")[2]
+	req, _ := http.NewRequest("GET", "http://initial-proxy-address/v1/docker-flow-proxy/remove?distribute=true", nil)
+
+	srv := Serve{}
+	actual, _ := srv.DistributeRequests(req, port, s.ServiceName)
+
+	s.Equal(1, requests)
+	s.Equal([]DistributeResult{{Address: "127.0.0.1", Status: 400, Error: "The request failed with status 400"}}, actual)
+}
+
+func (s *ServerTestSuite) Test_DistributeRequests_ReturnsError_WhenLookupHostFails() {
+	lookupHostOrig := lookupHost
+	defer func() { lookupHost = lookupHostOrig }()
+	lookupHost = func(host string) (addrs []string, err error) {
+		return []string{}, fmt.Errorf("This is an LookupHost error")
+	}
+	req, _ := http.NewRequest("GET", "http://initial-proxy-address/v1/docker-flow-proxy/remove", nil)
+
+	srv := Serve{}
+	_, err := srv.DistributeRequests(req, "8080", s.ServiceName)
+
+	s.Error(err)
+}
+
+// GetConfigHashes
+
+func (s *ServerTestSuite) Test_GetConfigHashes_ReturnsHashOfEachPeer() {
+	hash := proxy.ConfigHash{Config: "config-hash", Services: "services-hash"}
+	actualPath := ""
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actualPath = r.URL.Path
+		js, _ := json.Marshal(hash)
+		w.Write(js)
+	}))
+	defer func() { testServer.Close() }()
+	port := strings.Split(testServer.URL, ":")[2]
+	dnsIpsOrig := s.DnsIps
+	defer func() { s.DnsIps = dnsIpsOrig }()
+	s.DnsIps = []string{"127.0.0.1", "127.0.0.2"}
+
+	srv := Serve{}
+	actual, err := srv.GetConfigHashes(port, s.ServiceName)
+
+	s.NoError(err)
+	s.Equal("/v1/docker-flow-proxy/config-hash", actualPath)
+	s.Require().Len(actual, 2)
+	s.Equal(ConfigHashResult{Address: "127.0.0.1", ConfigHash: hash}, actual[0])
+	s.Equal("127.0.0.2", actual[1].Address)
+	s.NotEmpty(actual[1].Error)
+}
+
+// GetPeerServices
+
+func (s *ServerTestSuite) Test_GetPeerServices_ReturnsServicesOfPeerWithMostServices() {
+	defer os.Unsetenv("DISTRIBUTE_SECRET")
+	os.Setenv("DISTRIBUTE_SECRET", "my-secret")
+	responses := []map[string]proxy.Service{
+		{"service-1": {ServiceName: "service-1"}},
+		{
+			"service-1": {ServiceName: "service-1", Users: []proxy.User{{Username: "user", Password: "pass"}}},
+			"service-2": {ServiceName: "service-2", ServiceDest: []proxy.ServiceDest{{Port: "8080", ServicePath: []string{"/api"}}}},
+		},
+	}
+	requests := []*http.Request{}
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		js, _ := json.Marshal(responses[len(requests)])
+		requests = append(requests, r)
+		w.Write(js)
+	}))
+	defer func() { testServer.Close() }()
+	port := strings.Split(testServer.URL, ":")[2]
+	dnsIpsOrig := s.DnsIps
+	defer func() { s.DnsIps = dnsIpsOrig }()
+	s.DnsIps = []string{"127.0.0.1", "127.0.0.2", "127.0.0.1"}
+
+	srv := Serve{}
+	actual, err := srv.GetPeerServices(port, s.ServiceName)
+
+	s.NoError(err)
+	s.Equal(responses[1], actual)
+	s.Require().Len(requests, 2)
+	s.Equal("/v1/docker-flow-proxy/services", requests[0].URL.Path)
+	s.Equal("internal", requests[0].URL.Query().Get("format"))
+	s.True(IsForwarded(requests[0]))
+}
+
+func (s *ServerTestSuite) Test_GetPeerServices_ReturnsError_WhenNoPeerReturnsServices() {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer func() { testServer.Close() }()
+	port := strings.Split(testServer.URL, ":")[2]
+	dnsIpsOrig := s.DnsIps
+	defer func() { s.DnsIps = dnsIpsOrig }()
+	s.DnsIps = []string{"127.0.0.1", "127.0.0.2"}
+
+	srv := Serve{}
+	_, err := srv.GetPeerServices(port, s.ServiceName)
+
+	s.Error(err)
+}
+
+func (s *ServerTestSuite) Test_GetPeerServices_ReturnsError_WhenLookupHostFails() {
+	lookupHostOrig := lookupHost
+	defer func() { lookupHost = lookupHostOrig }()
+	lookupHost = func(host string) (addrs []string, err error) {
+		return []string{}, fmt.Errorf("This is an LookupHost error")
+	}
+
+	srv := Serve{}
+	_, err := srv.GetPeerServices("8080", s.ServiceName)
+
+	s.Error(err)
+}
+
+func (s *ServerTestSuite) Test_GetConfigHashes_ReturnsError_WhenLookupHostFails() {
+	lookupHostOrig := lookupHost
+	defer func() { lookupHost = lookupHostOrig }()
+	lookupHost = func(host string) (addrs []string, err error) {
+		return []string{}, fmt.Errorf("This is an LookupHost error")
+	}
+
+	srv := Serve{}
+	_, err := srv.GetConfigHashes("8080", s.ServiceName)
+
+	s.Error(err)
+}
+
+// NewConsistencyReport
+
+func (s *ServerTestSuite) Test_NewConsistencyReport_ListsAgreeingAndDivergingInstances() {
+	local := proxy.ConfigHash{Config: "config", Services: "services"}
+	results := []ConfigHashResult{
+		{Address: "10.0.0.1", ConfigHash: local},
+		{Address: "10.0.0.2", ConfigHash: proxy.ConfigHash{Config: "other-config", Services: "services"}},
+		{Address: "10.0.0.3", Error: "The request failed with status 500"},
+		{Address: "10.0.0.4", ConfigHash: local},
+	}
+
+	actual := NewConsistencyReport(local, results)
+
+	s.False(actual.Consistent)
+	s.Equal(local, actual.Hash)
+	s.Equal([]string{"10.0.0.1", "10.0.0.4"}, actual.Agreeing)
+	s.Equal([]ConfigHashResult{results[1], results[2]}, actual.Diverging)
+}
+
+func (s *ServerTestSuite) Test_NewConsistencyReport_IsConsistent_WhenAllHashesMatch() {
+	local := proxy.ConfigHash{Config: "config", Services: "services"}
+
+	actual := NewConsistencyReport(local, []ConfigHashResult{{Address: "10.0.0.1", ConfigHash: local}})
+
+	s.True(actual.Consistent)
+	s.Empty(actual.Diverging)
+}
+
+// IsDistributed
+
+func (s *ServerTestSuite) Test_IsDistributed_ReturnsTrue_WhenHeaderIsSet() {
+	req, _ := http.NewRequest("GET", "http://initial-proxy-address/v1/docker-flow-proxy/remove", nil)
+	s.False(IsDistributed(req))
+
+	req.Header.Set(DistributedHeader, "true")
+	s.True(IsDistributed(req))
+}
+
 // Mocks
 
 type ServerMock struct {
@@ -209,6 +613,21 @@ func (m *ServerMock) SendDistributeRequests(req *http.Request, port, serviceName
 	return params.Int(0), params.Error(1)
 }
 
+func (m *ServerMock) DistributeRequests(req *http.Request, port, serviceName string) ([]DistributeResult, error) {
+	params := m.Called(req, port, serviceName)
+	return params.Get(0).([]DistributeResult), params.Error(1)
+}
+
+func (m *ServerMock) GetConfigHashes(port, serviceName string) ([]ConfigHashResult, error) {
+	params := m.Called(port, serviceName)
+	return params.Get(0).([]ConfigHashResult), params.Error(1)
+}
+
+func (m *ServerMock) GetPeerServices(port, serviceName string) (map[string]proxy.Service, error) {
+	params := m.Called(port, serviceName)
+	return params.Get(0).(map[string]proxy.Service), params.Error(1)
+}
+
 func getServerMock(skipMethod string) *ServerMock {
 	mockObj := new(ServerMock)
 	if skipMethod != "SendDistributeRequests" {
@@ -3,8 +3,11 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -12,6 +15,7 @@ import (
 	"testing"
 
 	"./actions"
+	"./metrics"
 	"./proxy"
 	"./server"
 	"github.com/stretchr/testify/mock"
@@ -71,7 +75,7 @@ func (s *ServerTestSuite) SetupTest() {
 	s.ResponseWriter = getResponseWriterMock()
 	s.RequestReconfigure, _ = http.NewRequest("GET", s.ReconfigureUrl, nil)
 	s.RequestRemove, _ = http.NewRequest("GET", s.RemoveUrl, nil)
-	httpListenAndServe = func(addr string, handler http.Handler) error {
+	httpListenAndServe = func(srv *http.Server) error {
 		return nil
 	}
 	serverImpl = Serve{
@@ -97,8 +101,8 @@ func (s *ServerTestSuite) Test_Execute_InvokesHTTPListenAndServe() {
 	}
 	var actual string
 	expected := fmt.Sprintf("%s:%s", serverImpl.IP, serverImpl.Port)
-	httpListenAndServe = func(addr string, handler http.Handler) error {
-		actual = addr
+	httpListenAndServe = func(srv *http.Server) error {
+		actual = srv.Addr
 		return nil
 	}
 
@@ -113,7 +117,7 @@ func (s *ServerTestSuite) Test_Execute_ReturnsError_WhenHTTPListenAndServeFails(
 	defer func() {
 		httpListenAndServe = orig
 	}()
-	httpListenAndServe = func(addr string, handler http.Handler) error {
+	httpListenAndServe = func(srv *http.Server) error {
 		return fmt.Errorf("This is an error")
 	}
 
@@ -122,6 +126,23 @@ func (s *ServerTestSuite) Test_Execute_ReturnsError_WhenHTTPListenAndServeFails(
 	s.Error(actual)
 }
 
+func (s *ServerTestSuite) Test_Execute_ReturnsError_WhenTemplateLintFails() {
+	lintTemplateOrig := proxyLintTemplate
+	defer func() { proxyLintTemplate = lintTemplateOrig }()
+	actualPath := ""
+	proxyLintTemplate = func(templatesPath string) error {
+		actualPath = templatesPath
+		return fmt.Errorf("The template has issues")
+	}
+	srv := Serve{}
+	srv.TemplatesPath = "/my/templates"
+
+	err := srv.Execute([]string{})
+
+	s.Error(err)
+	s.Equal("/my/templates", actualPath)
+}
+
 func (s *ServerTestSuite) Test_Execute_InvokesRunExecute() {
 	orig := NewRun
 	defer func() {
@@ -154,6 +175,42 @@ func (s *ServerTestSuite) Test_Execute_InvokesCertInit() {
 	s.True(invoked)
 }
 
+func (s *ServerTestSuite) Test_Execute_InvokesListenSyslog_WhenSyslogListenerAddressIsSet() {
+	addressOrig := os.Getenv("SYSLOG_LISTENER_ADDRESS")
+	listenOrig := metricsListenSyslog
+	defer func() {
+		os.Setenv("SYSLOG_LISTENER_ADDRESS", addressOrig)
+		metricsListenSyslog = listenOrig
+	}()
+	os.Setenv("SYSLOG_LISTENER_ADDRESS", ":1514")
+	actual := ""
+	metricsListenSyslog = func(address string) (net.PacketConn, error) {
+		actual = address
+		return nil, nil
+	}
+
+	serverImpl.Execute([]string{})
+
+	s.Equal(":1514", actual)
+}
+
+func (s *ServerTestSuite) Test_Execute_ReturnsError_WhenListenSyslogFails() {
+	addressOrig := os.Getenv("SYSLOG_LISTENER_ADDRESS")
+	listenOrig := metricsListenSyslog
+	defer func() {
+		os.Setenv("SYSLOG_LISTENER_ADDRESS", addressOrig)
+		metricsListenSyslog = listenOrig
+	}()
+	os.Setenv("SYSLOG_LISTENER_ADDRESS", ":1514")
+	metricsListenSyslog = func(address string) (net.PacketConn, error) {
+		return nil, fmt.Errorf("This is an error")
+	}
+
+	actual := serverImpl.Execute([]string{})
+
+	s.Error(actual)
+}
+
 func (s *ServerTestSuite) Test_Execute_InvokesReloadAllServices() {
 	mockObj := getReconfigureMock("")
 	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
@@ -310,6 +367,351 @@ func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus200WhenUrlIsTest() {
 	}
 }
 
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsReloadWarnings_WhenUrlIsTest() {
+	warningsOrig := proxyGetReloadWarnings
+	defer func() { proxyGetReloadWarnings = warningsOrig }()
+	proxyGetReloadWarnings = func() []string {
+		return []string{"sockets: Failed to get the sockets from the old process!"}
+	}
+	rw := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/test", nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(rw, req)
+
+	s.Equal(200, rw.Code)
+	s.Contains(rw.Body.String(), `"ReloadWarnings":["sockets: Failed to get the sockets from the old process!"]`)
+}
+
+func (s *ServerTestSuite) Test_Execute_StartsHealthNotifier_WhenHealthNotifyUrlsIsSet() {
+	urlsOrig := os.Getenv("HEALTH_NOTIFY_URLS")
+	startOrig := metricsStartHealthNotifier
+	defer func() {
+		os.Setenv("HEALTH_NOTIFY_URLS", urlsOrig)
+		metricsStartHealthNotifier = startOrig
+	}()
+	os.Setenv("HEALTH_NOTIFY_URLS", "http://alerts.acme.com")
+	invoked := false
+	metricsStartHealthNotifier = func() error {
+		invoked = true
+		return nil
+	}
+
+	serverImpl.Execute([]string{})
+
+	s.True(invoked)
+}
+
+func (s *ServerTestSuite) Test_Execute_ReturnsError_WhenHealthNotifierFails() {
+	urlsOrig := os.Getenv("HEALTH_NOTIFY_URLS")
+	startOrig := metricsStartHealthNotifier
+	defer func() {
+		os.Setenv("HEALTH_NOTIFY_URLS", urlsOrig)
+		metricsStartHealthNotifier = startOrig
+	}()
+	os.Setenv("HEALTH_NOTIFY_URLS", "http://alerts.acme.com")
+	metricsStartHealthNotifier = func() error {
+		return fmt.Errorf("This is an error")
+	}
+
+	s.Error(serverImpl.Execute([]string{}))
+}
+
+func (s *ServerTestSuite) Test_Execute_InvokesBlocklistRefresher_WhenBlocklistUrlIsSet() {
+	startOrig := proxyStartBlocklistRefresher
+	defer func() {
+		os.Unsetenv("BLOCKLIST_URL")
+		proxyStartBlocklistRefresher = startOrig
+	}()
+	os.Setenv("BLOCKLIST_URL", "http://lists.acme.com")
+	invoked := false
+	proxyStartBlocklistRefresher = func() error {
+		invoked = true
+		return nil
+	}
+
+	serverImpl.Execute([]string{})
+
+	s.True(invoked)
+}
+
+func (s *ServerTestSuite) Test_Execute_InvokesDomainOwnership_WhenDomainOwnershipFileIsSet() {
+	startOrig := proxyStartDomainOwnership
+	defer func() {
+		os.Unsetenv("DOMAIN_OWNERSHIP_FILE")
+		proxyStartDomainOwnership = startOrig
+	}()
+	os.Setenv("DOMAIN_OWNERSHIP_FILE", "/run/secrets/domains.yml")
+	proxyStartDomainOwnership = func() error {
+		return fmt.Errorf("This is an error")
+	}
+
+	s.Error(serverImpl.Execute([]string{}))
+}
+
+func (s *ServerTestSuite) Test_Execute_InvokesServiceDefaults_WhenServiceDefaultsFileIsSet() {
+	startOrig := proxyStartServiceDefaults
+	defer func() {
+		os.Unsetenv("SERVICE_DEFAULTS_FILE")
+		proxyStartServiceDefaults = startOrig
+	}()
+	os.Setenv("SERVICE_DEFAULTS_FILE", "/run/secrets/defaults.yml")
+	proxyStartServiceDefaults = func() error {
+		return fmt.Errorf("This is an error")
+	}
+
+	s.Error(serverImpl.Execute([]string{}))
+}
+
+func (s *ServerTestSuite) Test_Execute_InvokesLoadState() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxyMock := getProxyMock("")
+	proxy.Instance = proxyMock
+
+	serverImpl.Execute([]string{})
+
+	proxyMock.AssertCalled(s.T(), "LoadState")
+}
+
+func (s *ServerTestSuite) Test_Execute_AddsServicesOfPeers_WhenSyncFromPeersIsTrue() {
+	proxyOrig := proxy.Instance
+	distributorOrig := distributor
+	defer func() {
+		os.Unsetenv("SYNC_FROM_PEERS")
+		os.Unsetenv("DISTRIBUTE_SECRET")
+		proxy.Instance = proxyOrig
+		distributor = distributorOrig
+	}()
+	os.Setenv("SYNC_FROM_PEERS", "true")
+	os.Setenv("DISTRIBUTE_SECRET", "my-secret")
+	services := map[string]proxy.Service{
+		"service-1": {ServiceName: "service-1", ServiceDest: []proxy.ServiceDest{{Port: "8080", ServicePath: []string{"/1"}}}},
+		"service-2": {ServiceName: "service-2", ServiceDomain: []string{"example.com"}},
+	}
+	distributor = DistributorMock{
+		GetPeerServicesMock: func(port, proxyServiceName string) (map[string]proxy.Service, error) {
+			return services, nil
+		},
+	}
+	proxyMock := getProxyMock("")
+	proxy.Instance = proxyMock
+
+	serverImpl.Execute([]string{})
+
+	proxyMock.AssertCalled(s.T(), "AddService", services["service-1"])
+	proxyMock.AssertCalled(s.T(), "AddService", services["service-2"])
+	proxyMock.AssertCalled(s.T(), "CreateConfigFromTemplates")
+	proxyMock.AssertCalled(s.T(), "Reload")
+}
+
+func (s *ServerTestSuite) Test_Execute_StartsWithoutServicesOfPeers_WhenPeersAreUnreachable() {
+	proxyOrig := proxy.Instance
+	distributorOrig := distributor
+	defer func() {
+		os.Unsetenv("SYNC_FROM_PEERS")
+		os.Unsetenv("DISTRIBUTE_SECRET")
+		proxy.Instance = proxyOrig
+		distributor = distributorOrig
+	}()
+	os.Setenv("SYNC_FROM_PEERS", "true")
+	os.Setenv("DISTRIBUTE_SECRET", "my-secret")
+	distributor = DistributorMock{
+		GetPeerServicesMock: func(port, proxyServiceName string) (map[string]proxy.Service, error) {
+			return nil, fmt.Errorf("None of the 2 instances returned the services")
+		},
+	}
+	proxyMock := getProxyMock("")
+	proxy.Instance = proxyMock
+
+	s.NoError(serverImpl.Execute([]string{}))
+
+	proxyMock.AssertNotCalled(s.T(), "AddService", mock.Anything)
+}
+
+func (s *ServerTestSuite) Test_Execute_DoesNotSyncFromPeers_WhenDistributeSecretIsNotSet() {
+	distributorOrig := distributor
+	defer func() {
+		os.Unsetenv("SYNC_FROM_PEERS")
+		distributor = distributorOrig
+	}()
+	os.Setenv("SYNC_FROM_PEERS", "true")
+	invoked := false
+	distributor = DistributorMock{
+		GetPeerServicesMock: func(port, proxyServiceName string) (map[string]proxy.Service, error) {
+			invoked = true
+			return nil, nil
+		},
+	}
+
+	serverImpl.Execute([]string{})
+
+	s.False(invoked)
+}
+
+func (s *ServerTestSuite) Test_Execute_AppliesPendingChanges_WhenApplyPendingOnStartIsTrue() {
+	applyOrig := proxyApplyPendingChanges
+	defer func() {
+		os.Unsetenv("APPLY_PENDING_ON_START")
+		proxyApplyPendingChanges = applyOrig
+	}()
+	os.Setenv("APPLY_PENDING_ON_START", "true")
+	reconfigureMock := getReconfigureMock("")
+	actualService := proxy.Service{}
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		actualService = serviceData
+		return reconfigureMock
+	}
+	removeMock := getRemoveMock("")
+	actualRemoved := ""
+	actions.NewRemove = func(
+		serviceName, aclName, configsPath, templatesPath string,
+		consulAddresses []string,
+		instanceName, mode string,
+		allowMutations bool,
+	) actions.Removable {
+		actualRemoved = serviceName
+		return removeMock
+	}
+	proxyApplyPendingChanges = func(apply func(operation proxy.PendingOperation) error) error {
+		apply(proxy.PendingOperation{Action: proxy.PendingAdd, Service: proxy.Service{ServiceName: "service-1"}})
+		return apply(proxy.PendingOperation{Action: proxy.PendingRemove, Service: proxy.Service{ServiceName: "service-2"}})
+	}
+
+	serverImpl.Execute([]string{})
+
+	s.Equal("service-1", actualService.ServiceName)
+	s.Equal("service-2", actualRemoved)
+	reconfigureMock.AssertCalled(s.T(), "Execute", []string{})
+	removeMock.AssertCalled(s.T(), "Execute", []string{})
+}
+
+func (s *ServerTestSuite) Test_Execute_DoesNotApplyPendingChanges_WhenApplyPendingOnStartIsNotSet() {
+	applyOrig := proxyApplyPendingChanges
+	defer func() { proxyApplyPendingChanges = applyOrig }()
+	invoked := false
+	proxyApplyPendingChanges = func(apply func(operation proxy.PendingOperation) error) error {
+		invoked = true
+		return nil
+	}
+
+	serverImpl.Execute([]string{})
+
+	s.False(invoked)
+}
+
+func (s *ServerTestSuite) Test_Execute_ReturnsError_WhenApiRateLimitIsInvalid() {
+	defer os.Unsetenv("API_RATE_LIMIT")
+	os.Setenv("API_RATE_LIMIT", "fast")
+
+	s.Error(serverImpl.Execute([]string{}))
+}
+
+func (s *ServerTestSuite) Test_IsRateLimited_ReturnsTrue_OnlyForMutationsAndReloads() {
+	testData := []struct {
+		method   string
+		path     string
+		expected bool
+	}{
+		{"GET", "/v1/docker-flow-proxy/reconfigure", true},
+		{"GET", "/v1/docker-flow-proxy/remove", true},
+		{"GET", "/v1/docker-flow-proxy/reload", true},
+		{"PUT", "/v1/docker-flow-proxy/cert", true},
+		{"PUT", "/v1/docker-flow-proxy/services/my-service/replicas", true},
+		{"GET", "/v1/docker-flow-proxy/config", false},
+		{"GET", "/v1/docker-flow-proxy/services", false},
+		{"GET", "/v1/docker-flow-proxy/certs", false},
+		{"GET", "/v1/test", false},
+	}
+	srv := Serve{}
+	for _, data := range testData {
+		req, _ := http.NewRequest(data.method, data.path, nil)
+
+		s.Equal(data.expected, srv.isRateLimited(req), data.path)
+	}
+}
+
+func (s *ServerTestSuite) Test_IsRateLimited_ReturnsFalse_WhenRequestIsForwarded() {
+	defer os.Unsetenv("DISTRIBUTE_SECRET")
+	os.Setenv("DISTRIBUTE_SECRET", "my-secret")
+	req, _ := http.NewRequest("GET", "/v1/docker-flow-proxy/reconfigure", nil)
+	req.Header.Set(server.DistributedHeader, "true")
+	req.Header.Set(server.SecretHeader, "my-secret")
+
+	srv := Serve{}
+
+	s.False(srv.isRateLimited(req))
+}
+
+func (s *ServerTestSuite) Test_GetRouteMethods_ReturnsMethodsOfEndpoints() {
+	testData := []struct {
+		path     string
+		expected []string
+	}{
+		{"/v1/docker-flow-proxy/services", []string{"GET"}},
+		{"/v1/docker-flow-proxy/cert", []string{"PUT", "DELETE"}},
+		{"/v1/docker-flow-proxy/certs/prune", []string{"DELETE"}},
+		{"/v1/docker-flow-proxy/services/my-service/diff", []string{"POST"}},
+		{"/v1/docker-flow-proxy/services/my-service/replicas", []string{"PUT"}},
+		{"/v1/docker-flow-proxy/services/my-service/stats", []string{"GET"}},
+		{"/v1/docker-flow-proxy/unknown", nil},
+	}
+	srv := Serve{}
+	for _, data := range testData {
+		s.Equal(data.expected, srv.getRouteMethods(data.path), data.path)
+	}
+}
+
+func (s *ServerTestSuite) Test_Execute_ReturnsError_WhenCorsCredentialsAreAllowedWithWildcard() {
+	defer func() {
+		os.Unsetenv("API_CORS_ORIGINS")
+		os.Unsetenv("API_CORS_CREDENTIALS")
+	}()
+	os.Setenv("API_CORS_ORIGINS", "*")
+	os.Setenv("API_CORS_CREDENTIALS", "true")
+
+	s.Error(serverImpl.Execute([]string{}))
+}
+
+func (s *ServerTestSuite) Test_Execute_ReturnsError_WhenBindAddressesAreInvalid() {
+	defer os.Unsetenv("BIND_ADDRESSES")
+	os.Setenv("BIND_ADDRESSES", "10.0.0.1,not-an-address")
+
+	err := serverImpl.Execute([]string{})
+
+	s.Error(err)
+	s.Contains(err.Error(), "not-an-address")
+}
+
+func (s *ServerTestSuite) Test_Execute_ReturnsError_WhenBlocklistRefresherFails() {
+	startOrig := proxyStartBlocklistRefresher
+	defer func() {
+		os.Unsetenv("BLOCKLIST_URL")
+		proxyStartBlocklistRefresher = startOrig
+	}()
+	os.Setenv("BLOCKLIST_URL", "http://lists.acme.com")
+	proxyStartBlocklistRefresher = func() error {
+		return fmt.Errorf("This is an error")
+	}
+
+	s.Error(serverImpl.Execute([]string{}))
+}
+
+func (s *ServerTestSuite) Test_Execute_ReturnsError_WhenStrictEnvVarsIsSetAndThereAreUnknownEnvVars() {
+	strictOrig := os.Getenv("STRICT_ENV_VARS")
+	osEnvironOrig := osEnviron
+	defer func() {
+		os.Setenv("STRICT_ENV_VARS", strictOrig)
+		osEnviron = osEnvironOrig
+	}()
+	os.Setenv("STRICT_ENV_VARS", "true")
+	osEnviron = func() []string {
+		return []string{"TIMEOUT_CLEINT=10"}
+	}
+
+	s.Error(serverImpl.Execute([]string{}))
+}
+
 // ServeHTTP > Cert
 
 func (s *ServerTestSuite) Test_ServeHTTP_InvokesCertPut_WhenUrlIsCert() {
@@ -377,6 +779,45 @@ func (s *ServerTestSuite) Test_ServeHTTP_InvokesCertGetAll_WhenUrlIsCerts() {
 	s.Assert().True(invoked)
 }
 
+// ServeHTTP > Certs Prune
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesCertPrune_WhenUrlIsCertsPrune() {
+	invoked := false
+	certOrig := cert
+	defer func() { cert = certOrig }()
+	cert = CertMock{
+		PruneMock: func(http.ResponseWriter, *http.Request) ([]string, error) {
+			invoked = true
+			return []string{}, nil
+		},
+	}
+	req, _ := http.NewRequest("DELETE", "http://acme.com/v1/docker-flow-proxy/certs/prune?dryRun=true", nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.True(invoked)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatusNotFound_WhenUrlIsCertsPruneAndMethodIsNotDelete() {
+	invoked := false
+	certOrig := cert
+	defer func() { cert = certOrig }()
+	cert = CertMock{
+		PruneMock: func(http.ResponseWriter, *http.Request) ([]string, error) {
+			invoked = true
+			return []string{}, nil
+		},
+	}
+	req, _ := http.NewRequest("GET", "http://acme.com/v1/docker-flow-proxy/certs/prune", nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.False(invoked)
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 404)
+}
+
 // ServeHTTP > Reload
 
 func (s *ServerTestSuite) Test_ServeHTTP_InvokesReload_WhenUrlIsReload() {
@@ -550,8 +991,8 @@ func (s *ServerTestSuite) Test_ServeHTTP_ReturnsJsonWithReqPath_WhenPresent() {
 			ServiceColor:     s.ServiceColor,
 			ServiceDomain:    s.ServiceDomain,
 			OutboundHostname: s.OutboundHostname,
-			ReqPathSearch:    search,
-			ReqPathReplace:   replace,
+			ReqPathSearch:    []string{search},
+			ReqPathReplace:   []string{replace},
 			ServiceDest:      []proxy.ServiceDest{s.sd},
 		},
 	})
@@ -578,8 +1019,8 @@ func (s *ServerTestSuite) Test_ServeHTTP_ReturnsJsonWithMode_WhenPresent() {
 			ServiceColor:     s.ServiceColor,
 			ServiceDomain:    s.ServiceDomain,
 			OutboundHostname: s.OutboundHostname,
-			ReqPathSearch:    search,
-			ReqPathReplace:   replace,
+			ReqPathSearch:    []string{search},
+			ReqPathReplace:   []string{replace},
 			ServiceDest:      []proxy.ServiceDest{
 				proxy.ServiceDest{
 					ServicePath: []string{"/path/to/my/service/api", "/path/to/my/other/service/api"},
@@ -734,6 +1175,79 @@ func (s *ServerTestSuite) Test_ServeHTTP_WritesErrorHeader_WhenRemoveDistributeI
 	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 500)
 }
 
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsFailedPeers_WhenRemoveDistributeIsTrueAndSomePeersAreUnreachable() {
+	distributorOrig := distributor
+	defer func() { distributor = distributorOrig }()
+	results := []server.DistributeResult{
+		{Address: "10.0.0.1", Status: 200},
+		{Address: "10.0.0.2", Error: "connection refused"},
+	}
+	distributor = DistributorMock{
+		DistributeRequestsMock: func(req *http.Request, port, proxyServiceName string) ([]server.DistributeResult, error) {
+			return results, nil
+		},
+	}
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s&distribute=true", s.RemoveUrl), nil)
+	expected, _ := json.Marshal(server.Response{
+		Status:      "OK",
+		Message:     DISTRIBUTED + " except the following addresses: [10.0.0.2]",
+		ServiceName: s.ServiceName,
+		Peers:       results,
+		Service:     proxy.Service{Distribute: true},
+	})
+
+	serverImpl.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+	s.ResponseWriter.AssertCalled(s.T(), "Write", expected)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesRemoveExecute_WhenRemoveRequestWasDistributed() {
+	distributorOrig := distributor
+	defer func() { distributor = distributorOrig }()
+	distributed := false
+	distributor = DistributorMock{
+		DistributeRequestsMock: func(req *http.Request, port, proxyServiceName string) ([]server.DistributeResult, error) {
+			distributed = true
+			return []server.DistributeResult{}, nil
+		},
+	}
+	mockObj := getRemoveMock("")
+	actions.NewRemove = func(
+		serviceName, aclName, configsPath, templatesPath string,
+		consulAddresses []string,
+		instanceName, mode string,
+		allowMutations bool,
+	) actions.Removable {
+		return mockObj
+	}
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s&distribute=true", s.RemoveUrl), nil)
+	req.Header.Set(server.DistributedHeader, "true")
+
+	serverImpl.ServeHTTP(s.ResponseWriter, req)
+
+	s.False(distributed)
+	mockObj.AssertCalled(s.T(), "Execute", []string{})
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesCertRemove_WhenUrlIsCertAndMethodIsDelete() {
+	invoked := false
+	certOrig := cert
+	defer func() { cert = certOrig }()
+	cert = CertMock{
+		RemoveMock: func(w http.ResponseWriter, req *http.Request) error {
+			invoked = true
+			return nil
+		},
+	}
+	req, _ := http.NewRequest("DELETE", s.CertUrl, nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.True(invoked)
+}
+
 func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenUrlIsReconfigureAndServiceNameQueryIsNotPresent() {
 	req, _ := http.NewRequest("GET", s.ReconfigureBaseUrl, nil)
 
@@ -773,26 +1287,232 @@ func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenUrlIsReconfigureAn
 	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 400)
 }
 
-func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenServicePathQueryIsNotPresent() {
-	url := fmt.Sprintf("%s?serviceName=my-service", s.ReconfigureBaseUrl)
-	req, _ := http.NewRequest("GET", url, nil)
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus200_WhenUrlIsReconfigureAndReqModeIsTcpAndSrcPortRangeIsPresent() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxy.Instance = getProxyMock("")
+	addr := fmt.Sprintf("%s?serviceName=rtp&srcPortRange=10000-10100&reqMode=tcp", s.ReconfigureBaseUrl)
+	req, _ := http.NewRequest("GET", addr, nil)
 
 	srv := Serve{}
 	srv.ServeHTTP(s.ResponseWriter, req)
 
-	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 400)
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
 }
 
-func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenModeIsServiceAndPortIsNotPresent() {
-	req, _ := http.NewRequest("GET", s.ReconfigureUrl, nil)
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenSourceAddressIsNotIP() {
+	addr := fmt.Sprintf("%s&sourceAddress=not-an-ip", s.ReconfigureUrl)
+	req, _ := http.NewRequest("GET", addr, nil)
 
-	srv := Serve{Mode: "service"}
+	srv := Serve{}
 	srv.ServeHTTP(s.ResponseWriter, req)
 
 	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 400)
 }
 
-func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenModeIsSwarmAndPortIsNotPresent() {
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenNormalizeTrailingSlashIsNotSupported() {
+	addr := fmt.Sprintf("%s&normalizeTrailingSlash=remove", s.ReconfigureUrl)
+	req, _ := http.NewRequest("GET", addr, nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 400)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenAuthErrorFileDoesNotExist() {
+	osStatOrig := osStat
+	defer func() { osStat = osStatOrig }()
+	osStat = func(name string) (os.FileInfo, error) {
+		return nil, fmt.Errorf("This is an stat error")
+	}
+	addr := fmt.Sprintf("%s&users=user-1:pass-1&authErrorFile=/errorfiles/401.http", s.ReconfigureUrl)
+	req, _ := http.NewRequest("GET", addr, nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 400)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesReconfigureExecute_WhenAuthErrorFileExists() {
+	osStatOrig := osStat
+	defer func() { osStat = osStatOrig }()
+	actualPath := ""
+	osStat = func(name string) (os.FileInfo, error) {
+		actualPath = name
+		return nil, nil
+	}
+	mockObj := getReconfigureMock("")
+	var actualService proxy.Service
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		actualService = serviceData
+		return mockObj
+	}
+	addr := fmt.Sprintf("%s&users=user-1:pass-1&authRealm=My%%20Service&authErrorFile=/errorfiles/401.http", s.ReconfigureUrl)
+	req, _ := http.NewRequest("GET", addr, nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	mockObj.AssertCalled(s.T(), "Execute", []string{})
+	s.Equal("/errorfiles/401.http", actualPath)
+	s.Equal("My Service", actualService.AuthRealm)
+	s.Equal("/errorfiles/401.http", actualService.AuthErrorFile)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_PassesReloadDelayToReconfigure_WhenRequestIsDistributed() {
+	mockObj := getReconfigureMock("")
+	var actualBase actions.BaseReconfigure
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		actualBase = baseData
+		return mockObj
+	}
+	req, _ := http.NewRequest("GET", s.ReconfigureUrl, nil)
+	req.Header.Set(server.DistributedHeader, "true")
+	req.Header.Set(server.ReloadDelayHeader, "4s")
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	mockObj.AssertCalled(s.T(), "Execute", []string{})
+	s.Equal(4*time.Second, actualBase.ReloadDelay)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesReconfigureExecute_WhenSourceAddressIsIP() {
+	mockObj := getReconfigureMock("")
+	var actualService proxy.Service
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		actualService = serviceData
+		return mockObj
+	}
+	addr := fmt.Sprintf("%s&sourceAddress=10.0.0.5&transparentProxy=true", s.ReconfigureUrl)
+	req, _ := http.NewRequest("GET", addr, nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	mockObj.AssertCalled(s.T(), "Execute", []string{})
+	s.Equal("10.0.0.5", actualService.SourceAddress)
+	s.True(actualService.TransparentProxy)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesReconfigureExecute_WhenBufferRequestIsPresent() {
+	mockObj := getReconfigureMock("")
+	var actualService proxy.Service
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		actualService = serviceData
+		return mockObj
+	}
+	addr := fmt.Sprintf("%s&bufferRequest=true&maxBodySize=1024", s.ReconfigureUrl)
+	req, _ := http.NewRequest("GET", addr, nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	mockObj.AssertCalled(s.T(), "Execute", []string{})
+	s.True(actualService.BufferRequest)
+	s.Equal(1024, actualService.MaxBodySize)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus405_WhenReadOnlyModeIsEnabled() {
+	defer os.Unsetenv("READ_ONLY_MODE")
+	os.Setenv("READ_ONLY_MODE", "true")
+	mockObj := getReconfigureMock("")
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		return mockObj
+	}
+	req, _ := http.NewRequest("GET", s.ReconfigureUrl, nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 405)
+	mockObj.AssertNotCalled(s.T(), "Execute", []string{})
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus405_WhenReadOnlyModeIsEnabledAndSecretDoesNotMatch() {
+	defer func() {
+		os.Unsetenv("READ_ONLY_MODE")
+		os.Unsetenv("DISTRIBUTE_SECRET")
+	}()
+	os.Setenv("READ_ONLY_MODE", "true")
+	os.Setenv("DISTRIBUTE_SECRET", "my-secret")
+	mockObj := getReconfigureMock("")
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		return mockObj
+	}
+	req, _ := http.NewRequest("GET", s.ReconfigureUrl, nil)
+	req.Header.Set(server.DistributedHeader, "true")
+	req.Header.Set(server.SecretHeader, "other-secret")
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 405)
+	mockObj.AssertNotCalled(s.T(), "Execute", []string{})
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesReconfigureExecute_WhenReadOnlyModeIsEnabledAndRequestIsForwarded() {
+	defer func() {
+		os.Unsetenv("READ_ONLY_MODE")
+		os.Unsetenv("DISTRIBUTE_SECRET")
+	}()
+	os.Setenv("READ_ONLY_MODE", "true")
+	os.Setenv("DISTRIBUTE_SECRET", "my-secret")
+	mockObj := getReconfigureMock("")
+	actualBase := actions.BaseReconfigure{}
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		actualBase = baseData
+		return mockObj
+	}
+	req, _ := http.NewRequest("GET", s.ReconfigureUrl, nil)
+	req.Header.Set(server.DistributedHeader, "true")
+	req.Header.Set(server.SecretHeader, "my-secret")
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	mockObj.AssertCalled(s.T(), "Execute", []string{})
+	s.True(actualBase.AllowMutations)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_DoesNotAllowMutations_WhenRequestIsNotForwarded() {
+	mockObj := getReconfigureMock("")
+	actualBase := actions.BaseReconfigure{AllowMutations: true}
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		actualBase = baseData
+		return mockObj
+	}
+	req, _ := http.NewRequest("GET", s.ReconfigureUrl, nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	mockObj.AssertCalled(s.T(), "Execute", []string{})
+	s.False(actualBase.AllowMutations)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenServicePathQueryIsNotPresent() {
+	url := fmt.Sprintf("%s?serviceName=my-service", s.ReconfigureBaseUrl)
+	req, _ := http.NewRequest("GET", url, nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 400)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenModeIsServiceAndPortIsNotPresent() {
+	req, _ := http.NewRequest("GET", s.ReconfigureUrl, nil)
+
+	srv := Serve{Mode: "service"}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 400)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenModeIsSwarmAndPortIsNotPresent() {
 	req, _ := http.NewRequest("GET", s.ReconfigureUrl, nil)
 
 	srv := Serve{Mode: "swARM"}
@@ -809,6 +1529,34 @@ func (s *ServerTestSuite) Test_ServeHTTP_InvokesReconfigureExecute() {
 	s.invokesReconfigure(req, true)
 }
 
+func (s *ServerTestSuite) Test_ServeHTTP_SetsCallerFromBearerToken_WhenDomainOwnershipFileIsSet() {
+	defer os.Unsetenv("DOMAIN_OWNERSHIP_FILE")
+	os.Setenv("DOMAIN_OWNERSHIP_FILE", "/run/secrets/domains.yml")
+	testData := []struct {
+		authorization string
+		expected      string
+	}{
+		{"Bearer payments-token", "payments-token"},
+		{"Basic dXNlcjpwYXNz", proxy.AnonymousCaller},
+		{"", proxy.AnonymousCaller},
+	}
+	for _, data := range testData {
+		actual := ""
+		mockObj := getReconfigureMock("")
+		actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+			actual = serviceData.Caller
+			return mockObj
+		}
+		req, _ := http.NewRequest("GET", s.ReconfigureUrl, nil)
+		req.Header.Set("Authorization", data.authorization)
+
+		srv := Serve{}
+		srv.ServeHTTP(s.ResponseWriter, req)
+
+		s.Equal(data.expected, actual)
+	}
+}
+
 func (s *ServerTestSuite) Test_ServeHTTP_DoesNotInvokeReconfigureExecute_WhenDistributeIsTrue() {
 	req, _ := http.NewRequest(
 		"GET",
@@ -818,266 +1566,1178 @@ func (s *ServerTestSuite) Test_ServeHTTP_DoesNotInvokeReconfigureExecute_WhenDis
 	s.invokesReconfigure(req, false)
 }
 
-func (s *ServerTestSuite) Test_ServeHTTP_DoesNotInvokeRemoveExecute_WhenDistributeIsTrue() {
-	req, _ := http.NewRequest(
-		"GET",
-		fmt.Sprintf("%s&distribute=true", s.RemoveUrl),
-		nil,
-	)
-	s.invokesReconfigure(req, false)
+func (s *ServerTestSuite) Test_ServeHTTP_DoesNotInvokeRemoveExecute_WhenDistributeIsTrue() {
+	req, _ := http.NewRequest(
+		"GET",
+		fmt.Sprintf("%s&distribute=true", s.RemoveUrl),
+		nil,
+	)
+	s.invokesReconfigure(req, false)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus500_WhenReconfigureExecuteFails() {
+	mockObj := getReconfigureMock("Execute")
+	mockObj.On("Execute", []string{}).Return(fmt.Errorf("This is an error"))
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		return mockObj
+	}
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, s.RequestReconfigure)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 500)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatusMatchingError_WhenReconfigureExecuteFails() {
+	testData := []struct {
+		err      error
+		expected int
+	}{
+		{&proxy.ErrConflict{Owner: "other-service", Path: "/api"}, 409},
+		{&proxy.ErrForbidden{Domain: "payments.example.com", Pattern: "*.example.com"}, 403},
+		{&proxy.ErrValidation{Fields: []string{"serviceName"}}, 400},
+		{fmt.Errorf("Could not read the file\n%w", proxy.ErrTemplateMissing), 500},
+		{&proxy.ErrReloadFailed{Output: "config", Err: fmt.Errorf("This is an error")}, 500},
+	}
+	for _, data := range testData {
+		mockObj := getReconfigureMock("Execute")
+		mockObj.On("Execute", []string{}).Return(data.err)
+		actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+			return mockObj
+		}
+		rw := getResponseWriterMock()
+
+		srv := Serve{}
+		srv.ServeHTTP(rw, s.RequestReconfigure)
+
+		rw.AssertCalled(s.T(), "WriteHeader", data.expected)
+	}
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus404_WhenRemoveExecuteReturnsErrServiceNotFound() {
+	mockObj := getRemoveMock("Execute")
+	mockObj.On("Execute", mock.Anything).Return(fmt.Errorf("%w: my-service", proxy.ErrServiceNotFound))
+	actions.NewRemove = func(
+		serviceName, aclName, configsPath, templatesPath string,
+		consulAddresses []string,
+		instanceName, mode string,
+		allowMutations bool,
+	) actions.Removable {
+		return mockObj
+	}
+
+	serverImpl.ServeHTTP(s.ResponseWriter, s.RequestRemove)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 404)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesReconfigureExecuteOnce_WhenIdempotencyKeyIsRepeated() {
+	idempotencyOrig := proxy.Idempotency
+	defer func() { proxy.Idempotency = idempotencyOrig }()
+	proxy.Idempotency = proxy.NewIdempotencyCache(time.Minute, 10)
+	mockObj := getReconfigureMock("")
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		return mockObj
+	}
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", s.ReconfigureUrl, nil)
+		req.Header.Set("Idempotency-Key", "my-key")
+		srv := Serve{}
+		srv.ServeHTTP(getResponseWriterMock(), req)
+	}
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s&requestId=my-key", s.ReconfigureUrl), nil)
+	srv := Serve{}
+	srv.ServeHTTP(getResponseWriterMock(), req)
+
+	mockObj.AssertNumberOfCalls(s.T(), "Execute", 1)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsCachedResponse_WhenIdempotencyKeyIsRepeated() {
+	idempotencyOrig := proxy.Idempotency
+	defer func() { proxy.Idempotency = idempotencyOrig }()
+	proxy.Idempotency = proxy.NewIdempotencyCache(time.Minute, 10)
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s&requestId=my-key", s.ReconfigureUrl), nil)
+	srv := Serve{}
+	srv.ServeHTTP(getResponseWriterMock(), req)
+	cached, _ := proxy.Idempotency.Get(getIdempotencyCacheKey("GET", "/v1/docker-flow-proxy/reconfigure", "my-key"))
+
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+	s.ResponseWriter.AssertCalled(s.T(), "Write", cached.Body)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus409_WhenRequestWithTheSameIdempotencyKeyIsInFlight() {
+	idempotencyOrig := proxy.Idempotency
+	defer func() { proxy.Idempotency = idempotencyOrig }()
+	proxy.Idempotency = proxy.NewIdempotencyCache(time.Minute, 10)
+	proxy.Idempotency.Reserve(context.Background(), getIdempotencyCacheKey("GET", "/v1/docker-flow-proxy/reconfigure", "my-key"))
+	mockObj := getReconfigureMock("")
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		return mockObj
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s&requestId=my-key", s.ReconfigureUrl), nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req.WithContext(ctx))
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 409)
+	mockObj.AssertNotCalled(s.T(), "Execute", []string{})
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus422_WhenIdempotencyKeyIsReusedForDifferentRequest() {
+	idempotencyOrig := proxy.Idempotency
+	defer func() { proxy.Idempotency = idempotencyOrig }()
+	proxy.Idempotency = proxy.NewIdempotencyCache(time.Minute, 10)
+	mockObj := getReconfigureMock("")
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		return mockObj
+	}
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s&requestId=my-key", s.ReconfigureUrl), nil)
+	srv := Serve{}
+	srv.ServeHTTP(getResponseWriterMock(), req)
+	req, _ = http.NewRequest("GET", fmt.Sprintf("%s&requestId=my-key&port=1234", s.ReconfigureUrl), nil)
+
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 422)
+	mockObj.AssertNumberOfCalls(s.T(), "Execute", 1)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus422_WhenIdempotencyKeyIsReusedWithDifferentBody() {
+	idempotencyOrig := proxy.Idempotency
+	defer func() { proxy.Idempotency = idempotencyOrig }()
+	proxy.Idempotency = proxy.NewIdempotencyCache(time.Minute, 10)
+	certOrig := cert
+	defer func() { cert = certOrig }()
+	cert = CertMock{
+		PutMock: func(http.ResponseWriter, *http.Request) (string, error) { return "", nil },
+	}
+	url := fmt.Sprintf("%s/cert?certName=my-cert.pem", s.BaseUrl)
+	req, _ := http.NewRequest("PUT", url, strings.NewReader("cert-1"))
+	req.Header.Set("Idempotency-Key", "my-key")
+	srv := Serve{}
+	srv.ServeHTTP(getResponseWriterMock(), req)
+	req, _ = http.NewRequest("PUT", url, strings.NewReader("cert-2"))
+	req.Header.Set("Idempotency-Key", "my-key")
+
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 422)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesExecuteOfEachEndpoint_WhenIdempotencyKeyIsSentToDifferentPaths() {
+	idempotencyOrig := proxy.Idempotency
+	defer func() { proxy.Idempotency = idempotencyOrig }()
+	proxy.Idempotency = proxy.NewIdempotencyCache(time.Minute, 10)
+	reconfigureMock := getReconfigureMock("")
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		return reconfigureMock
+	}
+	removeMock := getRemoveMock("")
+	actions.NewRemove = func(
+		serviceName, aclName, configsPath, templatesPath string,
+		consulAddresses []string,
+		instanceName, mode string,
+		allowMutations bool,
+	) actions.Removable {
+		return removeMock
+	}
+
+	for _, url := range []string{s.ReconfigureUrl, s.RemoveUrl} {
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Idempotency-Key", "my-key")
+		srv := Serve{}
+		srv.ServeHTTP(getResponseWriterMock(), req)
+	}
+
+	reconfigureMock.AssertNumberOfCalls(s.T(), "Execute", 1)
+	removeMock.AssertNumberOfCalls(s.T(), "Execute", 1)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsHeadersOfCachedResponse_WhenIdempotencyKeyIsRepeated() {
+	idempotencyOrig := proxy.Idempotency
+	defer func() { proxy.Idempotency = idempotencyOrig }()
+	proxy.Idempotency = proxy.NewIdempotencyCache(time.Minute, 10)
+	proxy.Idempotency.Reserve(context.Background(), getIdempotencyCacheKey("GET", "/v1/docker-flow-proxy/reconfigure", "my-key"))
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s&requestId=my-key", s.ReconfigureUrl), nil)
+	srv := Serve{}
+	proxy.Idempotency.Put(getIdempotencyCacheKey("GET", "/v1/docker-flow-proxy/reconfigure", "my-key"), proxy.IdempotentResponse{
+		Status:  200,
+		Header:  http.Header{"Content-Type": []string{"text/plain"}},
+		Body:    []byte("OK"),
+		Request: srv.getRequestFingerprint(req),
+	})
+	rw := httptest.NewRecorder()
+
+	srv.ServeHTTP(rw, req)
+
+	s.Equal(200, rw.Code)
+	s.Equal("text/plain", rw.Header().Get("Content-Type"))
+	s.Equal("OK", rw.Body.String())
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesRemoveExecuteOnce_WhenIdempotencyKeyIsRepeated() {
+	idempotencyOrig := proxy.Idempotency
+	defer func() { proxy.Idempotency = idempotencyOrig }()
+	proxy.Idempotency = proxy.NewIdempotencyCache(time.Minute, 10)
+	mockObj := getRemoveMock("")
+	actions.NewRemove = func(
+		serviceName, aclName, configsPath, templatesPath string,
+		consulAddresses []string,
+		instanceName, mode string,
+		allowMutations bool,
+	) actions.Removable {
+		return mockObj
+	}
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", s.RemoveUrl, nil)
+		req.Header.Set("Idempotency-Key", "my-key")
+		srv := Serve{}
+		srv.ServeHTTP(getResponseWriterMock(), req)
+	}
+
+	mockObj.AssertNumberOfCalls(s.T(), "Execute", 1)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesReconfigureExecuteForEachKey_WhenPayloadsAreIdentical() {
+	idempotencyOrig := proxy.Idempotency
+	defer func() { proxy.Idempotency = idempotencyOrig }()
+	proxy.Idempotency = proxy.NewIdempotencyCache(time.Minute, 10)
+	mockObj := getReconfigureMock("")
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		return mockObj
+	}
+
+	for _, key := range []string{"key-1", "key-2"} {
+		req, _ := http.NewRequest("GET", s.ReconfigureUrl, nil)
+		req.Header.Set("Idempotency-Key", key)
+		srv := Serve{}
+		srv.ServeHTTP(getResponseWriterMock(), req)
+	}
+
+	mockObj.AssertNumberOfCalls(s.T(), "Execute", 2)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_DoesNotCacheResponse_WhenReconfigureExecuteFails() {
+	idempotencyOrig := proxy.Idempotency
+	defer func() { proxy.Idempotency = idempotencyOrig }()
+	proxy.Idempotency = proxy.NewIdempotencyCache(time.Minute, 10)
+	mockObj := getReconfigureMock("Execute")
+	mockObj.On("Execute", []string{}).Return(fmt.Errorf("This is an error"))
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		return mockObj
+	}
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s&requestId=my-key", s.ReconfigureUrl), nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	_, ok := proxy.Idempotency.Get(getIdempotencyCacheKey("GET", "/v1/docker-flow-proxy/reconfigure", "my-key"))
+	s.False(ok)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsJson_WhenConsulTemplatePathIsPresent() {
+	pathFe := "/path/to/consul/fe/template"
+	pathBe := "/path/to/consul/fe/template"
+	address := fmt.Sprintf(
+		"%s?serviceName=%s&consulTemplateFePath=%s&consulTemplateBePath=%s",
+		s.ReconfigureBaseUrl,
+		s.ServiceName,
+		pathFe,
+		pathBe)
+	req, _ := http.NewRequest("GET", address, nil)
+	sd := proxy.ServiceDest{
+		ServicePath: []string{},
+	}
+	expected, _ := json.Marshal(server.Response{
+		Status:               "OK",
+		ServiceName:          s.ServiceName,
+		Service:              proxy.Service{
+			ReqMode:              "http",
+			ServiceName:          s.ServiceName,
+			ConsulTemplateFePath: pathFe,
+			ConsulTemplateBePath: pathBe,
+			PathType:             s.PathType,
+			ServiceDest:          []proxy.ServiceDest{sd},
+		},
+	})
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "Write", []byte(expected))
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesReconfigureExecute_WhenConsulTemplatePathIsPresent() {
+	sd := proxy.ServiceDest{
+		ServicePath: []string{},
+	}
+	pathFe := "/path/to/consul/fe/template"
+	pathBe := "/path/to/consul/be/template"
+	mockObj := getReconfigureMock("")
+	var actualBase actions.BaseReconfigure
+	expectedBase := actions.BaseReconfigure{
+		ConsulAddresses: []string{s.ConsulAddress},
+	}
+	expectedService := proxy.Service{
+		ServiceName:          s.ServiceName,
+		ConsulTemplateFePath: pathFe,
+		ConsulTemplateBePath: pathBe,
+		PathType:             s.PathType,
+		ReqMode:              "http",
+		ServiceDest:          []proxy.ServiceDest{sd},
+	}
+	var actualService proxy.Service
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		actualBase = baseData
+		actualService = serviceData
+		return mockObj
+	}
+	serverImpl := Serve{BaseReconfigure: expectedBase}
+	address := fmt.Sprintf(
+		"%s?serviceName=%s&consulTemplateFePath=%s&consulTemplateBePath=%s",
+		s.ReconfigureBaseUrl,
+		s.ServiceName,
+		pathFe,
+		pathBe)
+	req, _ := http.NewRequest("GET", address, nil)
+
+	serverImpl.ServeHTTP(s.ResponseWriter, req)
+
+	s.Equal(expectedBase, actualBase)
+	s.Equal(expectedService, actualService)
+	mockObj.AssertCalled(s.T(), "Execute", []string{})
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesPutCert_WhenServiceCertIsPresent() {
+	actualCertName := ""
+	expectedCert := "my-cert with new line \\n"
+	actualCert := ""
+	certOrig := cert
+	defer func() { cert = certOrig }()
+	cert = CertMock{
+		PutCertMock: func(certName string, certContent []byte) (string, error) {
+			actualCertName = certName
+			actualCert = string(certContent[:])
+			return "", nil
+		},
+	}
+	address := fmt.Sprintf(
+		"%s?serviceName=%s&servicePath=%s&serviceCert=%s",
+		s.ReconfigureBaseUrl,
+		s.ServiceName,
+		strings.Join(s.sd.ServicePath, ","),
+		expectedCert,
+	)
+	req, _ := http.NewRequest("GET", address, nil)
+
+	serverImpl.ServeHTTP(s.ResponseWriter, req)
+
+	s.Equal(s.ServiceName, actualCertName)
+	s.Equal(strings.Replace(expectedCert, "\\n", "\n", -1), actualCert)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesPutCertWithDomainName_WhenServiceCertIsPresent() {
+	actualCertName := ""
+	expectedCert := "my-cert"
+	actualCert := ""
+	certOrig := cert
+	defer func() { cert = certOrig }()
+	cert = CertMock{
+		PutCertMock: func(certName string, certContent []byte) (string, error) {
+			actualCertName = certName
+			actualCert = string(certContent[:])
+			return "", nil
+		},
+	}
+	address := fmt.Sprintf("%s&serviceDomain=%s&serviceCert=%s", s.ReconfigureUrl, s.ServiceDomain[0], expectedCert)
+	req, _ := http.NewRequest("GET", address, nil)
+
+	serverImpl.ServeHTTP(s.ResponseWriter, req)
+
+	s.Equal(s.ServiceDomain[0], actualCertName)
+	s.Equal(expectedCert, actualCert)
+}
+
+// ServeHTTP > Remove
+
+func (s *ServerTestSuite) Test_ServeHTTP_SetsContentTypeToJSON_WhenUrlIsRemove() {
+	var actual string
+	httpWriterSetContentType = func(w http.ResponseWriter, value string) {
+		actual = value
+	}
+	req, _ := http.NewRequest("GET", s.RemoveUrl, nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.Equal("application/json", actual)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsJSON_WhenUrlIsRemove() {
+	expected, _ := json.Marshal(server.Response{
+		Status:      "OK",
+		ServiceName: s.ServiceName,
+	})
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, s.RequestRemove)
+
+	s.ResponseWriter.AssertCalled(s.T(), "Write", []byte(expected))
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenUrlIsRemoveAndServiceNameQueryIsNotPresent() {
+	req, _ := http.NewRequest("GET", s.RemoveBaseUrl, nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 400)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesRemoveExecute() {
+	mockObj := getRemoveMock("")
+	aclName := "my-acl"
+	var actual actions.Remove
+	expected := actions.Remove{
+		ServiceName:     s.ServiceName,
+		TemplatesPath:   "",
+		ConfigsPath:     "",
+		ConsulAddresses: []string{s.ConsulAddress},
+		InstanceName:    s.InstanceName,
+		AclName:         aclName,
+	}
+	actions.NewRemove = func(
+		serviceName, aclName, configsPath, templatesPath string,
+		consulAddresses []string,
+		instanceName, mode string,
+		allowMutations bool,
+	) actions.Removable {
+		actual = actions.Remove{
+			ServiceName:     serviceName,
+			AclName:         aclName,
+			TemplatesPath:   templatesPath,
+			ConfigsPath:     configsPath,
+			ConsulAddresses: consulAddresses,
+			InstanceName:    instanceName,
+			Mode:            mode,
+			AllowMutations:  allowMutations,
+		}
+		return mockObj
+	}
+	url := fmt.Sprintf("%s?serviceName=%s&aclName=%s", s.RemoveBaseUrl, s.ServiceName, aclName)
+	req, _ := http.NewRequest("GET", url, nil)
+
+	serverImpl.ServeHTTP(s.ResponseWriter, req)
+
+	s.Equal(expected, actual)
+	mockObj.AssertCalled(s.T(), "Execute", []string{})
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_InvokesRemoveNamespaceExecute_WhenNamespaceQueryIsPresent() {
+	newRemoveNamespaceOrig := actions.NewRemoveNamespace
+	defer func() { actions.NewRemoveNamespace = newRemoveNamespaceOrig }()
+	mockObj := getRemoveMock("")
+	var actual string
+	actions.NewRemoveNamespace = func(
+		namespace, configsPath, templatesPath string,
+		consulAddresses []string,
+		instanceName, mode string,
+		allowMutations bool,
+	) actions.Removable {
+		actual = namespace
+		return mockObj
+	}
+	req, _ := http.NewRequest("GET", s.RemoveBaseUrl+"?namespace=mystack", nil)
+
+	serverImpl.ServeHTTP(s.ResponseWriter, req)
+
+	s.Equal("mystack", actual)
+	mockObj.AssertCalled(s.T(), "Execute", []string{})
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus404_WhenRemoveNamespaceExecuteReturnsErrServiceNotFound() {
+	newRemoveNamespaceOrig := actions.NewRemoveNamespace
+	defer func() { actions.NewRemoveNamespace = newRemoveNamespaceOrig }()
+	mockObj := getRemoveMock("Execute")
+	mockObj.On("Execute", mock.Anything).Return(fmt.Errorf("%w: no services in the namespace mystack", proxy.ErrServiceNotFound))
+	actions.NewRemoveNamespace = func(
+		namespace, configsPath, templatesPath string,
+		consulAddresses []string,
+		instanceName, mode string,
+		allowMutations bool,
+	) actions.Removable {
+		return mockObj
+	}
+	req, _ := http.NewRequest("GET", s.RemoveBaseUrl+"?namespace=mystack", nil)
+
+	serverImpl.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 404)
+}
+
+// ServeHTTP > Config
+
+func (s *ServerTestSuite) Test_ServeHTTP_SetsContentTypeToText_WhenUrlIsConfig() {
+	var actual string
+	httpWriterSetContentType = func(w http.ResponseWriter, value string) {
+		actual = value
+	}
+	req, _ := http.NewRequest("GET", s.ConfigUrl, nil)
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.Equal("text/plain", actual)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsConfig_WhenUrlIsConfig() {
+	expected := "some text"
+	readFileOrig := proxy.ReadFile
+	defer func() { proxy.ReadFile = readFileOrig }()
+	proxy.ReadFile = func(filename string) ([]byte, error) {
+		return []byte(expected), nil
+	}
+
+	req, _ := http.NewRequest("GET", s.ConfigUrl, nil)
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "Write", []byte(expected))
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus500_WhenReadFileFails() {
+	readFileOrig := proxy.ReadFile
+	defer func() { proxy.ReadFile = readFileOrig }()
+	proxy.ReadFile = func(filename string) ([]byte, error) {
+		return []byte(""), fmt.Errorf("This is an error")
+	}
+
+	req, _ := http.NewRequest("GET", s.ConfigUrl, nil)
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 500)
+	s.ResponseWriter.AssertCalled(s.T(), "Write", []byte("This is an error"))
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReadsConfigOnEachRequest_WhenUrlIsConfig() {
+	contents := []string{"first config", "second config"}
+	readFileOrig := proxy.ReadFile
+	defer func() { proxy.ReadFile = readFileOrig }()
+	proxy.ReadFile = func(filename string) ([]byte, error) {
+		content := contents[0]
+		contents = contents[1:]
+		return []byte(content), nil
+	}
+	req, _ := http.NewRequest("GET", s.ConfigUrl, nil)
+	srv := Serve{}
+
+	srv.ServeHTTP(s.ResponseWriter, req)
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "Write", []byte("first config"))
+	s.ResponseWriter.AssertCalled(s.T(), "Write", []byte("second config"))
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus404_WhenConfigMethodIsNotGet() {
+	req, _ := http.NewRequest("POST", s.ConfigUrl, nil)
+	srv := Serve{}
+
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 404)
+}
+
+// ConfigHash
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsConfigHash_WhenUrlIsConfigHash() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	services := map[string]proxy.Service{"my-service": {ServiceName: "my-service"}}
+	mockObj := new(ProxyMock)
+	mockObj.On("ReadConfig").Return("# comment\nglobal", nil)
+	mockObj.On("GetServices").Return(services)
+	mockObj.On("GetRenderer").Return(nil)
+	proxy.Instance = mockObj
+	expected, _ := json.Marshal(proxy.GetConfigHash(proxy.HaProxy{}.GetRenderer(), "global", services))
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/config-hash", s.BaseUrl), nil)
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+	s.ResponseWriter.AssertCalled(s.T(), "Write", expected)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus500_WhenConfigHashCannotReadConfig() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	mockObj := getProxyMock("ReadConfig")
+	mockObj.On("ReadConfig").Return("", fmt.Errorf("This is an error"))
+	proxy.Instance = mockObj
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/config-hash", s.BaseUrl), nil)
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 500)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus404_WhenConfigHashMethodIsNotGet() {
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("%s/config-hash", s.BaseUrl), nil)
+	srv := Serve{}
+
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 404)
+}
+
+// Consistency
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsConsistencyReport_WhenUrlIsConsistency() {
+	proxyOrig := proxy.Instance
+	distributorOrig := distributor
+	defer func() {
+		proxy.Instance = proxyOrig
+		distributor = distributorOrig
+	}()
+	proxy.Instance = getProxyMock("")
+	local := proxy.GetConfigHash(proxy.HaProxy{}.GetRenderer(), "", map[string]proxy.Service{})
+	results := []server.ConfigHashResult{
+		{Address: "10.0.0.1", ConfigHash: local},
+		{Address: "10.0.0.2", ConfigHash: proxy.ConfigHash{Config: "other", Services: local.Services}},
+	}
+	actualPort := ""
+	actualServiceName := ""
+	distributor = DistributorMock{
+		GetConfigHashesMock: func(port, proxyServiceName string) ([]server.ConfigHashResult, error) {
+			actualPort = port
+			actualServiceName = proxyServiceName
+			return results, nil
+		},
+	}
+	expected, _ := json.Marshal(server.ConsistencyReport{
+		Consistent: false,
+		Hash:       local,
+		Agreeing:   []string{"10.0.0.1"},
+		Diverging:  []server.ConfigHashResult{results[1]},
+	})
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/consistency", s.BaseUrl), nil)
+	srv := Serve{Port: "1234", ServiceName: "proxy"}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.Equal("1234", actualPort)
+	s.Equal("proxy", actualServiceName)
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+	s.ResponseWriter.AssertCalled(s.T(), "Write", expected)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus500_WhenConsistencyCannotGetConfigHashes() {
+	proxyOrig := proxy.Instance
+	distributorOrig := distributor
+	defer func() {
+		proxy.Instance = proxyOrig
+		distributor = distributorOrig
+	}()
+	proxy.Instance = getProxyMock("")
+	distributor = DistributorMock{
+		GetConfigHashesMock: func(port, proxyServiceName string) ([]server.ConfigHashResult, error) {
+			return nil, fmt.Errorf("This is an error")
+		},
+	}
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/consistency", s.BaseUrl), nil)
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 500)
+}
+
+// Services
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsServicesWithParamNames_WhenUrlIsServices() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	mockObj := getProxyMock("GetServices")
+	mockObj.On("GetServices").Return(map[string]proxy.Service{
+		"my-service": {
+			ServiceName:   "my-service",
+			AclName:       "01-my-service",
+			ReqMode:       "http",
+			HttpsPort:     8443,
+			ServiceDomain: []string{"example.com"},
+			ServiceDest:   []proxy.ServiceDest{{Port: "8080", ServicePath: []string{"/api"}}},
+			FullServiceName: "my-service",
+		},
+	})
+	proxy.Instance = mockObj
+	expected := `{"my-service":{"aclName":"01-my-service","httpsPort":8443,"reqMode":"http",` +
+		`"serviceDest":[{"port":"8080","servicePath":["/api"]}],"serviceDomain":["example.com"],"serviceName":"my-service"}}`
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/services", s.BaseUrl), nil)
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+	s.ResponseWriter.AssertCalled(s.T(), "Write", []byte(expected))
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsServicesInInternalFormat_WhenRequestIsForwarded() {
+	defer os.Unsetenv("DISTRIBUTE_SECRET")
+	os.Setenv("DISTRIBUTE_SECRET", "my-secret")
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	services := map[string]proxy.Service{
+		"my-service": {
+			ServiceName: "my-service",
+			Users:       []proxy.User{{Username: "user", Password: "pass"}},
+			ServiceDest: []proxy.ServiceDest{{Port: "8080", ServicePath: []string{"/api"}}},
+		},
+	}
+	mockObj := getProxyMock("GetServices")
+	mockObj.On("GetServices").Return(services)
+	proxy.Instance = mockObj
+	expected, _ := json.Marshal(services)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/services?format=internal", s.BaseUrl), nil)
+	req.Header.Set(server.DistributedHeader, "true")
+	req.Header.Set(server.SecretHeader, "my-secret")
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+	s.ResponseWriter.AssertCalled(s.T(), "Write", expected)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus403_WhenServicesInInternalFormatAreRequestedWithoutSecret() {
+	defer os.Unsetenv("DISTRIBUTE_SECRET")
+	os.Setenv("DISTRIBUTE_SECRET", "my-secret")
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/services?format=internal", s.BaseUrl), nil)
+	req.Header.Set(server.DistributedHeader, "true")
+	req.Header.Set(server.SecretHeader, "other-secret")
+
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 403)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsServicesOfNamespace_WhenNamespaceQueryIsPresent() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	mockObj := getProxyMock("GetServicesByNamespace")
+	mockObj.On("GetServicesByNamespace", "mystack").Return(map[string]proxy.Service{
+		"mystack_api": {ServiceName: "mystack_api"},
+	})
+	proxy.Instance = mockObj
+	expected := `{"mystack_api":{"serviceDest":[],"serviceName":"mystack_api"}}`
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/services?namespace=mystack", s.BaseUrl), nil)
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+	s.ResponseWriter.AssertCalled(s.T(), "Write", []byte(expected))
+	mockObj.AssertNotCalled(s.T(), "GetServices")
+}
+
+// Service stats
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsServiceBytes_WhenUrlIsServiceStats() {
+	getServiceBytesOrig := metricsGetServiceBytes
+	defer func() { metricsGetServiceBytes = getServiceBytesOrig }()
+	metricsGetServiceBytes = func(serviceName string) (metrics.ServiceBytes, bool) {
+		return metrics.ServiceBytes{BytesIn: 100, BytesOut: 1000}, serviceName == "go-demo"
+	}
+
+	req, _ := http.NewRequest("GET", s.BaseUrl+"/services/go-demo/stats", nil)
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+	s.ResponseWriter.AssertCalled(s.T(), "Write", []byte(`{"ServiceName":"go-demo","BytesIn":100,"BytesOut":1000}`))
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus404_WhenServiceStatsServiceIsNotRegistered() {
+	instanceOrig := metrics.Instance
+	defer func() { metrics.Instance = instanceOrig }()
+	metrics.Instance = metrics.NewCollector()
+
+	req, _ := http.NewRequest("GET", s.BaseUrl+"/services/unknown/stats", nil)
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 404)
+}
+
+// Replicas
+
+func (s *ServerTestSuite) Test_ServeHTTP_ScalesServiceWithoutReload_WhenReplicasAreWithinHeadroom() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxyMock := getProxyMock("GetServices")
+	proxyMock.On("GetServices").Return(map[string]proxy.Service{"my-service": {ServiceName: "my-service", Replicas: 3}})
+	proxy.Instance = proxyMock
+	reconfigureMock := getReconfigureMock("")
+	var actualService proxy.Service
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		actualService = serviceData
+		return reconfigureMock
+	}
+
+	req, _ := http.NewRequest("PUT", s.BaseUrl+"/services/my-service/replicas?replicas=5", nil)
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+	proxyMock.AssertCalled(s.T(), "SetServiceReplicas", "my-service", 5)
+	reconfigureMock.AssertCalled(s.T(), "CreateConfigs")
+	reconfigureMock.AssertNotCalled(s.T(), "Execute", mock.Anything)
+	s.Equal(5, actualService.Replicas)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReconfiguresService_WhenReplicasCannotBeAppliedAtRuntime() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxyMock := getProxyMock("SetServiceReplicas")
+	proxyMock.On("SetServiceReplicas", "my-service", 10).Return(proxy.ErrReconfigureRequired)
+	proxy.Instance = proxyMock
+	reconfigureMock := getReconfigureMock("")
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		return reconfigureMock
+	}
+
+	req, _ := http.NewRequest("PUT", s.BaseUrl+"/services/my-service/replicas?replicas=10", nil)
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+	reconfigureMock.AssertCalled(s.T(), "Execute", []string{})
+	reconfigureMock.AssertNotCalled(s.T(), "CreateConfigs")
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus404_WhenReplicasServiceDoesNotExist() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxyMock := getProxyMock("SetServiceReplicas")
+	proxyMock.On("SetServiceReplicas", "my-service", 5).Return(proxy.ErrServiceNotFound)
+	proxy.Instance = proxyMock
+
+	req, _ := http.NewRequest("PUT", s.BaseUrl+"/services/my-service/replicas?replicas=5", nil)
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 404)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenReplicasIsNotNumber() {
+	req, _ := http.NewRequest("PUT", s.BaseUrl+"/services/my-service/replicas?replicas=many", nil)
+	srv := Serve{}
+
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 400)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus404_WhenReplicasMethodIsNotPut() {
+	req, _ := http.NewRequest("GET", s.BaseUrl+"/services/my-service/replicas?replicas=5", nil)
+	srv := Serve{}
+
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 404)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus404_WhenServicesMethodIsNotGet() {
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("%s/services", s.BaseUrl), nil)
+	srv := Serve{}
+
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 404)
 }
 
-func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus500_WhenReconfigureExecuteFails() {
-	mockObj := getReconfigureMock("Execute")
-	mockObj.On("Execute", []string{}).Return(fmt.Errorf("This is an error"))
-	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
-		return mockObj
-	}
+// SupportBundle
 
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsSupportBundle_WhenUrlIsSupportBundle() {
+	defer os.Unsetenv("DISTRIBUTE_SECRET")
+	os.Setenv("DISTRIBUTE_SECRET", "my-secret")
+	expected := []byte("bundle content")
+	var actualContentType string
+	httpWriterSetContentType = func(w http.ResponseWriter, value string) {
+		actualContentType = value
+	}
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	mockObj := getProxyMock("CreateSupportBundle")
+	mockObj.On("CreateSupportBundle").Return(expected, nil)
+	proxy.Instance = mockObj
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/support-bundle", s.BaseUrl), nil)
+	req.Header.Set(server.SecretHeader, "my-secret")
 	srv := Serve{}
-	srv.ServeHTTP(s.ResponseWriter, s.RequestReconfigure)
+	srv.ServeHTTP(s.ResponseWriter, req)
 
-	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 500)
+	s.Equal("application/gzip", actualContentType)
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+	s.ResponseWriter.AssertCalled(s.T(), "Write", expected)
 }
 
-func (s *ServerTestSuite) Test_ServeHTTP_ReturnsJson_WhenConsulTemplatePathIsPresent() {
-	pathFe := "/path/to/consul/fe/template"
-	pathBe := "/path/to/consul/fe/template"
-	address := fmt.Sprintf(
-		"%s?serviceName=%s&consulTemplateFePath=%s&consulTemplateBePath=%s",
-		s.ReconfigureBaseUrl,
-		s.ServiceName,
-		pathFe,
-		pathBe)
-	req, _ := http.NewRequest("GET", address, nil)
-	sd := proxy.ServiceDest{
-		ServicePath: []string{},
-	}
-	expected, _ := json.Marshal(server.Response{
-		Status:               "OK",
-		ServiceName:          s.ServiceName,
-		Service:              proxy.Service{
-			ReqMode:              "http",
-			ServiceName:          s.ServiceName,
-			ConsulTemplateFePath: pathFe,
-			ConsulTemplateBePath: pathBe,
-			PathType:             s.PathType,
-			ServiceDest:          []proxy.ServiceDest{sd},
-		},
-	})
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus500_WhenCreateSupportBundleFails() {
+	defer os.Unsetenv("DISTRIBUTE_SECRET")
+	os.Setenv("DISTRIBUTE_SECRET", "my-secret")
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	mockObj := getProxyMock("CreateSupportBundle")
+	mockObj.On("CreateSupportBundle").Return([]byte{}, fmt.Errorf("This is an error"))
+	proxy.Instance = mockObj
 
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/support-bundle", s.BaseUrl), nil)
+	req.Header.Set(server.SecretHeader, "my-secret")
 	srv := Serve{}
 	srv.ServeHTTP(s.ResponseWriter, req)
 
-	s.ResponseWriter.AssertCalled(s.T(), "Write", []byte(expected))
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 500)
 }
 
-func (s *ServerTestSuite) Test_ServeHTTP_InvokesReconfigureExecute_WhenConsulTemplatePathIsPresent() {
-	sd := proxy.ServiceDest{
-		ServicePath: []string{},
-	}
-	pathFe := "/path/to/consul/fe/template"
-	pathBe := "/path/to/consul/be/template"
-	mockObj := getReconfigureMock("")
-	var actualBase actions.BaseReconfigure
-	expectedBase := actions.BaseReconfigure{
-		ConsulAddresses: []string{s.ConsulAddress},
-	}
-	expectedService := proxy.Service{
-		ServiceName:          s.ServiceName,
-		ConsulTemplateFePath: pathFe,
-		ConsulTemplateBePath: pathBe,
-		PathType:             s.PathType,
-		ReqMode:              "http",
-		ServiceDest:          []proxy.ServiceDest{sd},
-	}
-	var actualService proxy.Service
-	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
-		actualBase = baseData
-		actualService = serviceData
-		return mockObj
-	}
-	serverImpl := Serve{BaseReconfigure: expectedBase}
-	address := fmt.Sprintf(
-		"%s?serviceName=%s&consulTemplateFePath=%s&consulTemplateBePath=%s",
-		s.ReconfigureBaseUrl,
-		s.ServiceName,
-		pathFe,
-		pathBe)
-	req, _ := http.NewRequest("GET", address, nil)
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus404_WhenSupportBundleMethodIsNotGet() {
+	defer os.Unsetenv("DISTRIBUTE_SECRET")
+	os.Setenv("DISTRIBUTE_SECRET", "my-secret")
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	mockObj := getProxyMock("")
+	proxy.Instance = mockObj
 
-	serverImpl.ServeHTTP(s.ResponseWriter, req)
+	for _, method := range []string{"POST", "PUT", "DELETE"} {
+		req, _ := http.NewRequest(method, fmt.Sprintf("%s/support-bundle", s.BaseUrl), nil)
+		req.Header.Set(server.SecretHeader, "my-secret")
+		srv := Serve{}
+		srv.ServeHTTP(s.ResponseWriter, req)
+	}
 
-	s.Equal(expectedBase, actualBase)
-	s.Equal(expectedService, actualService)
-	mockObj.AssertCalled(s.T(), "Execute", []string{})
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 404)
+	s.ResponseWriter.AssertNotCalled(s.T(), "WriteHeader", 200)
+	mockObj.AssertNotCalled(s.T(), "CreateSupportBundle")
 }
 
-func (s *ServerTestSuite) Test_ServeHTTP_InvokesPutCert_WhenServiceCertIsPresent() {
-	actualCertName := ""
-	expectedCert := "my-cert with new line \\n"
-	actualCert := ""
-	certOrig := cert
-	defer func() { cert = certOrig }()
-	cert = CertMock{
-		PutCertMock: func(certName string, certContent []byte) (string, error) {
-			actualCertName = certName
-			actualCert = string(certContent[:])
-			return "", nil
-		},
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus403_WhenSupportBundleRequestDoesNotCarrySecret() {
+	defer os.Unsetenv("DISTRIBUTE_SECRET")
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	mockObj := getProxyMock("")
+	proxy.Instance = mockObj
+
+	for _, secret := range []string{"", "my-secret"} {
+		os.Setenv("DISTRIBUTE_SECRET", secret)
+		req, _ := http.NewRequest("GET", fmt.Sprintf("%s/support-bundle", s.BaseUrl), nil)
+		req.Header.Set(server.SecretHeader, "other-secret")
+		srv := Serve{}
+		srv.ServeHTTP(s.ResponseWriter, req)
 	}
-	address := fmt.Sprintf(
-		"%s?serviceName=%s&servicePath=%s&serviceCert=%s",
-		s.ReconfigureBaseUrl,
-		s.ServiceName,
-		strings.Join(s.sd.ServicePath, ","),
-		expectedCert,
-	)
-	req, _ := http.NewRequest("GET", address, nil)
 
-	serverImpl.ServeHTTP(s.ResponseWriter, req)
+	s.ResponseWriter.AssertNumberOfCalls(s.T(), "WriteHeader", 2)
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 403)
+	mockObj.AssertNotCalled(s.T(), "CreateSupportBundle")
+}
+
+// ServeHTTP > Debug
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsDebugState_WhenDebugEndpointsAreEnabled() {
+	defer func() { os.Unsetenv("ENABLE_DEBUG_ENDPOINTS") }()
+	os.Setenv("ENABLE_DEBUG_ENDPOINTS", "true")
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	mockObj := getProxyMock("DebugState")
+	mockObj.On("DebugState").Return(proxy.DebugState{Goroutines: 12, Services: 3, LastReloadMs: 25})
+	proxy.Instance = mockObj
+	var actual []byte
+	s.ResponseWriter = new(ResponseWriterMock)
+	s.ResponseWriter.On("Header").Return(nil)
+	s.ResponseWriter.On("WriteHeader", mock.Anything)
+	s.ResponseWriter.On("Write", mock.Anything).Return(0, nil).Run(func(args mock.Arguments) {
+		actual = args.Get(0).([]byte)
+	})
 
-	s.Equal(s.ServiceName, actualCertName)
-	s.Equal(strings.Replace(expectedCert, "\\n", "\n", -1), actualCert)
-}
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/debug/state", s.BaseUrl), nil)
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
 
-func (s *ServerTestSuite) Test_ServeHTTP_InvokesPutCertWithDomainName_WhenServiceCertIsPresent() {
-	actualCertName := ""
-	expectedCert := "my-cert"
-	actualCert := ""
-	certOrig := cert
-	defer func() { cert = certOrig }()
-	cert = CertMock{
-		PutCertMock: func(certName string, certContent []byte) (string, error) {
-			actualCertName = certName
-			actualCert = string(certContent[:])
-			return "", nil
-		},
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+	state := map[string]interface{}{}
+	s.Require().NoError(json.Unmarshal(actual, &state))
+	for _, key := range []string{
+		"Goroutines",
+		"Services",
+		"QuarantinedServices",
+		"Certs",
+		"IdempotencyEntries",
+		"ServiceChangeSubscribers",
+		"LastGenerationMs",
+		"LastReloadMs",
+		"LastGenerationAt",
+		"LastReloadAt",
+	} {
+		s.Contains(state, key)
 	}
-	address := fmt.Sprintf("%s&serviceDomain=%s&serviceCert=%s", s.ReconfigureUrl, s.ServiceDomain[0], expectedCert)
-	req, _ := http.NewRequest("GET", address, nil)
+	s.Equal(float64(12), state["Goroutines"])
+	s.Equal(float64(25), state["LastReloadMs"])
+}
 
-	serverImpl.ServeHTTP(s.ResponseWriter, req)
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus404_WhenDebugEndpointsAreNotEnabled() {
+	os.Unsetenv("ENABLE_DEBUG_ENDPOINTS")
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	mockObj := getProxyMock("")
+	proxy.Instance = mockObj
+	srv := Serve{}
 
-	s.Equal(s.ServiceDomain[0], actualCertName)
-	s.Equal(expectedCert, actualCert)
+	for _, url := range []string{fmt.Sprintf("%s/debug/state", s.BaseUrl), "http://acme.com/debug/pprof/"} {
+		s.ResponseWriter = getResponseWriterMock()
+		req, _ := http.NewRequest("GET", url, nil)
+
+		srv.ServeHTTP(s.ResponseWriter, req)
+
+		s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 404)
+	}
+	mockObj.AssertNotCalled(s.T(), "DebugState")
 }
 
-// ServeHTTP > Remove
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus404_WhenDebugStateMethodIsNotGet() {
+	defer func() { os.Unsetenv("ENABLE_DEBUG_ENDPOINTS") }()
+	os.Setenv("ENABLE_DEBUG_ENDPOINTS", "true")
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("%s/debug/state", s.BaseUrl), nil)
+	srv := Serve{}
 
-func (s *ServerTestSuite) Test_ServeHTTP_SetsContentTypeToJSON_WhenUrlIsRemove() {
-	var actual string
+	srv.ServeHTTP(s.ResponseWriter, req)
+
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 404)
+}
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsParamsSchema_WhenUrlIsSchema() {
+	actualContentType := ""
 	httpWriterSetContentType = func(w http.ResponseWriter, value string) {
-		actual = value
+		actualContentType = value
 	}
-	req, _ := http.NewRequest("GET", s.RemoveUrl, nil)
+	expected, _ := json.Marshal(proxy.GetParamsSchema())
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/schema", s.BaseUrl), nil)
 
 	srv := Serve{}
 	srv.ServeHTTP(s.ResponseWriter, req)
 
-	s.Equal("application/json", actual)
+	s.Equal("application/json", actualContentType)
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+	s.ResponseWriter.AssertCalled(s.T(), "Write", expected)
 }
 
-func (s *ServerTestSuite) Test_ServeHTTP_ReturnsJSON_WhenUrlIsRemove() {
-	expected, _ := json.Marshal(server.Response{
-		Status:      "OK",
-		ServiceName: s.ServiceName,
-	})
+// ServeHTTP > Services Diff
+
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsServiceDiff_WhenUrlIsServicesDiff() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	current := proxy.Service{
+		ServiceName:   "my-service",
+		ServiceDomain: []string{"my-domain.com"},
+		ServiceDest:   []proxy.ServiceDest{{Port: "1111", ServicePath: []string{"/api"}}},
+	}
+	proxyMock := getProxyMock("GetServices")
+	proxyMock.On("GetServices").Return(map[string]proxy.Service{"my-service": current})
+	proxy.Instance = proxyMock
+	reconfigureMock := getReconfigureMock("GetTemplates")
+	reconfigureMock.On("GetTemplates", mock.MatchedBy(func(sr *proxy.Service) bool {
+		return sr.ServiceDest[0].Port == "1111"
+	})).Return("front-1", "back", nil)
+	reconfigureMock.On("GetTemplates", mock.Anything).Return("front-2", "back", nil)
+	actions.NewReconfigure = func(baseData actions.BaseReconfigure, serviceData proxy.Service, mode string) actions.Reconfigurable {
+		return reconfigureMock
+	}
+	proposed := proxy.Service{
+		ServiceDomain: []string{"my-domain.com", "my-other-domain.com"},
+		ServiceDest:   []proxy.ServiceDest{{Port: "2222", ServicePath: []string{"/api"}}},
+	}
+	body, _ := json.Marshal(proposed)
+	req, _ := http.NewRequest("POST", fmt.Sprintf("%s/services/my-service/diff", s.BaseUrl), bytes.NewReader(body))
+	proposed.ServiceName = "my-service"
+	expectedDiff := proxy.DiffService(current, proposed)
+	expectedDiff.SnippetDiff = []string{"-front-1", "+front-2", " back"}
+	expected, _ := json.Marshal(expectedDiff)
 
 	srv := Serve{}
-	srv.ServeHTTP(s.ResponseWriter, s.RequestRemove)
+	srv.ServeHTTP(s.ResponseWriter, req)
 
-	s.ResponseWriter.AssertCalled(s.T(), "Write", []byte(expected))
+	s.Equal([]string{"my-other-domain.com"}, expectedDiff.AddedDomains)
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+	s.ResponseWriter.AssertCalled(s.T(), "Write", expected)
+	reconfigureMock.AssertNotCalled(s.T(), "Execute", mock.Anything)
 }
 
-func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenUrlIsRemoveAndServiceNameQueryIsNotPresent() {
-	req, _ := http.NewRequest("GET", s.RemoveBaseUrl, nil)
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus404_WhenServiceToDiffIsNotRegistered() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxy.Instance = getProxyMock("")
+	req, _ := http.NewRequest("POST", fmt.Sprintf("%s/services/my-service/diff", s.BaseUrl), strings.NewReader("{}"))
 
 	srv := Serve{}
 	srv.ServeHTTP(s.ResponseWriter, req)
 
-	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 400)
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 404)
 }
 
-func (s *ServerTestSuite) Test_ServeHTTP_InvokesRemoveExecute() {
-	mockObj := getRemoveMock("")
-	aclName := "my-acl"
-	var actual actions.Remove
-	expected := actions.Remove{
-		ServiceName:     s.ServiceName,
-		TemplatesPath:   "",
-		ConfigsPath:     "",
-		ConsulAddresses: []string{s.ConsulAddress},
-		InstanceName:    s.InstanceName,
-		AclName:         aclName,
-	}
-	actions.NewRemove = func(
-		serviceName, aclName, configsPath, templatesPath string,
-		consulAddresses []string,
-		instanceName, mode string,
-	) actions.Removable {
-		actual = actions.Remove{
-			ServiceName:     serviceName,
-			AclName:         aclName,
-			TemplatesPath:   templatesPath,
-			ConfigsPath:     configsPath,
-			ConsulAddresses: consulAddresses,
-			InstanceName:    instanceName,
-			Mode:            mode,
-		}
-		return mockObj
-	}
-	url := fmt.Sprintf("%s?serviceName=%s&aclName=%s", s.RemoveBaseUrl, s.ServiceName, aclName)
-	req, _ := http.NewRequest("GET", url, nil)
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenProposedServiceIsInvalid() {
+	proxyOrig := proxy.Instance
+	defer func() { proxy.Instance = proxyOrig }()
+	proxyMock := getProxyMock("GetServices")
+	proxyMock.On("GetServices").Return(map[string]proxy.Service{"my-service": {ServiceName: "my-service"}})
+	proxy.Instance = proxyMock
+	req, _ := http.NewRequest("POST", fmt.Sprintf("%s/services/my-service/diff", s.BaseUrl), strings.NewReader("not json"))
 
-	serverImpl.ServeHTTP(s.ResponseWriter, req)
+	srv := Serve{}
+	srv.ServeHTTP(s.ResponseWriter, req)
 
-	s.Equal(expected, actual)
-	mockObj.AssertCalled(s.T(), "Execute", []string{})
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 400)
 }
 
-// ServeHTTP > Config
-
-func (s *ServerTestSuite) Test_ServeHTTP_SetsContentTypeToText_WhenUrlIsConfig() {
-	var actual string
-	httpWriterSetContentType = func(w http.ResponseWriter, value string) {
-		actual = value
-	}
-	req, _ := http.NewRequest("GET", s.ConfigUrl, nil)
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus404_WhenUrlIsServicesDiffAndMethodIsNotPost() {
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/services/my-service/diff", s.BaseUrl), nil)
 
 	srv := Serve{}
 	srv.ServeHTTP(s.ResponseWriter, req)
 
-	s.Equal("text/html", actual)
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 404)
 }
 
-func (s *ServerTestSuite) Test_ServeHTTP_ReturnsConfig_WhenUrlIsConfig() {
-	expected := "some text"
-	readFileOrig := proxy.ReadFile
-	defer func() { proxy.ReadFile = readFileOrig }()
-	proxy.ReadFile = func(filename string) ([]byte, error) {
-		return []byte(expected), nil
-	}
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus400_WhenReconfigureParamIsInvalid() {
+	addr := fmt.Sprintf("%s?serviceName=redis&port=6379&reqMode=tcp&srcPort=abc", s.ReconfigureBaseUrl)
+	req, _ := http.NewRequest("GET", addr, nil)
 
-	req, _ := http.NewRequest("GET", s.ConfigUrl, nil)
 	srv := Serve{}
 	srv.ServeHTTP(s.ResponseWriter, req)
 
-	s.ResponseWriter.AssertCalled(s.T(), "Write", []byte(expected))
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 400)
 }
 
-func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus500_WhenReadFileFails() {
-	readFileOrig := readFile
-	defer func() { readFile = readFileOrig }()
-	readFile = func(filename string) ([]byte, error) {
-		return []byte(""), fmt.Errorf("This is an error")
+func (s *ServerTestSuite) Test_ServeHTTP_ReturnsMetrics_WhenUrlIsMetrics() {
+	actualContentType := ""
+	httpWriterSetContentType = func(w http.ResponseWriter, value string) {
+		actualContentType = value
 	}
+	var expected bytes.Buffer
+	metrics.Instance.WritePrometheus(&expected)
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/metrics", s.BaseUrl), nil)
 
-	req, _ := http.NewRequest("GET", s.ConfigUrl, nil)
 	srv := Serve{}
 	srv.ServeHTTP(s.ResponseWriter, req)
 
-	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 500)
+	s.Equal("text/plain; version=0.0.4", actualContentType)
+	s.ResponseWriter.AssertCalled(s.T(), "WriteHeader", 200)
+	s.ResponseWriter.AssertCalled(s.T(), "Write", expected.Bytes())
 }
 
 // Suite
@@ -1085,6 +2745,8 @@ func (s *ServerTestSuite) Test_ServeHTTP_ReturnsStatus500_WhenReadFileFails() {
 func TestServerUnitTestSuite(t *testing.T) {
 	s := new(ServerTestSuite)
 	logPrintf = func(format string, v ...interface{}) {}
+	proxyGenerateErrorFiles = func() error { return nil }
+	proxyLintTemplate = func(templatesPath string) error { return nil }
 	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		actualPath := r.URL.Path
 		if r.Method == "GET" {
@@ -1178,6 +2840,10 @@ type CertMock struct {
 	PutCertMock func(certName string, certContent []byte) (string, error)
 	GetAllMock  func(w http.ResponseWriter, req *http.Request) (server.CertResponse, error)
 	GetInitMock func() error
+	PruneMock       func(w http.ResponseWriter, req *http.Request) ([]string, error)
+	PruneCertsMock  func(dryRun bool) ([]string, error)
+	RemoveMock      func(w http.ResponseWriter, req *http.Request) error
+	RemoveCertMock  func(certName string) error
 }
 
 func (m CertMock) Put(w http.ResponseWriter, req *http.Request) (string, error) {
@@ -1196,6 +2862,45 @@ func (m CertMock) Init() error {
 	return m.GetInitMock()
 }
 
+func (m CertMock) Prune(w http.ResponseWriter, req *http.Request) ([]string, error) {
+	return m.PruneMock(w, req)
+}
+
+func (m CertMock) PruneCerts(dryRun bool) ([]string, error) {
+	return m.PruneCertsMock(dryRun)
+}
+
+func (m CertMock) Remove(w http.ResponseWriter, req *http.Request) error {
+	return m.RemoveMock(w, req)
+}
+
+func (m CertMock) RemoveCert(certName string) error {
+	return m.RemoveCertMock(certName)
+}
+
+type DistributorMock struct {
+	SendDistributeRequestsMock func(req *http.Request, port, proxyServiceName string) (int, error)
+	DistributeRequestsMock     func(req *http.Request, port, proxyServiceName string) ([]server.DistributeResult, error)
+	GetConfigHashesMock        func(port, proxyServiceName string) ([]server.ConfigHashResult, error)
+	GetPeerServicesMock        func(port, proxyServiceName string) (map[string]proxy.Service, error)
+}
+
+func (m DistributorMock) SendDistributeRequests(req *http.Request, port, proxyServiceName string) (int, error) {
+	return m.SendDistributeRequestsMock(req, port, proxyServiceName)
+}
+
+func (m DistributorMock) DistributeRequests(req *http.Request, port, proxyServiceName string) ([]server.DistributeResult, error) {
+	return m.DistributeRequestsMock(req, port, proxyServiceName)
+}
+
+func (m DistributorMock) GetConfigHashes(port, proxyServiceName string) ([]server.ConfigHashResult, error) {
+	return m.GetConfigHashesMock(port, proxyServiceName)
+}
+
+func (m DistributorMock) GetPeerServices(port, proxyServiceName string) (map[string]proxy.Service, error) {
+	return m.GetPeerServicesMock(port, proxyServiceName)
+}
+
 type ReloadMock struct {
 	ExecuteMock func() error
 }
@@ -1245,6 +2950,11 @@ func (m *ReconfigureMock) GetTemplates(sr *proxy.Service) (front, back string, e
 	return params.String(0), params.String(1), params.Error(2)
 }
 
+func (m *ReconfigureMock) CreateConfigs() error {
+	params := m.Called()
+	return params.Error(0)
+}
+
 func getReconfigureMock(skipMethod string) *ReconfigureMock {
 	mockObj := new(ReconfigureMock)
 	if skipMethod != "Execute" {
@@ -1259,6 +2969,9 @@ func getReconfigureMock(skipMethod string) *ReconfigureMock {
 	if skipMethod != "GetTemplates" {
 		mockObj.On("GetTemplates", mock.Anything).Return("", "", nil)
 	}
+	if skipMethod != "CreateConfigs" {
+		mockObj.On("CreateConfigs").Return(nil)
+	}
 	return mockObj
 }
 
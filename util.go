@@ -1,15 +1,25 @@
 package main
 
 import (
+	"./metrics"
+	"./proxy"
 	"./registry"
+	"./server"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"os"
 )
 
 var readFile = ioutil.ReadFile
-var httpListenAndServe = http.ListenAndServe
+var osStat = os.Stat
+var httpListenAndServe = func(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
 var httpWriterSetContentType = func(w http.ResponseWriter, value string) {
 	w.Header().Set("Content-Type", value)
 }
@@ -20,4 +30,18 @@ type Executable interface {
 }
 
 var lookupHost = net.LookupHost
+var metricsListenSyslog = metrics.Instance.ListenSyslog
+var metricsStartHealthNotifier = metrics.StartHealthNotifier
+var metricsGetServiceBytes = func(serviceName string) (metrics.ServiceBytes, bool) {
+	return metrics.Instance.GetServiceBytes(serviceName)
+}
+var proxyStartBlocklistRefresher = proxy.StartBlocklistRefresher
+var proxyStartDomainOwnership = proxy.StartDomainOwnership
+var proxyStartServiceDefaults = proxy.StartServiceDefaults
+var proxyLoadPendingChanges = proxy.LoadPendingChanges
+var proxyApplyPendingChanges = proxy.ApplyPendingChanges
+var proxyGenerateErrorFiles = proxy.GenerateErrorFiles
+var proxyGetReloadWarnings = proxy.GetReloadWarnings
+var proxyLintTemplate = proxy.LintTemplate
 var registryInstance registry.Registrarable = registry.Consul{}
+var distributor server.Server = server.NewServer()